@@ -31,7 +31,10 @@ func main() {
 		&models.Subscriber{},
 		&models.Tag{},
 		&models.Campaign{},
+		&models.CampaignDelivery{},
+		&models.SendingHold{},
 		&models.EmailEvent{},
+		&models.EmailMessage{},
 		&models.SubscriptionPlan{},
 		&models.Payment{},
 		&models.UserSubscription{},
@@ -39,6 +42,33 @@ func main() {
 		&models.WebhookLog{},
 		&models.APIKey{},
 		&models.EmailTemplate{},
+		&models.MailRoute{},
+		&models.DNSRecord{},
+		&models.DKIMKey{},
+		&models.FailedJob{},
+		&models.ProviderEvent{},
+		&models.DeliverabilityMetrics{},
+		&models.DeliverabilityDaily{},
+		&models.ReputationSnapshot{},
+		&models.WarmupPlan{},
+		&models.WarmupUsage{},
+		&models.SenderDomain{},
+		&models.DMARCReport{},
+		&models.DMARCRecord{},
+		&models.SeedMailbox{},
+		&models.SeedPlacement{},
+		&models.MailboxClaim{},
+		&models.InboxPlacement{},
+		&models.PruneJob{},
+		&models.PrunedSubscriber{},
+		&models.SubscriberSendProfile{},
+		&models.CampaignVariant{},
+		&models.CampaignTest{},
+		&models.Workflow{},
+		&models.WorkflowRun{},
+		&models.Suppression{},
+		&models.SuppressionAudit{},
+		&models.CampaignLink{},
 		&models.ReferralProgram{},
 		&models.ReferralCode{},
 		&models.ReferralEvent{},
@@ -58,6 +88,19 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Sender domains and DKIM keys used to be unique per domain; claims are
+	// now per creator, so drop the old global indexes
+	for model, index := range map[interface{}]string{
+		&models.SenderDomain{}: "idx_sender_domains_domain",
+		&models.DKIMKey{}:      "idx_dkim_keys_domain",
+	} {
+		if db.Migrator().HasIndex(model, index) {
+			if err := db.Migrator().DropIndex(model, index); err != nil {
+				log.Fatalf("Failed to drop index %s: %v", index, err)
+			}
+		}
+	}
+
 	// Start background worker
 	worker := workers.NewWorker()
 	worker.Start()
@@ -94,16 +137,33 @@ func main() {
 	webhookHandler := handlers.NewWebhookHandler()
 	referralHandler := handlers.NewReferralHandler()
 	templateHandler := handlers.NewTemplateHandler()
+	providerWebhookHandler := handlers.NewProviderWebhookHandler()
+	suppressionHandler := handlers.NewSuppressionHandler()
+	globalSuppressionHandler := handlers.NewGlobalSuppressionHandler()
+	domainHandler := handlers.NewDomainHandler()
+	seedHandler := handlers.NewSeedHandler()
+	deliverabilityHandler := handlers.NewDeliverabilityHandler()
+	engagementHandler := handlers.NewEngagementHandler()
+	workflowHandler := handlers.NewWorkflowHandler()
 
 	// Public endpoints (no auth required)
-	r.GET("/api/unsubscribe/:token", subscriberHandler.Unsubscribe)
-	r.GET("/api/track/open/:campaignId/:subscriberId", analyticsHandler.TrackOpen)
-	r.GET("/api/track/click/:campaignId/:subscriberId", analyticsHandler.TrackClick)
+	r.GET("/api/unsubscribe/:token", subscriberHandler.UnsubscribePage)
+	r.POST("/api/unsubscribe/:token", subscriberHandler.Unsubscribe)
+	r.GET("/api/preferences/:token", subscriberHandler.PreferencesPage)
+	r.POST("/api/preferences/:token", subscriberHandler.UpdatePreferences)
+	r.GET("/api/t/o/:token", analyticsHandler.TrackOpen)
+	r.GET("/api/t/c/:token", analyticsHandler.TrackClick)
 
 	// Payment webhooks (verified by signature)
 	r.POST("/api/webhooks/paystack", paymentHandler.PaystackWebhook)
 	r.POST("/api/webhooks/mpesa", paymentHandler.MpesaCallback)
 
+	// Email provider event webhooks (verified by signature)
+	r.POST("/api/webhooks/sendgrid", providerWebhookHandler.SendGridEvents)
+	r.POST("/api/webhooks/resend", providerWebhookHandler.ResendEvents)
+	r.POST("/api/webhooks/dmarc", providerWebhookHandler.DMARCReports)
+	r.POST("/api/webhooks/bounces", providerWebhookHandler.InboundBounces)
+
 	// Public referral endpoints
 	r.GET("/api/r/:code", referralHandler.TrackClick)
 	r.GET("/api/referrals/code/:code", referralHandler.GetCode)
@@ -181,10 +241,45 @@ func main() {
 			subscribers.GET("/export", subscriberHandler.Export)
 			subscribers.POST("/import", subscriberHandler.Import)
 			subscribers.GET("/:id", subscriberHandler.GetOne)
+			subscribers.GET("/:id/timeline", subscriberHandler.GetTimeline)
 			subscribers.PUT("/:id", subscriberHandler.Update)
 			subscribers.DELETE("/:id", subscriberHandler.Delete)
 		}
 
+		// Suppression list routes (protected)
+		suppressions := api.Group("/suppressions")
+		suppressions.Use(middleware.AuthMiddleware())
+		{
+			suppressions.GET("", suppressionHandler.GetAll)
+			suppressions.POST("", suppressionHandler.Create)
+			suppressions.GET("/export", suppressionHandler.Export)
+			suppressions.POST("/import", suppressionHandler.Import)
+			suppressions.GET("/audit", suppressionHandler.GetAudit)
+			suppressions.DELETE("/:id", suppressionHandler.Delete)
+		}
+
+		// Sender domain routes (protected)
+		domains := api.Group("/domains")
+		domains.Use(middleware.AuthMiddleware())
+		{
+			domains.POST("", domainHandler.Create)
+			domains.GET("", domainHandler.GetAll)
+			domains.GET("/:id", domainHandler.GetOne)
+			domains.POST("/:id/verify", domainHandler.Verify)
+			domains.GET("/:id/dmarc", domainHandler.GetDMARC)
+			domains.DELETE("/:id", domainHandler.Delete)
+		}
+
+		// Seed mailboxes for inbox placement tests
+		seeds := api.Group("/seeds")
+		seeds.Use(middleware.AuthMiddleware())
+		{
+			seeds.POST("", seedHandler.Create)
+			seeds.GET("", seedHandler.GetAll)
+			seeds.POST("/:id/check", seedHandler.Check)
+			seeds.DELETE("/:id", seedHandler.Delete)
+		}
+
 		// Tag routes (protected)
 		tags := api.Group("/tags")
 		tags.Use(middleware.AuthMiddleware())
@@ -208,6 +303,16 @@ func main() {
 			campaigns.POST("/:id/schedule", campaignHandler.Schedule)
 			campaigns.POST("/:id/send", campaignHandler.SendNow)
 			campaigns.GET("/:id/stats", campaignHandler.GetStats)
+			campaigns.GET("/:id/progress", campaignHandler.GetProgress)
+			campaigns.GET("/:id/messages", campaignHandler.GetMessages)
+			campaigns.GET("/:id/placement", seedHandler.GetCampaignPlacement)
+			campaigns.GET("/:id/test", campaignHandler.GetTest)
+			campaigns.PUT("/:id/test", campaignHandler.SetTest)
+			campaigns.DELETE("/:id/test", campaignHandler.DeleteTest)
+			campaigns.POST("/:id/test/variants", campaignHandler.AddVariant)
+			campaigns.PUT("/:id/test/variants/:variantId", campaignHandler.UpdateVariant)
+			campaigns.DELETE("/:id/test/variants/:variantId", campaignHandler.DeleteVariant)
+			campaigns.POST("/:id/test/winner", campaignHandler.PickWinner)
 		}
 
 		// Analytics routes (protected)
@@ -217,6 +322,40 @@ func main() {
 			analytics.GET("/overview", analyticsHandler.GetOverview)
 			analytics.GET("/growth", analyticsHandler.GetGrowth)
 			analytics.GET("/top-campaigns", analyticsHandler.GetTopCampaigns)
+			analytics.GET("/reputation", analyticsHandler.GetReputation)
+			analytics.GET("/warmup", analyticsHandler.GetWarmup)
+			analytics.GET("/send-time", analyticsHandler.GetSendTime)
+		}
+
+		// Deliverability (protected)
+		deliverability := api.Group("/deliverability")
+		deliverability.Use(middleware.AuthMiddleware())
+		{
+			deliverability.GET("/metrics", deliverabilityHandler.GetMetrics)
+			deliverability.GET("/providers", deliverabilityHandler.GetProviders)
+			deliverability.GET("/dns", deliverabilityHandler.GetDNS)
+			deliverability.POST("/dns/verify", deliverabilityHandler.VerifyDNS)
+			deliverability.GET("/bounces", deliverabilityHandler.GetBounceStats)
+			deliverability.GET("/bounces/subscribers", deliverabilityHandler.GetBouncedSubscribers)
+			deliverability.POST("/bounces/subscribers/:id/reset", deliverabilityHandler.ResetBounce)
+			deliverability.GET("/complaints", deliverabilityHandler.GetComplaintStats)
+			deliverability.GET("/complaints/subscribers", deliverabilityHandler.GetComplainedSubscribers)
+			deliverability.GET("/complaints/recent", deliverabilityHandler.GetRecentComplaints)
+		}
+
+		// Engagement and list pruning (protected)
+		engagement := api.Group("/engagement")
+		engagement.Use(middleware.AuthMiddleware())
+		{
+			engagement.GET("/stats", engagementHandler.GetStats)
+			engagement.GET("/unengaged", engagementHandler.GetUnengaged)
+			engagement.POST("/recalculate", engagementHandler.Recalculate)
+			engagement.POST("/prune/preview", engagementHandler.PreviewPrune)
+			engagement.GET("/prune", engagementHandler.GetPruneJobs)
+			engagement.GET("/prune/:id", engagementHandler.GetPruneJob)
+			engagement.POST("/prune/:id/confirm", engagementHandler.ConfirmPrune)
+			engagement.POST("/prune/:id/undo", engagementHandler.UndoPrune)
+			engagement.DELETE("/prune/:id", engagementHandler.CancelPrune)
 		}
 
 		// Subscription Plans (protected)
@@ -263,6 +402,21 @@ func main() {
 			webhooks.GET("/:id/logs", webhookHandler.GetLogs)
 		}
 
+		// Automation workflows (protected)
+		workflows := api.Group("/workflows")
+		workflows.Use(middleware.AuthMiddleware())
+		{
+			workflows.POST("", workflowHandler.Create)
+			workflows.GET("", workflowHandler.GetAll)
+			workflows.GET("/:id", workflowHandler.GetOne)
+			workflows.PUT("/:id", workflowHandler.Update)
+			workflows.DELETE("/:id", workflowHandler.Delete)
+			workflows.POST("/:id/activate", workflowHandler.Activate)
+			workflows.POST("/:id/pause", workflowHandler.Pause)
+			workflows.GET("/:id/runs", workflowHandler.GetRuns)
+			workflows.POST("/:id/runs/:runId/cancel", workflowHandler.CancelRun)
+		}
+
 		// Referral routes (protected)
 		referrals := api.Group("/referrals")
 		referrals.Use(middleware.AuthMiddleware())
@@ -307,6 +461,28 @@ func main() {
 			admin.DELETE("/content/:id", adminHandler.DeleteContent)
 			admin.GET("/revenue", adminHandler.GetRevenue)
 			admin.GET("/top-creators", adminHandler.GetTopCreators)
+			admin.GET("/mail-routes", adminHandler.GetMailRoutes)
+			admin.PUT("/mail-routes", adminHandler.SetMailRoute)
+			admin.DELETE("/mail-routes/:id", adminHandler.DeleteMailRoute)
+			admin.PUT("/dkim-keys", adminHandler.SetDKIMKey)
+			admin.GET("/jobs/failed", adminHandler.GetFailedJobs)
+			admin.POST("/jobs/failed/:id/retry", adminHandler.RetryFailedJob)
+			admin.GET("/sending-holds", adminHandler.GetSendingHolds)
+			admin.POST("/sending-holds/:id/release", adminHandler.ReleaseSendingHold)
+			admin.GET("/warmup-plans", adminHandler.GetWarmupPlans)
+			admin.PUT("/warmup-plans/:id", adminHandler.UpdateWarmupPlan)
+			admin.GET("/suppressions", globalSuppressionHandler.GetAll)
+			admin.POST("/suppressions", globalSuppressionHandler.Create)
+			admin.GET("/suppressions/export", globalSuppressionHandler.Export)
+			admin.POST("/suppressions/import", globalSuppressionHandler.Import)
+			admin.GET("/suppressions/audit", globalSuppressionHandler.GetAudit)
+			admin.DELETE("/suppressions/:id", globalSuppressionHandler.Delete)
+			admin.GET("/deliverability", deliverabilityHandler.AdminGetMetrics)
+			admin.GET("/deliverability/bounces", deliverabilityHandler.AdminGetBouncedSubscribers)
+			admin.GET("/deliverability/complaints", deliverabilityHandler.AdminGetComplainedSubscribers)
+			admin.GET("/deliverability/complaints/recent", deliverabilityHandler.AdminGetRecentComplaints)
+			admin.GET("/prune-jobs", engagementHandler.AdminGetPruneJobs)
+			admin.POST("/prune-jobs/:id/undo", engagementHandler.AdminUndoPrune)
 		}
 	}
 
@@ -6,17 +6,26 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
 	"github.com/okemwag/newsletter/internal/services"
 	"github.com/okemwag/newsletter/internal/types"
 )
 
 type AdminHandler struct {
-	adminService *services.AdminService
+	adminService   *services.AdminService
+	mailerRegistry *services.MailerRegistry
+	deliverability *services.DeliverabilityService
+	sendGuard      *services.SendGuardService
+	warmup         *services.WarmupService
 }
 
 func NewAdminHandler() *AdminHandler {
 	return &AdminHandler{
-		adminService: services.NewAdminService(),
+		adminService:   services.NewAdminService(),
+		mailerRegistry: services.NewMailerRegistry(),
+		deliverability: services.NewDeliverabilityService(),
+		sendGuard:      services.NewSendGuardService(),
+		warmup:         services.NewWarmupService(),
 	}
 }
 
@@ -212,3 +221,246 @@ func (h *AdminHandler) GetTopCreators(c *gin.Context) {
 
 	c.JSON(http.StatusOK, creators)
 }
+
+// GET /api/admin/mail-routes
+func (h *AdminHandler) GetMailRoutes(c *gin.Context) {
+	routes, err := h.mailerRegistry.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes":    routes,
+		"providers": h.mailerRegistry.Providers(),
+	})
+}
+
+// PUT /api/admin/mail-routes
+func (h *AdminHandler) SetMailRoute(c *gin.Context) {
+	var req services.SetMailRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	route, err := h.mailerRegistry.SetRoute(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+// DELETE /api/admin/mail-routes/:id
+func (h *AdminHandler) DeleteMailRoute(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		return
+	}
+
+	if err := h.mailerRegistry.DeleteRoute(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mail route deleted successfully"})
+}
+
+// PUT /api/admin/dkim-keys
+func (h *AdminHandler) SetDKIMKey(c *gin.Context) {
+	var req services.ConfigureDKIMKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.deliverability.ConfigureDKIMKey(req.CreatorID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// GET /api/admin/jobs/failed
+func (h *AdminHandler) GetFailedJobs(c *gin.Context) {
+	page := 1
+	pageSize := 50
+
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			page = parsed
+		}
+	}
+
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil {
+			pageSize = parsed
+		}
+	}
+
+	jobs, total, err := h.adminService.GetFailedJobs(c.Query("type"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  jobs,
+		"total": total,
+	})
+}
+
+// POST /api/admin/jobs/failed/:id/retry
+func (h *AdminHandler) RetryFailedJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.adminService.RetryFailedJob(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Job requeued",
+		"jobId":   job.ID,
+	})
+}
+
+// GET /api/admin/sending-holds?status=active
+func (h *AdminHandler) GetSendingHolds(c *gin.Context) {
+	filter := &services.HoldFilter{Page: 1, PageSize: 50}
+
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			filter.Page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 && parsed <= 200 {
+			filter.PageSize = parsed
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		holdStatus := models.HoldStatus(status)
+		filter.Status = &holdStatus
+	}
+	if creator := c.Query("creatorId"); creator != "" {
+		creatorID, err := uuid.Parse(creator)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creator ID"})
+			return
+		}
+		filter.CreatorID = &creatorID
+	}
+
+	holds, total, err := h.sendGuard.ListHolds(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  holds,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
+
+// POST /api/admin/sending-holds/:id/release
+func (h *AdminHandler) ReleaseSendingHold(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+
+	var req services.ReleaseHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hold, err := h.sendGuard.Release(id, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// GET /api/admin/warmup-plans?status=active
+func (h *AdminHandler) GetWarmupPlans(c *gin.Context) {
+	filter := &services.WarmupFilter{Page: 1, PageSize: 50}
+
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			filter.Page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 && parsed <= 200 {
+			filter.PageSize = parsed
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		warmupStatus := models.WarmupStatus(status)
+		filter.Status = &warmupStatus
+	}
+	if creator := c.Query("creatorId"); creator != "" {
+		creatorID, err := uuid.Parse(creator)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creator ID"})
+			return
+		}
+		filter.CreatorID = &creatorID
+	}
+
+	plans, total, err := h.warmup.ListPlans(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  plans,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
+
+// PUT /api/admin/warmup-plans/:id
+func (h *AdminHandler) UpdateWarmupPlan(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+
+	var req services.UpdateWarmupPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.warmup.Override(id, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -11,12 +12,20 @@ import (
 )
 
 type AnalyticsHandler struct {
-	analyticsService *services.AnalyticsService
+	analyticsService      *services.AnalyticsService
+	trackingService       *services.TrackingService
+	deliverabilityService *services.DeliverabilityService
+	warmupService         *services.WarmupService
+	sendTimeService       *services.SendTimeService
 }
 
 func NewAnalyticsHandler() *AnalyticsHandler {
 	return &AnalyticsHandler{
-		analyticsService: services.NewAnalyticsService(),
+		analyticsService:      services.NewAnalyticsService(),
+		trackingService:       services.NewTrackingService(),
+		deliverabilityService: services.NewDeliverabilityService(),
+		warmupService:         services.NewWarmupService(),
+		sendTimeService:       services.NewSendTimeService(),
 	}
 }
 
@@ -73,29 +82,93 @@ func (h *AnalyticsHandler) GetTopCampaigns(c *gin.Context) {
 	c.JSON(http.StatusOK, campaigns)
 }
 
-// GET /api/track/open/:campaignId/:subscriberId (Public - tracking pixel)
-func (h *AnalyticsHandler) TrackOpen(c *gin.Context) {
-	campaignID, err := uuid.Parse(c.Param("campaignId"))
+// GET /api/analytics/reputation?window=30&days=90
+func (h *AnalyticsHandler) GetReputation(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	window := 30
+	if w := c.Query("window"); w != "" {
+		parsed, err := strconv.Atoi(w)
+		if err != nil || (parsed != 7 && parsed != 30 && parsed != 90) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must be 7, 30 or 90"})
+			return
+		}
+		window = parsed
+	}
+
+	days := 90
+	if d := c.Query("days"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil && parsed > 0 && parsed <= 365 {
+			days = parsed
+		}
+	}
+
+	windows := make([]*services.DeliverabilityWindow, 0, len(services.ReputationWindows))
+	for _, windowDays := range services.ReputationWindows {
+		current, err := h.deliverabilityService.Window(creatorID, windowDays)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		windows = append(windows, current)
+	}
+
+	history, err := h.deliverabilityService.GetReputationHistory(creatorID, window, days)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	subscriberID, err := uuid.Parse(c.Param("subscriberId"))
+	c.JSON(http.StatusOK, gin.H{
+		"windows": windows,
+		"history": history,
+	})
+}
+
+// GET /api/analytics/warmup
+func (h *AnalyticsHandler) GetWarmup(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	progress, err := h.warmupService.GetProgress(userID.(uuid.UUID))
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": progress})
+}
+
+// GET /api/analytics/send-time
+func (h *AnalyticsHandler) GetSendTime(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	profile, err := h.sendTimeService.CreatorProfile(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GET /api/t/o/:token (Public - tracking pixel)
+func (h *AnalyticsHandler) TrackOpen(c *gin.Context) {
+	target, err := h.trackingService.ParseOpenToken(c.Param("token"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
 		return
 	}
 
 	// Record the event
 	event := &models.EmailEvent{
-		CampaignID:   campaignID,
-		SubscriberID: subscriberID,
+		CampaignID:   target.CampaignID,
+		SubscriberID: target.SubscriberID,
 		EventType:    models.EmailEventOpen,
 		IPAddress:    strPtr(c.ClientIP()),
 		UserAgent:    strPtr(c.GetHeader("User-Agent")),
 	}
-	h.analyticsService.RecordEvent(event)
+	h.analyticsService.RecordEngagement(event)
 
 	// Return 1x1 transparent GIF
 	c.Header("Content-Type", "image/gif")
@@ -109,40 +182,40 @@ func (h *AnalyticsHandler) TrackOpen(c *gin.Context) {
 	c.Data(http.StatusOK, "image/gif", transparentGIF)
 }
 
-// GET /api/track/click/:campaignId/:subscriberId (Public - link tracking)
+// GET /api/t/c/:token (Public - link tracking)
+// The target URL is looked up from the signed link ID, never taken from the
+// request, so the endpoint cannot be used as an open redirect.
 func (h *AnalyticsHandler) TrackClick(c *gin.Context) {
-	campaignID, err := uuid.Parse(c.Param("campaignId"))
+	target, err := h.trackingService.ParseClickToken(c.Param("token"))
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		c.Status(http.StatusNotFound)
 		return
 	}
 
-	subscriberID, err := uuid.Parse(c.Param("subscriberId"))
+	link, err := h.trackingService.ResolveLink(target.CampaignID, target.LinkID)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
-		return
-	}
-
-	url := c.Query("url")
-	if url == "" {
-		c.Status(http.StatusBadRequest)
+		c.Status(http.StatusNotFound)
 		return
 	}
 
 	// Record the event
-	metadata := `{"url": "` + url + `"}`
+	data, _ := json.Marshal(map[string]string{
+		"url":    link.URL,
+		"linkId": link.ID.String(),
+	})
+	metadata := string(data)
 	event := &models.EmailEvent{
-		CampaignID:   campaignID,
-		SubscriberID: subscriberID,
+		CampaignID:   target.CampaignID,
+		SubscriberID: target.SubscriberID,
 		EventType:    models.EmailEventClick,
 		Metadata:     &metadata,
 		IPAddress:    strPtr(c.ClientIP()),
 		UserAgent:    strPtr(c.GetHeader("User-Agent")),
 	}
-	h.analyticsService.RecordEvent(event)
+	h.analyticsService.RecordEngagement(event)
 
 	// Redirect to actual URL
-	c.Redirect(http.StatusTemporaryRedirect, url)
+	c.Redirect(http.StatusTemporaryRedirect, link.URL)
 }
 
 func strPtr(s string) *string {
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+// testErrorStatus maps A/B test errors to HTTP statuses
+func testErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCampaignTestNotFound), errors.Is(err, services.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCampaignTestLocked), errors.Is(err, services.ErrCampaignTestDecided):
+		return http.StatusConflict
+	case err.Error() == "campaign not found":
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// GET /api/campaigns/:id/test
+func (h *CampaignHandler) GetTest(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	report, err := h.campaignService.GetTestReport(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// PUT /api/campaigns/:id/test
+func (h *CampaignHandler) SetTest(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	var req services.CampaignTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	test, err := h.campaignService.SetTest(id, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, test)
+}
+
+// DELETE /api/campaigns/:id/test
+func (h *CampaignHandler) DeleteTest(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	if err := h.campaignService.DeleteTest(id, userID.(uuid.UUID)); err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "A/B test removed"})
+}
+
+// POST /api/campaigns/:id/test/variants
+func (h *CampaignHandler) AddVariant(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	var req services.CampaignVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := h.campaignService.AddVariant(id, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, variant)
+}
+
+// PUT /api/campaigns/:id/test/variants/:variantId
+func (h *CampaignHandler) UpdateVariant(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, variantID, ok := variantParams(c)
+	if !ok {
+		return
+	}
+
+	var req services.CampaignVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := h.campaignService.UpdateVariant(id, variantID, userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// DELETE /api/campaigns/:id/test/variants/:variantId
+func (h *CampaignHandler) DeleteVariant(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, variantID, ok := variantParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.campaignService.DeleteVariant(id, variantID, userID.(uuid.UUID)); err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted"})
+}
+
+// POST /api/campaigns/:id/test/winner
+// Picks the winner by hand, ending the test early.
+func (h *CampaignHandler) PickWinner(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	var req struct {
+		VariantID uuid.UUID `json:"variantId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.campaignService.PickWinner(id, userID.(uuid.UUID), req.VariantID)
+	if err != nil {
+		c.JSON(testErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// variantParams reads the campaign and variant IDs, writing the error
+// response when either is malformed
+func variantParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	variantID, err := uuid.Parse(c.Param("variantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, variantID, true
+}
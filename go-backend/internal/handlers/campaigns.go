@@ -1,20 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
 	"github.com/okemwag/newsletter/internal/services"
 )
 
 type CampaignHandler struct {
 	campaignService *services.CampaignService
+	messageService  *services.EmailMessageService
 }
 
 func NewCampaignHandler() *CampaignHandler {
 	return &CampaignHandler{
 		campaignService: services.NewCampaignService(),
+		messageService:  services.NewEmailMessageService(),
 	}
 }
 
@@ -148,12 +153,35 @@ func (h *CampaignHandler) SendNow(c *gin.Context) {
 	}
 
 	campaign, err := h.campaignService.SendNow(id, userID.(uuid.UUID))
+	if errors.Is(err, services.ErrSendingOnHold) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, campaign)
+	c.JSON(http.StatusAccepted, campaign)
+}
+
+// GET /api/campaigns/:id/progress
+func (h *CampaignHandler) GetProgress(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	progress, err := h.campaignService.GetProgress(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
 }
 
 // GET /api/campaigns/:id/stats
@@ -174,3 +202,42 @@ func (h *CampaignHandler) GetStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// GET /api/campaigns/:id/messages
+func (h *CampaignHandler) GetMessages(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	filter := &services.MessageFilter{}
+	if status := c.Query("status"); status != "" {
+		s := models.MessageStatus(status)
+		filter.Status = &s
+	}
+	if page := c.Query("page"); page != "" {
+		if p, err := strconv.Atoi(page); err == nil {
+			filter.Page = p
+		}
+	}
+	if pageSize := c.Query("pageSize"); pageSize != "" {
+		if ps, err := strconv.Atoi(pageSize); err == nil {
+			filter.PageSize = ps
+		}
+	}
+
+	messages, total, err := h.messageService.GetCampaignMessages(id, userID.(uuid.UUID), filter)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  messages,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type DeliverabilityHandler struct {
+	deliverabilityService *services.DeliverabilityService
+	bounceService         *services.BounceService
+	complaintService      *services.ComplaintService
+	suppressionService    *services.SuppressionService
+	domainService         *services.SenderDomainService
+}
+
+func NewDeliverabilityHandler() *DeliverabilityHandler {
+	return &DeliverabilityHandler{
+		deliverabilityService: services.NewDeliverabilityService(),
+		bounceService:         services.NewBounceService(),
+		complaintService:      services.NewComplaintService(),
+		suppressionService:    services.NewSuppressionService(),
+		domainService:         services.NewSenderDomainService(),
+	}
+}
+
+// pagination reads page and pageSize, capping pageSize at 200
+func pagination(c *gin.Context) (int, int) {
+	page, pageSize := 1, 50
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 && parsed <= 200 {
+			pageSize = parsed
+		}
+	}
+	return page, pageSize
+}
+
+// creatorFilter reads the optional creatorId admins narrow lists by. It
+// writes the error response and returns false when the ID is malformed.
+func creatorFilter(c *gin.Context) (*uuid.UUID, bool) {
+	creator := c.Query("creatorId")
+	if creator == "" {
+		return nil, true
+	}
+	creatorID, err := uuid.Parse(creator)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid creator ID"})
+		return nil, false
+	}
+	return &creatorID, true
+}
+
+// GET /api/deliverability/metrics
+func (h *DeliverabilityHandler) GetMetrics(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	metrics, err := h.deliverabilityService.GetDeliverabilityMetrics(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, metrics)
+}
+
+// GET /api/deliverability/providers
+func (h *DeliverabilityHandler) GetProviders(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	breakdown, err := h.deliverabilityService.GetProviderBreakdown(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// GET /api/deliverability/dns
+func (h *DeliverabilityHandler) GetDNS(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	records, err := h.deliverabilityService.GetDNSStatus(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// POST /api/deliverability/dns/verify
+func (h *DeliverabilityHandler) VerifyDNS(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	results, err := h.domainService.VerifyAll(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// GET /api/deliverability/bounces
+func (h *DeliverabilityHandler) GetBounceStats(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	stats, err := h.bounceService.GetBounceStats(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GET /api/deliverability/bounces/subscribers
+func (h *DeliverabilityHandler) GetBouncedSubscribers(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	h.listBounced(c, &creatorID)
+}
+
+// POST /api/deliverability/bounces/subscribers/:id/reset
+func (h *DeliverabilityHandler) ResetBounce(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscriber ID"})
+		return
+	}
+
+	subscriber, err := h.bounceService.ResetBounce(creatorID, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBouncedSubscriberNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A hard bounce also suppresses the address platform-wide; resetting the
+	// subscriber doesn't lift that, so say why mail still won't go out
+	response := gin.H{"subscriber": subscriber}
+	suppression, err := h.suppressionService.Check(subscriber.Email, &creatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check suppression list"})
+		return
+	}
+	if suppression != nil {
+		response["suppression"] = suppression
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /api/deliverability/complaints
+func (h *DeliverabilityHandler) GetComplaintStats(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	stats, err := h.complaintService.GetComplaintStats(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GET /api/deliverability/complaints/subscribers
+func (h *DeliverabilityHandler) GetComplainedSubscribers(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	h.listComplained(c, &creatorID)
+}
+
+// GET /api/deliverability/complaints/recent
+func (h *DeliverabilityHandler) GetRecentComplaints(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	h.listRecentComplaints(c, &creatorID)
+}
+
+// GET /api/admin/deliverability
+func (h *DeliverabilityHandler) AdminGetMetrics(c *gin.Context) {
+	creatorID, ok := creatorFilter(c)
+	if !ok {
+		return
+	}
+
+	filter := &services.MetricsFilter{CreatorID: creatorID, Sort: c.Query("sort")}
+	filter.Page, filter.PageSize = pagination(c)
+	if m := c.Query("minSent"); m != "" {
+		if parsed, err := strconv.ParseInt(m, 10, 64); err == nil && parsed > 0 {
+			filter.MinSent = parsed
+		}
+	}
+
+	metrics, total, err := h.deliverabilityService.ListMetrics(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  metrics,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
+
+// GET /api/admin/deliverability/bounces
+func (h *DeliverabilityHandler) AdminGetBouncedSubscribers(c *gin.Context) {
+	if creatorID, ok := creatorFilter(c); ok {
+		h.listBounced(c, creatorID)
+	}
+}
+
+// GET /api/admin/deliverability/complaints
+func (h *DeliverabilityHandler) AdminGetComplainedSubscribers(c *gin.Context) {
+	if creatorID, ok := creatorFilter(c); ok {
+		h.listComplained(c, creatorID)
+	}
+}
+
+// GET /api/admin/deliverability/complaints/recent
+func (h *DeliverabilityHandler) AdminGetRecentComplaints(c *gin.Context) {
+	if creatorID, ok := creatorFilter(c); ok {
+		h.listRecentComplaints(c, creatorID)
+	}
+}
+
+func (h *DeliverabilityHandler) listBounced(c *gin.Context, creatorID *uuid.UUID) {
+	page, pageSize := pagination(c)
+
+	subscribers, total, err := h.bounceService.GetBouncedSubscribers(creatorID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  subscribers,
+		"total": total,
+		"page":  page,
+	})
+}
+
+func (h *DeliverabilityHandler) listComplained(c *gin.Context, creatorID *uuid.UUID) {
+	page, pageSize := pagination(c)
+
+	subscribers, total, err := h.complaintService.GetComplainedSubscribers(creatorID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  subscribers,
+		"total": total,
+		"page":  page,
+	})
+}
+
+func (h *DeliverabilityHandler) listRecentComplaints(c *gin.Context, creatorID *uuid.UUID) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+
+	events, err := h.complaintService.GetRecentComplaints(creatorID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
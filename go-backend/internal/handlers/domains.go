@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type DomainHandler struct {
+	domainService *services.SenderDomainService
+	dmarcService  *services.DMARCReportService
+}
+
+func NewDomainHandler() *DomainHandler {
+	return &DomainHandler{
+		domainService: services.NewSenderDomainService(),
+		dmarcService:  services.NewDMARCReportService(),
+	}
+}
+
+// POST /api/domains
+func (h *DomainHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req services.AddSenderDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := h.domainService.Add(userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	guide, err := h.domainService.DNSConfig(domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"domain": domain,
+		"dns":    guide,
+	})
+}
+
+// GET /api/domains
+func (h *DomainHandler) GetAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	domains, err := h.domainService.List(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, domains)
+}
+
+// GET /api/domains/:id
+func (h *DomainHandler) GetOne(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	domain, err := h.domainService.Get(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	guide, err := h.domainService.DNSConfig(domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domain": domain,
+		"dns":    guide,
+	})
+}
+
+// POST /api/domains/:id/verify
+func (h *DomainHandler) Verify(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	result, err := h.domainService.Verify(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GET /api/domains/:id/dmarc?days=30
+func (h *DomainHandler) GetDMARC(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	domain, err := h.domainService.Get(id, creatorID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	days := 30
+	if d := c.Query("days"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil && parsed > 0 && parsed <= 365 {
+			days = parsed
+		}
+	}
+
+	summary, err := h.dmarcService.Summary(creatorID, domain.Domain, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// DELETE /api/domains/:id
+func (h *DomainHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+		return
+	}
+
+	if err := h.domainService.Delete(id, userID.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain deleted successfully"})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type EngagementHandler struct {
+	engagementService *services.EngagementService
+}
+
+func NewEngagementHandler() *EngagementHandler {
+	return &EngagementHandler{
+		engagementService: services.NewEngagementService(),
+	}
+}
+
+// pruneErrorStatus maps prune job errors to HTTP statuses
+func pruneErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPruneJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPruneNotConfirmable),
+		errors.Is(err, services.ErrPrunePreviewExpired),
+		errors.Is(err, services.ErrPruneNotUndoable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /api/engagement/stats
+func (h *EngagementHandler) GetStats(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	stats, err := h.engagementService.GetEngagementStats(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GET /api/engagement/unengaged
+func (h *EngagementHandler) GetUnengaged(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	page, pageSize := pagination(c)
+
+	subscribers, total, err := h.engagementService.GetUnengagedSubscribers(userID.(uuid.UUID), pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  subscribers,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// POST /api/engagement/recalculate
+func (h *EngagementHandler) Recalculate(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.engagementService.RecalculateAllScores(userID.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Engagement scores recalculated"})
+}
+
+// POST /api/engagement/prune/preview
+func (h *EngagementHandler) PreviewPrune(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req services.PrunePreviewRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	preview, err := h.engagementService.PreviewPrune(userID.(uuid.UUID), userID.(uuid.UUID), &req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNothingToPrune) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, preview)
+}
+
+// GET /api/engagement/prune
+func (h *EngagementHandler) GetPruneJobs(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	h.listPruneJobs(c, &creatorID)
+}
+
+// GET /api/engagement/prune/:id
+func (h *EngagementHandler) GetPruneJob(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prune job ID"})
+		return
+	}
+
+	job, err := h.engagementService.GetPruneJob(id, &creatorID)
+	if err != nil {
+		c.JSON(pruneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// POST /api/engagement/prune/:id/confirm
+func (h *EngagementHandler) ConfirmPrune(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prune job ID"})
+		return
+	}
+
+	job, err := h.engagementService.ConfirmPrune(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(pruneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// DELETE /api/engagement/prune/:id
+func (h *EngagementHandler) CancelPrune(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prune job ID"})
+		return
+	}
+
+	if err := h.engagementService.CancelPrune(id, userID.(uuid.UUID)); err != nil {
+		c.JSON(pruneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Prune preview cancelled"})
+}
+
+// POST /api/engagement/prune/:id/undo
+func (h *EngagementHandler) UndoPrune(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	creatorID := userID.(uuid.UUID)
+
+	h.undoPrune(c, &creatorID, creatorID)
+}
+
+// GET /api/admin/prune-jobs
+func (h *EngagementHandler) AdminGetPruneJobs(c *gin.Context) {
+	if creatorID, ok := creatorFilter(c); ok {
+		h.listPruneJobs(c, creatorID)
+	}
+}
+
+// POST /api/admin/prune-jobs/:id/undo
+func (h *EngagementHandler) AdminUndoPrune(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	h.undoPrune(c, nil, userID.(uuid.UUID))
+}
+
+func (h *EngagementHandler) listPruneJobs(c *gin.Context, creatorID *uuid.UUID) {
+	filter := &services.PruneJobFilter{CreatorID: creatorID}
+	filter.Page, filter.PageSize = pagination(c)
+	if status := c.Query("status"); status != "" {
+		jobStatus := models.PruneJobStatus(status)
+		filter.Status = &jobStatus
+	}
+
+	jobs, total, err := h.engagementService.ListPruneJobs(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  jobs,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
+
+func (h *EngagementHandler) undoPrune(c *gin.Context, creatorID *uuid.UUID, actorID uuid.UUID) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prune job ID"})
+		return
+	}
+
+	job, err := h.engagementService.UndoPrune(id, creatorID, actorID)
+	if err != nil {
+		c.JSON(pruneErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type ProviderWebhookHandler struct {
+	eventService   *services.ProviderEventService
+	dmarcService   *services.DMARCReportService
+	inboundService *services.InboundBounceService
+}
+
+func NewProviderWebhookHandler() *ProviderWebhookHandler {
+	return &ProviderWebhookHandler{
+		eventService:   services.NewProviderEventService(),
+		dmarcService:   services.NewDMARCReportService(),
+		inboundService: services.NewInboundBounceService(),
+	}
+}
+
+// inboundMaxUpload caps a forwarded DMARC report or bounce
+const inboundMaxUpload = 25 << 20
+
+// providerMaxBatch caps a provider event webhook batch
+const providerMaxBatch = 5 << 20
+
+// POST /api/webhooks/sendgrid
+func (h *ProviderWebhookHandler) SendGridEvents(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, providerMaxBatch)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	err = services.VerifySendGridSignature(body,
+		c.GetHeader("X-Twilio-Email-Event-Webhook-Signature"),
+		c.GetHeader("X-Twilio-Email-Event-Webhook-Timestamp"))
+	if err != nil {
+		h.rejectUnverified(c, "sendgrid", err)
+		return
+	}
+
+	events, err := services.ParseSendGridEvents(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.process(c, events)
+}
+
+// POST /api/webhooks/resend
+func (h *ProviderWebhookHandler) ResendEvents(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, providerMaxBatch)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	eventID := c.GetHeader("svix-id")
+	err = services.VerifyResendSignature(body, eventID,
+		c.GetHeader("svix-timestamp"),
+		c.GetHeader("svix-signature"))
+	if err != nil {
+		h.rejectUnverified(c, "resend", err)
+		return
+	}
+
+	events, err := services.ParseResendEvent(body, eventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.process(c, events)
+}
+
+// POST /api/webhooks/dmarc?token=
+// Accepts a report attachment as the body (XML, gzip or zip), a forwarded
+// email (message/rfc822), or an inbound-parse style multipart form with the
+// attachments as files and the raw message in an "email" field.
+func (h *ProviderWebhookHandler) DMARCReports(c *gin.Context) {
+	if err := services.VerifyDMARCIngestToken(ingestToken(c)); err != nil {
+		h.rejectUnverified(c, "dmarc", err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, inboundMaxUpload)
+	result := &services.DMARCIngestResult{}
+
+	switch mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); {
+	case mediaType == "multipart/form-data":
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, raw := range form.Value["email"] {
+			if err := h.ingest(result, []byte(raw), true); err != nil {
+				h.rejectReport(c, err)
+				return
+			}
+		}
+		for _, files := range form.File {
+			for _, header := range files {
+				file, err := header.Open()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				data, err := io.ReadAll(file)
+				file.Close()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if err := h.ingest(result, data, false); err != nil && !errors.Is(err, services.ErrUnrecognizedReport) {
+					h.rejectReport(c, err)
+					return
+				}
+			}
+		}
+
+	default:
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := h.ingest(result, body, mediaType == "message/rfc822"); err != nil {
+			h.rejectReport(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *ProviderWebhookHandler) ingest(total *services.DMARCIngestResult, data []byte, message bool) error {
+	ingest := h.dmarcService.Ingest
+	if message {
+		ingest = h.dmarcService.IngestMessage
+	}
+	result, err := ingest(data)
+	if result != nil {
+		total.Stored += result.Stored
+		total.Duplicates += result.Duplicates
+		total.Skipped += result.Skipped
+	}
+	return err
+}
+
+// rejectReport answers 400 for unreadable submissions so they aren't
+// redelivered, and 500 for storage errors so they are
+func (h *ProviderWebhookHandler) rejectReport(c *gin.Context, err error) {
+	log.Printf("[DMARC] Failed to ingest report: %v", err)
+	if errors.Is(err, services.ErrUnrecognizedReport) || errors.Is(err, services.ErrMalformedReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store report"})
+}
+
+// POST /api/webhooks/bounces?token=
+// Accepts one message sent to the return path: the raw message as the body,
+// or an inbound-parse style multipart form with the raw message in an
+// "email" field and the envelope in "envelope" or "to"
+func (h *ProviderWebhookHandler) InboundBounces(c *gin.Context) {
+	if err := services.VerifyBounceIngestToken(ingestToken(c)); err != nil {
+		h.rejectUnverified(c, "bounces", err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, inboundMaxUpload)
+
+	var raw []byte
+	envelopeTo := c.Query("recipient")
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType == "multipart/form-data" {
+		raw = []byte(c.PostForm("email"))
+		if envelope := c.PostForm("envelope"); envelope != "" {
+			var parsed struct {
+				To []string `json:"to"`
+			}
+			if json.Unmarshal([]byte(envelope), &parsed) == nil && len(parsed.To) > 0 {
+				envelopeTo = parsed.To[0]
+			}
+		}
+		if envelopeTo == "" {
+			envelopeTo = c.PostForm("to")
+		}
+	} else {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		raw = body
+	}
+	if len(raw) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No message in request"})
+		return
+	}
+
+	report, err := h.inboundService.ProcessMessage(raw, envelopeTo)
+	if err != nil {
+		log.Printf("[Inbound] Failed to process message: %v", err)
+		if errors.Is(err, services.ErrMalformedInboundMessage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ingestToken is the shared secret of an inbound mail forwarder
+func ingestToken(c *gin.Context) string {
+	if token := c.GetHeader("X-Ingest-Token"); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+func (h *ProviderWebhookHandler) process(c *gin.Context, events []services.ProviderEventInput) {
+	// A storage or apply error is returned as 500 so the provider redelivers
+	// the batch; events already applied are skipped on the retry
+	processed, err := h.eventService.Process(events)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": len(events), "processed": processed})
+}
+
+func (h *ProviderWebhookHandler) rejectUnverified(c *gin.Context, provider string, err error) {
+	if errors.Is(err, services.ErrWebhookNotConfigured) {
+		log.Printf("[ProviderEvents] Rejecting %s webhook: %v", provider, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type SeedHandler struct {
+	seedService *services.SeedService
+}
+
+func NewSeedHandler() *SeedHandler {
+	return &SeedHandler{
+		seedService: services.NewSeedService(),
+	}
+}
+
+// POST /api/seeds
+func (h *SeedHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req services.AddSeedMailboxRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	check, err := h.seedService.AddMailbox(userID.(uuid.UUID), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, check)
+}
+
+// GET /api/seeds
+func (h *SeedHandler) GetAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	mailboxes, err := h.seedService.ListMailboxes(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mailboxes)
+}
+
+// POST /api/seeds/:id/check
+func (h *SeedHandler) Check(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seed mailbox ID"})
+		return
+	}
+
+	check, err := h.seedService.CheckMailbox(id, userID.(uuid.UUID))
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, services.ErrSeedMailboxNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, check)
+}
+
+// DELETE /api/seeds/:id
+func (h *SeedHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seed mailbox ID"})
+		return
+	}
+
+	if err := h.seedService.DeleteMailbox(id, userID.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Seed mailbox deleted successfully"})
+}
+
+// GET /api/campaigns/:id/placement
+func (h *SeedHandler) GetCampaignPlacement(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	report, err := h.seedService.GetCampaignPlacement(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/csv"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -14,11 +15,13 @@ import (
 
 type SubscriberHandler struct {
 	subscriberService *services.SubscriberService
+	messageService    *services.EmailMessageService
 }
 
 func NewSubscriberHandler() *SubscriberHandler {
 	return &SubscriberHandler{
 		subscriberService: services.NewSubscriberService(),
+		messageService:    services.NewEmailMessageService(),
 	}
 }
 
@@ -34,7 +37,11 @@ func (h *SubscriberHandler) Create(c *gin.Context) {
 
 	subscriber, err := h.subscriberService.Create(&req, userID.(uuid.UUID))
 	if err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		status := http.StatusConflict
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -127,7 +134,11 @@ func (h *SubscriberHandler) Update(c *gin.Context) {
 
 	subscriber, err := h.subscriberService.Update(id, &req, userID.(uuid.UUID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -282,13 +293,133 @@ func (h *SubscriberHandler) GetStats(c *gin.Context) {
 }
 
 // GET /api/unsubscribe/:token (Public endpoint)
+// Only shows a confirmation page: link scanners follow GET links, so the
+// unsubscribe itself happens on POST.
+func (h *SubscriberHandler) UnsubscribePage(c *gin.Context) {
+	token := c.Param("token")
+
+	subscriber, err := h.subscriberService.FindByUnsubscribeToken(token)
+	if err != nil {
+		renderUnsubscribePage(c, http.StatusNotFound, unsubscribeInvalidPage, nil)
+		return
+	}
+
+	if subscriber.Status != models.SubscriberStatusActive {
+		renderUnsubscribePage(c, http.StatusOK, unsubscribeDonePage, nil)
+		return
+	}
+
+	renderUnsubscribePage(c, http.StatusOK, unsubscribeConfirmPage, gin.H{
+		"Email":  subscriber.Email,
+		"Action": c.Request.URL.RequestURI(),
+	})
+}
+
+// POST /api/unsubscribe/:token (Public endpoint)
+// Handles both RFC 8058 one-click requests from mailbox providers and the
+// confirmation form.
 func (h *SubscriberHandler) Unsubscribe(c *gin.Context) {
 	token := c.Param("token")
 
-	if err := h.subscriberService.Unsubscribe(token); err != nil {
+	var campaignID *uuid.UUID
+	if id, err := uuid.Parse(c.Query("c")); err == nil {
+		campaignID = &id
+	}
+
+	oneClick := c.PostForm("List-Unsubscribe") == "One-Click"
+
+	if err := h.subscriberService.Unsubscribe(token, campaignID); err != nil {
+		if oneClick {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		renderUnsubscribePage(c, http.StatusNotFound, unsubscribeInvalidPage, nil)
+		return
+	}
+
+	if oneClick {
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully unsubscribed"})
+		return
+	}
+	renderUnsubscribePage(c, http.StatusOK, unsubscribeDonePage, nil)
+}
+
+// GET /api/preferences/:token (Public endpoint)
+// The preference center, reached from the link in each newsletter.
+func (h *SubscriberHandler) PreferencesPage(c *gin.Context) {
+	subscriber, err := h.subscriberService.FindByUnsubscribeToken(c.Param("token"))
+	if err != nil {
+		renderUnsubscribePage(c, http.StatusNotFound, preferencesInvalidPage, nil)
+		return
+	}
+
+	h.renderPreferences(c, http.StatusOK, subscriber, "")
+}
+
+// POST /api/preferences/:token (Public endpoint)
+func (h *SubscriberHandler) UpdatePreferences(c *gin.Context) {
+	token := c.Param("token")
+
+	var req struct {
+		Timezone string `form:"timezone" json:"timezone"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully unsubscribed"})
+	subscriber, err := h.subscriberService.SetTimezoneByToken(token, req.Timezone)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			if subscriber, findErr := h.subscriberService.FindByUnsubscribeToken(token); findErr == nil {
+				h.renderPreferences(c, http.StatusBadRequest, subscriber, "Pick a timezone from the list.")
+				return
+			}
+		}
+		renderUnsubscribePage(c, http.StatusNotFound, preferencesInvalidPage, nil)
+		return
+	}
+
+	h.renderPreferences(c, http.StatusOK, subscriber, "Your preferences have been saved.")
+}
+
+func (h *SubscriberHandler) renderPreferences(c *gin.Context, status int, subscriber *models.Subscriber, message string) {
+	timezone := ""
+	if subscriber.Timezone != nil {
+		timezone = *subscriber.Timezone
+	}
+	renderUnsubscribePage(c, status, preferencesPage, gin.H{
+		"Email":          subscriber.Email,
+		"Timezone":       timezone,
+		"Timezones":      commonTimezones,
+		"Message":        message,
+		"Action":         c.Request.URL.RequestURI(),
+		"UnsubscribeURL": "/api/unsubscribe/" + c.Param("token"),
+	})
+}
+
+// GET /api/subscribers/:id/timeline
+func (h *SubscriberHandler) GetTimeline(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscriber ID"})
+		return
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	timeline, err := h.messageService.GetSubscriberTimeline(id, userID.(uuid.UUID), limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": timeline})
 }
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+// SuppressionHandler serves a creator's own suppression list, or the
+// platform-wide list when global is set (admin routes)
+type SuppressionHandler struct {
+	suppressionService *services.SuppressionService
+	global             bool
+}
+
+func NewSuppressionHandler() *SuppressionHandler {
+	return &SuppressionHandler{
+		suppressionService: services.NewSuppressionService(),
+	}
+}
+
+func NewGlobalSuppressionHandler() *SuppressionHandler {
+	return &SuppressionHandler{
+		suppressionService: services.NewSuppressionService(),
+		global:             true,
+	}
+}
+
+// scope returns the list the request works on and the acting user
+func (h *SuppressionHandler) scope(c *gin.Context) (*uuid.UUID, *uuid.UUID) {
+	userID, _ := c.Get("userID")
+	actorID := userID.(uuid.UUID)
+	if h.global {
+		return nil, &actorID
+	}
+	return &actorID, &actorID
+}
+
+// GET /api/suppressions
+func (h *SuppressionHandler) GetAll(c *gin.Context) {
+	creatorID, _ := h.scope(c)
+
+	filter := &services.SuppressionFilter{
+		Email:  c.Query("email"),
+		Reason: c.Query("reason"),
+	}
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			filter.Page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil {
+			filter.PageSize = parsed
+		}
+	}
+
+	entries, total, err := h.suppressionService.List(creatorID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+		"page":  filter.Page,
+	})
+}
+
+// POST /api/suppressions
+func (h *SuppressionHandler) Create(c *gin.Context) {
+	creatorID, actorID := h.scope(c)
+
+	var req services.AddSuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, created, err := h.suppressionService.Add(creatorID, &req, "api", actorID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, entry)
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// DELETE /api/suppressions/:id
+func (h *SuppressionHandler) Delete(c *gin.Context) {
+	creatorID, actorID := h.scope(c)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suppression ID"})
+		return
+	}
+
+	var note *string
+	if n := c.Query("note"); n != "" {
+		note = &n
+	}
+
+	if err := h.suppressionService.Remove(id, creatorID, actorID, note); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Suppression removed successfully"})
+}
+
+// POST /api/suppressions/import
+func (h *SuppressionHandler) Import(c *gin.Context) {
+	creatorID, actorID := h.scope(c)
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+
+	// Read header
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV format"})
+		return
+	}
+
+	// Find column indices
+	emailIdx := -1
+	reasonIdx := -1
+	noteIdx := -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "email":
+			emailIdx = i
+		case "reason":
+			reasonIdx = i
+		case "note":
+			noteIdx = i
+		}
+	}
+
+	if emailIdx == -1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV must have an 'email' column"})
+		return
+	}
+
+	// Rows without a reason column fall back to the form value, then manual
+	defaultReason := models.SuppressionReason(c.PostForm("reason"))
+
+	var entries []services.AddSuppressionRequest
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || emailIdx >= len(record) {
+			continue
+		}
+
+		req := services.AddSuppressionRequest{
+			Email:  record[emailIdx],
+			Reason: defaultReason,
+		}
+		if reasonIdx >= 0 && reasonIdx < len(record) && record[reasonIdx] != "" {
+			req.Reason = models.SuppressionReason(record[reasonIdx])
+		}
+		if noteIdx >= 0 && noteIdx < len(record) && record[noteIdx] != "" {
+			req.Note = &record[noteIdx]
+		}
+
+		entries = append(entries, req)
+	}
+
+	added, skipped := h.suppressionService.Import(creatorID, entries, actorID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Import completed",
+		"added":   added,
+		"skipped": skipped,
+	})
+}
+
+// GET /api/suppressions/export
+func (h *SuppressionHandler) Export(c *gin.Context) {
+	creatorID, _ := h.scope(c)
+
+	entries, err := h.suppressionService.All(creatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename=suppressions.csv")
+
+	writer := csv.NewWriter(c.Writer)
+	defer writer.Flush()
+
+	// Write header
+	writer.Write([]string{"email", "reason", "source", "note", "created_at"})
+
+	// Write data
+	for _, entry := range entries {
+		note := ""
+		if entry.Note != nil {
+			note = *entry.Note
+		}
+		writer.Write([]string{
+			entry.Email,
+			string(entry.Reason),
+			entry.Source,
+			note,
+			entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+}
+
+// GET /api/suppressions/audit
+func (h *SuppressionHandler) GetAudit(c *gin.Context) {
+	creatorID, _ := h.scope(c)
+
+	page := 1
+	pageSize := 50
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil {
+			pageSize = parsed
+		}
+	}
+
+	entries, total, err := h.suppressionService.GetAudit(creatorID, c.Query("email"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+		"page":  page,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pages served by the public unsubscribe endpoints
+var (
+	unsubscribeConfirmPage = template.Must(template.New("confirm").Parse(unsubscribeLayout + `
+{{define "content"}}
+		<h1>Unsubscribe</h1>
+		<p>Stop sending newsletters to <strong>{{.Email}}</strong>?</p>
+		<form method="POST" action="{{.Action}}">
+			<button type="submit">Unsubscribe</button>
+		</form>
+{{end}}`))
+
+	unsubscribeDonePage = template.Must(template.New("done").Parse(unsubscribeLayout + `
+{{define "content"}}
+		<h1>You're unsubscribed</h1>
+		<p>You won't receive any more newsletters at this address.</p>
+{{end}}`))
+
+	unsubscribeInvalidPage = template.Must(template.New("invalid").Parse(unsubscribeLayout + `
+{{define "content"}}
+		<h1>Link not valid</h1>
+		<p>This unsubscribe link is invalid or has expired.</p>
+{{end}}`))
+
+	preferencesPage = template.Must(template.New("preferences").Parse(unsubscribeLayout + `
+{{define "title"}}Email preferences{{end}}
+{{define "content"}}
+		<h1>Email preferences</h1>
+		<p>Newsletters to <strong>{{.Email}}</strong> are delivered in this timezone.</p>
+		{{if .Message}}<p class="message">{{.Message}}</p>{{end}}
+		<form method="POST" action="{{.Action}}">
+			<input id="timezone" name="timezone" list="timezones" value="{{.Timezone}}" placeholder="e.g. Africa/Nairobi" required>
+			<datalist id="timezones">{{range .Timezones}}<option value="{{.}}">{{end}}</datalist>
+			<button type="submit">Save</button>
+		</form>
+		<p><a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+		<script>
+			var input = document.getElementById("timezone");
+			if (!input.value && window.Intl) {
+				input.value = Intl.DateTimeFormat().resolvedOptions().timeZone || "";
+			}
+		</script>
+{{end}}`))
+
+	preferencesInvalidPage = template.Must(template.New("preferencesInvalid").Parse(unsubscribeLayout + `
+{{define "title"}}Email preferences{{end}}
+{{define "content"}}
+		<h1>Link not valid</h1>
+		<p>This preferences link is invalid or has expired.</p>
+{{end}}`))
+)
+
+// commonTimezones are suggested in the preference center; any IANA name is
+// accepted
+var commonTimezones = []string{
+	"Africa/Nairobi", "Africa/Lagos", "Africa/Johannesburg", "Africa/Cairo",
+	"Africa/Accra", "Africa/Kampala", "Africa/Dar_es_Salaam", "Africa/Kigali",
+	"Europe/London", "Europe/Paris", "Europe/Berlin", "Asia/Dubai",
+	"Asia/Kolkata", "Asia/Singapore", "Asia/Tokyo", "Australia/Sydney",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Los_Angeles",
+	"America/Sao_Paulo", "UTC",
+}
+
+const unsubscribeLayout = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<meta name="robots" content="noindex">
+	<title>{{block "title" .}}Unsubscribe{{end}}</title>
+	<style>
+		body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #0a0a0a; color: #fff; padding: 40px; }
+		.container { max-width: 500px; margin: 0 auto; background: #111; border: 1px solid #222; border-radius: 12px; padding: 40px; text-align: center; }
+		p { color: #888; line-height: 1.6; }
+		input { width: 100%; box-sizing: border-box; background: #000; color: #fff; border: 1px solid #333; border-radius: 8px; padding: 12px; font-size: 16px; margin-bottom: 16px; }
+		a, .message { color: #06b6d4; }
+		button { background: #06b6d4; color: #fff; border: 0; border-radius: 8px; padding: 12px 24px; font-size: 16px; cursor: pointer; }
+	</style>
+</head>
+<body>
+	<div class="container">{{template "content" .}}</div>
+</body>
+</html>`
+
+func renderUnsubscribePage(c *gin.Context, status int, page *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
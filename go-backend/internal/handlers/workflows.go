@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+type WorkflowHandler struct {
+	workflowService *services.WorkflowService
+}
+
+func NewWorkflowHandler() *WorkflowHandler {
+	return &WorkflowHandler{
+		workflowService: services.NewWorkflowService(),
+	}
+}
+
+// workflowErrorStatus maps workflow errors to HTTP statuses
+func workflowErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWorkflowNotFound), errors.Is(err, services.ErrWorkflowRunNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWorkflow):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// POST /api/workflows
+func (h *WorkflowHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req services.WorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflow, err := h.workflowService.Create(&req, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, workflow)
+}
+
+// GET /api/workflows
+func (h *WorkflowHandler) GetAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	workflows, err := h.workflowService.GetAll(userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflows)
+}
+
+// GET /api/workflows/:id
+func (h *WorkflowHandler) GetOne(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+
+	workflow, err := h.workflowService.GetByID(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// PUT /api/workflows/:id
+func (h *WorkflowHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+
+	var req services.WorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflow, err := h.workflowService.Update(id, &req, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// DELETE /api/workflows/:id
+func (h *WorkflowHandler) Delete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+
+	if err := h.workflowService.Delete(id, userID.(uuid.UUID)); err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workflow deleted"})
+}
+
+// POST /api/workflows/:id/activate
+func (h *WorkflowHandler) Activate(c *gin.Context) {
+	h.setStatus(c, models.WorkflowActive)
+}
+
+// POST /api/workflows/:id/pause
+// Runs in progress wait at their current step until the workflow is
+// activated again.
+func (h *WorkflowHandler) Pause(c *gin.Context) {
+	h.setStatus(c, models.WorkflowPaused)
+}
+
+func (h *WorkflowHandler) setStatus(c *gin.Context, status models.WorkflowStatus) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+
+	workflow, err := h.workflowService.SetStatus(id, userID.(uuid.UUID), status)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// GET /api/workflows/:id/runs
+// Lists subscribers' runs, optionally by status or subscriberId, with how
+// many runs are in each status.
+func (h *WorkflowHandler) GetRuns(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+
+	filter := &services.WorkflowRunFilter{}
+	filter.Page, filter.PageSize = pagination(c)
+	if status := c.Query("status"); status != "" {
+		runStatus := models.WorkflowRunStatus(status)
+		filter.Status = &runStatus
+	}
+	if subscriber := c.Query("subscriberId"); subscriber != "" {
+		subscriberID, err := uuid.Parse(subscriber)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscriber ID"})
+			return
+		}
+		filter.SubscriberID = &subscriberID
+	}
+
+	runs, total, err := h.workflowService.ListRuns(id, userID.(uuid.UUID), filter)
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := h.workflowService.GetRunCounts(id, userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   runs,
+		"total":  total,
+		"page":   filter.Page,
+		"counts": counts,
+	})
+}
+
+// POST /api/workflows/:id/runs/:runId/cancel
+func (h *WorkflowHandler) CancelRun(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workflow ID"})
+		return
+	}
+	runID, err := uuid.Parse(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	if err := h.workflowService.CancelRun(id, runID, userID.(uuid.UUID)); err != nil {
+		c.JSON(workflowErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Run cancelled"})
+}
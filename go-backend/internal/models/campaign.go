@@ -12,6 +12,7 @@ const (
 	CampaignStatusDraft     CampaignStatus = "draft"
 	CampaignStatusScheduled CampaignStatus = "scheduled"
 	CampaignStatusSending   CampaignStatus = "sending"
+	CampaignStatusPaused    CampaignStatus = "paused" // held by the sending circuit breaker
 	CampaignStatusSent      CampaignStatus = "sent"
 	CampaignStatusFailed    CampaignStatus = "failed"
 )
@@ -24,27 +25,53 @@ type CampaignStats struct {
 	UniqueOpens     int `json:"uniqueOpens"`
 	Clicks          int `json:"clicks"`
 	UniqueClicks    int `json:"uniqueClicks"`
+	MachineOpens    int `json:"machineOpens"`  // opens by privacy proxies and scanners, not in Opens
+	MachineClicks   int `json:"machineClicks"` // clicks by link scanners and bots, not in Clicks
 	Bounces         int `json:"bounces"`
 	Complaints      int `json:"complaints"`
 	Unsubscribes    int `json:"unsubscribes"`
+
+	Links        []LinkStats   `json:"links,omitempty"`
+	Timeline     []StatsBucket `json:"timeline,omitempty"` // hourly, first 72 hours after sending started
+	AggregatedAt *time.Time    `json:"aggregatedAt,omitempty"`
+}
+
+// LinkStats counts human clicks on one link of a campaign
+type LinkStats struct {
+	LinkID       *uuid.UUID `json:"linkId,omitempty"`
+	URL          string     `json:"url"`
+	Clicks       int        `json:"clicks"`
+	UniqueClicks int        `json:"uniqueClicks"`
+}
+
+// StatsBucket holds the human opens and clicks of one hour after sending
+type StatsBucket struct {
+	Hour   int `json:"hour"` // hours since sending started
+	Opens  int `json:"opens"`
+	Clicks int `json:"clicks"`
 }
 
 type Campaign struct {
-	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Title        string         `gorm:"size:300;not null" json:"title"`
-	Subject      string         `gorm:"size:500;not null" json:"subject"`
-	PreviewText  *string        `gorm:"column:preview_text;size:200" json:"previewText,omitempty"`
-	Content      string         `gorm:"type:text;not null" json:"content"`
-	HTMLContent  *string        `gorm:"column:html_content;type:text" json:"htmlContent,omitempty"`
-	Status       CampaignStatus `gorm:"type:varchar(20);default:'draft'" json:"status"`
-	CreatorID    uuid.UUID      `gorm:"column:creator_id;type:uuid;not null" json:"creatorId"`
-	Creator      User           `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
-	TargetTags   []Tag          `gorm:"many2many:campaign_tags;" json:"targetTags,omitempty"`
-	ScheduledAt  *time.Time     `gorm:"column:scheduled_at" json:"scheduledAt,omitempty"`
-	SentAt       *time.Time     `gorm:"column:sent_at" json:"sentAt,omitempty"`
-	Stats        *string        `gorm:"type:jsonb" json:"stats,omitempty"` // CampaignStats as JSON
-	CreatedAt    time.Time      `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
-	UpdatedAt    time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+	ID                uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Title             string         `gorm:"size:300;not null" json:"title"`
+	Subject           string         `gorm:"size:500;not null" json:"subject"`
+	PreviewText       *string        `gorm:"column:preview_text;size:200" json:"previewText,omitempty"`
+	Content           string         `gorm:"type:text;not null" json:"content"`
+	HTMLContent       *string        `gorm:"column:html_content;type:text" json:"htmlContent,omitempty"`
+	Status            CampaignStatus `gorm:"type:varchar(20);default:'draft'" json:"status"`
+	CreatorID         uuid.UUID      `gorm:"column:creator_id;type:uuid;not null" json:"creatorId"`
+	Creator           User           `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	TargetTags        []Tag          `gorm:"many2many:campaign_tags;" json:"targetTags,omitempty"`
+	ScheduledAt       *time.Time     `gorm:"column:scheduled_at" json:"scheduledAt,omitempty"`
+	SentAt            *time.Time     `gorm:"column:sent_at" json:"sentAt,omitempty"`
+	SendWindowMinutes *int           `gorm:"column:send_window_minutes" json:"sendWindowMinutes,omitempty"`    // spread the send over this long
+	OptimizeSendTime  bool           `gorm:"column:optimize_send_time;default:false" json:"optimizeSendTime"`  // deliver at each subscriber's best hour
+	LocalSendAt       *string        `gorm:"column:local_send_at;size:16" json:"localSendAt,omitempty"`        // wall time, e.g. "2025-03-01T09:00", in each subscriber's timezone
+	DefaultTimezone   *string        `gorm:"column:default_timezone;size:64" json:"defaultTimezone,omitempty"` // for subscribers whose timezone isn't known
+	NextSendAt        *time.Time     `gorm:"column:next_send_at" json:"nextSendAt,omitempty"`                  // a rolling send waiting for its next deliveries picks up here
+	Stats             *string        `gorm:"type:jsonb" json:"stats,omitempty"`                                // CampaignStats as JSON
+	CreatedAt         time.Time      `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
 }
 
 func (Campaign) TableName() string {
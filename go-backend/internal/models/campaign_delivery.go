@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending DeliveryStatus = "pending"
+	DeliveryStatusSending DeliveryStatus = "sending"
+	DeliveryStatusSent    DeliveryStatus = "sent"
+	DeliveryStatusFailed  DeliveryStatus = "failed"
+	DeliveryStatusSkipped DeliveryStatus = "skipped" // subscriber left the list before their turn
+	DeliveryStatusHeld    DeliveryStatus = "held"    // waits for the winner of the campaign's A/B test
+)
+
+// CampaignDelivery is one recipient of a campaign send. Rows are created up
+// front when sending starts and claimed in batches by the workers, so a send
+// can resume after a restart.
+type CampaignDelivery struct {
+	ID              uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CampaignID      uuid.UUID      `gorm:"column:campaign_id;type:uuid;not null;uniqueIndex:idx_campaign_delivery_recipient;index:idx_campaign_delivery_status" json:"campaignId"`
+	Campaign        Campaign       `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
+	SubscriberID    uuid.UUID      `gorm:"column:subscriber_id;type:uuid;not null;uniqueIndex:idx_campaign_delivery_recipient" json:"subscriberId"`
+	Subscriber      Subscriber     `gorm:"foreignKey:SubscriberID;constraint:OnDelete:CASCADE" json:"-"`
+	Status          DeliveryStatus `gorm:"type:varchar(20);default:'pending';index:idx_campaign_delivery_status" json:"status"`
+	MailboxProvider string         `gorm:"column:mailbox_provider;size:20;index" json:"mailboxProvider"` // gmail, outlook, yahoo, apple, other
+	NotBefore       *time.Time     `gorm:"column:not_before" json:"notBefore,omitempty"`                 // held back by throttling or a send window
+	Timezone        *string        `gorm:"column:timezone;size:64" json:"timezone,omitempty"`            // zone a local-time send was planned in
+	VariantID       *uuid.UUID     `gorm:"column:variant_id;type:uuid;index" json:"variantId,omitempty"` // A/B test variant sent
+	MessageID       *uuid.UUID     `gorm:"column:message_id;type:uuid" json:"messageId,omitempty"`       // email_messages entry
+	Attempts        int            `gorm:"column:attempts;default:0" json:"attempts"`
+	LastError       *string        `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	ClaimedAt       *time.Time     `gorm:"column:claimed_at" json:"claimedAt,omitempty"`
+	SentAt          *time.Time     `gorm:"column:sent_at" json:"sentAt,omitempty"`
+	CreatedAt       time.Time      `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (CampaignDelivery) TableName() string {
+	return "campaign_deliveries"
+}
+
+// CampaignProgress summarises the delivery rows of a campaign
+type CampaignProgress struct {
+	CampaignID uuid.UUID      `json:"campaignId"`
+	Status     CampaignStatus `json:"status"`
+	Total      int64          `json:"total"`
+	Pending    int64          `json:"pending"`
+	Sending    int64          `json:"sending"`
+	Sent       int64          `json:"sent"`
+	Failed     int64          `json:"failed"`
+	Skipped    int64          `json:"skipped"`
+	Held       int64          `json:"held"` // waiting for an A/B test winner
+	Percent    float64        `json:"percent"`
+
+	// Local-time sends roll through the timezones; these say how far along
+	NextSendAt *time.Time         `json:"nextSendAt,omitempty"`
+	Timezones  []TimezoneProgress `json:"timezones,omitempty"`
+}
+
+// TimezoneProgress summarises the deliveries of a local-time send in one
+// timezone
+type TimezoneProgress struct {
+	Timezone string     `json:"timezone"`
+	SendAt   *time.Time `json:"sendAt,omitempty"`
+	Status   string     `json:"status"` // waiting, sending or done
+	Total    int64      `json:"total"`
+	Pending  int64      `json:"pending"`
+	Sending  int64      `json:"sending"`
+	Sent     int64      `json:"sent"`
+	Failed   int64      `json:"failed"`
+	Skipped  int64      `json:"skipped"`
+	Held     int64      `json:"held"` // waiting for the A/B test winner
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CampaignLink is a link found in a campaign's HTML. Rewritten links carry
+// its ID so clicks can be attributed per link without exposing the target
+// URL in the tracking redirect.
+type CampaignLink struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CampaignID uuid.UUID `gorm:"column:campaign_id;type:uuid;not null;uniqueIndex:idx_campaign_link_url" json:"campaignId"`
+	Campaign   Campaign  `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
+	URLHash    string    `gorm:"column:url_hash;size:64;not null;uniqueIndex:idx_campaign_link_url" json:"-"` // sha256 of URL
+	URL        string    `gorm:"column:url;type:text;not null" json:"url"`
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (CampaignLink) TableName() string {
+	return "campaign_links"
+}
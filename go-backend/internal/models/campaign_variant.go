@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CampaignVariant is one version of a campaign in an A/B test. Fields left
+// empty fall back to the campaign's own.
+type CampaignVariant struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CampaignID  uuid.UUID `gorm:"column:campaign_id;type:uuid;not null;index" json:"campaignId"`
+	Campaign    Campaign  `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
+	Name        string    `gorm:"size:50;not null" json:"name"`
+	Subject     *string   `gorm:"size:500" json:"subject,omitempty"`
+	PreviewText *string   `gorm:"column:preview_text;size:200" json:"previewText,omitempty"`
+	Content     *string   `gorm:"type:text" json:"content,omitempty"`
+	HTMLContent *string   `gorm:"column:html_content;type:text" json:"htmlContent,omitempty"`
+	FromName    *string   `gorm:"column:from_name;size:100" json:"fromName,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (CampaignVariant) TableName() string {
+	return "campaign_variants"
+}
+
+type CampaignTestStatus string
+
+const (
+	CampaignTestDraft   CampaignTestStatus = "draft"   // configured, campaign not sent yet
+	CampaignTestRunning CampaignTestStatus = "running" // test slice sent, waiting to pick a winner
+	CampaignTestDecided CampaignTestStatus = "decided" // winner sent to the remainder
+)
+
+// Metrics a test's winner can be picked by
+const (
+	TestMetricOpens   = "opens"
+	TestMetricClicks  = "clicks"
+	TestMetricRevenue = "revenue"
+)
+
+// CampaignTest is the A/B test set up on a campaign. The variants are sent to
+// Percent of the recipients; after WaitMinutes the best one by Metric goes to
+// the rest, unless the creator picked a winner first.
+type CampaignTest struct {
+	CampaignID      uuid.UUID          `gorm:"column:campaign_id;type:uuid;primaryKey" json:"campaignId"`
+	Campaign        Campaign           `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
+	Status          CampaignTestStatus `gorm:"type:varchar(20);not null;default:'draft';index" json:"status"`
+	Percent         int                `gorm:"column:percent;not null" json:"percent"`
+	WaitMinutes     int                `gorm:"column:wait_minutes;not null" json:"waitMinutes"`
+	Metric          string             `gorm:"column:metric;size:20;not null" json:"metric"`
+	EndsAt          *time.Time         `gorm:"column:ends_at;index" json:"endsAt,omitempty"`
+	WinnerVariantID *uuid.UUID         `gorm:"column:winner_variant_id;type:uuid" json:"winnerVariantId,omitempty"`
+	Confidence      *float64           `gorm:"column:confidence" json:"confidence,omitempty"` // that the winner beat the runner-up, in percent
+	DecidedAt       *time.Time         `gorm:"column:decided_at" json:"decidedAt,omitempty"`
+	DecidedBy       *uuid.UUID         `gorm:"column:decided_by;type:uuid" json:"decidedBy,omitempty"` // set when picked manually
+	CreatedAt       time.Time          `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time          `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (CampaignTest) TableName() string {
+	return "campaign_tests"
+}
+
+// VariantResult is how one variant of a test is doing
+type VariantResult struct {
+	Variant      CampaignVariant `json:"variant"`
+	Sent         int64           `json:"sent"`
+	UniqueOpens  int64           `json:"uniqueOpens"`
+	UniqueClicks int64           `json:"uniqueClicks"`
+	Revenue      int64           `json:"revenue"` // payments from recipients after sending, smallest currency unit
+	OpenRate     float64         `json:"openRate"`
+	ClickRate    float64         `json:"clickRate"`
+	RevenuePer   float64         `json:"revenuePerRecipient"`
+	Score        float64         `json:"score"`      // the test's metric, per recipient
+	Confidence   *float64        `json:"confidence"` // that the leader beats this variant, in percent; nil for the leader
+	Leader       bool            `json:"leader"`
+	Winner       bool            `json:"winner"`
+}
+
+// CampaignTestReport is a test with its variants' results
+type CampaignTestReport struct {
+	Test        CampaignTest    `json:"test"`
+	Variants    []VariantResult `json:"variants"`
+	Significant bool            `json:"significant"` // the leader beats every other variant at 95% confidence
+}
@@ -20,7 +20,7 @@ type DeliverabilityMetrics struct {
 	CreatorID        uuid.UUID `gorm:"column:creator_id;type:uuid;not null;uniqueIndex" json:"creatorId"`
 	Creator          User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
 
-	// Email counts (rolling 30-day metrics)
+	// Email counts over the last 30 days, summed from DeliverabilityDaily
 	TotalSent       int64 `gorm:"column:total_sent;default:0" json:"totalSent"`
 	TotalDelivered  int64 `gorm:"column:total_delivered;default:0" json:"totalDelivered"`
 	TotalOpened     int64 `gorm:"column:total_opened;default:0" json:"totalOpened"`
@@ -28,6 +28,10 @@ type DeliverabilityMetrics struct {
 	TotalBounced    int64 `gorm:"column:total_bounced;default:0" json:"totalBounced"`
 	TotalComplaints int64 `gorm:"column:total_complaints;default:0" json:"totalComplaints"`
 
+	// Machine opens/clicks (proxies, scanners), kept out of the totals above
+	TotalMachineOpened  int64 `gorm:"column:total_machine_opened;default:0" json:"totalMachineOpened"`
+	TotalMachineClicked int64 `gorm:"column:total_machine_clicked;default:0" json:"totalMachineClicked"`
+
 	// Rates (calculated)
 	DeliveryRate   float64 `gorm:"column:delivery_rate;default:100" json:"deliveryRate"`
 	OpenRate       float64 `gorm:"column:open_rate;default:0" json:"openRate"`
@@ -52,6 +56,62 @@ func (DeliverabilityMetrics) TableName() string {
 	return "deliverability_metrics"
 }
 
+// DeliverabilityDaily holds one creator's sending counters for one UTC day.
+// Rolling windows and reputation are computed from these rows.
+type DeliverabilityDaily struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID uuid.UUID `gorm:"column:creator_id;type:uuid;not null;uniqueIndex:idx_deliverability_daily_day" json:"creatorId"`
+	Creator   User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Day       time.Time `gorm:"column:day;type:date;not null;uniqueIndex:idx_deliverability_daily_day" json:"day"`
+
+	Sent           int64 `gorm:"column:sent;default:0" json:"sent"`
+	Delivered      int64 `gorm:"column:delivered;default:0" json:"delivered"`
+	Opened         int64 `gorm:"column:opened;default:0" json:"opened"`
+	Clicked        int64 `gorm:"column:clicked;default:0" json:"clicked"`
+	MachineOpened  int64 `gorm:"column:machine_opened;default:0" json:"machineOpened"`
+	MachineClicked int64 `gorm:"column:machine_clicked;default:0" json:"machineClicked"`
+	Bounced        int64 `gorm:"column:bounced;default:0" json:"bounced"`
+	HardBounces    int64 `gorm:"column:hard_bounces;default:0" json:"hardBounces"`
+	SoftBounces    int64 `gorm:"column:soft_bounces;default:0" json:"softBounces"`
+	Complaints     int64 `gorm:"column:complaints;default:0" json:"complaints"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (DeliverabilityDaily) TableName() string {
+	return "deliverability_daily"
+}
+
+// ReputationSnapshot records a creator's reputation over a rolling window as
+// of one day, so reputation can be charted over time
+type ReputationSnapshot struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID  uuid.UUID `gorm:"column:creator_id;type:uuid;not null;uniqueIndex:idx_reputation_snapshot_day" json:"creatorId"`
+	Creator    User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Day        time.Time `gorm:"column:day;type:date;not null;uniqueIndex:idx_reputation_snapshot_day" json:"day"`
+	WindowDays int       `gorm:"column:window_days;not null;uniqueIndex:idx_reputation_snapshot_day" json:"windowDays"` // 7, 30 or 90
+
+	Sent       int64 `gorm:"column:sent;default:0" json:"sent"`
+	Delivered  int64 `gorm:"column:delivered;default:0" json:"delivered"`
+	Bounced    int64 `gorm:"column:bounced;default:0" json:"bounced"`
+	Complaints int64 `gorm:"column:complaints;default:0" json:"complaints"`
+
+	DeliveryRate    float64 `gorm:"column:delivery_rate;default:0" json:"deliveryRate"`
+	OpenRate        float64 `gorm:"column:open_rate;default:0" json:"openRate"`
+	ClickRate       float64 `gorm:"column:click_rate;default:0" json:"clickRate"`
+	BounceRate      float64 `gorm:"column:bounce_rate;default:0" json:"bounceRate"`
+	ComplaintRate   float64 `gorm:"column:complaint_rate;default:0" json:"complaintRate"`
+	ReputationScore float64 `gorm:"column:reputation_score;default:100" json:"reputationScore"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (ReputationSnapshot) TableName() string {
+	return "reputation_snapshots"
+}
+
 // DNSRecord stores DNS configuration status for custom domains
 type DNSRecord struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
@@ -78,16 +138,40 @@ func (DNSRecord) TableName() string {
 	return "dns_records"
 }
 
+// DKIMKey holds the signing key for a sending domain. Its public half is
+// published through the DKIM DNSRecord row for the same domain. Each creator
+// claiming a domain has their own key; only the verified owner's signs.
+type DKIMKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID  *uuid.UUID `gorm:"column:creator_id;type:uuid;index;uniqueIndex:idx_dkim_key_creator_domain" json:"creatorId,omitempty"` // nil for platform-owned domains
+	Creator    *User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Domain     string     `gorm:"column:domain;size:255;not null;index:idx_dkim_key_domain;uniqueIndex:idx_dkim_key_creator_domain" json:"domain"`
+	Selector   string     `gorm:"column:selector;size:63;not null" json:"selector"`
+	PrivateKey string     `gorm:"column:private_key;type:text;not null" json:"-"` // PEM, encrypted with ENCRYPTION_KEY
+	PublicKey  string     `gorm:"column:public_key;type:text;not null" json:"publicKey"` // DNS TXT value
+	IsActive   bool       `gorm:"column:is_active;default:true" json:"isActive"`
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (DKIMKey) TableName() string {
+	return "dkim_keys"
+}
+
 // InboxPlacement tracks inbox vs spam placement per provider
 type InboxPlacement struct {
 	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	CreatorID  uuid.UUID `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
 	Creator    User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
-	CampaignID uuid.UUID `gorm:"column:campaign_id;type:uuid;not null;index" json:"campaignId"`
+	CampaignID uuid.UUID `gorm:"column:campaign_id;type:uuid;not null;index;uniqueIndex:idx_inbox_placement_campaign_provider" json:"campaignId"`
 	Campaign   Campaign  `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
 
 	// Provider (gmail, outlook, yahoo, etc.)
-	Provider string `gorm:"column:provider;size:50;not null;index" json:"provider"`
+	Provider string `gorm:"column:provider;size:50;not null;index;uniqueIndex:idx_inbox_placement_campaign_provider" json:"provider"`
+
+	// Where the counts come from: "seed" for seed mailbox results, otherwise
+	// "estimate" from recipient engagement
+	Source string `gorm:"column:source;size:20;not null;default:'estimate'" json:"source"`
 
 	// Placement stats
 	TotalSent   int `gorm:"column:total_sent;default:0" json:"totalSent"`
@@ -95,6 +179,9 @@ type InboxPlacement struct {
 	SpamCount   int `gorm:"column:spam_count;default:0" json:"spamCount"`
 	UnknownCount int `gorm:"column:unknown_count;default:0" json:"unknownCount"`
 
+	// Part of InboxCount that landed in a promotions tab or folder (seeds only)
+	PromotionsCount int `gorm:"column:promotions_count;default:0" json:"promotionsCount"`
+
 	// Calculated placement rate
 	InboxRate float64 `gorm:"column:inbox_rate;default:0" json:"inboxRate"`
 
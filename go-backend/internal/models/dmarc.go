@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DMARCReport is one aggregate (RUA) report a mailbox provider sent about a
+// creator's domain
+type DMARCReport struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID   uuid.UUID  `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
+	Creator     User       `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	DNSRecordID *uuid.UUID `gorm:"column:dns_record_id;type:uuid;index" json:"dnsRecordId,omitempty"` // the domain's DMARC record
+	Domain      string     `gorm:"column:domain;size:255;not null;index" json:"domain"`
+
+	OrgName  string    `gorm:"column:org_name;size:255;not null;uniqueIndex:idx_dmarc_report_org_id" json:"orgName"`
+	ReportID string    `gorm:"column:report_id;size:255;not null;uniqueIndex:idx_dmarc_report_org_id" json:"reportId"`
+	Email    string    `gorm:"column:email;size:255" json:"email,omitempty"`
+	BeginAt  time.Time `gorm:"column:begin_at;not null;index" json:"beginAt"`
+	EndAt    time.Time `gorm:"column:end_at;not null" json:"endAt"`
+
+	// Policy as the reporter saw it published
+	Policy          string `gorm:"column:policy;size:20" json:"policy"`
+	SubdomainPolicy string `gorm:"column:subdomain_policy;size:20" json:"subdomainPolicy,omitempty"`
+	ADKIM           string `gorm:"column:adkim;size:1" json:"adkim,omitempty"`
+	ASPF            string `gorm:"column:aspf;size:1" json:"aspf,omitempty"`
+	Percent         int    `gorm:"column:percent;default:100" json:"percent"`
+
+	MessageCount int64     `gorm:"column:message_count;default:0" json:"messageCount"`
+	PassCount    int64     `gorm:"column:pass_count;default:0" json:"passCount"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (DMARCReport) TableName() string {
+	return "dmarc_reports"
+}
+
+// DMARCRecord is one row of an aggregate report: the messages a source IP
+// sent with the same identifiers and results
+type DMARCRecord struct {
+	ID        uuid.UUID   `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	ReportID  uuid.UUID   `gorm:"column:report_id;type:uuid;not null;index" json:"reportId"`
+	Report    DMARCReport `gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatorID uuid.UUID   `gorm:"column:creator_id;type:uuid;not null;index:idx_dmarc_record_creator_source" json:"creatorId"`
+	Domain    string      `gorm:"column:domain;size:255;not null" json:"domain"`
+	SourceIP  string      `gorm:"column:source_ip;size:45;not null;index:idx_dmarc_record_creator_source" json:"sourceIp"`
+	Count     int64       `gorm:"column:count;not null" json:"count"`
+
+	// policy_evaluated: results after alignment, and what the receiver did
+	Disposition string `gorm:"column:disposition;size:20" json:"disposition"`
+	DKIMAligned bool   `gorm:"column:dkim_aligned" json:"dkimAligned"`
+	SPFAligned  bool   `gorm:"column:spf_aligned" json:"spfAligned"`
+	Passed      bool   `gorm:"column:passed;index" json:"passed"` // DKIM or SPF passed aligned
+
+	HeaderFrom   string `gorm:"column:header_from;size:255" json:"headerFrom"`
+	EnvelopeFrom string `gorm:"column:envelope_from;size:255" json:"envelopeFrom,omitempty"`
+	DKIMDomain   string `gorm:"column:dkim_domain;size:255" json:"dkimDomain,omitempty"`
+	DKIMResult   string `gorm:"column:dkim_result;size:20" json:"dkimResult,omitempty"`
+	SPFDomain    string `gorm:"column:spf_domain;size:255" json:"spfDomain,omitempty"`
+	SPFResult    string `gorm:"column:spf_result;size:20" json:"spfResult,omitempty"`
+
+	BeginAt   time.Time `gorm:"column:begin_at;not null;index" json:"beginAt"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (DMARCRecord) TableName() string {
+	return "dmarc_records"
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MessageStatus string
+
+const (
+	MessageStatusQueued    MessageStatus = "queued"
+	MessageStatusSent      MessageStatus = "sent"
+	MessageStatusDeferred  MessageStatus = "deferred"
+	MessageStatusDelivered MessageStatus = "delivered"
+	MessageStatusBounced   MessageStatus = "bounced"
+	MessageStatusFailed    MessageStatus = "failed"
+)
+
+// messageStatusRank orders statuses so late or out-of-order provider events
+// never move a message backwards (e.g. a deferral arriving after delivery)
+var messageStatusRank = map[MessageStatus]int{
+	MessageStatusQueued:    0,
+	MessageStatusSent:      1,
+	MessageStatusDeferred:  2,
+	MessageStatusDelivered: 3,
+	MessageStatusFailed:    3,
+	MessageStatusBounced:   4,
+}
+
+// Supersedes reports whether status s may replace the current status
+func (s MessageStatus) Supersedes(current MessageStatus) bool {
+	return messageStatusRank[s] > messageStatusRank[current]
+}
+
+// EmailMessage is the log entry for a single outbound email
+type EmailMessage struct {
+	ID                uuid.UUID     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID         *uuid.UUID    `gorm:"column:creator_id;type:uuid;index" json:"creatorId,omitempty"`
+	CampaignID        *uuid.UUID    `gorm:"column:campaign_id;type:uuid;index" json:"campaignId,omitempty"`
+	SubscriberID      *uuid.UUID    `gorm:"column:subscriber_id;type:uuid;index" json:"subscriberId,omitempty"`
+	Recipient         string        `gorm:"column:recipient;size:255;not null;index" json:"recipient"`
+	Subject           string        `gorm:"column:subject;size:500" json:"subject"`
+	Class             MessageClass  `gorm:"column:class;type:varchar(20)" json:"class"`
+	Provider          *string       `gorm:"column:provider;size:30" json:"provider,omitempty"`
+	ProviderMessageID *string       `gorm:"column:provider_message_id;size:255;index" json:"providerMessageId,omitempty"`
+	Status            MessageStatus `gorm:"type:varchar(20);default:'queued';index" json:"status"`
+	Attempts          int           `gorm:"column:attempts;default:0" json:"attempts"`
+	LastError         *string       `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	SentAt            *time.Time    `gorm:"column:sent_at" json:"sentAt,omitempty"`
+	DeliveredAt       *time.Time    `gorm:"column:delivered_at" json:"deliveredAt,omitempty"`
+	LastEventAt       *time.Time    `gorm:"column:last_event_at" json:"lastEventAt,omitempty"`
+	CreatedAt         time.Time     `gorm:"column:created_at;autoCreateTime;index" json:"createdAt"`
+	UpdatedAt         time.Time     `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (EmailMessage) TableName() string {
+	return "email_messages"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FailedJob is the dead-letter record of a background job that exhausted its
+// retries or failed permanently
+type FailedJob struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	JobID     uuid.UUID  `gorm:"column:job_id;type:uuid;not null;index" json:"jobId"`
+	JobType   string     `gorm:"column:job_type;size:50;not null;index" json:"jobType"`
+	Payload   string     `gorm:"type:jsonb;not null" json:"payload"`
+	Attempts  int        `gorm:"column:attempts;not null" json:"attempts"`
+	Error     string     `gorm:"column:error;type:text" json:"error"`
+	FailedAt  time.Time  `gorm:"column:failed_at;autoCreateTime;index" json:"failedAt"`
+	RetriedAt *time.Time `gorm:"column:retried_at" json:"retriedAt,omitempty"`
+}
+
+func (FailedJob) TableName() string {
+	return "failed_jobs"
+}
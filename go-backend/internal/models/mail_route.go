@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageClass separates one-off transactional mail from bulk campaign mail
+type MessageClass string
+
+const (
+	MessageClassTransactional MessageClass = "transactional"
+	MessageClassBulk          MessageClass = "bulk"
+)
+
+// MailRoute selects the email provider used for a message class.
+// A nil CreatorID makes the route the platform-wide default.
+type MailRoute struct {
+	ID               uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID        *uuid.UUID   `gorm:"column:creator_id;type:uuid;index" json:"creatorId,omitempty"`
+	Creator          *User        `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Class            MessageClass `gorm:"column:class;type:varchar(20);not null" json:"class"`
+	Provider         string       `gorm:"column:provider;size:30;not null" json:"provider"`
+	FallbackProvider *string      `gorm:"column:fallback_provider;size:30" json:"fallbackProvider,omitempty"`
+	CreatedAt        time.Time    `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt        time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (MailRoute) TableName() string {
+	return "mail_routes"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// MailboxClaim marks an IMAP mailbox as being read by one worker, so several
+// instances don't poll the same mailbox at once
+type MailboxClaim struct {
+	Mailbox   string    `gorm:"column:mailbox;size:100;primaryKey" json:"mailbox"` // e.g. "seed:<id>" or "return-path"
+	ClaimedAt time.Time `gorm:"column:claimed_at;not null" json:"claimedAt"`
+}
+
+func (MailboxClaim) TableName() string {
+	return "mailbox_claims"
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProviderEvent records each inbound provider webhook event once. The unique
+// (provider, event_id) pair makes redelivered events a no-op.
+type ProviderEvent struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Provider          string     `gorm:"column:provider;size:30;not null;uniqueIndex:idx_provider_event" json:"provider"`
+	EventID           string     `gorm:"column:event_id;size:255;not null;uniqueIndex:idx_provider_event" json:"eventId"`
+	EventType         string     `gorm:"column:event_type;size:30;not null;index" json:"eventType"`
+	MessageID         *uuid.UUID `gorm:"column:message_id;type:uuid;index" json:"messageId,omitempty"` // email_messages entry
+	ProviderMessageID *string    `gorm:"column:provider_message_id;size:255" json:"providerMessageId,omitempty"`
+	Email             string     `gorm:"column:email;size:255" json:"email"`
+	Payload           *string    `gorm:"type:jsonb" json:"payload,omitempty"`
+	OccurredAt        time.Time  `gorm:"column:occurred_at;index" json:"occurredAt"`
+	ProcessedAt       *time.Time `gorm:"column:processed_at" json:"processedAt,omitempty"`
+	IgnoredReason     *string    `gorm:"column:ignored_reason;size:255" json:"ignoredReason,omitempty"` // why a handled event changed nothing
+	CreatedAt         time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (ProviderEvent) TableName() string {
+	return "provider_events"
+}
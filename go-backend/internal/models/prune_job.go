@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PruneJobStatus string
+
+const (
+	PruneJobPreview   PruneJobStatus = "preview"   // counted, waiting for the creator to confirm
+	PruneJobQueued    PruneJobStatus = "queued"    // confirmed, waiting for a worker
+	PruneJobRunning   PruneJobStatus = "running"   // a worker is archiving or deleting
+	PruneJobCompleted PruneJobStatus = "completed" // done; archive jobs can still be undone
+	PruneJobFailed    PruneJobStatus = "failed"
+	PruneJobCancelled PruneJobStatus = "cancelled" // preview discarded or expired
+	PruneJobUndone    PruneJobStatus = "undone"    // archived subscribers were restored
+)
+
+type PruneMode string
+
+const (
+	PruneModeArchive PruneMode = "archive" // mark unsubscribed; restorable
+	PruneModeDelete  PruneMode = "delete"  // permanent removal
+)
+
+// PruneJob removes a creator's unengaged subscribers in the background. The
+// cutoff is fixed when the preview is taken, so confirming later prunes the
+// audience the creator was shown rather than whoever has gone quiet since.
+type PruneJob struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID   uuid.UUID      `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
+	Creator     User           `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Status      PruneJobStatus `gorm:"type:varchar(20);not null;default:'preview';index" json:"status"`
+	Mode        PruneMode      `gorm:"type:varchar(20);not null;default:'archive'" json:"mode"`
+	Cutoff      time.Time      `gorm:"column:cutoff;not null" json:"cutoff"` // no opens since
+	RequestedBy uuid.UUID      `gorm:"column:requested_by;type:uuid;not null" json:"requestedBy"`
+
+	Candidates int64   `gorm:"column:candidates;default:0" json:"candidates"` // matching at preview time
+	Pruned     int64   `gorm:"column:pruned;default:0" json:"pruned"`
+	Restored   int64   `gorm:"column:restored;default:0" json:"restored"`
+	Error      *string `gorm:"column:error;type:text" json:"error,omitempty"`
+
+	ConfirmedAt *time.Time `gorm:"column:confirmed_at" json:"confirmedAt,omitempty"`
+	StartedAt   *time.Time `gorm:"column:started_at" json:"startedAt,omitempty"`
+	CompletedAt *time.Time `gorm:"column:completed_at" json:"completedAt,omitempty"`
+	UndoneAt    *time.Time `gorm:"column:undone_at" json:"undoneAt,omitempty"`
+	UndoneBy    *uuid.UUID `gorm:"column:undone_by;type:uuid" json:"undoneBy,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (PruneJob) TableName() string {
+	return "prune_jobs"
+}
+
+// PrunedSubscriber records a subscriber an archive job unsubscribed, so the
+// job can be undone without touching people who unsubscribed on their own
+type PrunedSubscriber struct {
+	JobID        uuid.UUID `gorm:"column:job_id;type:uuid;primaryKey" json:"jobId"`
+	SubscriberID uuid.UUID `gorm:"column:subscriber_id;type:uuid;primaryKey;index" json:"subscriberId"`
+	ArchivedAt   time.Time `gorm:"column:archived_at;not null" json:"archivedAt"`
+}
+
+func (PrunedSubscriber) TableName() string {
+	return "pruned_subscribers"
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SeedMailbox is a test inbox a creator owns at a mailbox provider. Every
+// campaign is also sent to the creator's seeds, and the seeds are read over
+// IMAP to see which folder the campaign landed in.
+type SeedMailbox struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID uuid.UUID `gorm:"column:creator_id;type:uuid;not null;index;uniqueIndex:idx_seed_mailbox_creator_email" json:"creatorId"`
+	Creator   User      `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Email     string    `gorm:"column:email;size:255;not null;uniqueIndex:idx_seed_mailbox_creator_email" json:"email"`
+	Provider  string    `gorm:"column:provider;size:50;not null" json:"provider"`
+
+	// IMAP access
+	IMAPHost string `gorm:"column:imap_host;size:255;not null" json:"imapHost"`
+	IMAPPort int    `gorm:"column:imap_port;not null;default:993" json:"imapPort"`
+	IMAPTLS  bool   `gorm:"column:imap_tls;not null;default:true" json:"imapTls"`
+	Username string `gorm:"column:username;size:255;not null" json:"username"`
+	Password string `gorm:"column:password;type:text;not null" json:"-"`
+
+	// Folder overrides; empty means detect from the server's folder list
+	InboxFolder      string `gorm:"column:inbox_folder;size:255" json:"inboxFolder,omitempty"`
+	SpamFolder       string `gorm:"column:spam_folder;size:255" json:"spamFolder,omitempty"`
+	PromotionsFolder string `gorm:"column:promotions_folder;size:255" json:"promotionsFolder,omitempty"`
+
+	IsActive      bool       `gorm:"column:is_active;default:true" json:"isActive"`
+	LastCheckedAt *time.Time `gorm:"column:last_checked_at" json:"lastCheckedAt,omitempty"`
+	LastError     *string    `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (SeedMailbox) TableName() string {
+	return "seed_mailboxes"
+}
+
+type SeedPlacementStatus string
+
+const (
+	SeedPlacementPending    SeedPlacementStatus = "pending"    // not sent yet, or sent and not found yet
+	SeedPlacementInbox      SeedPlacementStatus = "inbox"      // found in the primary inbox
+	SeedPlacementPromotions SeedPlacementStatus = "promotions" // found in a promotions tab or folder
+	SeedPlacementSpam       SeedPlacementStatus = "spam"       // found in the spam or junk folder
+	SeedPlacementMissing    SeedPlacementStatus = "missing"    // not found before polling gave up
+	SeedPlacementFailed     SeedPlacementStatus = "failed"     // the send itself failed
+)
+
+// SeedPlacement is where one campaign landed in one seed mailbox. The token
+// is sent in the X-Seed-Token header and searched for over IMAP.
+type SeedPlacement struct {
+	ID            uuid.UUID           `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CampaignID    uuid.UUID           `gorm:"column:campaign_id;type:uuid;not null;index;uniqueIndex:idx_seed_placement_campaign_seed" json:"campaignId"`
+	Campaign      Campaign            `gorm:"foreignKey:CampaignID;constraint:OnDelete:CASCADE" json:"-"`
+	SeedMailboxID uuid.UUID           `gorm:"column:seed_mailbox_id;type:uuid;not null;uniqueIndex:idx_seed_placement_campaign_seed" json:"seedMailboxId"`
+	SeedMailbox   SeedMailbox         `gorm:"foreignKey:SeedMailboxID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatorID     uuid.UUID           `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
+	Email         string              `gorm:"column:email;size:255;not null" json:"email"`
+	Provider      string              `gorm:"column:provider;size:50;not null" json:"provider"`
+	Token         string              `gorm:"column:token;size:64;not null;uniqueIndex" json:"-"`
+	Status        SeedPlacementStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Folder        string              `gorm:"column:folder;size:255" json:"folder,omitempty"`
+	Checks        int                 `gorm:"column:checks;default:0" json:"checks"`
+	LastError     *string             `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+
+	SentAt    *time.Time `gorm:"column:sent_at" json:"sentAt,omitempty"`
+	CheckedAt *time.Time `gorm:"column:checked_at" json:"checkedAt,omitempty"`
+	FoundAt   *time.Time `gorm:"column:found_at" json:"foundAt,omitempty"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (SeedPlacement) TableName() string {
+	return "seed_placements"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubscriberSendProfile is when a subscriber tends to open mail, built from
+// their human opens. Hours are UTC.
+type SubscriberSendProfile struct {
+	SubscriberID uuid.UUID  `gorm:"column:subscriber_id;type:uuid;primaryKey" json:"subscriberId"`
+	Subscriber   Subscriber `gorm:"foreignKey:SubscriberID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatorID    uuid.UUID  `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
+	OpenHours    []int      `gorm:"column:open_hours;type:jsonb;serializer:json" json:"openHours"` // opens per UTC hour, 24 buckets
+	Opens        int        `gorm:"column:opens;default:0" json:"opens"`
+	BestHour     *int       `gorm:"column:best_hour" json:"bestHour,omitempty"`   // UTC hour to send at, once there are enough opens
+	UTCOffset    *int       `gorm:"column:utc_offset" json:"utcOffset,omitempty"` // inferred timezone, hours east of UTC
+	LastOpenAt   *time.Time `gorm:"column:last_open_at" json:"lastOpenAt,omitempty"`
+	CreatedAt    time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (SubscriberSendProfile) TableName() string {
+	return "subscriber_send_profiles"
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SenderDomainStatus string
+
+const (
+	SenderDomainPending  SenderDomainStatus = "pending"  // records not published or not yet passing
+	SenderDomainVerified SenderDomainStatus = "verified" // SPF, DKIM and DMARC all pass
+	SenderDomainFailing  SenderDomainStatus = "failing"  // was verified, a re-check found a regression
+)
+
+// SenderDomain is a domain a creator sends from. Its DKIM key lives in
+// dkim_keys and the records to publish in dns_records. Any number of creators
+// may claim a domain, but only one can hold it verified (or failing).
+type SenderDomain struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID    uuid.UUID          `gorm:"column:creator_id;type:uuid;not null;index;uniqueIndex:idx_sender_domain_creator_domain" json:"creatorId"`
+	Creator      User               `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Domain       string             `gorm:"column:domain;size:255;not null;uniqueIndex:idx_sender_domain_creator_domain;uniqueIndex:idx_sender_domain_owner,where:status <> 'pending'" json:"domain"`
+	Status       SenderDomainStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	DKIMSelector string             `gorm:"column:dkim_selector;size:63;not null" json:"dkimSelector"`
+
+	// Results of the last check
+	SPFValid     bool     `gorm:"column:spf_valid;default:false" json:"spfValid"`
+	SPFLookups   int      `gorm:"column:spf_lookups;default:0" json:"spfLookups"`
+	DKIMValid    bool     `gorm:"column:dkim_valid;default:false" json:"dkimValid"`
+	DMARCValid   bool     `gorm:"column:dmarc_valid;default:false" json:"dmarcValid"`
+	DMARCPolicy  string   `gorm:"column:dmarc_policy;size:20" json:"dmarcPolicy,omitempty"`
+	DMARCAligned bool     `gorm:"column:dmarc_aligned;default:false" json:"dmarcAligned"`
+	Issues       []string `gorm:"column:issues;type:jsonb;serializer:json" json:"issues,omitempty"`
+
+	LastCheckedAt *time.Time `gorm:"column:last_checked_at;index" json:"lastCheckedAt,omitempty"`
+	VerifiedAt    *time.Time `gorm:"column:verified_at" json:"verifiedAt,omitempty"`
+	FailingSince  *time.Time `gorm:"column:failing_since" json:"failingSince,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (SenderDomain) TableName() string {
+	return "sender_domains"
+}
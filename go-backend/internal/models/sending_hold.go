@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type HoldScope string
+
+const (
+	HoldScopePlatform HoldScope = "platform" // all bulk sending
+	HoldScopeCreator  HoldScope = "creator"  // every campaign of one creator
+	HoldScopeCampaign HoldScope = "campaign" // one in-flight campaign
+)
+
+type HoldStatus string
+
+const (
+	HoldStatusActive   HoldStatus = "active"
+	HoldStatusReleased HoldStatus = "released"
+)
+
+// SendingHold pauses bulk sending after bounce or complaint rates crossed
+// their limits. Holds stay active until an admin releases them.
+type SendingHold struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Scope      HoldScope  `gorm:"type:varchar(20);not null;index" json:"scope"`
+	CreatorID  *uuid.UUID `gorm:"column:creator_id;type:uuid;index" json:"creatorId,omitempty"`
+	CampaignID *uuid.UUID `gorm:"column:campaign_id;type:uuid;index" json:"campaignId,omitempty"`
+	Status     HoldStatus `gorm:"type:varchar(20);not null;default:'active';index" json:"status"`
+
+	// What tripped the breaker, measured over the sliding window
+	Reason        string  `gorm:"column:reason;size:50;not null" json:"reason"` // bounce_rate, complaint_rate
+	Sent          int64   `gorm:"column:sent" json:"sent"`
+	Bounces       int64   `gorm:"column:bounces" json:"bounces"`
+	Complaints    int64   `gorm:"column:complaints" json:"complaints"`
+	BounceRate    float64 `gorm:"column:bounce_rate" json:"bounceRate"`
+	ComplaintRate float64 `gorm:"column:complaint_rate" json:"complaintRate"`
+	Limit         float64 `gorm:"column:limit_rate" json:"limit"`
+
+	ReleasedBy  *uuid.UUID `gorm:"column:released_by;type:uuid" json:"releasedBy,omitempty"`
+	ReleasedAt  *time.Time `gorm:"column:released_at" json:"releasedAt,omitempty"`
+	ReleaseNote *string    `gorm:"column:release_note;type:text" json:"releaseNote,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (SendingHold) TableName() string {
+	return "sending_holds"
+}
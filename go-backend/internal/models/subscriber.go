@@ -15,6 +15,14 @@ const (
 	SubscriberStatusComplaint    SubscriberStatus = "complaint"
 )
 
+// Where a subscriber's timezone came from. GeoIP guesses never replace one
+// set through the API or the preference center.
+const (
+	TimezoneSourceAPI         = "api"
+	TimezoneSourceGeoIP       = "geoip"
+	TimezoneSourcePreferences = "preferences"
+)
+
 type Subscriber struct {
 	ID               uuid.UUID        `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	Email            string           `gorm:"size:255;not null;index:idx_subscriber_email_creator,unique" json:"email"`
@@ -29,6 +37,9 @@ type Subscriber struct {
 	Metadata         *string          `gorm:"type:jsonb" json:"metadata,omitempty"`
 	SubscribedAt     time.Time        `gorm:"column:subscribed_at;autoCreateTime" json:"subscribedAt"`
 	UnsubscribedAt   *time.Time       `gorm:"column:unsubscribed_at" json:"unsubscribedAt,omitempty"`
+	Timezone         *string          `gorm:"column:timezone;size:64" json:"timezone,omitempty"` // IANA name, e.g. "Africa/Nairobi"
+	TimezoneSource   *string          `gorm:"column:timezone_source;size:20" json:"timezoneSource,omitempty"`
+	SignupIP         *string          `gorm:"column:signup_ip;size:45" json:"-"`
 	CreatedAt        time.Time        `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
 	UpdatedAt        time.Time        `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
 
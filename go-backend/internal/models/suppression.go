@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SuppressionReason string
+
+const (
+	SuppressionReasonHardBounce SuppressionReason = "hard_bounce"
+	SuppressionReasonComplaint  SuppressionReason = "complaint"
+	SuppressionReasonManual     SuppressionReason = "manual"
+	SuppressionReasonLegal      SuppressionReason = "legal_request"
+)
+
+// IsValid reports whether r is a known suppression reason
+func (r SuppressionReason) IsValid() bool {
+	switch r {
+	case SuppressionReasonHardBounce, SuppressionReasonComplaint, SuppressionReasonManual, SuppressionReasonLegal:
+		return true
+	}
+	return false
+}
+
+// Suppression blocks all mail to an address. Entries without a creator apply
+// platform-wide; the others only to that creator's sends.
+type Suppression struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Email     string            `gorm:"column:email;size:255;not null;uniqueIndex:idx_suppression_creator_email,where:creator_id IS NOT NULL;uniqueIndex:idx_suppression_global_email,where:creator_id IS NULL" json:"email"` // normalized
+	CreatorID *uuid.UUID        `gorm:"column:creator_id;type:uuid;uniqueIndex:idx_suppression_creator_email,where:creator_id IS NOT NULL" json:"creatorId,omitempty"`
+	Reason    SuppressionReason `gorm:"type:varchar(20);not null;index" json:"reason"`
+	Source    string            `gorm:"column:source;size:50" json:"source"` // bounce, complaint, api, import
+	Note      *string           `gorm:"column:note;type:text" json:"note,omitempty"`
+	CreatedBy *uuid.UUID        `gorm:"column:created_by;type:uuid" json:"createdBy,omitempty"`
+	CreatedAt time.Time         `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+}
+
+func (Suppression) TableName() string {
+	return "suppressions"
+}
+
+type SuppressionAction string
+
+const (
+	SuppressionActionAdded   SuppressionAction = "added"
+	SuppressionActionRemoved SuppressionAction = "removed"
+)
+
+// SuppressionAudit records who added or removed a suppression entry. It is
+// kept after the entry itself is deleted.
+type SuppressionAudit struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Email     string            `gorm:"column:email;size:255;not null;index" json:"email"`
+	CreatorID *uuid.UUID        `gorm:"column:creator_id;type:uuid;index" json:"creatorId,omitempty"`
+	Action    SuppressionAction `gorm:"type:varchar(20);not null" json:"action"`
+	Reason    SuppressionReason `gorm:"type:varchar(20)" json:"reason"`
+	Source    string            `gorm:"column:source;size:50" json:"source"`
+	Note      *string           `gorm:"column:note;type:text" json:"note,omitempty"`
+	ActorID   *uuid.UUID        `gorm:"column:actor_id;type:uuid" json:"actorId,omitempty"` // nil for automatic entries
+	CreatedAt time.Time         `gorm:"column:created_at;autoCreateTime;index" json:"createdAt"`
+}
+
+func (SuppressionAudit) TableName() string {
+	return "suppression_audits"
+}
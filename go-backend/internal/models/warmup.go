@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WarmupStatus string
+
+const (
+	WarmupStatusActive    WarmupStatus = "active"
+	WarmupStatusCompleted WarmupStatus = "completed" // ramp finished, no cap
+	WarmupStatusDisabled  WarmupStatus = "disabled"  // switched off by an admin
+)
+
+// WarmupPlan caps how much a creator may send per day from a sending domain
+// while its reputation is built up. The cap ramps from InitialDailyLimit to
+// TargetDailyLimit over Days days, unless DailyLimits spells the caps out.
+type WarmupPlan struct {
+	ID                uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID         uuid.UUID    `gorm:"column:creator_id;type:uuid;not null;uniqueIndex:idx_warmup_plan_domain" json:"creatorId"`
+	Creator           User         `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Domain            string       `gorm:"column:domain;size:255;not null;uniqueIndex:idx_warmup_plan_domain" json:"domain"` // empty for the platform's shared domain
+	Status            WarmupStatus `gorm:"type:varchar(20);not null;default:'active';index" json:"status"`
+	StartDate         time.Time    `gorm:"column:start_date;type:date;not null" json:"startDate"`
+	Days              int          `gorm:"column:days;not null" json:"days"`
+	InitialDailyLimit int          `gorm:"column:initial_daily_limit;not null" json:"initialDailyLimit"`
+	TargetDailyLimit  int          `gorm:"column:target_daily_limit;not null" json:"targetDailyLimit"`
+	DailyLimits       []int        `gorm:"column:daily_limits;type:jsonb;serializer:json" json:"dailyLimits,omitempty"` // explicit per-day caps set by an admin
+	OverriddenBy      *uuid.UUID   `gorm:"column:overridden_by;type:uuid" json:"overriddenBy,omitempty"`
+	OverrideNote      *string      `gorm:"column:override_note;type:text" json:"overrideNote,omitempty"`
+	CreatedAt         time.Time    `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (WarmupPlan) TableName() string {
+	return "warmup_plans"
+}
+
+// WarmupUsage tracks one day of a warm-up plan. Reserved counts the
+// recipients scheduled for the day, Sent those actually sent.
+type WarmupUsage struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	PlanID    uuid.UUID  `gorm:"column:plan_id;type:uuid;not null;uniqueIndex:idx_warmup_usage_day" json:"planId"`
+	Plan      WarmupPlan `gorm:"foreignKey:PlanID;constraint:OnDelete:CASCADE" json:"-"`
+	Day       time.Time  `gorm:"column:day;type:date;not null;uniqueIndex:idx_warmup_usage_day" json:"day"`
+	Reserved  int64      `gorm:"column:reserved;default:0" json:"reserved"`
+	Sent      int64      `gorm:"column:sent;default:0" json:"sent"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (WarmupUsage) TableName() string {
+	return "warmup_usage"
+}
@@ -12,10 +12,13 @@ const (
 	WebhookEventSubscriberCreated   WebhookEventType = "subscriber.created"
 	WebhookEventSubscriberDeleted   WebhookEventType = "subscriber.deleted"
 	WebhookEventCampaignSent        WebhookEventType = "campaign.sent"
+	WebhookEventCampaignPaused      WebhookEventType = "campaign.paused"
+	WebhookEventDomainFailing       WebhookEventType = "domain.failing"
 	WebhookEventPaymentSuccess      WebhookEventType = "payment.success"
 	WebhookEventPaymentFailed       WebhookEventType = "payment.failed"
 	WebhookEventSubscriptionCreated WebhookEventType = "subscription.created"
 	WebhookEventSubscriptionExpired WebhookEventType = "subscription.expired"
+	WebhookEventWorkflowStep        WebhookEventType = "workflow.step" // sent by workflow webhook steps
 )
 
 type Webhook struct {
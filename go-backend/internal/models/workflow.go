@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WorkflowStatus string
+
+const (
+	WorkflowDraft  WorkflowStatus = "draft"
+	WorkflowActive WorkflowStatus = "active" // new runs start on its trigger
+	WorkflowPaused WorkflowStatus = "paused" // no new runs; runs in progress wait until it is activated again
+)
+
+type WorkflowTriggerType string
+
+const (
+	TriggerSubscriberCreated WorkflowTriggerType = "subscriber_created"
+	TriggerTagAdded          WorkflowTriggerType = "tag_added"
+	TriggerTagRemoved        WorkflowTriggerType = "tag_removed"
+	TriggerLinkClicked       WorkflowTriggerType = "link_clicked"
+	TriggerPaymentSuccess    WorkflowTriggerType = "payment_success"
+	TriggerPaymentFailed     WorkflowTriggerType = "payment_failed"
+	TriggerInactivity        WorkflowTriggerType = "inactivity"
+)
+
+// WorkflowTrigger is the event that starts a subscriber on a workflow. The
+// optional fields narrow it down.
+type WorkflowTrigger struct {
+	Type         WorkflowTriggerType `json:"type"`
+	TagID        *uuid.UUID          `json:"tagId,omitempty"`        // tag_added, tag_removed
+	CampaignID   *uuid.UUID          `json:"campaignId,omitempty"`   // link_clicked
+	URLContains  string              `json:"urlContains,omitempty"`  // link_clicked
+	InactiveDays int                 `json:"inactiveDays,omitempty"` // inactivity: no opens or clicks for this long
+}
+
+type WorkflowStepType string
+
+const (
+	StepWait         WorkflowStepType = "wait"
+	StepCondition    WorkflowStepType = "condition"
+	StepSendTemplate WorkflowStepType = "send_template"
+	StepAddTag       WorkflowStepType = "add_tag"
+	StepRemoveTag    WorkflowStepType = "remove_tag"
+	StepUpdateField  WorkflowStepType = "update_field"
+	StepWebhook      WorkflowStepType = "webhook"
+)
+
+// WorkflowStep is one node of a workflow graph. Steps link to each other by
+// ID; a step without a next step ends the run.
+type WorkflowStep struct {
+	ID   string           `json:"id"`
+	Type WorkflowStepType `json:"type"`
+	Next string           `json:"next,omitempty"`
+
+	Delay string `json:"delay,omitempty"` // wait: e.g. "3d", "12h", "30m"
+
+	Condition *WorkflowCondition `json:"condition,omitempty"` // condition: Then when it holds, Else otherwise
+	Then      string             `json:"then,omitempty"`
+	Else      string             `json:"else,omitempty"`
+
+	TemplateID *uuid.UUID `json:"templateId,omitempty"` // send_template
+	TagID      *uuid.UUID `json:"tagId,omitempty"`      // add_tag, remove_tag
+	Field      string     `json:"field,omitempty"`      // update_field: firstName, lastName, timezone, source or metadata.<key>
+	Value      string     `json:"value,omitempty"`
+	WebhookID  *uuid.UUID `json:"webhookId,omitempty"` // webhook: one of the creator's webhooks
+}
+
+// WorkflowCondition tests a subscriber. A leaf compares Field with Value
+// using Op; All and Any combine nested conditions.
+type WorkflowCondition struct {
+	Field string              `json:"field,omitempty"` // e.g. firstName, status, engagementScore, daysSinceOpen, tag, metadata.plan
+	Op    string              `json:"op,omitempty"`    // eq, neq, contains, gt, gte, lt, lte, exists, not_exists
+	Value string              `json:"value,omitempty"`
+	All   []WorkflowCondition `json:"all,omitempty"`
+	Any   []WorkflowCondition `json:"any,omitempty"`
+}
+
+// Workflow is an automation a creator's subscribers move through, one run
+// per subscriber. The first step is the entry point.
+type Workflow struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatorID    uuid.UUID       `gorm:"column:creator_id;type:uuid;not null;index" json:"creatorId"`
+	Creator      User            `gorm:"foreignKey:CreatorID;constraint:OnDelete:CASCADE" json:"-"`
+	Name         string          `gorm:"size:200;not null" json:"name"`
+	Status       WorkflowStatus  `gorm:"type:varchar(20);not null;default:'draft';index" json:"status"`
+	Trigger      WorkflowTrigger `gorm:"column:trigger;type:jsonb;serializer:json" json:"trigger"`
+	TriggerType  string          `gorm:"column:trigger_type;size:30;index" json:"-"` // copy of Trigger.Type for lookups
+	Steps        []WorkflowStep  `gorm:"column:steps;type:jsonb;serializer:json" json:"steps"`
+	AllowReentry bool            `gorm:"column:allow_reentry;default:false" json:"allowReentry"` // run again for subscribers who finished it
+	CheckedAt    *time.Time      `gorm:"column:checked_at" json:"-"`                             // last inactivity scan
+	CreatedAt    time.Time       `gorm:"column:created_at;autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time       `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (Workflow) TableName() string {
+	return "workflows"
+}
+
+type WorkflowRunStatus string
+
+const (
+	WorkflowRunWaiting   WorkflowRunStatus = "waiting"   // until WakeAt
+	WorkflowRunQueued    WorkflowRunStatus = "queued"    // job enqueued to advance it
+	WorkflowRunRunning   WorkflowRunStatus = "running"   // claimed by a worker
+	WorkflowRunCompleted WorkflowRunStatus = "completed" // reached the end
+	WorkflowRunExited    WorkflowRunStatus = "exited"    // subscriber left the list
+	WorkflowRunFailed    WorkflowRunStatus = "failed"
+	WorkflowRunCancelled WorkflowRunStatus = "cancelled" // by the creator, or its step was removed
+)
+
+// WorkflowRunEvent records one step a run went through
+type WorkflowRunEvent struct {
+	StepID string    `json:"stepId"`
+	Type   string    `json:"type"`
+	Result string    `json:"result,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// WorkflowRun is one subscriber's progress through a workflow. It is saved
+// after every step, so runs pick up where they were after a restart. A
+// subscriber has at most one open run per workflow (idx_workflow_run_open).
+type WorkflowRun struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	WorkflowID   uuid.UUID          `gorm:"column:workflow_id;type:uuid;not null;index;uniqueIndex:idx_workflow_run_open,where:status = 'waiting' OR status = 'queued' OR status = 'running'" json:"workflowId"`
+	Workflow     Workflow           `gorm:"foreignKey:WorkflowID;constraint:OnDelete:CASCADE" json:"-"`
+	SubscriberID uuid.UUID          `gorm:"column:subscriber_id;type:uuid;not null;index;uniqueIndex:idx_workflow_run_open" json:"subscriberId"`
+	Subscriber   Subscriber         `gorm:"foreignKey:SubscriberID;constraint:OnDelete:CASCADE" json:"-"`
+	Status       WorkflowRunStatus  `gorm:"type:varchar(20);not null;index:idx_workflow_run_due" json:"status"`
+	CurrentStep  string             `gorm:"column:current_step;size:100" json:"currentStep"`
+	WakeAt       *time.Time         `gorm:"column:wake_at;index:idx_workflow_run_due" json:"wakeAt,omitempty"`
+	ClaimedAt    *time.Time         `gorm:"column:claimed_at" json:"-"`                                                  // when it was last queued or picked up
+	TriggerData  map[string]string  `gorm:"column:trigger_data;type:jsonb;serializer:json" json:"triggerData,omitempty"` // e.g. the clicked URL
+	History      []WorkflowRunEvent `gorm:"column:history;type:jsonb;serializer:json" json:"history"`
+	LastError    *string            `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	StartedAt    time.Time          `gorm:"column:started_at;autoCreateTime" json:"startedAt"`
+	FinishedAt   *time.Time         `gorm:"column:finished_at" json:"finishedAt,omitempty"`
+	UpdatedAt    time.Time          `gorm:"column:updated_at;autoUpdateTime" json:"updatedAt"`
+}
+
+func (WorkflowRun) TableName() string {
+	return "workflow_runs"
+}
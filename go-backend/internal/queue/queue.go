@@ -0,0 +1,359 @@
+// Package queue is a durable background job queue backed by Redis Streams.
+//
+// Each job type gets its own stream (jobs:{<type>}) read by a consumer group,
+// and its own delayed set in the same Redis Cluster slot.
+// A worker renews its claim on a message while the job runs; messages whose
+// claim goes unrenewed past the job timeout, because their worker died, are
+// reclaimed by other workers. Failed jobs are retried with exponential
+// backoff through a delayed set, and jobs that exhaust their attempts are
+// dead-lettered to the failed_jobs table. Without Redis, jobs run in-process with the same retry
+// policy.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// Job types handled by the background workers
+const (
+	TypeSendEmail        = "send_email"
+	TypeBulkImport       = "bulk_import"
+	TypeAggregateStats   = "aggregate_stats"
+	TypeSendWebhook      = "send_webhook"
+	TypeSendCampaign     = "send_campaign"
+	TypePruneSubscribers = "prune_subscribers"
+	TypeRunWorkflow      = "run_workflow"
+	TypePollSeedMailbox  = "poll_seed_mailbox"
+	TypePollReturnPath   = "poll_return_path"
+)
+
+const (
+	consumerGroup = "workers"
+
+	defaultConcurrency = 2
+	defaultMaxAttempts = 5
+	defaultTimeout     = 5 * time.Minute
+
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 30 * time.Minute
+)
+
+// streamKey and delayedKey name a job type's keys. The shared hash tag keeps
+// them in one cluster slot so scripts and transactions can touch both.
+func streamKey(jobType string) string  { return "jobs:{" + jobType + "}" }
+func delayedKey(jobType string) string { return "jobs:{" + jobType + "}:delayed" }
+
+// Job is a unit of work on the queue
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler processes a job. Returning an error schedules a retry unless the
+// error is wrapped with Permanent.
+type Handler func(ctx context.Context, job *Job) error
+
+// Options tune how a job type is consumed
+type Options struct {
+	Concurrency int           // worker goroutines per process
+	MaxAttempts int           // attempts before the job is dead-lettered
+	Timeout     time.Duration // deadline on the handler's context; a job is reclaimed only if its worker stops renewing the claim for this long
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+type registration struct {
+	handler Handler
+	opts    Options
+}
+
+// Queue dispatches jobs to registered handlers
+type Queue struct {
+	mu       sync.RWMutex
+	handlers map[string]*registration
+	consumer string
+	started  bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a queue with no registered handlers
+func New() *Queue {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		handlers: make(map[string]*registration),
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+var (
+	defaultQueue     *Queue
+	defaultQueueOnce sync.Once
+)
+
+// Default returns the process-wide queue
+func Default() *Queue {
+	defaultQueueOnce.Do(func() {
+		defaultQueue = New()
+	})
+	return defaultQueue
+}
+
+// Register sets the handler for a job type on the default queue
+func Register(jobType string, handler Handler, opts Options) {
+	Default().Register(jobType, handler, opts)
+}
+
+// Enqueue adds a job to the default queue
+func Enqueue(jobType string, payload interface{}) (*Job, error) {
+	return Default().Enqueue(jobType, payload)
+}
+
+// Register sets the handler for a job type. Handlers must be registered
+// before Start for their consumers to run.
+func (q *Queue) Register(jobType string, handler Handler, opts Options) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	q.mu.Lock()
+	q.handlers[jobType] = &registration{handler: handler, opts: opts}
+	q.mu.Unlock()
+}
+
+func (q *Queue) registration(jobType string) (*registration, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	reg, ok := q.handlers[jobType]
+	return reg, ok
+}
+
+// Enqueue adds a job to its stream. If Redis is unavailable the job runs
+// in-process so work is never silently dropped.
+func (q *Queue) Enqueue(jobType string, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", jobType, err)
+	}
+
+	maxAttempts := defaultMaxAttempts
+	reg, registered := q.registration(jobType)
+	if registered {
+		maxAttempts = reg.opts.MaxAttempts
+	}
+
+	job := &Job{
+		ID:          uuid.New(),
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: maxAttempts,
+		CreatedAt:   time.Now(),
+	}
+
+	if rdb := database.GetRedis(); rdb != nil {
+		err := q.publish(rdb, job)
+		if err == nil {
+			return job, nil
+		}
+		log.Printf("[Queue] Failed to publish %s job %s, running in-process: %v", jobType, job.ID, err)
+	}
+
+	if !registered {
+		return nil, fmt.Errorf("no handler registered for job type %q", jobType)
+	}
+
+	q.wg.Add(1)
+	go q.runLocal(reg, job)
+	return job, nil
+}
+
+// Requeue enqueues a dead-lettered job again with a fresh attempt budget
+func (q *Queue) Requeue(failed *models.FailedJob) (*Job, error) {
+	job, err := q.Enqueue(failed.JobType, json.RawMessage(failed.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	failed.RetriedAt = &now
+	if db := database.GetDB(); db != nil {
+		db.Model(failed).Update("retried_at", now)
+	}
+	return job, nil
+}
+
+// Start launches consumers for every registered job type
+func (q *Queue) Start() {
+	q.mu.Lock()
+	if q.started {
+		q.mu.Unlock()
+		return
+	}
+	q.started = true
+	q.mu.Unlock()
+
+	rdb := database.GetRedis()
+	if rdb == nil {
+		log.Println("[Queue] Redis unavailable, jobs will run in-process")
+		return
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	jobTypes := make([]string, 0, len(q.handlers))
+	for jobType, reg := range q.handlers {
+		jobTypes = append(jobTypes, jobType)
+		stream := streamKey(jobType)
+		if err := ensureGroup(q.ctx, rdb, stream); err != nil {
+			log.Printf("[Queue] Failed to create consumer group for %s: %v", stream, err)
+			continue
+		}
+
+		for i := 0; i < reg.opts.Concurrency; i++ {
+			q.wg.Add(1)
+			go q.consume(stream, reg, fmt.Sprintf("%s-%s-%d", q.consumer, jobType, i))
+		}
+	}
+
+	q.wg.Add(1)
+	go q.promoteDelayed(jobTypes)
+
+	log.Printf("[Queue] Started consumers for %d job types", len(q.handlers))
+}
+
+// Stop cancels consumers and waits for in-flight jobs to finish
+func (q *Queue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// execute runs a single attempt of a job
+func (q *Queue) execute(reg *registration, job *Job) (err error) {
+	job.Attempts++
+
+	ctx, cancel := context.WithTimeout(q.ctx, reg.opts.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return reg.handler(ctx, job)
+}
+
+// shouldDeadLetter reports whether a failed job has no retries left
+func shouldDeadLetter(job *Job, err error) bool {
+	return IsPermanent(err) || job.Attempts >= job.MaxAttempts
+}
+
+// runLocal processes a job in-process, retrying with backoff until it
+// succeeds, fails permanently or the queue stops
+func (q *Queue) runLocal(reg *registration, job *Job) {
+	defer q.wg.Done()
+
+	for {
+		err := q.execute(reg, job)
+		if err == nil {
+			return
+		}
+		job.LastError = err.Error()
+
+		if shouldDeadLetter(job, err) {
+			deadLetter(job, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff(job.Attempts)):
+		case <-q.ctx.Done():
+			deadLetter(job, fmt.Errorf("queue stopped before retry: %w", err))
+			return
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt, with jitter
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << uint(attempts-1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) / 5))
+	return delay + jitter
+}
+
+// deadLetter stores a job that will not be retried
+func deadLetter(job *Job, err error) {
+	log.Printf("[Queue] %s job %s failed after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+
+	db := database.GetDB()
+	if db == nil {
+		return
+	}
+
+	failed := &models.FailedJob{
+		JobID:    job.ID,
+		JobType:  job.Type,
+		Payload:  string(job.Payload),
+		Attempts: job.Attempts,
+		Error:    err.Error(),
+	}
+	if dbErr := db.Create(failed).Error; dbErr != nil {
+		log.Printf("[Queue] Failed to dead-letter job %s: %v", job.ID, dbErr)
+	}
+}
@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// promoteScript atomically moves due jobs from a job type's delayed set
+// (KEYS[1]) back onto its stream (KEYS[2]) so a crash between the two steps
+// cannot lose a job
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('XADD', KEYS[2], '*', 'job', member)
+end
+return #due
+`)
+
+// publish appends a job to its stream
+func (q *Queue) publish(rdb *redis.Client, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return rdb.XAdd(q.ctx, &redis.XAddArgs{
+		Stream: streamKey(job.Type),
+		Values: map[string]interface{}{"job": string(data)},
+	}).Err()
+}
+
+func ensureGroup(ctx context.Context, rdb *redis.Client, stream string) error {
+	err := rdb.XGroupCreateMkStream(ctx, stream, consumerGroup, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// consume reads jobs for one stream until the queue stops. Entries left
+// pending by a crashed worker are reclaimed once they have gone unrenewed for
+// longer than the job timeout.
+func (q *Queue) consume(stream string, reg *registration, consumer string) {
+	defer q.wg.Done()
+
+	for q.ctx.Err() == nil {
+		rdb := database.GetRedis()
+		if rdb == nil {
+			return
+		}
+
+		messages, _, err := rdb.XAutoClaim(q.ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    consumerGroup,
+			Consumer: consumer,
+			MinIdle:  reg.opts.Timeout,
+			Start:    "0-0",
+			Count:    1,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) && q.ctx.Err() == nil {
+			log.Printf("[Queue] Failed to reclaim from %s: %v", stream, err)
+		}
+
+		if len(messages) == 0 {
+			streams, err := rdb.XReadGroup(q.ctx, &redis.XReadGroupArgs{
+				Group:    consumerGroup,
+				Consumer: consumer,
+				Streams:  []string{stream, ">"},
+				Count:    1,
+				Block:    5 * time.Second,
+			}).Result()
+			if errors.Is(err, redis.Nil) || q.ctx.Err() != nil {
+				continue
+			}
+			if err != nil {
+				log.Printf("[Queue] Failed to read from %s: %v", stream, err)
+				select {
+				case <-time.After(time.Second):
+				case <-q.ctx.Done():
+				}
+				continue
+			}
+			for _, s := range streams {
+				messages = append(messages, s.Messages...)
+			}
+		}
+
+		for _, msg := range messages {
+			q.handleMessage(rdb, stream, consumer, reg, msg)
+		}
+	}
+}
+
+// handleMessage runs one attempt of a stream entry and acknowledges it once
+// it has succeeded, been scheduled for retry or been dead-lettered
+func (q *Queue) handleMessage(rdb *redis.Client, stream, consumer string, reg *registration, msg redis.XMessage) {
+	raw, _ := msg.Values["job"].(string)
+
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		log.Printf("[Queue] Dropping malformed entry %s on %s: %v", msg.ID, stream, err)
+		q.ack(rdb, stream, msg.ID, nil, time.Time{})
+		return
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = reg.opts.MaxAttempts
+	}
+
+	stop := keepClaimed(rdb, stream, consumer, reg, msg.ID)
+	err := q.execute(reg, &job)
+	stop()
+	if err == nil {
+		q.ack(rdb, stream, msg.ID, nil, time.Time{})
+		return
+	}
+	job.LastError = err.Error()
+
+	if shouldDeadLetter(&job, err) {
+		deadLetter(&job, err)
+		q.ack(rdb, stream, msg.ID, nil, time.Time{})
+		return
+	}
+
+	retryAt := time.Now().Add(backoff(job.Attempts))
+	log.Printf("[Queue] %s job %s attempt %d failed, retrying at %s: %v",
+		job.Type, job.ID, job.Attempts, retryAt.Format(time.RFC3339), err)
+	q.ack(rdb, stream, msg.ID, &job, retryAt)
+}
+
+// keepClaimed resets the entry's idle time while its job runs, so it is only
+// reclaimed from a worker that died, not from one whose handler is slow or
+// ignores its context. The returned func stops it.
+func keepClaimed(rdb *redis.Client, stream, consumer string, reg *registration, id string) func() {
+	interval := reg.opts.Timeout / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := rdb.XClaimJustID(context.Background(), &redis.XClaimArgs{
+					Stream:   stream,
+					Group:    consumerGroup,
+					Consumer: consumer,
+					Messages: []string{id},
+				}).Err()
+				if err != nil {
+					log.Printf("[Queue] Failed to extend claim on %s %s: %v", stream, id, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// ack removes an entry from the stream, optionally moving the job to the
+// delayed set in the same transaction
+func (q *Queue) ack(rdb *redis.Client, stream, id string, retry *Job, retryAt time.Time) {
+	// Use a fresh context so acknowledgements still land while shutting down
+	ctx := context.Background()
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if retry != nil {
+			data, err := json.Marshal(retry)
+			if err != nil {
+				return err
+			}
+			pipe.ZAdd(ctx, delayedKey(retry.Type), redis.Z{
+				Score:  float64(retryAt.UnixMilli()),
+				Member: string(data),
+			})
+		}
+		pipe.XAck(ctx, stream, consumerGroup, id)
+		pipe.XDel(ctx, stream, id)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Queue] Failed to acknowledge %s on %s: %v", id, stream, err)
+	}
+}
+
+// promoteDelayed moves retries whose backoff has elapsed back onto their streams
+func (q *Queue) promoteDelayed(jobTypes []string) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			rdb := database.GetRedis()
+			if rdb == nil {
+				return
+			}
+			now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			for _, jobType := range jobTypes {
+				keys := []string{delayedKey(jobType), streamKey(jobType)}
+				if err := promoteScript.Run(q.ctx, rdb, keys, now).Err(); err != nil && q.ctx.Err() == nil {
+					log.Printf("[Queue] Failed to promote delayed %s jobs: %v", jobType, err)
+				}
+			}
+		}
+	}
+}
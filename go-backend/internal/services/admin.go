@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/okemwag/newsletter/internal/database"
 	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
 	"github.com/okemwag/newsletter/internal/types"
 	"gorm.io/gorm"
 )
@@ -256,3 +257,42 @@ func (s *AdminService) GetTopCreators(limit int) ([]map[string]interface{}, erro
 
 	return results, nil
 }
+
+// GetFailedJobs lists dead-lettered background jobs, newest first
+func (s *AdminService) GetFailedJobs(jobType string, page, pageSize int) ([]models.FailedJob, int64, error) {
+	var jobs []models.FailedJob
+	var total int64
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 50
+	}
+	offset := (page - 1) * pageSize
+
+	query := s.db.Model(&models.FailedJob{})
+	if jobType != "" {
+		query = query.Where("job_type = ?", jobType)
+	}
+	query.Count(&total)
+
+	if err := query.Order("failed_at DESC").Limit(pageSize).Offset(offset).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return jobs, total, nil
+}
+
+// RetryFailedJob puts a dead-lettered job back on the queue
+func (s *AdminService) RetryFailedJob(id uuid.UUID) (*queue.Job, error) {
+	var failed models.FailedJob
+	if err := s.db.First(&failed, "id = ?", id).Error; err != nil {
+		return nil, errors.New("failed job not found")
+	}
+	if failed.RetriedAt != nil {
+		return nil, errors.New("job has already been retried")
+	}
+
+	return queue.Default().Requeue(&failed)
+}
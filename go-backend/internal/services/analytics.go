@@ -1,6 +1,8 @@
 package services
 
 import (
+	"encoding/json"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,12 +12,14 @@ import (
 )
 
 type AnalyticsService struct {
-	db *gorm.DB
+	db         *gorm.DB
+	classifier *EventClassifier
 }
 
 func NewAnalyticsService() *AnalyticsService {
 	return &AnalyticsService{
-		db: database.GetDB(),
+		db:         database.GetDB(),
+		classifier: NewEventClassifier(),
 	}
 }
 
@@ -26,6 +30,8 @@ type OverviewStats struct {
 	SentCampaigns      int64 `json:"sentCampaigns"`
 	TotalOpens         int64 `json:"totalOpens"`
 	TotalClicks        int64 `json:"totalClicks"`
+	MachineOpens       int64 `json:"machineOpens"`
+	MachineClicks      int64 `json:"machineClicks"`
 	AvgOpenRate        float64 `json:"avgOpenRate"`
 	AvgClickRate       float64 `json:"avgClickRate"`
 	SubscribersThisMonth int64 `json:"subscribersThisMonth"`
@@ -49,16 +55,17 @@ func (s *AnalyticsService) GetOverview(creatorID uuid.UUID) (*OverviewStats, err
 	s.db.Model(&models.Campaign{}).Where("creator_id = ?", creatorID).Count(&stats.TotalCampaigns)
 	s.db.Model(&models.Campaign{}).Where("creator_id = ? AND status = ?", creatorID, models.CampaignStatusSent).Count(&stats.SentCampaigns)
 
-	// Event counts
-	s.db.Model(&models.EmailEvent{}).
-		Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
-		Where("campaigns.creator_id = ? AND email_events.event_type = ?", creatorID, models.EmailEventOpen).
-		Count(&stats.TotalOpens)
-
-	s.db.Model(&models.EmailEvent{}).
-		Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
-		Where("campaigns.creator_id = ? AND email_events.event_type = ?", creatorID, models.EmailEventClick).
-		Count(&stats.TotalClicks)
+	// Event counts; opens and clicks by proxies and scanners are reported apart
+	countEvents := func(eventType models.EmailEventType, machine bool, count *int64) {
+		s.db.Model(&models.EmailEvent{}).
+			Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
+			Where("campaigns.creator_id = ? AND email_events.event_type = ? AND email_events.is_machine = ?", creatorID, eventType, machine).
+			Count(count)
+	}
+	countEvents(models.EmailEventOpen, false, &stats.TotalOpens)
+	countEvents(models.EmailEventClick, false, &stats.TotalClicks)
+	countEvents(models.EmailEventOpen, true, &stats.MachineOpens)
+	countEvents(models.EmailEventClick, true, &stats.MachineClicks)
 
 	// This month stats
 	startOfMonth := time.Now().AddDate(0, 0, -time.Now().Day()+1).Truncate(24 * time.Hour)
@@ -109,9 +116,86 @@ func (s *AnalyticsService) GetGrowthData(creatorID uuid.UUID, days int) ([]Growt
 }
 
 func (s *AnalyticsService) RecordEvent(event *models.EmailEvent) error {
+	// Attach the event to the message it was recorded against
+	if event.MessageID == nil {
+		var msg models.EmailMessage
+		err := s.db.Select("id").
+			Where("campaign_id = ? AND subscriber_id = ?", event.CampaignID, event.SubscriberID).
+			Order("created_at DESC").
+			First(&msg).Error
+		if err == nil {
+			event.MessageID = &msg.ID
+		}
+	}
+	s.classifier.Classify(event)
 	return s.db.Create(event).Error
 }
 
+// RecordEngagement stores an open or click and, unless it was made by a
+// scanner, credits it to the subscriber's engagement. Opens fetched by a
+// privacy or image proxy still count, but their time is not used for send
+// time profiles. Machine events are counted separately in the creator's
+// deliverability metrics.
+func (s *AnalyticsService) RecordEngagement(event *models.EmailEvent) error {
+	if err := s.RecordEvent(event); err != nil {
+		return err
+	}
+
+	var campaign models.Campaign
+	if err := s.db.Select("id", "creator_id").First(&campaign, "id = ?", event.CampaignID).Error; err != nil {
+		return nil
+	}
+
+	deliverability := NewDeliverabilityService()
+	switch {
+	case event.EventType == models.EmailEventClick && event.IsMachine:
+		deliverability.RecordMachineClick(campaign.CreatorID)
+	case event.EventType == models.EmailEventClick:
+		deliverability.RecordClick(campaign.CreatorID)
+	case event.IsMachine:
+		deliverability.RecordMachineOpen(campaign.CreatorID)
+	default:
+		deliverability.RecordOpen(campaign.CreatorID)
+	}
+
+	if !countsAsEngagement(event) {
+		return nil
+	}
+
+	engagement := NewEngagementService()
+	if event.EventType == models.EmailEventClick {
+		s.triggerClickWorkflows(event, campaign.CreatorID)
+		return engagement.RecordClick(event.SubscriberID, event.CampaignID)
+	}
+	if !event.IsMachine {
+		if err := NewSendTimeService().RecordOpen(event.SubscriberID, campaign.CreatorID, event.CreatedAt); err != nil {
+			log.Printf("[SendTime] Failed to update profile for subscriber %s: %v", event.SubscriberID, err)
+		}
+	}
+	return engagement.RecordOpen(event.SubscriberID, event.CampaignID)
+}
+
+// triggerClickWorkflows starts the creator's link_clicked workflows for a
+// human click
+func (s *AnalyticsService) triggerClickWorkflows(event *models.EmailEvent, creatorID uuid.UUID) {
+	var link struct {
+		URL string `json:"url"`
+	}
+	if event.Metadata != nil {
+		json.Unmarshal([]byte(*event.Metadata), &link)
+	}
+
+	NewWorkflowService().TriggerWorkflows(creatorID, event.SubscriberID, &WorkflowEvent{
+		Type:       models.TriggerLinkClicked,
+		CampaignID: &event.CampaignID,
+		URL:        link.URL,
+		Data: map[string]string{
+			"url":        link.URL,
+			"campaignId": event.CampaignID.String(),
+		},
+	})
+}
+
 func (s *AnalyticsService) GetCampaignEvents(campaignID uuid.UUID, eventType *models.EmailEventType) ([]models.EmailEvent, error) {
 	var events []models.EmailEvent
 	query := s.db.Where("campaign_id = ?", campaignID)
@@ -257,10 +257,10 @@ func (s *AuthService) sendVerificationEmail(user *models.User) {
 		return // Non-fatal
 	}
 	
-	// Send via Resend
-	emailService := NewResendEmailService()
-	if emailService.IsConfigured() {
-		emailService.SendVerificationEmail(user.Email, code)
+	// Send via the transactional mail route
+	mailer := NewMailerRegistry()
+	if mailer.IsConfigured(models.MessageClassTransactional, nil) {
+		mailer.SendVerificationEmail(user.Email, code)
 	}
 }
 
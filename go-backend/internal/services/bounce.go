@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"log"
 	"time"
@@ -16,31 +17,47 @@ const (
 	MaxSoftBounces = 3
 )
 
+var ErrBouncedSubscriberNotFound = errors.New("bounced subscriber not found")
+
 // BounceService handles email bounce processing
 type BounceService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	suppressions   *SuppressionService
+	deliverability *DeliverabilityService
 }
 
 // NewBounceService creates a new bounce service
 func NewBounceService() *BounceService {
 	return &BounceService{
-		db: database.GetDB(),
+		db:             database.GetDB(),
+		suppressions:   NewSuppressionService(),
+		deliverability: NewDeliverabilityService(),
 	}
 }
 
-// BounceEvent represents an incoming bounce event from email provider
+// BounceEvent represents an incoming bounce event from email provider.
+// Whether it is hard or soft is decided by ClassifyBounce from the status
+// and diagnostic, not taken from the caller.
 type BounceEvent struct {
-	Email       string            `json:"email"`
-	BounceType  models.BounceType `json:"bounceType"` // "hard" or "soft"
-	Reason      string            `json:"reason"`
-	Timestamp   time.Time         `json:"timestamp"`
-	CampaignID  *uuid.UUID        `json:"campaignId,omitempty"`
-	MessageID   string            `json:"messageId,omitempty"`
-	Provider    string            `json:"provider"` // sendgrid, resend, etc.
+	Email        string            `json:"email"`
+	Status       string            `json:"status,omitempty"`       // RFC 3463 enhanced status code, e.g. 5.1.1
+	Reason       string            `json:"reason"`                 // diagnostic from the receiving server
+	ProviderType models.BounceType `json:"providerType,omitempty"` // provider's own hard/soft, used when there is no status code
+	Timestamp    time.Time         `json:"timestamp"`
+	CampaignID   *uuid.UUID        `json:"campaignId,omitempty"`
+	MessageID    string            `json:"messageId,omitempty"`
+	Provider     string            `json:"provider"` // sendgrid, resend, return-path, etc.
 }
 
-// ProcessBounce handles a bounce event and updates subscriber status
+// ProcessBounce classifies a bounce event and updates subscriber status
 func (s *BounceService) ProcessBounce(creatorID uuid.UUID, event *BounceEvent) error {
+	classification := ClassifyBounce(event.Status, event.Reason, event.ProviderType)
+
+	// A hard bounce means the mailbox does not exist, for any sender
+	if classification.Type == models.BounceTypeHard {
+		s.suppressions.Suppress(nil, event.Email, models.SuppressionReasonHardBounce, "bounce")
+	}
+
 	// Find the subscriber
 	var subscriber models.Subscriber
 	if err := s.db.Where("email = ? AND creator_id = ?", event.Email, creatorID).First(&subscriber).Error; err != nil {
@@ -57,18 +74,18 @@ func (s *BounceService) ProcessBounce(creatorID uuid.UUID, event *BounceEvent) e
 	subscriber.BounceReason = &event.Reason
 
 	// Handle based on bounce type
-	if event.BounceType == models.BounceTypeHard {
+	if classification.Type == models.BounceTypeHard {
 		// Hard bounce - immediately mark as bounced and unsubscribe
-		return s.handleHardBounce(&subscriber, event)
+		return s.handleHardBounce(&subscriber, event, classification)
 	}
 
 	// Soft bounce - increment counter and check threshold
-	return s.handleSoftBounce(&subscriber, event)
+	return s.handleSoftBounce(&subscriber, event, classification)
 }
 
 // handleHardBounce processes a hard bounce (permanent delivery failure)
-func (s *BounceService) handleHardBounce(subscriber *models.Subscriber, event *BounceEvent) error {
-	log.Printf("[Bounce] Hard bounce for %s: %s", subscriber.Email, event.Reason)
+func (s *BounceService) handleHardBounce(subscriber *models.Subscriber, event *BounceEvent, classification BounceClassification) error {
+	log.Printf("[Bounce] Hard bounce (%s) for %s: %s", classification.Category, subscriber.Email, event.Reason)
 
 	subscriber.Status = models.SubscriberStatusBounced
 	subscriber.BounceCount = subscriber.BounceCount + 1
@@ -81,7 +98,7 @@ func (s *BounceService) handleHardBounce(subscriber *models.Subscriber, event *B
 
 	// Record the event
 	if event.CampaignID != nil {
-		s.recordBounceEvent(subscriber, event)
+		s.recordBounceEvent(subscriber, event, classification)
 	}
 
 	// Update deliverability metrics
@@ -91,7 +108,7 @@ func (s *BounceService) handleHardBounce(subscriber *models.Subscriber, event *B
 }
 
 // handleSoftBounce processes a soft bounce (temporary delivery failure)
-func (s *BounceService) handleSoftBounce(subscriber *models.Subscriber, event *BounceEvent) error {
+func (s *BounceService) handleSoftBounce(subscriber *models.Subscriber, event *BounceEvent, classification BounceClassification) error {
 	subscriber.BounceCount = subscriber.BounceCount + 1
 
 	if subscriber.BounceCount >= MaxSoftBounces {
@@ -110,7 +127,7 @@ func (s *BounceService) handleSoftBounce(subscriber *models.Subscriber, event *B
 
 	// Record the event
 	if event.CampaignID != nil {
-		s.recordBounceEvent(subscriber, event)
+		s.recordBounceEvent(subscriber, event, classification)
 	}
 
 	// Update deliverability metrics
@@ -120,8 +137,14 @@ func (s *BounceService) handleSoftBounce(subscriber *models.Subscriber, event *B
 }
 
 // recordBounceEvent creates an email event record for the bounce
-func (s *BounceService) recordBounceEvent(subscriber *models.Subscriber, event *BounceEvent) {
-	metadata := `{"reason": "` + event.Reason + `", "bounceType": "` + string(event.BounceType) + `"}`
+func (s *BounceService) recordBounceEvent(subscriber *models.Subscriber, event *BounceEvent, classification BounceClassification) {
+	raw, _ := json.Marshal(map[string]string{
+		"reason":     event.Reason,
+		"bounceType": string(classification.Type),
+		"category":   classification.Category,
+		"status":     classification.Status,
+	})
+	metadata := string(raw)
 	
 	emailEvent := &models.EmailEvent{
 		CampaignID:   *event.CampaignID,
@@ -135,67 +158,14 @@ func (s *BounceService) recordBounceEvent(subscriber *models.Subscriber, event *
 	}
 }
 
-// updateMetrics updates the creator's deliverability metrics
+// updateMetrics counts the bounce in today's rollup and refreshes the
+// creator's rolling metrics
 func (s *BounceService) updateMetrics(creatorID uuid.UUID, bounceType models.BounceType) {
-	var metrics models.DeliverabilityMetrics
-	
-	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// Create new metrics record
-		metrics = models.DeliverabilityMetrics{
-			CreatorID: creatorID,
-		}
-		s.db.Create(&metrics)
+	if err := s.deliverability.RecordBounce(creatorID, bounceType); err != nil {
+		log.Printf("[Bounce] Failed to record bounce for creator %s: %v", creatorID, err)
+		return
 	}
-
-	metrics.TotalBounced++
-	if bounceType == models.BounceTypeHard {
-		metrics.HardBounces++
-	} else {
-		metrics.SoftBounces++
-	}
-
-	// Recalculate bounce rate
-	if metrics.TotalSent > 0 {
-		metrics.BounceRate = float64(metrics.TotalBounced) / float64(metrics.TotalSent) * 100
-	}
-
-	// Update reputation score (decrease for bounces)
-	s.updateReputationScore(&metrics)
-
-	s.db.Save(&metrics)
-}
-
-// updateReputationScore recalculates sender reputation based on metrics
-func (s *BounceService) updateReputationScore(metrics *models.DeliverabilityMetrics) {
-	// Start with perfect score
-	score := 100.0
-
-	// Deduct for bounce rate (target: <2%)
-	if metrics.BounceRate > 2 {
-		score -= (metrics.BounceRate - 2) * 5 // -5 points per 1% over 2%
-	}
-
-	// Deduct for complaint rate (target: <0.1%)
-	if metrics.ComplaintRate > 0.1 {
-		score -= (metrics.ComplaintRate - 0.1) * 50 // -50 points per 1% over 0.1%
-	}
-
-	// Bonus for good engagement
-	if metrics.OpenRate > 20 {
-		score += (metrics.OpenRate - 20) * 0.5 // +0.5 points per 1% over 20%
-	}
-
-	// Clamp to 0-100
-	if score < 0 {
-		score = 0
-	}
-	if score > 100 {
-		score = 100
-	}
-
-	metrics.ReputationScore = score
-	metrics.LastCalculatedAt = time.Now()
+	s.deliverability.RecalculateMetrics(creatorID)
 }
 
 // GetBounceStats returns bounce statistics for a creator
@@ -226,13 +196,17 @@ func (s *BounceService) GetBounceStats(creatorID uuid.UUID) (map[string]interfac
 	}, nil
 }
 
-// GetBouncedSubscribers returns list of bounced subscribers for a creator
-func (s *BounceService) GetBouncedSubscribers(creatorID uuid.UUID, limit, offset int) ([]models.Subscriber, int64, error) {
+// GetBouncedSubscribers returns bounced subscribers, most recent first. A nil
+// creator lists every creator's, for admins.
+func (s *BounceService) GetBouncedSubscribers(creatorID *uuid.UUID, limit, offset int) ([]models.Subscriber, int64, error) {
 	var subscribers []models.Subscriber
 	var total int64
 
-	query := s.db.Where("creator_id = ? AND status = ?", creatorID, models.SubscriberStatusBounced)
-	
+	query := s.db.Model(&models.Subscriber{}).Where("status = ?", models.SubscriberStatusBounced)
+	if creatorID != nil {
+		query = query.Where("creator_id = ?", *creatorID)
+	}
+
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
@@ -244,15 +218,29 @@ func (s *BounceService) GetBouncedSubscribers(creatorID uuid.UUID, limit, offset
 	return subscribers, total, nil
 }
 
-// ResetBounce resets bounce status for a subscriber (e.g., after email is corrected)
-func (s *BounceService) ResetBounce(creatorID, subscriberID uuid.UUID) error {
-	return s.db.Model(&models.Subscriber{}).
+// ResetBounce resets bounce status for a subscriber (e.g., after email is corrected).
+// Subscribers who unsubscribed or complained are not reactivated.
+func (s *BounceService) ResetBounce(creatorID, subscriberID uuid.UUID) (*models.Subscriber, error) {
+	result := s.db.Model(&models.Subscriber{}).
 		Where("id = ? AND creator_id = ?", subscriberID, creatorID).
+		Where("status IN ?", []models.SubscriberStatus{models.SubscriberStatusBounced, models.SubscriberStatusActive}).
 		Updates(map[string]interface{}{
-			"status":        models.SubscriberStatusActive,
-			"bounce_count":  0,
-			"bounce_reason": nil,
-			"last_bounce_at": nil,
+			"status":          models.SubscriberStatusActive,
+			"bounce_count":    0,
+			"bounce_reason":   nil,
+			"last_bounce_at":  nil,
 			"unsubscribed_at": nil,
-		}).Error
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrBouncedSubscriberNotFound
+	}
+
+	var subscriber models.Subscriber
+	if err := s.db.First(&subscriber, "id = ?", subscriberID).Error; err != nil {
+		return nil, err
+	}
+	return &subscriber, nil
 }
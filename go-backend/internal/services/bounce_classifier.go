@@ -0,0 +1,205 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// Why a delivery failed, from the RFC 3463 status code subject
+const (
+	BounceCategoryMailbox     = "mailbox"      // the mailbox doesn't exist or is disabled
+	BounceCategoryDomain      = "domain"       // the domain doesn't exist or accepts no mail
+	BounceCategoryMailboxFull = "mailbox_full" // over quota
+	BounceCategoryPolicy      = "policy"       // blocked: reputation, spam filtering, sender policy
+	BounceCategoryContent     = "content"      // message rejected for its size or content
+	BounceCategorySystem      = "system"       // receiving system or network trouble
+	BounceCategoryExpired     = "expired"      // gave up retrying
+	BounceCategoryUnknown     = "unknown"
+)
+
+// BounceClassification is the validated outcome of a failed delivery
+type BounceClassification struct {
+	Type     models.BounceType `json:"bounceType"`
+	Category string            `json:"category"`
+	Status   string            `json:"status,omitempty"` // enhanced status code the decision was based on
+}
+
+var (
+	enhancedStatusPattern = regexp.MustCompile(`\b([245])\.(\d{1,3})\.(\d{1,3})\b`)
+	basicReplyPattern     = regexp.MustCompile(`^\s*(?:smtp;\s*)?([245]\d\d)\b`)
+)
+
+// Diagnostic phrases for a recipient that doesn't exist, and for blocks that
+// mention the recipient but aren't about it
+var (
+	unknownRecipientPhrases = []string{
+		"user unknown", "unknown user", "no such user", "unknown recipient",
+		"does not exist", "doesn't exist", "mailbox not found", "mailbox unavailable",
+		"invalid recipient", "invalid mailbox", "not a valid mailbox", "no mailbox here",
+		"recipient address rejected", "account disabled", "account has been disabled",
+	}
+	policyPhrases = []string{
+		"block", "spam", "blacklist", "blocklist", "listed", "reputation", "policy", "rate limit",
+	}
+)
+
+// ClassifyBounce decides whether a failed delivery is permanent. The enhanced
+// status code (RFC 3463) is used when given or quoted in the diagnostic,
+// then the basic SMTP reply code. The provider's own classification is only
+// trusted when neither is available or the code is too generic to decide.
+//
+// Only failures that say the address is bad are hard: policy blocks,
+// content rejections and full mailboxes are soft even with a 5.x.x status,
+// since the same address may accept mail later.
+func ClassifyBounce(status, diagnostic string, providerType models.BounceType) BounceClassification {
+	validHint := providerType == models.BounceTypeHard || providerType == models.BounceTypeSoft
+
+	code := normalizeEnhancedStatus(status)
+	if code == "" {
+		code = enhancedStatusPattern.FindString(diagnostic)
+	}
+	var result BounceClassification
+	switch match := basicReplyPattern.FindStringSubmatch(diagnostic); {
+	case code != "":
+		result = classifyEnhancedStatus(code, diagnostic)
+	case match != nil:
+		result = classifyBasicReply(match[1], diagnostic)
+	case validHint:
+		return BounceClassification{Type: providerType, Category: BounceCategoryUnknown}
+	default:
+		if mentionsUnknownRecipient(diagnostic) {
+			return BounceClassification{Type: models.BounceTypeHard, Category: BounceCategoryMailbox}
+		}
+		return BounceClassification{Type: models.BounceTypeSoft, Category: BounceCategoryUnknown}
+	}
+
+	if result.Category == BounceCategoryUnknown && validHint {
+		result.Type = providerType
+	}
+	return result
+}
+
+// normalizeEnhancedStatus returns the X.Y.Z code from a Status field, which
+// may carry a trailing comment, or "" if there isn't one
+func normalizeEnhancedStatus(status string) string {
+	return enhancedStatusPattern.FindString(strings.TrimSpace(status))
+}
+
+func classifyEnhancedStatus(code, diagnostic string) BounceClassification {
+	parts := strings.Split(code, ".")
+	class, subject, detail := parts[0], parts[1], parts[2]
+
+	result := BounceClassification{Type: models.BounceTypeSoft, Category: BounceCategoryUnknown, Status: code}
+	if class != "5" {
+		// 4.x.x is transient by definition
+		switch subject {
+		case "2":
+			if detail == "2" {
+				result.Category = BounceCategoryMailboxFull
+			}
+		case "4":
+			result.Category = BounceCategorySystem
+			if detail == "7" {
+				result.Category = BounceCategoryExpired
+			}
+		case "7":
+			result.Category = BounceCategoryPolicy
+		default:
+			result.Category = BounceCategorySystem
+		}
+		return result
+	}
+
+	switch subject {
+	case "1": // addressing
+		switch detail {
+		case "1", "3", "6":
+			result.Type, result.Category = models.BounceTypeHard, BounceCategoryMailbox
+		case "2", "10":
+			result.Type, result.Category = models.BounceTypeHard, BounceCategoryDomain
+		case "7", "8":
+			// Our sender address was refused, not the recipient's
+			result.Category = BounceCategoryPolicy
+		default:
+			return refineGeneric(result, diagnostic)
+		}
+	case "2": // mailbox
+		switch detail {
+		case "1":
+			result.Type, result.Category = models.BounceTypeHard, BounceCategoryMailbox
+		case "2":
+			result.Category = BounceCategoryMailboxFull
+		case "3":
+			result.Category = BounceCategoryContent
+		default:
+			return refineGeneric(result, diagnostic)
+		}
+	case "3": // mail system
+		result.Category = BounceCategorySystem
+	case "4": // network and routing
+		switch detail {
+		case "4":
+			result.Type, result.Category = models.BounceTypeHard, BounceCategoryDomain
+		case "7":
+			result.Category = BounceCategoryExpired
+		default:
+			// Some providers report unknown recipients as 5.4.1
+			result.Category = BounceCategorySystem
+			return refineGeneric(result, diagnostic)
+		}
+	case "6": // content
+		result.Category = BounceCategoryContent
+	case "7": // security and policy
+		result.Category = BounceCategoryPolicy
+	default: // 5.0.x and 5.5.x are too generic to act on without the diagnostic
+		return refineGeneric(result, diagnostic)
+	}
+	return result
+}
+
+// classifyBasicReply handles diagnostics with only a three digit reply code
+func classifyBasicReply(code, diagnostic string) BounceClassification {
+	result := BounceClassification{Type: models.BounceTypeSoft, Category: BounceCategoryUnknown, Status: code}
+	switch {
+	case code[0] != '5':
+		result.Category = BounceCategorySystem
+	case code == "552":
+		result.Category = BounceCategoryMailboxFull
+	default:
+		return refineGeneric(result, diagnostic)
+	}
+	return result
+}
+
+// refineGeneric upgrades a permanent failure with a generic code to hard
+// when the diagnostic says the recipient doesn't exist
+func refineGeneric(result BounceClassification, diagnostic string) BounceClassification {
+	if mentionsPolicy(diagnostic) {
+		result.Category = BounceCategoryPolicy
+		return result
+	}
+	if mentionsUnknownRecipient(diagnostic) {
+		result.Type, result.Category = models.BounceTypeHard, BounceCategoryMailbox
+	}
+	return result
+}
+
+func mentionsUnknownRecipient(diagnostic string) bool {
+	return containsAnyFold(diagnostic, unknownRecipientPhrases)
+}
+
+func mentionsPolicy(diagnostic string) bool {
+	return containsAnyFold(diagnostic, policyPhrases)
+}
+
+func containsAnyFold(s string, phrases []string) bool {
+	s = strings.ToLower(s)
+	for _, phrase := range phrases {
+		if strings.Contains(s, phrase) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+func TestClassifyBounce(t *testing.T) {
+	const (
+		hard = models.BounceTypeHard
+		soft = models.BounceTypeSoft
+	)
+
+	tests := []struct {
+		name       string
+		status     string
+		diagnostic string
+		hint       models.BounceType
+		wantType   models.BounceType
+		category   string
+		code       string
+	}{
+		// Enhanced status codes
+		{name: "unknown mailbox", status: "5.1.1", wantType: hard, category: BounceCategoryMailbox, code: "5.1.1"},
+		{name: "status with a comment", status: "5.1.1 (bad destination mailbox address)", wantType: hard, category: BounceCategoryMailbox, code: "5.1.1"},
+		{name: "bad domain", status: "5.1.2", wantType: hard, category: BounceCategoryDomain, code: "5.1.2"},
+		{name: "null MX", status: "5.1.10", wantType: hard, category: BounceCategoryDomain, code: "5.1.10"},
+		{name: "no route to domain", status: "5.4.4", wantType: hard, category: BounceCategoryDomain, code: "5.4.4"},
+		{name: "disabled mailbox", status: "5.2.1", wantType: hard, category: BounceCategoryMailbox, code: "5.2.1"},
+		{name: "our sender refused", status: "5.1.7", wantType: soft, category: BounceCategoryPolicy, code: "5.1.7"},
+		{name: "full mailbox stays soft", status: "5.2.2", wantType: soft, category: BounceCategoryMailboxFull, code: "5.2.2"},
+		{name: "message too large", status: "5.2.3", wantType: soft, category: BounceCategoryContent, code: "5.2.3"},
+		{name: "mail system trouble", status: "5.3.0", wantType: soft, category: BounceCategorySystem, code: "5.3.0"},
+		{name: "content rejected", status: "5.6.0", wantType: soft, category: BounceCategoryContent, code: "5.6.0"},
+		{name: "policy block stays soft", status: "5.7.1", diagnostic: "550 5.7.1 Service unavailable; client host blocked using Spamhaus", wantType: soft, category: BounceCategoryPolicy, code: "5.7.1"},
+		{name: "policy beats provider hint", status: "5.7.1", hint: hard, wantType: soft, category: BounceCategoryPolicy, code: "5.7.1"},
+		{name: "gave up retrying", status: "5.4.7", wantType: soft, category: BounceCategoryExpired, code: "5.4.7"},
+		{name: "5.4.1 naming an unknown recipient", status: "5.4.1", diagnostic: "550 5.4.1 Recipient address rejected: Access denied", wantType: hard, category: BounceCategoryMailbox, code: "5.4.1"},
+		{name: "5.4.1 without a reason", status: "5.4.1", wantType: soft, category: BounceCategorySystem, code: "5.4.1"},
+
+		// Transient codes are never hard
+		{name: "temporary full mailbox", status: "4.2.2", wantType: soft, category: BounceCategoryMailboxFull, code: "4.2.2"},
+		{name: "temporary expiry", status: "4.4.7", wantType: soft, category: BounceCategoryExpired, code: "4.4.7"},
+		{name: "greylisted", status: "4.7.1", diagnostic: "451 4.7.1 Greylisted, try again later", wantType: soft, category: BounceCategoryPolicy, code: "4.7.1"},
+		{name: "temporary with unknown user text", status: "4.1.1", diagnostic: "user unknown", hint: hard, wantType: soft, category: BounceCategorySystem, code: "4.1.1"},
+
+		// Generic permanent codes need the diagnostic
+		{name: "generic code, unknown user", status: "5.0.0", diagnostic: "550 5.0.0 <a@example.org>: no such user", wantType: hard, category: BounceCategoryMailbox, code: "5.0.0"},
+		{name: "generic code, block that names the user", status: "5.0.0", diagnostic: "550 user a@example.org is listed on our blocklist", wantType: soft, category: BounceCategoryPolicy, code: "5.0.0"},
+		{name: "generic code falls back to the hint", status: "5.5.0", hint: hard, wantType: hard, category: BounceCategoryUnknown, code: "5.5.0"},
+		{name: "generic code without a hint", status: "5.5.0", wantType: soft, category: BounceCategoryUnknown, code: "5.5.0"},
+
+		// Codes quoted in the diagnostic
+		{name: "enhanced code in diagnostic", diagnostic: "smtp; 550 5.1.1 <a@example.org>: Recipient address rejected", wantType: hard, category: BounceCategoryMailbox, code: "5.1.1"},
+		{name: "status field wins over diagnostic", status: "4.2.2", diagnostic: "550 5.1.1 user unknown", wantType: soft, category: BounceCategoryMailboxFull, code: "4.2.2"},
+		{name: "basic reply with unknown mailbox", diagnostic: "550 Requested action not taken: mailbox unavailable", wantType: hard, category: BounceCategoryMailbox, code: "550"},
+		{name: "basic reply mailbox full", diagnostic: "552 Mailbox full", wantType: soft, category: BounceCategoryMailboxFull, code: "552"},
+		{name: "basic transient reply", diagnostic: "smtp; 421 Too many connections", hint: hard, wantType: soft, category: BounceCategorySystem, code: "421"},
+		{name: "basic reply with no detail", diagnostic: "554 Transaction failed", wantType: soft, category: BounceCategoryUnknown, code: "554"},
+
+		// No codes at all
+		{name: "provider hint alone", hint: hard, wantType: hard, category: BounceCategoryUnknown},
+		{name: "soft provider hint alone", diagnostic: "mailbox not found", hint: soft, wantType: soft, category: BounceCategoryUnknown},
+		{name: "unknown recipient text alone", diagnostic: "The email account that you tried to reach does not exist", wantType: hard, category: BounceCategoryMailbox},
+		{name: "nothing to go on", diagnostic: "something went wrong", wantType: soft, category: BounceCategoryUnknown},
+		{name: "invalid provider hint is ignored", hint: "permanent", wantType: soft, category: BounceCategoryUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyBounce(tt.status, tt.diagnostic, tt.hint)
+			if got.Type != tt.wantType || got.Category != tt.category || got.Status != tt.code {
+				t.Errorf("ClassifyBounce(%q, %q, %q) = %+v, want {Type:%s Category:%s Status:%s}",
+					tt.status, tt.diagnostic, tt.hint, got, tt.wantType, tt.category, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,672 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+	"gorm.io/gorm"
+)
+
+const (
+	deliveryBatchSize     = 100
+	deliveryMaxAttempts   = 3
+	deliveryRetryBase     = time.Minute      // wait before the first retry, doubling with each attempt
+	deliveryRetryMax      = 30 * time.Minute // longest wait between retries
+	deliveryStaleAfter    = 10 * time.Minute // claimed rows older than this are released
+	campaignIdleAfter     = 2 * time.Minute  // campaigns without activity this long are resumed
+	campaignSliceDuration = 4 * time.Minute  // work per job before handing off to a new one
+
+	// While throttled, sends go out in small batches with a pause in between
+	throttledBatchSize = 10
+	throttleDelay      = 30 * time.Second
+)
+
+// SendCampaignPayload is the queued payload that drives a campaign send
+type SendCampaignPayload struct {
+	CampaignID uuid.UUID `json:"campaignId"`
+}
+
+// sendConcurrency is how many messages a worker sends in parallel
+func sendConcurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("CAMPAIGN_SEND_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// createDeliveries records one pending delivery per target subscriber. It is
+// idempotent, so it can be re-run for a campaign that was interrupted.
+func (s *CampaignService) createDeliveries(campaign *models.Campaign) (int64, error) {
+	args := []interface{}{campaign.ID}
+	query := `INSERT INTO campaign_deliveries (campaign_id, subscriber_id, mailbox_provider, status, attempts, created_at, updated_at)
+		SELECT DISTINCT ?, subscribers.id, ` + mailboxProviderSQL("subscribers.email") + `, 'pending', 0, NOW(), NOW() FROM subscribers`
+
+	// If campaign has target tags, filter by them
+	if len(campaign.TargetTags) > 0 {
+		tagIDs := make([]uuid.UUID, len(campaign.TargetTags))
+		for i, tag := range campaign.TargetTags {
+			tagIDs[i] = tag.ID
+		}
+		query += ` JOIN subscriber_tags ON subscriber_tags.subscriber_id = subscribers.id AND subscriber_tags.tag_id IN ?`
+		args = append(args, tagIDs)
+	}
+
+	query += ` WHERE subscribers.creator_id = ? AND subscribers.status = ?
+		AND NOT EXISTS (
+			SELECT 1 FROM suppressions
+			WHERE suppressions.email = LOWER(TRIM(subscribers.email))
+			AND (suppressions.creator_id IS NULL OR suppressions.creator_id = ?)
+		)
+		ON CONFLICT (campaign_id, subscriber_id) DO NOTHING`
+	args = append(args, campaign.CreatorID, models.SubscriberStatusActive, campaign.CreatorID)
+
+	if err := s.db.Exec(query, args...).Error; err != nil {
+		return 0, errors.New("failed to prepare campaign recipients")
+	}
+
+	var total int64
+	s.db.Model(&models.CampaignDelivery{}).Where("campaign_id = ?", campaign.ID).Count(&total)
+
+	// An A/B test sends its variants to a slice first and holds the rest
+	if _, err := s.startTest(campaign); err != nil {
+		log.Printf("[ABTest] Failed to start test for campaign %s: %v", campaign.ID, err)
+		return 0, errors.New("failed to start A/B test")
+	}
+
+	if err := s.planDeliveries(campaign, total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// planDeliveries sets when a campaign's pending deliveries go out: within the
+// warm-up cap, at local time, at each subscriber's best hour, or spread over
+// the send window
+func (s *CampaignService) planDeliveries(campaign *models.Campaign, total int64) error {
+	// A creator still warming up a domain sends at most the day's cap
+	scheduled, err := s.warmup.Schedule(campaign)
+	if err != nil {
+		log.Printf("[Warmup] Failed to schedule campaign %s: %v", campaign.ID, err)
+		return errors.New("failed to schedule warm-up sends")
+	}
+	if scheduled {
+		return nil
+	}
+
+	// Local-time sends roll through the subscribers' timezones
+	if campaign.LocalSendAt != nil {
+		if err := s.planLocalTime(campaign); err != nil {
+			log.Printf("Failed to plan local-time send for campaign %s: %v", campaign.ID, err)
+			return errors.New("failed to schedule local-time sends")
+		}
+		return nil
+	}
+
+	// Optimized sends go out at each subscriber's best hour instead of a window
+	if campaign.OptimizeSendTime {
+		err := s.sendTime.Plan(campaign, time.Now())
+		if err == nil {
+			return nil
+		}
+		log.Printf("[SendTime] Failed to time campaign %s, sending without optimization: %v", campaign.ID, err)
+	}
+
+	if window := s.sendWindow(campaign, total); window > 0 {
+		s.spreadDeliveries(campaign.ID, window)
+	}
+	return nil
+}
+
+// sendWindow is how long a send should be spread over: the campaign's own
+// window, or a default one for sends above CAMPAIGN_SPREAD_THRESHOLD recipients
+func (s *CampaignService) sendWindow(campaign *models.Campaign, total int64) time.Duration {
+	if campaign.SendWindowMinutes != nil {
+		return time.Duration(*campaign.SendWindowMinutes) * time.Minute
+	}
+	if total >= int64(envInt("CAMPAIGN_SPREAD_THRESHOLD", 10000)) {
+		return time.Duration(envInt("CAMPAIGN_SPREAD_MINUTES", 60)) * time.Minute
+	}
+	return 0
+}
+
+// spreadDeliveries staggers the not-before times of pending deliveries evenly
+// across the window. Delivery IDs are random, so providers are interleaved.
+func (s *CampaignService) spreadDeliveries(campaignID uuid.UUID, window time.Duration) {
+	err := s.db.Exec(`UPDATE campaign_deliveries SET not_before = ? + spread.slot * (? * INTERVAL '1 millisecond')
+		FROM (
+			SELECT id, (ROW_NUMBER() OVER (ORDER BY id) - 1)::float / COUNT(*) OVER () AS slot
+			FROM campaign_deliveries
+			WHERE campaign_id = ? AND status = ?
+		) spread
+		WHERE campaign_deliveries.id = spread.id`,
+		time.Now(), window.Milliseconds(), campaignID, models.DeliveryStatusPending,
+	).Error
+	if err != nil {
+		log.Printf("Failed to spread campaign %s over %s: %v", campaignID, window, err)
+	}
+}
+
+func (s *CampaignService) enqueueSend(campaignID uuid.UUID) error {
+	_, err := queue.Enqueue(queue.TypeSendCampaign, SendCampaignPayload{CampaignID: campaignID})
+	return err
+}
+
+// ProcessDeliveries sends pending deliveries in batches. It returns done=false
+// when its time slice ran out with work left, so the caller can hand the rest
+// to a new job instead of holding one for the whole campaign.
+func (s *CampaignService) ProcessDeliveries(ctx context.Context, campaignID uuid.UUID) (bool, error) {
+	sliceEnd := time.Now().Add(campaignSliceDuration)
+
+	for {
+		var campaign models.Campaign
+		if err := s.db.First(&campaign, "id = ?", campaignID).Error; err != nil {
+			return true, errors.New("campaign not found")
+		}
+		if campaign.Status != models.CampaignStatusSending {
+			return true, nil
+		}
+
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if time.Now().After(sliceEnd) {
+			return false, nil
+		}
+
+		// The circuit breaker may slow the send down or pause it outright
+		batchSize := deliveryBatchSize
+		switch s.guard.Check(&campaign) {
+		case SendActionPause:
+			return true, nil
+		case SendActionThrottle:
+			batchSize = throttledBatchSize
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(throttleDelay):
+			}
+		}
+
+		batch, err := s.claimDeliveries(campaignID, batchSize, s.throttle.Blocked())
+		if err != nil {
+			return false, err
+		}
+		if len(batch) == 0 {
+			// Recipients may be held back by a send window or a throttled provider
+			next := s.nextDue(campaignID)
+			if next == nil {
+				return true, s.finishIfComplete(&campaign)
+			}
+			wait := time.Until(*next)
+			if wait > campaignSliceDuration {
+				// Nothing due for a while, e.g. the next timezone of a
+				// local-time send: free the worker until then
+				return true, s.waitForNextWave(&campaign, *next)
+			}
+			if wait < time.Second {
+				wait = time.Second
+			}
+			if remaining := time.Until(sliceEnd); wait > remaining {
+				wait = remaining
+			}
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		s.sendBatch(&campaign, batch)
+	}
+}
+
+// claimDeliveries marks a batch of pending rows as sending. SKIP LOCKED lets
+// several workers share one campaign without claiming the same recipient.
+// Rows that are not due yet, or whose mailbox provider is blocked, are left.
+func (s *CampaignService) claimDeliveries(campaignID uuid.UUID, limit int, blockedProviders []string) ([]models.CampaignDelivery, error) {
+	var batch []models.CampaignDelivery
+	now := time.Now()
+
+	args := []interface{}{models.DeliveryStatusSending, now, now, campaignID, models.DeliveryStatusPending, now}
+	providerFilter := ""
+	if len(blockedProviders) > 0 {
+		providerFilter = "AND COALESCE(mailbox_provider, '') NOT IN ?"
+		args = append(args, blockedProviders)
+	}
+	args = append(args, limit)
+
+	err := s.db.Raw(`UPDATE campaign_deliveries
+		SET status = ?, claimed_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM campaign_deliveries
+			WHERE campaign_id = ? AND status = ? AND (not_before IS NULL OR not_before <= ?)
+			`+providerFilter+`
+			ORDER BY not_before NULLS FIRST, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		args...,
+	).Scan(&batch).Error
+
+	return batch, err
+}
+
+// nextDue returns when the next pending delivery of a campaign can be sent,
+// or nil when none are pending
+func (s *CampaignService) nextDue(campaignID uuid.UUID) *time.Time {
+	var pending int64
+	s.db.Model(&models.CampaignDelivery{}).
+		Where("campaign_id = ? AND status = ?", campaignID, models.DeliveryStatusPending).
+		Count(&pending)
+	if pending == 0 {
+		return nil
+	}
+
+	var next struct{ NotBefore *time.Time }
+	s.db.Model(&models.CampaignDelivery{}).
+		Select("MIN(not_before) as not_before").
+		Where("campaign_id = ? AND status = ? AND not_before > ?", campaignID, models.DeliveryStatusPending, time.Now()).
+		Scan(&next)
+	if next.NotBefore != nil {
+		return next.NotBefore
+	}
+	// Due now, but every remaining provider is over its budget for this minute
+	soon := time.Now().Add(5 * time.Second)
+	return &soon
+}
+
+// sendBatch sends a claimed batch with bounded concurrency
+func (s *CampaignService) sendBatch(campaign *models.Campaign, batch []models.CampaignDelivery) {
+	subscriberIDs := make([]uuid.UUID, len(batch))
+	for i, d := range batch {
+		subscriberIDs[i] = d.SubscriberID
+	}
+
+	var subscribers []models.Subscriber
+	s.db.Where("id IN ?", subscriberIDs).Find(&subscribers)
+
+	variants := make(map[uuid.UUID]*models.CampaignVariant)
+	if list, err := s.variants(campaign.ID); err == nil {
+		for i := range list {
+			variants[list[i].ID] = &list[i]
+		}
+	}
+	winner := s.testWinner(campaign.ID, variants)
+	byID := make(map[uuid.UUID]*models.Subscriber, len(subscribers))
+	emails := make([]string, len(subscribers))
+	for i := range subscribers {
+		byID[subscribers[i].ID] = &subscribers[i]
+		emails[i] = subscribers[i].Email
+	}
+
+	// Addresses may have been suppressed since the deliveries were created
+	suppressed, err := s.suppressions.Suppressed(emails, campaign.CreatorID)
+	if err != nil {
+		log.Printf("Failed to check suppressions for campaign %s: %v", campaign.ID, err)
+	}
+
+	sem := make(chan struct{}, sendConcurrency())
+	var wg sync.WaitGroup
+	var sent int64
+
+	for i := range batch {
+		delivery := &batch[i]
+		sub, ok := byID[delivery.SubscriberID]
+		if !ok || sub.Status != models.SubscriberStatusActive || suppressed[NormalizeEmail(sub.Email)] {
+			s.updateDelivery(delivery, models.DeliveryStatusSkipped, nil)
+			continue
+		}
+
+		if delivery.MailboxProvider == "" {
+			delivery.MailboxProvider = MailboxProviderFor(sub.Email)
+		}
+		provider := delivery.MailboxProvider
+		if !s.throttle.Allow(provider) {
+			// Over the provider's rate; try again next minute
+			next := time.Now().Truncate(time.Minute).Add(time.Minute)
+			if until := s.throttle.DeferredUntil(provider); until.After(next) {
+				next = until
+			}
+			s.holdDelivery(delivery, next, true)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.throttle.Acquire(provider)
+			defer s.throttle.Release(provider)
+			variant := winner
+			if delivery.VariantID != nil {
+				variant = variants[*delivery.VariantID]
+			}
+			if s.deliver(campaign, variant, delivery, sub) {
+				atomic.AddInt64(&sent, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if sent > 0 {
+		if err := s.deliverability.RecordSend(campaign.CreatorID, sent); err != nil {
+			log.Printf("Failed to record sends for campaign %s: %v", campaign.ID, err)
+		}
+		if err := s.warmup.RecordSent(campaign.CreatorID, sent); err != nil {
+			log.Printf("[Warmup] Failed to record sends for campaign %s: %v", campaign.ID, err)
+		}
+	}
+}
+
+// deliver sends the campaign to one subscriber and records the outcome. It
+// reports whether the message was accepted by the provider.
+func (s *CampaignService) deliver(campaign *models.Campaign, variant *models.CampaignVariant, delivery *models.CampaignDelivery, sub *models.Subscriber) bool {
+	firstName := ""
+	lastName := ""
+	if sub.FirstName != nil {
+		firstName = *sub.FirstName
+	}
+	if sub.LastName != nil {
+		lastName = *sub.LastName
+	}
+
+	// Render email content with subscriber data
+	content := contentFor(campaign, variant)
+	htmlContent := content.content
+	if content.htmlContent != nil && *content.htmlContent != "" {
+		rendered, err := s.mailer.RenderTemplate(*content.htmlContent, sub, campaign)
+		if err == nil {
+			htmlContent = rendered
+		}
+	}
+	htmlContent = withPreheader(htmlContent, content.previewText)
+
+	// Add our open pixel and click-tracking links
+	tracked := false
+	if instrumented, err := s.tracking.Instrument(htmlContent, campaign.ID, sub.ID); err == nil {
+		htmlContent = instrumented
+		tracked = true
+	} else if !errors.Is(err, ErrTrackingNotConfigured) {
+		log.Printf("Failed to add tracking to campaign %s: %v", campaign.ID, err)
+	}
+
+	req := &EmailRequest{
+		To: EmailRecipient{
+			Email:            sub.Email,
+			FirstName:        firstName,
+			LastName:         lastName,
+			UnsubscribeToken: sub.UnsubscribeToken,
+		},
+		Subject:      content.subject,
+		HTMLContent:  htmlContent,
+		TextContent:  content.content,
+		FromName:     content.fromName,
+		CampaignID:   campaign.ID.String(),
+		Tracked:      tracked,
+		Class:        models.MessageClassBulk,
+		CreatorID:    &campaign.CreatorID,
+		SubscriberID: &sub.ID,
+	}
+	if delivery.MessageID != nil {
+		req.MessageID = *delivery.MessageID
+	}
+
+	_, err := s.mailer.Send(req)
+	if req.MessageID != uuid.Nil {
+		delivery.MessageID = &req.MessageID
+	}
+
+	if err == nil {
+		s.updateDelivery(delivery, models.DeliveryStatusSent, nil)
+		return true
+	}
+	if errors.Is(err, ErrRecipientSuppressed) {
+		s.updateDelivery(delivery, models.DeliveryStatusSkipped, err)
+		return false
+	}
+
+	// A 4xx reply is the receiving provider deferring us: back off from it
+	// and hold the recipient until the backoff ends
+	var perr *ProviderError
+	if errors.As(err, &perr) && perr.SMTPCode >= 400 && perr.SMTPCode < 500 {
+		until := s.throttle.Defer(delivery.MailboxProvider)
+		log.Printf("[Mailer] %s deferred campaign %s, backing off until %s", delivery.MailboxProvider, campaign.ID, until.Format(time.RFC3339))
+		if delivery.Attempts < deliveryMaxAttempts {
+			s.holdDelivery(delivery, until, false)
+			return false
+		}
+	}
+
+	// Transient provider failures, and sends held back because the suppression
+	// list couldn't be read, go back in the pool for another attempt
+	transient := (perr != nil && perr.Retryable()) || errors.Is(err, ErrSuppressionCheckFailed)
+	if transient && delivery.Attempts < deliveryMaxAttempts {
+		s.retryDelivery(delivery, err)
+		return false
+	}
+	s.updateDelivery(delivery, models.DeliveryStatusFailed, err)
+	return false
+}
+
+// retryDelivery returns a delivery that failed transiently to the pool,
+// backing off exponentially with each attempt
+func (s *CampaignService) retryDelivery(delivery *models.CampaignDelivery, sendErr error) {
+	delay := deliveryRetryMax
+	if delivery.Attempts > 0 {
+		delay = deliveryRetryBase << uint(delivery.Attempts-1)
+	}
+	if delay <= 0 || delay > deliveryRetryMax {
+		delay = deliveryRetryMax
+	}
+
+	updates := map[string]interface{}{
+		"status":     models.DeliveryStatusPending,
+		"not_before": time.Now().Add(delay),
+		"last_error": sendErr.Error(),
+		"updated_at": time.Now(),
+	}
+	if delivery.MessageID != nil {
+		updates["message_id"] = *delivery.MessageID
+	}
+	if err := s.db.Model(&models.CampaignDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to reschedule delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// holdDelivery returns a claimed delivery to the pool until the given time.
+// Set notAttempted when nothing was sent, so the claim isn't counted.
+func (s *CampaignService) holdDelivery(delivery *models.CampaignDelivery, until time.Time, notAttempted bool) {
+	updates := map[string]interface{}{
+		"status":           models.DeliveryStatusPending,
+		"not_before":       until,
+		"mailbox_provider": delivery.MailboxProvider,
+		"updated_at":       time.Now(),
+	}
+	if notAttempted {
+		updates["attempts"] = gorm.Expr("GREATEST(attempts - 1, 0)")
+	}
+	if delivery.MessageID != nil {
+		updates["message_id"] = *delivery.MessageID
+	}
+	if err := s.db.Model(&models.CampaignDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to hold delivery %s: %v", delivery.ID, err)
+	}
+}
+
+func (s *CampaignService) updateDelivery(delivery *models.CampaignDelivery, status models.DeliveryStatus, sendErr error) {
+	updates := map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	if status == models.DeliveryStatusSent {
+		updates["sent_at"] = time.Now()
+		updates["last_error"] = nil
+	}
+	if sendErr != nil {
+		updates["last_error"] = sendErr.Error()
+	}
+	if delivery.MessageID != nil {
+		updates["message_id"] = *delivery.MessageID
+	}
+
+	if err := s.db.Model(&models.CampaignDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// finishIfComplete marks the campaign sent once no delivery is outstanding
+func (s *CampaignService) finishIfComplete(campaign *models.Campaign) error {
+	progress, err := s.progress(campaign)
+	if err != nil {
+		return err
+	}
+	if progress.Pending > 0 || progress.Sending > 0 {
+		// Another worker still holds part of the campaign
+		return nil
+	}
+	if progress.Held > 0 {
+		// The A/B test slice is out; the rest waits for the winner
+		return s.waitForWinner(campaign)
+	}
+
+	var stats models.CampaignStats
+	if campaign.Stats != nil {
+		json.Unmarshal([]byte(*campaign.Stats), &stats)
+	}
+	stats.TotalRecipients = int(progress.Total)
+	stats.Sent = int(progress.Sent)
+	statsJSON, _ := json.Marshal(stats)
+
+	now := time.Now()
+	result := s.db.Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusSending).
+		Updates(map[string]interface{}{
+			"status":  models.CampaignStatusSent,
+			"sent_at": now,
+			"stats":   string(statsJSON),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	// Pick up delivery and engagement events that arrived during the send
+	if _, err := s.AggregateStats(campaign.ID); err != nil {
+		log.Printf("Failed to aggregate stats for campaign %s: %v", campaign.ID, err)
+	}
+	return nil
+}
+
+// ResumeStalledSends picks up campaigns left in sending, e.g. after a restart.
+// Rows claimed by a worker that died are released back to pending; sends with
+// no recent activity are queued again and continue from the first pending row.
+func (s *CampaignService) ResumeStalledSends() {
+	s.db.Model(&models.CampaignDelivery{}).
+		Where("status = ? AND claimed_at < ?", models.DeliveryStatusSending, time.Now().Add(-deliveryStaleAfter)).
+		Updates(map[string]interface{}{"status": models.DeliveryStatusPending, "updated_at": time.Now()})
+
+	var campaigns []models.Campaign
+	s.db.Preload("TargetTags").
+		Where("status = ?", models.CampaignStatusSending).
+		Where("next_send_at IS NULL"). // waiting for its next wave, see StartDueWaves
+		Where("updated_at < ?", time.Now().Add(-campaignIdleAfter)).
+		Where("NOT EXISTS (SELECT 1 FROM campaign_deliveries d WHERE d.campaign_id = campaigns.id AND d.updated_at >= ?)", time.Now().Add(-campaignIdleAfter)).
+		Find(&campaigns)
+
+	for i := range campaigns {
+		campaign := &campaigns[i]
+
+		// The send was claimed but its recipients were never recorded
+		var count int64
+		s.db.Model(&models.CampaignDelivery{}).Where("campaign_id = ?", campaign.ID).Count(&count)
+		if count == 0 {
+			if _, err := s.createDeliveries(campaign); err != nil {
+				log.Printf("Failed to prepare recipients for campaign %s: %v", campaign.ID, err)
+				continue
+			}
+		}
+
+		log.Printf("Resuming campaign send: %s", campaign.Title)
+		if err := s.enqueueSend(campaign.ID); err != nil {
+			log.Printf("Failed to enqueue campaign %s: %v", campaign.ID, err)
+		}
+	}
+}
+
+// GetProgress reports how far a campaign send has got
+func (s *CampaignService) GetProgress(id uuid.UUID, creatorID uuid.UUID) (*models.CampaignProgress, error) {
+	campaign, err := s.FindByID(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	return s.progress(campaign)
+}
+
+func (s *CampaignService) progress(campaign *models.Campaign) (*models.CampaignProgress, error) {
+	var rows []struct {
+		Status models.DeliveryStatus
+		Count  int64
+	}
+	err := s.db.Model(&models.CampaignDelivery{}).
+		Select("status, COUNT(*) as count").
+		Where("campaign_id = ?", campaign.ID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &models.CampaignProgress{
+		CampaignID: campaign.ID,
+		Status:     campaign.Status,
+	}
+	for _, row := range rows {
+		progress.Total += row.Count
+		switch row.Status {
+		case models.DeliveryStatusPending:
+			progress.Pending = row.Count
+		case models.DeliveryStatusSending:
+			progress.Sending = row.Count
+		case models.DeliveryStatusSent:
+			progress.Sent = row.Count
+		case models.DeliveryStatusFailed:
+			progress.Failed = row.Count
+		case models.DeliveryStatusSkipped:
+			progress.Skipped = row.Count
+		case models.DeliveryStatusHeld:
+			progress.Held = row.Count
+		}
+	}
+
+	if progress.Total > 0 {
+		done := progress.Sent + progress.Failed + progress.Skipped
+		progress.Percent = float64(done) * 100 / float64(progress.Total)
+	}
+
+	if campaign.LocalSendAt != nil {
+		if progress.Timezones, err = s.timezoneProgress(campaign.ID); err != nil {
+			return nil, err
+		}
+		progress.NextSendAt = campaign.NextSendAt
+		for _, zone := range progress.Timezones {
+			if zone.Status == "waiting" && (progress.NextSendAt == nil || zone.SendAt.Before(*progress.NextSendAt)) {
+				progress.NextSendAt = zone.SendAt
+			}
+		}
+	}
+
+	return progress, nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// statsTimelineHours is how much of the post-send engagement curve is kept
+const statsTimelineHours = 72
+
+// AggregateStats recomputes a campaign's counters from its deliveries and
+// email events. Unique counts are deduplicated per subscriber, and machine
+// opens and clicks are kept apart from human ones. It is idempotent and runs
+// on a schedule while a campaign is still collecting engagement.
+func (s *CampaignService) AggregateStats(campaignID uuid.UUID) (*models.CampaignStats, error) {
+	var campaign models.Campaign
+	if err := s.db.First(&campaign, "id = ?", campaignID).Error; err != nil {
+		return nil, errors.New("campaign not found")
+	}
+
+	var stats models.CampaignStats
+	if campaign.Stats != nil {
+		json.Unmarshal([]byte(*campaign.Stats), &stats)
+	}
+
+	// Recipient counts come from the delivery rows when the campaign has them
+	if progress, err := s.progress(&campaign); err == nil && progress.Total > 0 {
+		stats.TotalRecipients = int(progress.Total)
+		stats.Sent = int(progress.Sent)
+	}
+
+	if err := s.aggregateEvents(campaignID, &stats); err != nil {
+		return nil, err
+	}
+
+	links, err := s.aggregateLinks(campaignID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Links = links
+
+	timeline, err := s.aggregateTimeline(&campaign)
+	if err != nil {
+		return nil, err
+	}
+	stats.Timeline = timeline
+
+	if err := s.aggregatePlacement(&campaign); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	stats.AggregatedAt = &now
+
+	statsJSON, _ := json.Marshal(stats)
+	if err := s.db.Model(&campaign).Update("stats", string(statsJSON)).Error; err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// aggregateEvents fills the per-type totals and unique counts
+func (s *CampaignService) aggregateEvents(campaignID uuid.UUID, stats *models.CampaignStats) error {
+	var rows []struct {
+		EventType models.EmailEventType
+		IsMachine bool
+		Total     int
+		Unique    int
+	}
+	err := s.db.Model(&models.EmailEvent{}).
+		Select("event_type, is_machine, COUNT(*) as total, COUNT(DISTINCT subscriber_id) as \"unique\"").
+		Where("campaign_id = ?", campaignID).
+		Group("event_type, is_machine").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	// Reset so event types that no longer have rows don't keep stale counts
+	stats.Delivered, stats.Bounces, stats.Complaints, stats.Unsubscribes = 0, 0, 0, 0
+	stats.Opens, stats.UniqueOpens, stats.Clicks, stats.UniqueClicks = 0, 0, 0, 0
+	stats.MachineOpens, stats.MachineClicks = 0, 0
+
+	for _, row := range rows {
+		if row.IsMachine {
+			switch row.EventType {
+			case models.EmailEventOpen:
+				stats.MachineOpens = row.Total
+			case models.EmailEventClick:
+				stats.MachineClicks = row.Total
+			}
+			continue
+		}
+
+		switch row.EventType {
+		case models.EmailEventDelivered:
+			stats.Delivered = row.Unique
+		case models.EmailEventOpen:
+			stats.Opens = row.Total
+			stats.UniqueOpens = row.Unique
+		case models.EmailEventClick:
+			stats.Clicks = row.Total
+			stats.UniqueClicks = row.Unique
+		case models.EmailEventBounce:
+			stats.Bounces = row.Unique
+		case models.EmailEventComplaint:
+			stats.Complaints = row.Unique
+		case models.EmailEventUnsubscribe:
+			stats.Unsubscribes = row.Unique
+		}
+	}
+
+	return nil
+}
+
+// aggregateLinks counts human clicks per link URL, most clicked first
+func (s *CampaignService) aggregateLinks(campaignID uuid.UUID) ([]models.LinkStats, error) {
+	var rows []struct {
+		URL    string
+		Total  int
+		Unique int
+	}
+	err := s.db.Model(&models.EmailEvent{}).
+		Select("metadata->>'url' as url, COUNT(*) as total, COUNT(DISTINCT subscriber_id) as \"unique\"").
+		Where("campaign_id = ? AND event_type = ? AND is_machine = ? AND metadata->>'url' IS NOT NULL",
+			campaignID, models.EmailEventClick, false).
+		Group("metadata->>'url'").
+		Order("total DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var campaignLinks []models.CampaignLink
+	s.db.Where("campaign_id = ?", campaignID).Find(&campaignLinks)
+	linkIDs := make(map[string]uuid.UUID, len(campaignLinks))
+	for _, link := range campaignLinks {
+		linkIDs[link.URL] = link.ID
+	}
+
+	links := make([]models.LinkStats, len(rows))
+	for i, row := range rows {
+		links[i] = models.LinkStats{
+			URL:          row.URL,
+			Clicks:       row.Total,
+			UniqueClicks: row.Unique,
+		}
+		if id, ok := linkIDs[row.URL]; ok {
+			links[i].LinkID = &id
+		}
+	}
+	return links, nil
+}
+
+// aggregateTimeline buckets human opens and clicks by hour for the first 72
+// hours after sending started
+func (s *CampaignService) aggregateTimeline(campaign *models.Campaign) ([]models.StatsBucket, error) {
+	start := s.sendStartedAt(campaign)
+	if start == nil {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Hour      int
+		EventType models.EmailEventType
+		Total     int
+	}
+	err := s.db.Model(&models.EmailEvent{}).
+		Select("FLOOR(EXTRACT(EPOCH FROM created_at - ?) / 3600)::int as hour, event_type, COUNT(*) as total", *start).
+		Where("campaign_id = ? AND event_type IN ? AND is_machine = ? AND created_at >= ? AND created_at < ?",
+			campaign.ID, []models.EmailEventType{models.EmailEventOpen, models.EmailEventClick}, false,
+			*start, start.Add(statsTimelineHours*time.Hour)).
+		Group("hour, event_type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := make([]models.StatsBucket, statsTimelineHours)
+	for i := range timeline {
+		timeline[i].Hour = i
+	}
+	for _, row := range rows {
+		if row.Hour < 0 || row.Hour >= statsTimelineHours {
+			continue
+		}
+		if row.EventType == models.EmailEventOpen {
+			timeline[row.Hour].Opens = row.Total
+		} else {
+			timeline[row.Hour].Clicks = row.Total
+		}
+	}
+
+	// Don't report empty hours that haven't happened yet
+	elapsed := int(time.Since(*start).Hours()) + 1
+	if elapsed < statsTimelineHours {
+		timeline = timeline[:elapsed]
+	}
+	return timeline, nil
+}
+
+// sendStartedAt is when the first message of the campaign went out
+func (s *CampaignService) sendStartedAt(campaign *models.Campaign) *time.Time {
+	var first struct {
+		Started *time.Time
+	}
+	s.db.Model(&models.CampaignDelivery{}).
+		Select("MIN(sent_at) as started").
+		Where("campaign_id = ?", campaign.ID).
+		Scan(&first)
+	if first.Started != nil {
+		return first.Started
+	}
+	return campaign.SentAt
+}
+
+// aggregatePlacement writes per mailbox provider inbox estimates to
+// InboxPlacement. A recipient who opened or clicked is counted as inboxed and
+// one who complained as spam; the rest are unknown. Campaigns sent to seed
+// mailboxes keep their measured placement instead.
+func (s *CampaignService) aggregatePlacement(campaign *models.Campaign) error {
+	var seeds int64
+	s.db.Model(&models.SeedPlacement{}).Where("campaign_id = ?", campaign.ID).Count(&seeds)
+	if seeds > 0 {
+		return nil
+	}
+
+	var rows []struct {
+		Provider string
+		Sent     int
+		Inbox    int
+		Spam     int
+	}
+	err := s.db.Raw(`SELECT COALESCE(NULLIF(d.mailbox_provider, ''), ?) AS provider,
+			COUNT(*) AS sent,
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM email_events e
+				WHERE e.campaign_id = d.campaign_id AND e.subscriber_id = d.subscriber_id
+				AND e.event_type IN ? AND e.is_machine = FALSE
+			)) AS inbox,
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM email_events e
+				WHERE e.campaign_id = d.campaign_id AND e.subscriber_id = d.subscriber_id
+				AND e.event_type = ?
+			)) AS spam
+		FROM campaign_deliveries d
+		WHERE d.campaign_id = ? AND d.status = ?
+		GROUP BY 1`,
+		MailboxOther, []models.EmailEventType{models.EmailEventOpen, models.EmailEventClick},
+		models.EmailEventComplaint, campaign.ID, models.DeliveryStatusSent,
+	).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		placement := models.InboxPlacement{
+			CreatorID:  campaign.CreatorID,
+			CampaignID: campaign.ID,
+			Provider:   row.Provider,
+			Source:     InboxPlacementEstimate,
+			TotalSent:  row.Sent,
+			InboxCount: row.Inbox,
+			SpamCount:  row.Spam,
+		}
+		placement.UnknownCount = int(max(int64(row.Sent-row.Inbox-row.Spam), 0))
+		if row.Sent > 0 {
+			placement.InboxRate = float64(row.Inbox) / float64(row.Sent) * 100
+		}
+
+		err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "campaign_id"}, {Name: "provider"}},
+			DoUpdates: clause.AssignmentColumns([]string{"total_sent", "inbox_count", "spam_count", "unknown_count", "inbox_rate", "updated_at"}),
+		}).Create(&placement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,669 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCampaignTestNotFound = errors.New("campaign has no A/B test")
+	ErrVariantNotFound      = errors.New("variant not found")
+	ErrCampaignTestLocked   = errors.New("A/B test can only be changed before the campaign is sent")
+	ErrCampaignTestDecided  = errors.New("A/B test is not waiting for a winner")
+)
+
+// significanceLevel is the confidence, in percent, at which a test's leader
+// is reported as significant
+const significanceLevel = 95.0
+
+type CampaignTestRequest struct {
+	Percent     int    `json:"percent" binding:"required,min=1,max=100"`        // share of recipients the variants go to
+	WaitMinutes int    `json:"waitMinutes" binding:"required,min=10,max=10080"` // before the winner is picked
+	Metric      string `json:"metric" binding:"required,oneof=opens clicks revenue"`
+}
+
+type CampaignVariantRequest struct {
+	Name        string  `json:"name" binding:"required,max=50"`
+	Subject     *string `json:"subject,omitempty"`
+	PreviewText *string `json:"previewText,omitempty"`
+	Content     *string `json:"content,omitempty"`
+	HTMLContent *string `json:"htmlContent,omitempty"`
+	FromName    *string `json:"fromName,omitempty"`
+}
+
+// editableTest loads a campaign and its test for changes, which are only
+// allowed until the campaign starts sending
+func (s *CampaignService) editableTest(campaignID, creatorID uuid.UUID) (*models.Campaign, *models.CampaignTest, error) {
+	campaign, err := s.FindByID(campaignID, creatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if campaign.Status != models.CampaignStatusDraft && campaign.Status != models.CampaignStatusScheduled {
+		return nil, nil, ErrCampaignTestLocked
+	}
+
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ?", campaign.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return campaign, nil, nil
+		}
+		return nil, nil, err
+	}
+	return campaign, &test, nil
+}
+
+// SetTest sets up or changes a campaign's A/B test
+func (s *CampaignService) SetTest(campaignID, creatorID uuid.UUID, req *CampaignTestRequest) (*models.CampaignTest, error) {
+	campaign, test, err := s.editableTest(campaignID, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.LocalSendAt != nil || campaign.OptimizeSendTime {
+		return nil, errors.New("A/B tests can't be combined with local-time or optimized send times")
+	}
+
+	if test == nil {
+		test = &models.CampaignTest{CampaignID: campaign.ID, Status: models.CampaignTestDraft}
+	}
+	test.Percent = req.Percent
+	test.WaitMinutes = req.WaitMinutes
+	test.Metric = req.Metric
+
+	if err := s.db.Save(test).Error; err != nil {
+		return nil, errors.New("failed to save A/B test")
+	}
+	return test, nil
+}
+
+// DeleteTest removes a campaign's A/B test and its variants
+func (s *CampaignService) DeleteTest(campaignID, creatorID uuid.UUID) error {
+	campaign, test, err := s.editableTest(campaignID, creatorID)
+	if err != nil {
+		return err
+	}
+	if test == nil {
+		return ErrCampaignTestNotFound
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campaign_id = ?", campaign.ID).Delete(&models.CampaignVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(test).Error
+	})
+}
+
+// AddVariant adds a version of the campaign to its A/B test
+func (s *CampaignService) AddVariant(campaignID, creatorID uuid.UUID, req *CampaignVariantRequest) (*models.CampaignVariant, error) {
+	campaign, test, err := s.editableTest(campaignID, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if test == nil {
+		return nil, ErrCampaignTestNotFound
+	}
+
+	variant := &models.CampaignVariant{CampaignID: campaign.ID}
+	applyVariantRequest(variant, req)
+	if err := s.db.Create(variant).Error; err != nil {
+		return nil, errors.New("failed to create variant")
+	}
+	return variant, nil
+}
+
+// UpdateVariant replaces a variant's fields
+func (s *CampaignService) UpdateVariant(campaignID, variantID, creatorID uuid.UUID, req *CampaignVariantRequest) (*models.CampaignVariant, error) {
+	campaign, _, err := s.editableTest(campaignID, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var variant models.CampaignVariant
+	if err := s.db.First(&variant, "id = ? AND campaign_id = ?", variantID, campaign.ID).Error; err != nil {
+		return nil, ErrVariantNotFound
+	}
+	applyVariantRequest(&variant, req)
+	if err := s.db.Save(&variant).Error; err != nil {
+		return nil, errors.New("failed to update variant")
+	}
+	return &variant, nil
+}
+
+// DeleteVariant removes a variant from the test
+func (s *CampaignService) DeleteVariant(campaignID, variantID, creatorID uuid.UUID) error {
+	campaign, _, err := s.editableTest(campaignID, creatorID)
+	if err != nil {
+		return err
+	}
+
+	result := s.db.Where("id = ? AND campaign_id = ?", variantID, campaign.ID).Delete(&models.CampaignVariant{})
+	if result.Error != nil {
+		return errors.New("failed to delete variant")
+	}
+	if result.RowsAffected == 0 {
+		return ErrVariantNotFound
+	}
+	return nil
+}
+
+func applyVariantRequest(variant *models.CampaignVariant, req *CampaignVariantRequest) {
+	variant.Name = req.Name
+	variant.Subject = req.Subject
+	variant.PreviewText = req.PreviewText
+	variant.Content = req.Content
+	variant.HTMLContent = req.HTMLContent
+	variant.FromName = req.FromName
+}
+
+func (s *CampaignService) variants(campaignID uuid.UUID) ([]models.CampaignVariant, error) {
+	var variants []models.CampaignVariant
+	err := s.db.Where("campaign_id = ?", campaignID).Order("created_at, id").Find(&variants).Error
+	return variants, err
+}
+
+// checkTest makes sure a campaign's A/B test, if any, can run
+func (s *CampaignService) checkTest(campaign *models.Campaign) error {
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ?", campaign.ID).Error; err != nil {
+		return nil
+	}
+	var count int64
+	s.db.Model(&models.CampaignVariant{}).Where("campaign_id = ?", campaign.ID).Count(&count)
+	if count < 2 {
+		return errors.New("A/B test needs at least two variants")
+	}
+	return nil
+}
+
+// startTest splits the first Percent of a campaign's pending deliveries
+// evenly across its variants and holds the rest for the winner. It reports
+// whether the campaign has a test.
+func (s *CampaignService) startTest(campaign *models.Campaign) (bool, error) {
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ? AND status = ?", campaign.ID, models.CampaignTestDraft).Error; err != nil {
+		return false, nil
+	}
+	variants, err := s.variants(campaign.ID)
+	if err != nil || len(variants) < 2 {
+		return false, err
+	}
+
+	var pending int64
+	s.db.Model(&models.CampaignDelivery{}).
+		Where("campaign_id = ? AND status = ?", campaign.ID, models.DeliveryStatusPending).
+		Count(&pending)
+	size := (pending*int64(test.Percent) + 99) / 100
+	if size < int64(len(variants)) {
+		size = int64(len(variants))
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Delivery IDs are random, so ordering by their hash picks a random
+		// slice that stays the same for every variant's update
+		for i, variant := range variants {
+			if err := tx.Exec(`UPDATE campaign_deliveries SET variant_id = ?, updated_at = NOW()
+				WHERE id IN (
+					SELECT id FROM (
+						SELECT id, ROW_NUMBER() OVER (ORDER BY md5(id::text)) - 1 AS n
+						FROM campaign_deliveries
+						WHERE campaign_id = ? AND status = ?
+					) slice
+					WHERE n < ? AND n % ? = ?
+				)`,
+				variant.ID, campaign.ID, models.DeliveryStatusPending, size, len(variants), i,
+			).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.CampaignDelivery{}).
+			Where("campaign_id = ? AND status = ? AND variant_id IS NULL", campaign.ID, models.DeliveryStatusPending).
+			Updates(map[string]interface{}{"status": models.DeliveryStatusHeld, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		endsAt := time.Now().Add(time.Duration(test.WaitMinutes) * time.Minute)
+		return tx.Model(&test).Updates(map[string]interface{}{
+			"status":  models.CampaignTestRunning,
+			"ends_at": endsAt,
+		}).Error
+	})
+	return err == nil, err
+}
+
+// waitForWinner parks a send whose test slice is done until its winner is
+// picked
+func (s *CampaignService) waitForWinner(campaign *models.Campaign) error {
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ?", campaign.ID).Error; err != nil || test.EndsAt == nil {
+		return err
+	}
+	return s.waitForNextWave(campaign, *test.EndsAt)
+}
+
+// GetTestReport reports how each variant of a campaign's test is doing
+func (s *CampaignService) GetTestReport(campaignID, creatorID uuid.UUID) (*models.CampaignTestReport, error) {
+	campaign, err := s.FindByID(campaignID, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ?", campaign.ID).Error; err != nil {
+		return nil, ErrCampaignTestNotFound
+	}
+	return s.testReport(campaign, &test)
+}
+
+func (s *CampaignService) testReport(campaign *models.Campaign, test *models.CampaignTest) (*models.CampaignTestReport, error) {
+	variants, err := s.variants(campaign.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent []struct {
+		VariantID uuid.UUID
+		Count     int64
+	}
+	s.db.Model(&models.CampaignDelivery{}).
+		Select("variant_id, COUNT(*) as count").
+		Where("campaign_id = ? AND status = ? AND variant_id IS NOT NULL", campaign.ID, models.DeliveryStatusSent).
+		Group("variant_id").
+		Scan(&sent)
+
+	var engaged []struct {
+		VariantID uuid.UUID
+		EventType models.EmailEventType
+		Count     int64
+	}
+	s.db.Raw(`SELECT d.variant_id, e.event_type, COUNT(DISTINCT e.subscriber_id) as count
+		FROM email_events e
+		JOIN campaign_deliveries d ON d.campaign_id = e.campaign_id AND d.subscriber_id = e.subscriber_id
+		WHERE e.campaign_id = ? AND e.event_type IN ? AND d.variant_id IS NOT NULL
+		AND (e.is_machine = FALSE OR e.machine_reason IN ?)
+		GROUP BY d.variant_id, e.event_type`,
+		campaign.ID, []models.EmailEventType{models.EmailEventOpen, models.EmailEventClick}, proxyMachineReasons,
+	).Scan(&engaged)
+
+	revenue, err := s.variantRevenue(campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.CampaignTestReport{Test: *test}
+	index := make(map[uuid.UUID]*models.VariantResult, len(variants))
+	report.Variants = make([]models.VariantResult, len(variants))
+	for i, variant := range variants {
+		report.Variants[i].Variant = variant
+		report.Variants[i].Winner = test.WinnerVariantID != nil && *test.WinnerVariantID == variant.ID
+		index[variant.ID] = &report.Variants[i]
+	}
+	for _, row := range sent {
+		if result, ok := index[row.VariantID]; ok {
+			result.Sent = row.Count
+		}
+	}
+	for _, row := range engaged {
+		result, ok := index[row.VariantID]
+		if !ok {
+			continue
+		}
+		if row.EventType == models.EmailEventOpen {
+			result.UniqueOpens = row.Count
+		} else {
+			result.UniqueClicks = row.Count
+		}
+	}
+
+	samples := make([]variantSample, len(variants))
+	for i := range report.Variants {
+		result := &report.Variants[i]
+		rev := revenue[result.Variant.ID]
+		result.Revenue = int64(rev.Sum)
+		if result.Sent > 0 {
+			result.OpenRate = float64(result.UniqueOpens) / float64(result.Sent)
+			result.ClickRate = float64(result.UniqueClicks) / float64(result.Sent)
+			result.RevenuePer = rev.Sum / float64(result.Sent)
+		}
+
+		samples[i] = variantSample{n: float64(result.Sent)}
+		switch test.Metric {
+		case models.TestMetricOpens:
+			samples[i].sum, samples[i].sumSq = float64(result.UniqueOpens), float64(result.UniqueOpens)
+		case models.TestMetricClicks:
+			samples[i].sum, samples[i].sumSq = float64(result.UniqueClicks), float64(result.UniqueClicks)
+		case models.TestMetricRevenue:
+			samples[i].sum, samples[i].sumSq = rev.Sum, rev.SumSq
+		}
+		result.Score = samples[i].mean()
+	}
+
+	// The leader is the best scoring variant; the earliest one wins a tie
+	leader := 0
+	for i := range report.Variants {
+		if report.Variants[i].Score > report.Variants[leader].Score {
+			leader = i
+		}
+	}
+	report.Variants[leader].Leader = true
+
+	report.Significant = len(report.Variants) > 1
+	for i := range report.Variants {
+		if i == leader {
+			continue
+		}
+		confidence := samples[leader].confidenceOver(samples[i], test.Metric == models.TestMetricRevenue)
+		report.Variants[i].Confidence = confidence
+		if confidence == nil || *confidence < significanceLevel {
+			report.Significant = false
+		}
+	}
+	return report, nil
+}
+
+type revenueSample struct {
+	Sum   float64
+	SumSq float64
+}
+
+// variantRevenue totals, per variant, what recipients paid for the creator's
+// plans within CAMPAIGN_REVENUE_DAYS of being sent the campaign
+func (s *CampaignService) variantRevenue(campaign *models.Campaign) (map[uuid.UUID]revenueSample, error) {
+	var rows []struct {
+		VariantID uuid.UUID
+		Sum       float64
+		SumSq     float64
+	}
+	err := s.db.Raw(`SELECT variant_id, SUM(amount) as sum, SUM(amount * amount) as sum_sq
+		FROM (
+			SELECT d.variant_id, (
+				SELECT COALESCE(SUM(p.amount), 0)
+				FROM payments p
+				JOIN subscription_plans sp ON sp.id = p.plan_id
+				LEFT JOIN users u ON u.id = p.user_id
+				WHERE sp.creator_id = ? AND p.status = ?
+				AND LOWER(COALESCE(p.email, u.email)) = s.email
+				AND p.paid_at >= d.sent_at AND p.paid_at < d.sent_at + ? * INTERVAL '1 day'
+			)::float AS amount
+			FROM campaign_deliveries d
+			JOIN subscribers s ON s.id = d.subscriber_id
+			WHERE d.campaign_id = ? AND d.status = ? AND d.variant_id IS NOT NULL
+		) recipients
+		GROUP BY variant_id`,
+		campaign.CreatorID, models.PaymentStatusSuccess, envInt("CAMPAIGN_REVENUE_DAYS", 7),
+		campaign.ID, models.DeliveryStatusSent,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	revenue := make(map[uuid.UUID]revenueSample, len(rows))
+	for _, row := range rows {
+		revenue[row.VariantID] = revenueSample{Sum: row.Sum, SumSq: row.SumSq}
+	}
+	return revenue, nil
+}
+
+// variantSample summarises one variant's per-recipient metric
+type variantSample struct {
+	n, sum, sumSq float64
+}
+
+func (v variantSample) mean() float64 {
+	if v.n == 0 {
+		return 0
+	}
+	return v.sum / v.n
+}
+
+// confidenceOver is the one-sided confidence, in percent, that v's true
+// metric is higher than other's: a two-proportion z-test for rates, Welch's
+// test (normal approximation) for revenue. Nil without enough recipients.
+func (v variantSample) confidenceOver(other variantSample, continuous bool) *float64 {
+	if v.n < 2 || other.n < 2 {
+		return nil
+	}
+
+	var se float64
+	if continuous {
+		se = math.Sqrt(v.variance()/v.n + other.variance()/other.n)
+	} else {
+		p := (v.sum + other.sum) / (v.n + other.n)
+		se = math.Sqrt(p * (1 - p) * (1/v.n + 1/other.n))
+	}
+
+	confidence := 50.0
+	if se > 0 {
+		z := (v.mean() - other.mean()) / se
+		confidence = 50 * (1 + math.Erf(z/math.Sqrt2))
+	}
+	confidence = math.Round(confidence*10) / 10
+	return &confidence
+}
+
+func (v variantSample) variance() float64 {
+	mean := v.mean()
+	return math.Max(v.sumSq-v.n*mean*mean, 0) / (v.n - 1)
+}
+
+// PickWinner ends a running test early with the creator's choice of winner
+func (s *CampaignService) PickWinner(campaignID, creatorID, variantID uuid.UUID) (*models.CampaignTestReport, error) {
+	campaign, err := s.FindByID(campaignID, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var test models.CampaignTest
+	if err := s.db.First(&test, "campaign_id = ?", campaign.ID).Error; err != nil {
+		return nil, ErrCampaignTestNotFound
+	}
+	if test.Status != models.CampaignTestRunning {
+		return nil, ErrCampaignTestDecided
+	}
+	var variant models.CampaignVariant
+	if err := s.db.First(&variant, "id = ? AND campaign_id = ?", variantID, campaign.ID).Error; err != nil {
+		return nil, ErrVariantNotFound
+	}
+
+	report, err := s.testReport(campaign, &test)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sendWinner(campaign, &test, variant.ID, winnerConfidence(report, variant.ID), &creatorID); err != nil {
+		return nil, err
+	}
+	return s.testReport(campaign, &test)
+}
+
+// DecideDueTests picks the winners of tests whose wait is over and sends
+// them to the held recipients
+func (s *CampaignService) DecideDueTests() {
+	var tests []models.CampaignTest
+	s.db.Joins("JOIN campaigns ON campaigns.id = campaign_tests.campaign_id").
+		Where("campaign_tests.status = ? AND campaign_tests.ends_at <= ? AND campaigns.status = ?",
+			models.CampaignTestRunning, time.Now(), models.CampaignStatusSending).
+		Find(&tests)
+
+	for i := range tests {
+		test := &tests[i]
+		var campaign models.Campaign
+		if err := s.db.First(&campaign, "id = ?", test.CampaignID).Error; err != nil {
+			continue
+		}
+
+		report, err := s.testReport(&campaign, test)
+		if err != nil {
+			log.Printf("[ABTest] Failed to score campaign %s: %v", campaign.ID, err)
+			continue
+		}
+		var winner uuid.UUID
+		for _, result := range report.Variants {
+			if result.Leader {
+				winner = result.Variant.ID
+			}
+		}
+		if winner == uuid.Nil {
+			continue
+		}
+
+		if err := s.sendWinner(&campaign, test, winner, winnerConfidence(report, winner), nil); err != nil {
+			log.Printf("[ABTest] Failed to send winner of campaign %s: %v", campaign.ID, err)
+		}
+	}
+}
+
+// winnerConfidence is how sure the test is that the winner beat the closest
+// other variant. Nil when a lower scoring variant is picked by hand.
+func winnerConfidence(report *models.CampaignTestReport, winner uuid.UUID) *float64 {
+	var confidence *float64
+	for _, result := range report.Variants {
+		if result.Variant.ID == winner {
+			if !result.Leader {
+				return nil
+			}
+			continue
+		}
+		if result.Confidence == nil {
+			return nil
+		}
+		if confidence == nil || *result.Confidence < *confidence {
+			confidence = result.Confidence
+		}
+	}
+	return confidence
+}
+
+// testWinner is the variant the remainder of a decided test is sent, or nil.
+// Remainder deliveries keep a NULL variant_id so they stay out of the report.
+func (s *CampaignService) testWinner(campaignID uuid.UUID, variants map[uuid.UUID]*models.CampaignVariant) *models.CampaignVariant {
+	var test models.CampaignTest
+	err := s.db.Select("campaign_id, winner_variant_id").
+		First(&test, "campaign_id = ? AND status = ?", campaignID, models.CampaignTestDecided).Error
+	if err != nil || test.WinnerVariantID == nil {
+		return nil
+	}
+	return variants[*test.WinnerVariantID]
+}
+
+// sendWinner records the winner and releases the held recipients to it. The
+// test's status is the claim, so a winner is only ever sent once.
+func (s *CampaignService) sendWinner(campaign *models.Campaign, test *models.CampaignTest, winner uuid.UUID, confidence *float64, decidedBy *uuid.UUID) error {
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CampaignTest{}).
+			Where("campaign_id = ? AND status = ?", test.CampaignID, models.CampaignTestRunning).
+			Updates(map[string]interface{}{
+				"status":            models.CampaignTestDecided,
+				"winner_variant_id": winner,
+				"confidence":        confidence,
+				"decided_at":        now,
+				"decided_by":        decidedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCampaignTestDecided
+		}
+
+		return tx.Model(&models.CampaignDelivery{}).
+			Where("campaign_id = ? AND status = ?", campaign.ID, models.DeliveryStatusHeld).
+			Updates(map[string]interface{}{
+				"status":     models.DeliveryStatusPending,
+				"not_before": nil,
+				"updated_at": now,
+			}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	test.Status = models.CampaignTestDecided
+	test.WinnerVariantID = &winner
+	test.Confidence = confidence
+	test.DecidedAt = &now
+	test.DecidedBy = decidedBy
+	log.Printf("[ABTest] Campaign %s: sending variant %s to the remaining recipients", campaign.ID, winner)
+
+	// The remainder is planned like any other send
+	var pending int64
+	s.db.Model(&models.CampaignDelivery{}).
+		Where("campaign_id = ? AND status = ?", campaign.ID, models.DeliveryStatusPending).
+		Count(&pending)
+	if err := s.planDeliveries(campaign, pending); err != nil {
+		log.Printf("[ABTest] Failed to plan the remainder of campaign %s: %v", campaign.ID, err)
+	}
+
+	s.db.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Update("next_send_at", nil)
+	if campaign.Status == models.CampaignStatusSending {
+		if err := s.enqueueSend(campaign.ID); err != nil {
+			log.Printf("Failed to enqueue campaign %s: %v", campaign.ID, err)
+		}
+	}
+	return nil
+}
+
+// variantContent is what a recipient of a variant is sent; fields the
+// variant leaves empty come from the campaign
+type variantContent struct {
+	subject     string
+	previewText string
+	content     string
+	htmlContent *string
+	fromName    string
+}
+
+func contentFor(campaign *models.Campaign, variant *models.CampaignVariant) variantContent {
+	c := variantContent{
+		subject:     campaign.Subject,
+		content:     campaign.Content,
+		htmlContent: campaign.HTMLContent,
+	}
+	if campaign.PreviewText != nil {
+		c.previewText = *campaign.PreviewText
+	}
+	if variant == nil {
+		return c
+	}
+
+	if variant.Subject != nil && *variant.Subject != "" {
+		c.subject = *variant.Subject
+	}
+	if variant.PreviewText != nil && *variant.PreviewText != "" {
+		c.previewText = *variant.PreviewText
+	}
+	if variant.Content != nil && *variant.Content != "" {
+		c.content = *variant.Content
+	}
+	if variant.HTMLContent != nil && *variant.HTMLContent != "" {
+		c.htmlContent = variant.HTMLContent
+	}
+	if variant.FromName != nil {
+		c.fromName = *variant.FromName
+	}
+	return c
+}
+
+var bodyTagPattern = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+// withPreheader adds the preview text mail clients show after the subject,
+// hidden from the message itself
+func withPreheader(htmlContent, text string) string {
+	if text == "" {
+		return htmlContent
+	}
+	preheader := fmt.Sprintf(`<div style="display:none;max-height:0;overflow:hidden;mso-hide:all">%s</div>`, html.EscapeString(text))
+	if loc := bodyTagPattern.FindStringIndex(htmlContent); loc != nil {
+		return htmlContent[:loc[1]] + preheader + htmlContent[loc[1]:]
+	}
+	return preheader + htmlContent
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,15 +14,31 @@ import (
 
 type CampaignService struct {
 	db                *gorm.DB
-	emailService      *EmailService
+	mailer            *MailerRegistry
 	subscriberService *SubscriberService
+	suppressions      *SuppressionService
+	tracking          *TrackingService
+	deliverability    *DeliverabilityService
+	guard             *SendGuardService
+	throttle          *MailboxThrottle
+	warmup            *WarmupService
+	seeds             *SeedService
+	sendTime          *SendTimeService
 }
 
 func NewCampaignService() *CampaignService {
 	return &CampaignService{
 		db:                database.GetDB(),
-		emailService:      NewEmailService(),
+		mailer:            NewMailerRegistry(),
 		subscriberService: NewSubscriberService(),
+		suppressions:      NewSuppressionService(),
+		tracking:          NewTrackingService(),
+		deliverability:    NewDeliverabilityService(),
+		guard:             NewSendGuardService(),
+		throttle:          GetMailboxThrottle(),
+		warmup:            NewWarmupService(),
+		seeds:             NewSeedService(),
+		sendTime:          NewSendTimeService(),
 	}
 }
 
@@ -32,6 +49,7 @@ type CreateCampaignRequest struct {
 	Content     string   `json:"content" binding:"required"`
 	HTMLContent *string  `json:"htmlContent,omitempty"`
 	TargetTagIDs []string `json:"targetTagIds,omitempty"`
+	SendWindowMinutes *int `json:"sendWindowMinutes,omitempty" binding:"omitempty,min=1,max=1440"`
 }
 
 type UpdateCampaignRequest struct {
@@ -41,10 +59,18 @@ type UpdateCampaignRequest struct {
 	Content     *string  `json:"content,omitempty"`
 	HTMLContent *string  `json:"htmlContent,omitempty"`
 	TargetTagIDs []string `json:"targetTagIds,omitempty"`
+	SendWindowMinutes *int `json:"sendWindowMinutes,omitempty" binding:"omitempty,min=1,max=1440"`
 }
 
 type ScheduleCampaignRequest struct {
-	ScheduledAt time.Time `json:"scheduledAt" binding:"required"`
+	ScheduledAt time.Time `json:"scheduledAt" binding:"required_without=LocalTime"`
+	// Deliver at each subscriber's best hour in the 24 hours from ScheduledAt
+	OptimizeSendTime bool `json:"optimizeSendTime"`
+	// Deliver at this wall-clock time ("2025-03-01T09:00") in each
+	// subscriber's timezone instead of at ScheduledAt
+	LocalTime string `json:"localTime,omitempty"`
+	// Timezone for LocalTime when a subscriber's own isn't known; UTC if unset
+	Timezone string `json:"timezone,omitempty"`
 }
 
 func (s *CampaignService) Create(req *CreateCampaignRequest, creatorID uuid.UUID) (*models.Campaign, error) {
@@ -56,6 +82,7 @@ func (s *CampaignService) Create(req *CreateCampaignRequest, creatorID uuid.UUID
 		HTMLContent: req.HTMLContent,
 		Status:      models.CampaignStatusDraft,
 		CreatorID:   creatorID,
+		SendWindowMinutes: req.SendWindowMinutes,
 	}
 
 	if err := s.db.Create(campaign).Error; err != nil {
@@ -125,6 +152,9 @@ func (s *CampaignService) Update(id uuid.UUID, req *UpdateCampaignRequest, creat
 	if req.HTMLContent != nil {
 		campaign.HTMLContent = req.HTMLContent
 	}
+	if req.SendWindowMinutes != nil {
+		campaign.SendWindowMinutes = req.SendWindowMinutes
+	}
 
 	if err := s.db.Save(campaign).Error; err != nil {
 		return nil, errors.New("failed to update campaign")
@@ -169,12 +199,32 @@ func (s *CampaignService) Schedule(id uuid.UUID, req *ScheduleCampaignRequest, c
 		return nil, errors.New("can only schedule draft campaigns")
 	}
 
-	if req.ScheduledAt.Before(time.Now()) {
-		return nil, errors.New("scheduled time must be in the future")
+	if req.LocalTime != "" || req.OptimizeSendTime {
+		var tests int64
+		s.db.Model(&models.CampaignTest{}).Where("campaign_id = ?", campaign.ID).Count(&tests)
+		if tests > 0 {
+			return nil, errors.New("A/B tests can't be combined with local-time or optimized send times")
+		}
+	}
+
+	if req.LocalTime != "" {
+		if req.OptimizeSendTime {
+			return nil, errors.New("a local-time send can't also optimize send time")
+		}
+		if err := s.scheduleLocal(campaign, req); err != nil {
+			return nil, err
+		}
+	} else {
+		if req.ScheduledAt.Before(time.Now()) {
+			return nil, errors.New("scheduled time must be in the future")
+		}
+		campaign.ScheduledAt = &req.ScheduledAt
+		campaign.LocalSendAt = nil
+		campaign.DefaultTimezone = nil
 	}
 
 	campaign.Status = models.CampaignStatusScheduled
-	campaign.ScheduledAt = &req.ScheduledAt
+	campaign.OptimizeSendTime = req.OptimizeSendTime
 
 	if err := s.db.Save(campaign).Error; err != nil {
 		return nil, errors.New("failed to schedule campaign")
@@ -183,6 +233,8 @@ func (s *CampaignService) Schedule(id uuid.UUID, req *ScheduleCampaignRequest, c
 	return campaign, nil
 }
 
+// SendNow starts sending a campaign. Recipients are recorded as delivery rows
+// and sent by the background workers; use GetProgress to follow the send.
 func (s *CampaignService) SendNow(id uuid.UUID, creatorID uuid.UUID) (*models.Campaign, error) {
 	campaign, err := s.FindByID(id, creatorID)
 	if err != nil {
@@ -193,99 +245,60 @@ func (s *CampaignService) SendNow(id uuid.UUID, creatorID uuid.UUID) (*models.Ca
 		return nil, errors.New("campaign already sent or sending")
 	}
 
-	if !s.emailService.IsConfigured() {
+	if !s.mailer.IsConfigured(models.MessageClassBulk, &campaign.CreatorID) {
 		return nil, errors.New("email service not configured")
 	}
 
-	// Update status to sending
-	campaign.Status = models.CampaignStatusSending
-	s.db.Save(campaign)
+	if hold := s.guard.ActiveHold(campaign.CreatorID, nil); hold != nil {
+		return nil, ErrSendingOnHold
+	}
 
-	// Get target subscribers
-	subscribers, err := s.getTargetSubscribers(campaign)
-	if err != nil {
-		campaign.Status = models.CampaignStatusFailed
-		s.db.Save(campaign)
+	if err := s.checkTest(campaign); err != nil {
 		return nil, err
 	}
 
-	// Initialize stats
-	stats := models.CampaignStats{
-		TotalRecipients: len(subscribers),
+	// Claim the campaign so concurrent requests or workers cannot start it twice
+	result := s.db.Model(&models.Campaign{}).
+		Where("id = ? AND status IN ?", campaign.ID, []models.CampaignStatus{models.CampaignStatusDraft, models.CampaignStatusScheduled}).
+		Update("status", models.CampaignStatusSending)
+	if result.Error != nil {
+		return nil, result.Error
 	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("campaign already sent or sending")
+	}
+	campaign.Status = models.CampaignStatusSending
 
-	// Send to each subscriber
-	for _, sub := range subscribers {
-		firstName := ""
-		lastName := ""
-		if sub.FirstName != nil {
-			firstName = *sub.FirstName
-		}
-		if sub.LastName != nil {
-			lastName = *sub.LastName
-		}
-
-		// Render email content with subscriber data
-		htmlContent := campaign.Content
-		if campaign.HTMLContent != nil && *campaign.HTMLContent != "" {
-			rendered, err := s.emailService.RenderTemplate(*campaign.HTMLContent, &sub, campaign)
-			if err == nil {
-				htmlContent = rendered
-			}
-		}
+	// Sent ahead of its schedule, a local-time campaign goes to everyone now
+	if campaign.LocalSendAt != nil && campaign.ScheduledAt != nil && time.Now().Before(*campaign.ScheduledAt) {
+		campaign.LocalSendAt = nil
+		s.db.Model(campaign).Update("local_send_at", nil)
+	}
 
-		err := s.emailService.Send(&SendEmailRequest{
-			To: EmailRecipient{
-				Email:            sub.Email,
-				FirstName:        firstName,
-				LastName:         lastName,
-				UnsubscribeToken: sub.UnsubscribeToken,
-			},
-			Subject:     campaign.Subject,
-			HTMLContent: htmlContent,
-			TextContent: campaign.Content,
-			CampaignID:  campaign.ID.String(),
-		})
-
-		if err == nil {
-			stats.Sent++
-		}
+	total, err := s.createDeliveries(campaign)
+	if err != nil {
+		campaign.Status = models.CampaignStatusFailed
+		s.db.Save(campaign)
+		return nil, err
 	}
 
-	// Update campaign with results
-	now := time.Now()
-	campaign.Status = models.CampaignStatusSent
-	campaign.SentAt = &now
+	stats := models.CampaignStats{TotalRecipients: int(total)}
 	statsJSON, _ := json.Marshal(stats)
 	statsStr := string(statsJSON)
 	campaign.Stats = &statsStr
+	s.db.Model(campaign).Update("stats", statsStr)
 
-	s.db.Save(campaign)
-
-	return campaign, nil
-}
-
-func (s *CampaignService) getTargetSubscribers(campaign *models.Campaign) ([]models.Subscriber, error) {
-	var subscribers []models.Subscriber
-	
-	query := s.db.Where("creator_id = ? AND status = ?", campaign.CreatorID, models.SubscriberStatusActive)
-
-	// If campaign has target tags, filter by them
-	if len(campaign.TargetTags) > 0 {
-		tagIDs := make([]uuid.UUID, len(campaign.TargetTags))
-		for i, tag := range campaign.TargetTags {
-			tagIDs[i] = tag.ID
-		}
-		query = query.Joins("JOIN subscriber_tags ON subscriber_tags.subscriber_id = subscribers.id").
-			Where("subscriber_tags.tag_id IN ?", tagIDs).
-			Distinct()
+	// Seed mailboxes get the campaign too, to measure inbox placement
+	if err := s.seeds.QueueCampaign(campaign); err != nil {
+		log.Printf("Failed to queue seeds for campaign %s: %v", campaign.ID, err)
 	}
 
-	if err := query.Find(&subscribers).Error; err != nil {
-		return nil, err
+	if err := s.enqueueSend(campaign.ID); err != nil {
+		// The resume sweep picks the campaign up on the next worker tick
+		log.Printf("Failed to enqueue campaign %s: %v", campaign.ID, err)
 	}
 
-	return subscribers, nil
+	return campaign, nil
 }
 
 func (s *CampaignService) GetStats(id uuid.UUID, creatorID uuid.UUID) (*models.CampaignStats, error) {
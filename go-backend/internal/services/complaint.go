@@ -16,13 +16,17 @@ const ComplaintThreshold = 0.1
 
 // ComplaintService handles spam complaint processing
 type ComplaintService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	suppressions   *SuppressionService
+	deliverability *DeliverabilityService
 }
 
 // NewComplaintService creates a new complaint service
 func NewComplaintService() *ComplaintService {
 	return &ComplaintService{
-		db: database.GetDB(),
+		db:             database.GetDB(),
+		suppressions:   NewSuppressionService(),
+		deliverability: NewDeliverabilityService(),
 	}
 }
 
@@ -39,6 +43,9 @@ type ComplaintEvent struct {
 
 // ProcessComplaint handles a spam complaint and updates subscriber status
 func (s *ComplaintService) ProcessComplaint(creatorID uuid.UUID, event *ComplaintEvent) error {
+	// The complaint is about this creator's mail, so suppress it for them only
+	s.suppressions.Suppress(&creatorID, event.Email, models.SuppressionReasonComplaint, "complaint")
+
 	// Find the subscriber
 	var subscriber models.Subscriber
 	if err := s.db.Where("email = ? AND creator_id = ?", event.Email, creatorID).First(&subscriber).Error; err != nil {
@@ -94,62 +101,14 @@ func (s *ComplaintService) recordComplaintEvent(subscriber *models.Subscriber, e
 	}
 }
 
-// updateMetrics updates the creator's complaint metrics
+// updateMetrics counts the complaint in today's rollup and refreshes the
+// creator's rolling metrics
 func (s *ComplaintService) updateMetrics(creatorID uuid.UUID) {
-	var metrics models.DeliverabilityMetrics
-	
-	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// Create new metrics record
-		metrics = models.DeliverabilityMetrics{
-			CreatorID: creatorID,
-		}
-		s.db.Create(&metrics)
-	}
-
-	metrics.TotalComplaints++
-
-	// Recalculate complaint rate
-	if metrics.TotalSent > 0 {
-		metrics.ComplaintRate = float64(metrics.TotalComplaints) / float64(metrics.TotalSent) * 100
-	}
-
-	// Update reputation score (complaints heavily penalize reputation)
-	s.updateReputationScore(&metrics)
-	metrics.LastCalculatedAt = time.Now()
-
-	s.db.Save(&metrics)
-}
-
-// updateReputationScore recalculates sender reputation based on metrics
-func (s *ComplaintService) updateReputationScore(metrics *models.DeliverabilityMetrics) {
-	score := 100.0
-
-	// Heavy penalty for complaint rate (target: <0.1%)
-	if metrics.ComplaintRate > 0.1 {
-		// Each 0.1% over threshold = -20 points
-		score -= (metrics.ComplaintRate - 0.1) * 200
-	}
-
-	// Penalty for bounce rate (target: <2%)
-	if metrics.BounceRate > 2 {
-		score -= (metrics.BounceRate - 2) * 5
-	}
-
-	// Bonus for good engagement
-	if metrics.OpenRate > 20 {
-		score += (metrics.OpenRate - 20) * 0.5
-	}
-
-	// Clamp to 0-100
-	if score < 0 {
-		score = 0
-	}
-	if score > 100 {
-		score = 100
+	if err := s.deliverability.RecordComplaint(creatorID); err != nil {
+		log.Printf("[Complaint] Failed to record complaint for creator %s: %v", creatorID, err)
+		return
 	}
-
-	metrics.ReputationScore = score
+	s.deliverability.RecalculateMetrics(creatorID)
 }
 
 // checkComplaintThreshold checks if complaint rate exceeds threshold and logs warning
@@ -162,8 +121,7 @@ func (s *ComplaintService) checkComplaintThreshold(creatorID uuid.UUID) {
 	if metrics.ComplaintRate > ComplaintThreshold {
 		log.Printf("[ALERT] Creator %s complaint rate %.2f%% exceeds threshold %.2f%%", 
 			creatorID, metrics.ComplaintRate, ComplaintThreshold)
-		// TODO: Send notification to creator
-		// TODO: Could implement automatic sending restrictions
+		// In-flight sends are throttled or paused by SendGuardService
 	}
 }
 
@@ -192,13 +150,17 @@ func (s *ComplaintService) GetComplaintStats(creatorID uuid.UUID) (map[string]in
 	}, nil
 }
 
-// GetComplainedSubscribers returns list of subscribers who filed complaints
-func (s *ComplaintService) GetComplainedSubscribers(creatorID uuid.UUID, limit, offset int) ([]models.Subscriber, int64, error) {
+// GetComplainedSubscribers returns subscribers who filed complaints. A nil
+// creator lists every creator's, for admins.
+func (s *ComplaintService) GetComplainedSubscribers(creatorID *uuid.UUID, limit, offset int) ([]models.Subscriber, int64, error) {
 	var subscribers []models.Subscriber
 	var total int64
 
-	query := s.db.Where("creator_id = ? AND status = ?", creatorID, models.SubscriberStatusComplaint)
-	
+	query := s.db.Model(&models.Subscriber{}).Where("status = ?", models.SubscriberStatusComplaint)
+	if creatorID != nil {
+		query = query.Where("creator_id = ?", *creatorID)
+	}
+
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
@@ -210,15 +172,20 @@ func (s *ComplaintService) GetComplainedSubscribers(creatorID uuid.UUID, limit,
 	return subscribers, total, nil
 }
 
-// GetRecentComplaints returns recent complaint events for a creator
-func (s *ComplaintService) GetRecentComplaints(creatorID uuid.UUID, limit int) ([]models.EmailEvent, error) {
+// GetRecentComplaints returns recent complaint events, newest first. A nil
+// creator covers every creator, for admins.
+func (s *ComplaintService) GetRecentComplaints(creatorID *uuid.UUID, limit int) ([]models.EmailEvent, error) {
 	var events []models.EmailEvent
-	
-	err := s.db.Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
-		Where("campaigns.creator_id = ? AND email_events.event_type = ?", creatorID, models.EmailEventComplaint).
-		Order("email_events.created_at DESC").
+
+	query := s.db.Where("email_events.event_type = ?", models.EmailEventComplaint)
+	if creatorID != nil {
+		query = query.Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
+			Where("campaigns.creator_id = ?", *creatorID)
+	}
+
+	err := query.Order("email_events.created_at DESC").
 		Limit(limit).
 		Find(&events).Error
-	
+
 	return events, err
 }
@@ -3,13 +3,13 @@ package services
 import (
 	"errors"
 	"fmt"
-	"net"
+	"log"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/okemwag/newsletter/internal/database"
 	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -25,173 +25,140 @@ func NewDeliverabilityService() *DeliverabilityService {
 	}
 }
 
-// DNSConfigGuide returns the DNS records needed for a domain
-type DNSConfigGuide struct {
-	Domain     string              `json:"domain"`
-	SPF        DNSRecordGuide      `json:"spf"`
-	DKIM       DNSRecordGuide      `json:"dkim"`
-	DMARC      DNSRecordGuide      `json:"dmarc"`
-	Status     DNSVerificationStatus `json:"status"`
+// ConfigureDKIMKeyRequest sets the signing key for a sending domain
+type ConfigureDKIMKeyRequest struct {
+	CreatorID  *uuid.UUID `json:"creatorId,omitempty"` // admin only, nil for platform domains
+	Domain     string `json:"domain" binding:"required"`
+	Selector   string `json:"selector" binding:"required"`
+	PrivateKey string `json:"privateKey" binding:"required"` // PEM encoded RSA key
 }
 
-// DNSRecordGuide contains the recommended DNS record
-type DNSRecordGuide struct {
-	RecordType  string `json:"recordType"`
-	Host        string `json:"host"`
-	Value       string `json:"value"`
-	TTL         int    `json:"ttl"`
-	IsVerified  bool   `json:"isVerified"`
-	Instructions string `json:"instructions"`
+// ConfigureDKIMKey stores a DKIM signing key and the matching DKIM DNS record.
+// Pass a nil creatorID for platform-owned sending domains.
+func (s *DeliverabilityService) ConfigureDKIMKey(creatorID *uuid.UUID, req *ConfigureDKIMKeyRequest) (*models.DKIMKey, error) {
+	return s.configureDKIMKey(s.db, creatorID, req)
 }
 
-// DNSVerificationStatus overall verification status
-type DNSVerificationStatus struct {
-	AllVerified bool   `json:"allVerified"`
-	SPFVerified bool   `json:"spfVerified"`
-	DKIMVerified bool  `json:"dkimVerified"`
-	DMARCVerified bool `json:"dmarcVerified"`
-	LastChecked *time.Time `json:"lastChecked,omitempty"`
-}
+// configureDKIMKey is ConfigureDKIMKey inside the caller's transaction
+func (s *DeliverabilityService) configureDKIMKey(db *gorm.DB, creatorID *uuid.UUID, req *ConfigureDKIMKeyRequest) (*models.DKIMKey, error) {
+	domain := strings.ToLower(strings.TrimSpace(req.Domain))
 
-// GenerateDNSConfig generates DNS configuration guide for a domain
-func (s *DeliverabilityService) GenerateDNSConfig(domain string) *DNSConfigGuide {
-	// Standard recommendations - these should be customized based on email provider
-	return &DNSConfigGuide{
-		Domain: domain,
-		SPF: DNSRecordGuide{
-			RecordType: "TXT",
-			Host:       "@",
-			Value:      "v=spf1 include:sendgrid.net include:_spf.google.com ~all",
-			TTL:        3600,
-			Instructions: "Add this TXT record to your domain's DNS settings. This tells email servers which servers are allowed to send email on behalf of your domain.",
-		},
-		DKIM: DNSRecordGuide{
-			RecordType: "CNAME",
-			Host:       "s1._domainkey",
-			Value:      "s1.domainkey.sendgrid.net",
-			TTL:        3600,
-			Instructions: "Add this CNAME record for DKIM signing. DKIM adds a digital signature to your emails to verify authenticity.",
-		},
-		DMARC: DNSRecordGuide{
-			RecordType: "TXT",
-			Host:       "_dmarc",
-			Value:      fmt.Sprintf("v=DMARC1; p=quarantine; rua=mailto:dmarc-reports@%s; pct=100", domain),
-			TTL:        3600,
-			Instructions: "Add this TXT record for DMARC policy. DMARC tells receiving servers what to do with emails that fail SPF or DKIM checks.",
-		},
+	signer, err := NewDKIMSigner(domain, req.Selector, req.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicRecord, err := signer.PublicKeyRecord()
+	if err != nil {
+		return nil, err
 	}
-}
-
-// VerifyDNS checks if DNS records are properly configured
-func (s *DeliverabilityService) VerifyDNS(creatorID uuid.UUID, domain string) (*DNSVerificationStatus, error) {
-	status := &DNSVerificationStatus{}
-	now := time.Now()
-	status.LastChecked = &now
-
-	// Check SPF
-	status.SPFVerified = s.verifySPF(domain)
-
-	// Check DKIM
-	status.DKIMVerified = s.verifyDKIM(domain)
-
-	// Check DMARC
-	status.DMARCVerified = s.verifyDMARC(domain)
-
-	status.AllVerified = status.SPFVerified && status.DKIMVerified && status.DMARCVerified
 
-	// Store verification results
-	s.storeDNSStatus(creatorID, domain, status)
+	// A creator can't take over a domain another account has verified
+	if creatorID != nil {
+		var claimed int64
+		err := db.Model(&models.SenderDomain{}).
+			Where("domain = ? AND creator_id <> ? AND status <> ?", domain, *creatorID, models.SenderDomainPending).
+			Count(&claimed).Error
+		if err != nil {
+			return nil, err
+		}
+		if claimed > 0 {
+			return nil, ErrSenderDomainClaimed
+		}
+	}
 
-	return status, nil
-}
+	var key models.DKIMKey
+	err = dkimKeyOwner(db, creatorID).Where("domain = ?", domain).First(&key).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
 
-// verifySPF checks SPF record exists
-func (s *DeliverabilityService) verifySPF(domain string) bool {
-	txtRecords, err := net.LookupTXT(domain)
+	sealed, err := utils.EncryptSecret(req.PrivateKey)
 	if err != nil {
-		return false
+		log.Printf("[DKIM] Failed to encrypt key for %s: %v", domain, err)
+		return nil, errors.New("failed to save DKIM key")
 	}
 
-	for _, txt := range txtRecords {
-		if strings.HasPrefix(txt, "v=spf1") {
-			return true
-		}
+	key.CreatorID = creatorID
+	key.Domain = domain
+	key.Selector = req.Selector
+	key.PrivateKey = sealed
+	key.PublicKey = publicRecord
+	key.IsActive = true
+
+	if err := db.Save(&key).Error; err != nil {
+		return nil, errors.New("failed to save DKIM key")
 	}
-	return false
-}
 
-// verifyDKIM checks DKIM record exists
-func (s *DeliverabilityService) verifyDKIM(domain string) bool {
-	// Check common DKIM selectors
-	selectors := []string{"s1._domainkey", "google._domainkey", "default._domainkey", "mail._domainkey"}
-	
-	for _, selector := range selectors {
-		host := fmt.Sprintf("%s.%s", selector, domain)
-		_, err := net.LookupTXT(host)
-		if err == nil {
-			return true
+	// Keep the DKIM DNS record in step with the key so the creator knows what to publish
+	if creatorID != nil {
+		var record models.DNSRecord
+		err := db.Where("creator_id = ? AND domain = ? AND record_type = ?", *creatorID, domain, "DKIM").First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			record = models.DNSRecord{CreatorID: *creatorID, Domain: domain, RecordType: "DKIM"}
+		}
+		if record.RecordValue != publicRecord {
+			record.IsVerified = false
+			record.VerifiedAt = nil
 		}
-		// Also check CNAME
-		_, err = net.LookupCNAME(host)
-		if err == nil {
-			return true
+		record.RecordName = fmt.Sprintf("%s._domainkey", req.Selector)
+		record.RecordValue = publicRecord
+		if err := db.Save(&record).Error; err != nil {
+			return nil, errors.New("failed to save DKIM record")
 		}
 	}
-	return false
+
+	invalidateDKIMSigner(domain)
+	return &key, nil
+}
+
+// GetDKIMSigner returns the active signer for a domain, or nil if none is
+// configured. Keys of creators whose claim on the domain is still pending
+// verification never sign.
+func (s *DeliverabilityService) GetDKIMSigner(domain string) (*DKIMSigner, error) {
+	query := s.db.Where("domain = ? AND is_active = ?", strings.ToLower(domain), true).
+		Where("NOT EXISTS (SELECT 1 FROM sender_domains WHERE sender_domains.creator_id = dkim_keys.creator_id AND sender_domains.domain = dkim_keys.domain AND sender_domains.status = ?)",
+			models.SenderDomainPending).
+		Order("creator_id IS NULL")
+	return s.loadSigner(query)
 }
 
-// verifyDMARC checks DMARC record exists
-func (s *DeliverabilityService) verifyDMARC(domain string) bool {
-	dmarcHost := "_dmarc." + domain
-	txtRecords, err := net.LookupTXT(dmarcHost)
+// GetCreatorDKIMSigner returns the active signer a creator (nil for the
+// platform) holds for a domain, whether or not it is verified yet
+func (s *DeliverabilityService) GetCreatorDKIMSigner(creatorID *uuid.UUID, domain string) (*DKIMSigner, error) {
+	query := dkimKeyOwner(s.db, creatorID).Where("domain = ? AND is_active = ?", strings.ToLower(domain), true)
+	return s.loadSigner(query)
+}
+
+// loadSigner decrypts the first key the query finds
+func (s *DeliverabilityService) loadSigner(query *gorm.DB) (*DKIMSigner, error) {
+	var key models.DKIMKey
+	err := query.First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		return false
+		return nil, err
+	}
+	privateKey, err := utils.DecryptSecret(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM key for %s: %w", key.Domain, err)
 	}
 
-	for _, txt := range txtRecords {
-		if strings.HasPrefix(txt, "v=DMARC1") {
-			return true
+	// Keys stored before they were encrypted are sealed on first use
+	if !utils.IsEncryptedSecret(key.PrivateKey) {
+		if sealed, err := utils.EncryptSecret(privateKey); err == nil {
+			s.db.Model(&models.DKIMKey{}).Where("id = ?", key.ID).Update("private_key", sealed)
 		}
 	}
-	return false
+	return NewDKIMSigner(key.Domain, key.Selector, privateKey)
 }
 
-// storeDNSStatus stores DNS verification results in database
-func (s *DeliverabilityService) storeDNSStatus(creatorID uuid.UUID, domain string, status *DNSVerificationStatus) {
-	recordTypes := []struct {
-		Type     string
-		Verified bool
-	}{
-		{"SPF", status.SPFVerified},
-		{"DKIM", status.DKIMVerified},
-		{"DMARC", status.DMARCVerified},
-	}
-
-	for _, rt := range recordTypes {
-		var record models.DNSRecord
-		err := s.db.Where("creator_id = ? AND domain = ? AND record_type = ?", creatorID, domain, rt.Type).First(&record).Error
-		
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			record = models.DNSRecord{
-				CreatorID:  creatorID,
-				Domain:     domain,
-				RecordType: rt.Type,
-				IsVerified: rt.Verified,
-				LastChecked: status.LastChecked,
-			}
-			if rt.Verified {
-				record.VerifiedAt = status.LastChecked
-			}
-			s.db.Create(&record)
-		} else {
-			record.IsVerified = rt.Verified
-			record.LastChecked = status.LastChecked
-			if rt.Verified && record.VerifiedAt == nil {
-				record.VerifiedAt = status.LastChecked
-			}
-			s.db.Save(&record)
-		}
+// dkimKeyOwner scopes a DKIM key query to a creator, or to platform keys
+func dkimKeyOwner(db *gorm.DB, creatorID *uuid.UUID) *gorm.DB {
+	if creatorID == nil {
+		return db.Where("creator_id IS NULL")
 	}
+	return db.Where("creator_id = ?", *creatorID)
 }
 
 // GetDeliverabilityMetrics returns all deliverability metrics for a creator
@@ -216,61 +183,115 @@ func (s *DeliverabilityService) GetDeliverabilityMetrics(creatorID uuid.UUID) (*
 	return &metrics, nil
 }
 
-// RecordDelivery records a successful email delivery
-func (s *DeliverabilityService) RecordDelivery(creatorID, campaignID uuid.UUID, provider string) error {
-	var metrics models.DeliverabilityMetrics
-	
-	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		metrics = models.DeliverabilityMetrics{
-			CreatorID: creatorID,
-		}
-		s.db.Create(&metrics)
+// CreatorDeliverability is a creator's metrics with enough about the creator
+// for admins to tell who they are
+type CreatorDeliverability struct {
+	models.DeliverabilityMetrics
+	CreatorEmail   string  `json:"creatorEmail"`
+	NewsletterName *string `json:"newsletterName,omitempty"`
+}
+
+// MetricsFilter narrows and orders the admin view of creators' metrics
+type MetricsFilter struct {
+	CreatorID *uuid.UUID
+	MinSent   int64  // ignore creators with too little volume for the rates to mean much
+	Sort      string // bounceRate, complaintRate, reputationScore or totalSent
+	Page      int
+	PageSize  int
+}
+
+// metricsSortColumns maps sort keys to ORDER BY clauses, worst first
+var metricsSortColumns = map[string]string{
+	"bounceRate":      "bounce_rate DESC",
+	"complaintRate":   "complaint_rate DESC",
+	"reputationScore": "reputation_score ASC",
+	"totalSent":       "total_sent DESC",
+}
+
+// ListMetrics returns every creator's deliverability metrics, worst first by
+// complaint rate unless the filter says otherwise
+func (s *DeliverabilityService) ListMetrics(filter *MetricsFilter) ([]CreatorDeliverability, int64, error) {
+	order, ok := metricsSortColumns[filter.Sort]
+	if !ok {
+		order = metricsSortColumns["complaintRate"]
 	}
 
-	metrics.TotalDelivered++
-	metrics.TotalSent++
+	query := s.db.Model(&models.DeliverabilityMetrics{})
+	if filter.CreatorID != nil {
+		query = query.Where("creator_id = ?", *filter.CreatorID)
+	}
+	if filter.MinSent > 0 {
+		query = query.Where("total_sent >= ?", filter.MinSent)
+	}
 
-	// Recalculate delivery rate
-	if metrics.TotalSent > 0 {
-		metrics.DeliveryRate = float64(metrics.TotalDelivered) / float64(metrics.TotalSent) * 100
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
 	}
 
-	return s.db.Save(&metrics).Error
-}
+	var metrics []models.DeliverabilityMetrics
+	err := query.Preload("Creator").
+		Order(order).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&metrics).Error
+	if err != nil {
+		return nil, 0, err
+	}
 
-// RecordSend records an email send (for calculating rates)
-func (s *DeliverabilityService) RecordSend(creatorID uuid.UUID, count int64) error {
-	var metrics models.DeliverabilityMetrics
-	
-	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		metrics = models.DeliverabilityMetrics{
-			CreatorID: creatorID,
+	results := make([]CreatorDeliverability, len(metrics))
+	for i, m := range metrics {
+		results[i] = CreatorDeliverability{
+			DeliverabilityMetrics: m,
+			CreatorEmail:          m.Creator.Email,
+			NewsletterName:        m.Creator.NewsletterName,
 		}
-		s.db.Create(&metrics)
 	}
+	return results, total, nil
+}
+
+// RecordDelivery records a successful email delivery
+func (s *DeliverabilityService) RecordDelivery(creatorID, campaignID uuid.UUID, provider string) error {
+	return s.incrementDaily(creatorID, map[string]int64{"delivered": 1})
+}
 
-	metrics.TotalSent += count
-	return s.db.Save(&metrics).Error
+// RecordSend records an email send (for calculating rates)
+func (s *DeliverabilityService) RecordSend(creatorID uuid.UUID, count int64) error {
+	return s.incrementDaily(creatorID, map[string]int64{"sent": count})
 }
 
 // RecordOpen records an email open event
 func (s *DeliverabilityService) RecordOpen(creatorID uuid.UUID) error {
-	return s.db.Model(&models.DeliverabilityMetrics{}).
-		Where("creator_id = ?", creatorID).
-		Updates(map[string]interface{}{
-			"total_opened": gorm.Expr("total_opened + 1"),
-		}).Error
+	return s.incrementDaily(creatorID, map[string]int64{"opened": 1})
 }
 
 // RecordClick records an email click event
 func (s *DeliverabilityService) RecordClick(creatorID uuid.UUID) error {
-	return s.db.Model(&models.DeliverabilityMetrics{}).
-		Where("creator_id = ?", creatorID).
-		Updates(map[string]interface{}{
-			"total_clicked": gorm.Expr("total_clicked + 1"),
-		}).Error
+	return s.incrementDaily(creatorID, map[string]int64{"clicked": 1})
+}
+
+// RecordMachineOpen records an open by a privacy proxy or scanner
+func (s *DeliverabilityService) RecordMachineOpen(creatorID uuid.UUID) error {
+	return s.incrementDaily(creatorID, map[string]int64{"machine_opened": 1})
+}
+
+// RecordMachineClick records a click by a link scanner or bot
+func (s *DeliverabilityService) RecordMachineClick(creatorID uuid.UUID) error {
+	return s.incrementDaily(creatorID, map[string]int64{"machine_clicked": 1})
+}
+
+// RecordBounce records a bounce of either type
+func (s *DeliverabilityService) RecordBounce(creatorID uuid.UUID, bounceType models.BounceType) error {
+	counts := map[string]int64{"bounced": 1, "soft_bounces": 1}
+	if bounceType == models.BounceTypeHard {
+		counts = map[string]int64{"bounced": 1, "hard_bounces": 1}
+	}
+	return s.incrementDaily(creatorID, counts)
+}
+
+// RecordComplaint records a spam complaint
+func (s *DeliverabilityService) RecordComplaint(creatorID uuid.UUID) error {
+	return s.incrementDaily(creatorID, map[string]int64{"complaints": 1})
 }
 
 // GetDNSStatus returns DNS configuration status for a creator
@@ -298,27 +319,15 @@ func (s *DeliverabilityService) GetProviderBreakdown(creatorID uuid.UUID) (map[s
 	}
 
 	providers := map[string]int{
-		"gmail":    0,
-		"outlook":  0,
-		"yahoo":    0,
-		"apple":    0,
-		"other":    0,
+		MailboxGmail:   0,
+		MailboxOutlook: 0,
+		MailboxYahoo:   0,
+		MailboxApple:   0,
+		MailboxOther:   0,
 	}
 
 	for _, sub := range subscribers {
-		email := strings.ToLower(sub.Email)
-		switch {
-		case strings.Contains(email, "@gmail.") || strings.Contains(email, "@googlemail."):
-			providers["gmail"]++
-		case strings.Contains(email, "@outlook.") || strings.Contains(email, "@hotmail.") || strings.Contains(email, "@live.") || strings.Contains(email, "@msn."):
-			providers["outlook"]++
-		case strings.Contains(email, "@yahoo.") || strings.Contains(email, "@ymail."):
-			providers["yahoo"]++
-		case strings.Contains(email, "@icloud.") || strings.Contains(email, "@me.com") || strings.Contains(email, "@mac.com"):
-			providers["apple"]++
-		default:
-			providers["other"]++
-		}
+		providers[MailboxProviderFor(sub.Email)]++
 	}
 
 	total := 0
@@ -336,46 +345,3 @@ func (s *DeliverabilityService) GetProviderBreakdown(creatorID uuid.UUID) (map[s
 
 	return result, nil
 }
-
-// RecalculateMetrics recalculates all deliverability metrics for a creator
-func (s *DeliverabilityService) RecalculateMetrics(creatorID uuid.UUID) error {
-	var metrics models.DeliverabilityMetrics
-	
-	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil
-	}
-
-	// Recalculate rates
-	if metrics.TotalSent > 0 {
-		metrics.DeliveryRate = float64(metrics.TotalDelivered) / float64(metrics.TotalSent) * 100
-		metrics.BounceRate = float64(metrics.TotalBounced) / float64(metrics.TotalSent) * 100
-		metrics.ComplaintRate = float64(metrics.TotalComplaints) / float64(metrics.TotalSent) * 100
-	}
-	if metrics.TotalDelivered > 0 {
-		metrics.OpenRate = float64(metrics.TotalOpened) / float64(metrics.TotalDelivered) * 100
-		metrics.ClickRate = float64(metrics.TotalClicked) / float64(metrics.TotalDelivered) * 100
-	}
-
-	// Recalculate reputation
-	score := 100.0
-	if metrics.BounceRate > 2 {
-		score -= (metrics.BounceRate - 2) * 5
-	}
-	if metrics.ComplaintRate > 0.1 {
-		score -= (metrics.ComplaintRate - 0.1) * 200
-	}
-	if metrics.OpenRate > 20 {
-		score += (metrics.OpenRate - 20) * 0.5
-	}
-	if score < 0 {
-		score = 0
-	}
-	if score > 100 {
-		score = 100
-	}
-	metrics.ReputationScore = score
-	metrics.LastCalculatedAt = time.Now()
-
-	return s.db.Save(&metrics).Error
-}
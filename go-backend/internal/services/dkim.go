@@ -0,0 +1,185 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimSignedHeaders lists the headers we sign when present (RFC 6376 §5.4.1)
+var dkimSignedHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// dkimSelectorPattern is one or more DNS labels, as a selector becomes part
+// of the name selector._domainkey.domain (RFC 6376 §3.1)
+var dkimSelectorPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// validDKIMSelector reports whether a selector is safe to put in a DNS name
+func validDKIMSelector(selector string) bool {
+	return len(selector) <= 63 && dkimSelectorPattern.MatchString(selector)
+}
+
+// mailHeader is a single header field of an outgoing message
+type mailHeader struct {
+	Name  string
+	Value string
+}
+
+// DKIMSigner signs messages with rsa-sha256 and relaxed/relaxed canonicalization
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	key      *rsa.PrivateKey
+}
+
+// NewDKIMSigner parses a PEM encoded RSA private key (PKCS#1 or PKCS#8)
+func NewDKIMSigner(domain, selector, privateKeyPEM string) (*DKIMSigner, error) {
+	key, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if domain == "" || selector == "" {
+		return nil, errors.New("DKIM domain and selector are required")
+	}
+	if !validDKIMSelector(selector) {
+		return nil, errors.New("DKIM selector must be made of DNS labels (letters, digits and hyphens)")
+	}
+	return &DKIMSigner{
+		Domain:   strings.ToLower(domain),
+		Selector: selector,
+		key:      key,
+	}, nil
+}
+
+// Sign returns the value of the DKIM-Signature header for the message
+func (s *DKIMSigner) Sign(headers []mailHeader, body []byte) (string, error) {
+	bodyHash := sha256.Sum256(dkimRelaxedBody(body))
+
+	// Sign the last occurrence of each header we care about
+	var signed []mailHeader
+	var names []string
+	for _, want := range dkimSignedHeaders {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if strings.EqualFold(headers[i].Name, want) {
+				signed = append(signed, headers[i])
+				names = append(names, strings.ToLower(want))
+				break
+			}
+		}
+	}
+
+	tags := []string{
+		"v=1",
+		"a=rsa-sha256",
+		"c=relaxed/relaxed",
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		"t=" + strconv.FormatInt(time.Now().Unix(), 10),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	value := strings.Join(tags, "; ")
+
+	h := sha256.New()
+	for _, hdr := range signed {
+		h.Write([]byte(dkimRelaxedHeader(hdr.Name, hdr.Value) + "\r\n"))
+	}
+	// The signature header itself is hashed without its trailing CRLF
+	h.Write([]byte(dkimRelaxedHeader("DKIM-Signature", value)))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	// Fold between tags so the header stays readable; relaxed canonicalization
+	// treats the folding whitespace the same as the single spaces hashed above
+	return strings.Join(tags[:len(tags)-1], ";\r\n\t") + ";\r\n\tb=" + base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// PublicKeyRecord returns the TXT record value publishing the signer's public key
+func (s *DKIMSigner) PublicKeyRecord() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+}
+
+// GenerateDKIMKey creates a new RSA signing key, PEM encoded as PKCS#1
+func GenerateDKIMKey(bits int) (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate DKIM key: %w", err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// dkimRelaxedHeader applies the relaxed header canonicalization algorithm
+func dkimRelaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value)
+}
+
+// dkimRelaxedBody applies the relaxed body canonicalization algorithm
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.FieldsFunc(line, isWSP), " ")
+		// FieldsFunc drops leading whitespace, which relaxed keeps as one space
+		if len(line) > 0 && isWSP(rune(line[0])) && lines[i] != "" {
+			lines[i] = " " + lines[i]
+		}
+	}
+
+	// Remove trailing empty lines
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	if end == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines[:end], "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// parseRSAPrivateKey decodes a PEM block holding an RSA private key
+func parseRSAPrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("DKIM private key must be RSA")
+	}
+	return key, nil
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dmarcMaxReportSize caps a decompressed report, guarding against archive bombs
+const dmarcMaxReportSize = 50 << 20
+
+var (
+	ErrUnknownDMARCDomain = errors.New("report is for a domain with no DMARC record on file")
+	ErrAmbiguousDMARC     = errors.New("report matches verified domains of more than one creator")
+	ErrUnrecognizedReport = errors.New("not a DMARC aggregate report")
+	ErrMalformedReport    = errors.New("malformed DMARC report submission")
+)
+
+// DMARCReportService ingests DMARC aggregate reports and summarizes them per
+// creator domain
+type DMARCReportService struct {
+	db *gorm.DB
+}
+
+func NewDMARCReportService() *DMARCReportService {
+	return &DMARCReportService{db: database.GetDB()}
+}
+
+// VerifyDMARCIngestToken checks the shared secret inbound mail forwarders
+// post reports with, from DMARC_INGEST_SECRET
+func VerifyDMARCIngestToken(token string) error {
+	return verifyIngestToken("DMARC_INGEST_SECRET", token)
+}
+
+// dmarcFeedback is the aggregate report format of RFC 7489 appendix C
+type dmarcFeedback struct {
+	ReportMetadata struct {
+		OrgName   string `xml:"org_name"`
+		Email     string `xml:"email"`
+		ReportID  string `xml:"report_id"`
+		DateRange struct {
+			Begin int64 `xml:"begin"`
+			End   int64 `xml:"end"`
+		} `xml:"date_range"`
+	} `xml:"report_metadata"`
+	PolicyPublished struct {
+		Domain string `xml:"domain"`
+		ADKIM  string `xml:"adkim"`
+		ASPF   string `xml:"aspf"`
+		P      string `xml:"p"`
+		SP     string `xml:"sp"`
+		Pct    *int   `xml:"pct"`
+	} `xml:"policy_published"`
+	Records []struct {
+		Row struct {
+			SourceIP        string `xml:"source_ip"`
+			Count           int64  `xml:"count"`
+			PolicyEvaluated struct {
+				Disposition string `xml:"disposition"`
+				DKIM        string `xml:"dkim"`
+				SPF         string `xml:"spf"`
+			} `xml:"policy_evaluated"`
+		} `xml:"row"`
+		Identifiers struct {
+			HeaderFrom   string `xml:"header_from"`
+			EnvelopeFrom string `xml:"envelope_from"`
+		} `xml:"identifiers"`
+		AuthResults struct {
+			DKIM []dmarcAuthResult `xml:"dkim"`
+			SPF  []dmarcAuthResult `xml:"spf"`
+		} `xml:"auth_results"`
+	} `xml:"record"`
+}
+
+type dmarcAuthResult struct {
+	Domain string `xml:"domain"`
+	Result string `xml:"result"`
+}
+
+// pick returns the first passing result, or the first one when none passed
+func pick(results []dmarcAuthResult) dmarcAuthResult {
+	for _, r := range results {
+		if strings.EqualFold(r.Result, "pass") {
+			return r
+		}
+	}
+	if len(results) > 0 {
+		return results[0]
+	}
+	return dmarcAuthResult{}
+}
+
+// DMARCIngestResult counts what happened to the reports in one submission
+type DMARCIngestResult struct {
+	Stored     int `json:"stored"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"` // unreadable, or for a domain we don't know
+}
+
+func (r *DMARCIngestResult) add(other *DMARCIngestResult) {
+	r.Stored += other.Stored
+	r.Duplicates += other.Duplicates
+	r.Skipped += other.Skipped
+}
+
+// Ingest stores the reports in one attachment: XML, gzip or zip
+func (s *DMARCReportService) Ingest(data []byte) (*DMARCIngestResult, error) {
+	documents, err := reportDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DMARCIngestResult{}
+	for _, document := range documents {
+		var feedback dmarcFeedback
+		if err := xml.Unmarshal(document, &feedback); err != nil ||
+			feedback.ReportMetadata.OrgName == "" || feedback.ReportMetadata.ReportID == "" || feedback.PolicyPublished.Domain == "" {
+			result.Skipped++
+			continue
+		}
+
+		stored, err := s.store(&feedback)
+		switch {
+		case errors.Is(err, ErrUnknownDMARCDomain), errors.Is(err, ErrAmbiguousDMARC):
+			log.Printf("[DMARC] Skipping report %s from %s: %v", feedback.ReportMetadata.ReportID, feedback.ReportMetadata.OrgName, err)
+			result.Skipped++
+		case err != nil:
+			return result, err
+		case stored:
+			result.Stored++
+		default:
+			result.Duplicates++
+		}
+	}
+	return result, nil
+}
+
+// IngestMessage stores the reports attached to a raw RFC 5322 email, as
+// forwarded from the rua mailbox
+func (s *DMARCReportService) IngestMessage(raw []byte) (*DMARCIngestResult, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: email: %v", ErrMalformedReport, err)
+	}
+
+	var attachments [][]byte
+	if err := collectAttachments(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, &attachments); err != nil {
+		return nil, err
+	}
+
+	result := &DMARCIngestResult{}
+	for _, attachment := range attachments {
+		one, err := s.Ingest(attachment)
+		if errors.Is(err, ErrUnrecognizedReport) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.add(one)
+	}
+	return result, nil
+}
+
+// collectAttachments walks a MIME entity and gathers the decoded bodies of
+// parts that may hold a report
+func collectAttachments(contentType, encoding string, body io.Reader, out *[][]byte) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: multipart body: %v", ErrMalformedReport, err)
+			}
+			if err := collectAttachments(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, out); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Reports arrive as application/gzip, application/zip or text/xml under
+	// various names; skip the human readable parts
+	if mediaType == "text/plain" || mediaType == "text/html" {
+		return nil
+	}
+	if strings.EqualFold(strings.TrimSpace(encoding), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, dmarcMaxReportSize))
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+	*out = append(*out, data)
+	return nil
+}
+
+// reportDocuments unpacks an attachment into its XML documents
+func reportDocuments(data []byte) ([][]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: gzip report: %v", ErrMalformedReport, err)
+		}
+		document, err := io.ReadAll(io.LimitReader(reader, dmarcMaxReportSize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: gzip report: %v", ErrMalformedReport, err)
+		}
+		return [][]byte{document}, nil
+
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: zip report: %v", ErrMalformedReport, err)
+		}
+		var documents [][]byte
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%w: zip report: %v", ErrMalformedReport, err)
+			}
+			document, err := io.ReadAll(io.LimitReader(rc, dmarcMaxReportSize))
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%w: zip report: %v", ErrMalformedReport, err)
+			}
+			documents = append(documents, document)
+		}
+		return documents, nil
+
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")):
+		return [][]byte{data}, nil
+	}
+	return nil, ErrUnrecognizedReport
+}
+
+// store saves a parsed report against the creator whose DMARC record covers
+// its domain. It returns false when the report was already stored.
+func (s *DMARCReportService) store(feedback *dmarcFeedback) (bool, error) {
+	record, err := s.dmarcRecordFor(feedback)
+	if err != nil {
+		return false, err
+	}
+
+	meta, policy := feedback.ReportMetadata, feedback.PolicyPublished
+	report := models.DMARCReport{
+		CreatorID:       record.CreatorID,
+		DNSRecordID:     &record.ID,
+		Domain:          record.Domain,
+		OrgName:         meta.OrgName,
+		ReportID:        meta.ReportID,
+		Email:           meta.Email,
+		BeginAt:         time.Unix(meta.DateRange.Begin, 0).UTC(),
+		EndAt:           time.Unix(meta.DateRange.End, 0).UTC(),
+		Policy:          strings.ToLower(policy.P),
+		SubdomainPolicy: strings.ToLower(policy.SP),
+		ADKIM:           strings.ToLower(policy.ADKIM),
+		ASPF:            strings.ToLower(policy.ASPF),
+		Percent:         100,
+	}
+	if policy.Pct != nil {
+		report.Percent = *policy.Pct
+	}
+
+	rows := make([]models.DMARCRecord, 0, len(feedback.Records))
+	for _, r := range feedback.Records {
+		dkim, spf := pick(r.AuthResults.DKIM), pick(r.AuthResults.SPF)
+		row := models.DMARCRecord{
+			CreatorID:    record.CreatorID,
+			Domain:       record.Domain,
+			SourceIP:     r.Row.SourceIP,
+			Count:        r.Row.Count,
+			Disposition:  strings.ToLower(r.Row.PolicyEvaluated.Disposition),
+			DKIMAligned:  strings.EqualFold(r.Row.PolicyEvaluated.DKIM, "pass"),
+			SPFAligned:   strings.EqualFold(r.Row.PolicyEvaluated.SPF, "pass"),
+			HeaderFrom:   strings.ToLower(r.Identifiers.HeaderFrom),
+			EnvelopeFrom: strings.ToLower(r.Identifiers.EnvelopeFrom),
+			DKIMDomain:   strings.ToLower(dkim.Domain),
+			DKIMResult:   strings.ToLower(dkim.Result),
+			SPFDomain:    strings.ToLower(spf.Domain),
+			SPFResult:    strings.ToLower(spf.Result),
+			BeginAt:      report.BeginAt,
+		}
+		row.Passed = row.DKIMAligned || row.SPFAligned
+
+		report.MessageCount += row.Count
+		if row.Passed {
+			report.PassCount += row.Count
+		}
+		rows = append(rows, row)
+	}
+
+	stored := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		stored = true
+
+		for i := range rows {
+			rows[i].ReportID = report.ID
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 500).Error
+	})
+	return stored, err
+}
+
+// dmarcRecordFor finds the DMARC DNSRecord a report belongs to: the policy
+// domain, or for a policy found at the organizational domain, the From
+// domain of the reported mail. Only sender domains whose owner has verified
+// them count, and a report that matches more than one creator's domains is
+// not assigned to any of them.
+func (s *DMARCReportService) dmarcRecordFor(feedback *dmarcFeedback) (*models.DNSRecord, error) {
+	domains := []string{strings.ToLower(feedback.PolicyPublished.Domain)}
+	for _, r := range feedback.Records {
+		if from := strings.ToLower(r.Identifiers.HeaderFrom); from != "" && from != domains[0] {
+			domains = append(domains, from)
+			break
+		}
+	}
+
+	// A failing domain was verified before, so its owner is still known
+	var records []models.DNSRecord
+	err := s.db.Joins("JOIN sender_domains ON sender_domains.domain = dns_records.domain AND sender_domains.creator_id = dns_records.creator_id").
+		Where("dns_records.record_type = ? AND dns_records.domain IN ?", "DMARC", domains).
+		Where("sender_domains.status IN ?", []models.SenderDomainStatus{models.SenderDomainVerified, models.SenderDomainFailing}).
+		Order("dns_records.created_at ASC").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrUnknownDMARCDomain
+	}
+	for _, record := range records[1:] {
+		if record.CreatorID != records[0].CreatorID {
+			return nil, ErrAmbiguousDMARC
+		}
+	}
+	return &records[0], nil
+}
+
+// DMARCSource is what receivers reported about mail from one source IP
+type DMARCSource struct {
+	SourceIP        string    `json:"sourceIp"`
+	Messages        int64     `json:"messages"`
+	Passed          int64     `json:"passed"`
+	Failed          int64     `json:"failed"`
+	DKIMAligned     int64     `json:"dkimAligned"`
+	SPFAligned      int64     `json:"spfAligned"`
+	Quarantined     int64     `json:"quarantined"`
+	Rejected        int64     `json:"rejected"`
+	PassRate        float64   `json:"passRate"`
+	DKIMDomains     []string  `json:"dkimDomains,omitempty"`     // who signed the mail
+	EnvelopeDomains []string  `json:"envelopeDomains,omitempty"` // return-path domains
+	LastSeen        time.Time `json:"lastSeen"`
+}
+
+// DMARCSummary aggregates a domain's reports over the last Days days
+type DMARCSummary struct {
+	Domain   string        `json:"domain"`
+	Days     int           `json:"days"`
+	Reports  int64         `json:"reports"`
+	Messages int64         `json:"messages"`
+	Passed   int64         `json:"passed"`
+	PassRate float64       `json:"passRate"`
+	Sources  []DMARCSource `json:"sources"` // most failures first
+	Failing  []DMARCSource `json:"failing"` // sources with mail failing alignment
+}
+
+// Summary reports, per source IP, how a creator's domain fared in the
+// aggregate reports of the last days days
+func (s *DMARCReportService) Summary(creatorID uuid.UUID, domain string, days int) (*DMARCSummary, error) {
+	since := time.Now().AddDate(0, 0, -days)
+	summary := &DMARCSummary{Domain: domain, Days: days, Sources: []DMARCSource{}, Failing: []DMARCSource{}}
+
+	s.db.Model(&models.DMARCReport{}).
+		Where("creator_id = ? AND domain = ? AND begin_at > ?", creatorID, domain, since).
+		Count(&summary.Reports)
+
+	var rows []struct {
+		SourceIP        string
+		Messages        int64
+		Passed          int64
+		DKIMAligned     int64
+		SPFAligned      int64
+		Quarantined     int64
+		Rejected        int64
+		DKIMDomains     string
+		EnvelopeDomains string
+		LastSeen        time.Time
+	}
+	err := s.db.Model(&models.DMARCRecord{}).
+		Select(`source_ip, SUM(count) AS messages,
+			COALESCE(SUM(count) FILTER (WHERE passed), 0) AS passed,
+			COALESCE(SUM(count) FILTER (WHERE dkim_aligned), 0) AS dkim_aligned,
+			COALESCE(SUM(count) FILTER (WHERE spf_aligned), 0) AS spf_aligned,
+			COALESCE(SUM(count) FILTER (WHERE disposition = 'quarantine'), 0) AS quarantined,
+			COALESCE(SUM(count) FILTER (WHERE disposition = 'reject'), 0) AS rejected,
+			COALESCE(STRING_AGG(DISTINCT NULLIF(dkim_domain, ''), ','), '') AS dkim_domains,
+			COALESCE(STRING_AGG(DISTINCT NULLIF(envelope_from, ''), ','), '') AS envelope_domains,
+			MAX(begin_at) AS last_seen`).
+		Where("creator_id = ? AND domain = ? AND begin_at > ?", creatorID, domain, since).
+		Group("source_ip").
+		Order("SUM(count) - COALESCE(SUM(count) FILTER (WHERE passed), 0) DESC, messages DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		source := DMARCSource{
+			SourceIP:    row.SourceIP,
+			Messages:    row.Messages,
+			Passed:      row.Passed,
+			Failed:      row.Messages - row.Passed,
+			DKIMAligned: row.DKIMAligned,
+			SPFAligned:  row.SPFAligned,
+			Quarantined: row.Quarantined,
+			Rejected:    row.Rejected,
+			LastSeen:    row.LastSeen,
+		}
+		if row.DKIMDomains != "" {
+			source.DKIMDomains = strings.Split(row.DKIMDomains, ",")
+		}
+		if row.EnvelopeDomains != "" {
+			source.EnvelopeDomains = strings.Split(row.EnvelopeDomains, ",")
+		}
+		if source.Messages > 0 {
+			source.PassRate = float64(source.Passed) / float64(source.Messages) * 100
+		}
+
+		summary.Messages += source.Messages
+		summary.Passed += source.Passed
+		summary.Sources = append(summary.Sources, source)
+		if source.Failed > 0 {
+			summary.Failing = append(summary.Failing, source)
+		}
+	}
+	if summary.Messages > 0 {
+		summary.PassRate = float64(summary.Passed) / float64(summary.Messages) * 100
+	}
+	return summary, nil
+}
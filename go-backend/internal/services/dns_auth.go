@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DNSResolver looks up TXT records. *net.Resolver satisfies it; pass a fake
+// to check domains without network access.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// spfMaxLookups is the RFC 7208 §4.6.4 limit on DNS-querying SPF terms
+const spfMaxLookups = 10
+
+// lookupTXT returns a name's TXT records, or none when the name doesn't exist
+func lookupTXT(ctx context.Context, resolver DNSResolver, name string) ([]string, error) {
+	records, err := resolver.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return records, err
+}
+
+// findRecord returns the records starting with the version tag
+func findRecord(records []string, version string) []string {
+	var found []string
+	for _, record := range records {
+		tag := strings.TrimSpace(record)
+		if i := strings.IndexAny(tag, " ;"); i >= 0 {
+			tag = tag[:i]
+		}
+		if strings.EqualFold(tag, version) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// parseTagList parses a "k=v; k=v" tag list as used by DKIM and DMARC
+// records. Tag names are lowercased.
+func parseTagList(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+// organizationalDomain approximates the registrable part of a domain: the
+// last two labels, or three under a country code second level such as co.ke
+func organizationalDomain(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+
+	n := 2
+	tld, second := labels[len(labels)-1], labels[len(labels)-2]
+	if len(tld) == 2 {
+		switch second {
+		case "co", "com", "ac", "or", "org", "ne", "net", "go", "gov", "edu", "sc", "me":
+			n = 3
+		}
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// --- SPF ---
+
+// SPFCheck is the outcome of evaluating a domain's SPF record
+type SPFCheck struct {
+	Record   string   `json:"record,omitempty"`
+	Valid    bool     `json:"valid"`
+	Lookups  int      `json:"lookups"`            // DNS-querying terms, nested includes counted
+	Includes []string `json:"includes,omitempty"` // every included domain, nested ones too
+	Missing  []string `json:"missing,omitempty"`  // required includes that were not found
+	Issues   []string `json:"issues,omitempty"`
+}
+
+// CheckSPF evaluates a domain's SPF record: there must be exactly one, it
+// must stay within 10 DNS lookups, reach every required include and not
+// authorize the whole internet with +all
+func CheckSPF(ctx context.Context, resolver DNSResolver, domain string, required []string) *SPFCheck {
+	check := &SPFCheck{}
+
+	records, err := lookupTXT(ctx, resolver, domain)
+	if err != nil {
+		check.Issues = append(check.Issues, fmt.Sprintf("SPF lookup failed: %v", err))
+		return check
+	}
+	spf := findRecord(records, "v=spf1")
+	switch {
+	case len(spf) == 0:
+		check.Issues = append(check.Issues, "no SPF record found")
+		return check
+	case len(spf) > 1:
+		check.Issues = append(check.Issues, "multiple SPF records found; receivers treat this as an error")
+		return check
+	}
+	check.Record = spf[0]
+
+	seen := map[string]bool{strings.ToLower(domain): true}
+	check.walkSPF(ctx, resolver, check.Record, seen)
+
+	if check.Lookups > spfMaxLookups {
+		check.Issues = append(check.Issues, fmt.Sprintf("SPF needs %d DNS lookups, the limit is %d", check.Lookups, spfMaxLookups))
+	}
+	for _, want := range required {
+		if !seen[strings.ToLower(want)] {
+			check.Missing = append(check.Missing, want)
+			check.Issues = append(check.Issues, fmt.Sprintf("SPF record does not include %s", want))
+		}
+	}
+
+	check.Valid = len(check.Issues) == 0
+	return check
+}
+
+// walkSPF counts the lookups of one record and follows its includes and
+// redirect, recording included domains in seen
+func (c *SPFCheck) walkSPF(ctx context.Context, resolver DNSResolver, record string, seen map[string]bool) {
+	terms := strings.Fields(record)[1:]
+	for _, term := range terms {
+		lower := strings.ToLower(term)
+
+		if name, value, ok := strings.Cut(lower, "="); ok {
+			if name == "redirect" {
+				c.Lookups++
+				c.followSPF(ctx, resolver, value, seen)
+			}
+			continue
+		}
+
+		qualifier := byte('+')
+		if strings.IndexByte("+-~?", lower[0]) >= 0 {
+			qualifier = lower[0]
+			lower = lower[1:]
+		}
+		mechanism, arg, _ := strings.Cut(lower, ":")
+		mechanism, _, _ = strings.Cut(mechanism, "/")
+
+		switch mechanism {
+		case "include":
+			c.Lookups++
+			c.Includes = append(c.Includes, arg)
+			c.followSPF(ctx, resolver, arg, seen)
+		case "a", "mx", "ptr", "exists":
+			c.Lookups++
+		case "all":
+			if qualifier == '+' {
+				c.Issues = append(c.Issues, "SPF ends in +all, which lets any server send as the domain")
+			}
+		}
+	}
+}
+
+func (c *SPFCheck) followSPF(ctx context.Context, resolver DNSResolver, domain string, seen map[string]bool) {
+	// Macros can't be expanded without a message; loops and runaway chains
+	// stop once the lookup limit is passed
+	if domain == "" || strings.Contains(domain, "%") || seen[domain] || c.Lookups > spfMaxLookups {
+		return
+	}
+	seen[domain] = true
+
+	records, err := lookupTXT(ctx, resolver, domain)
+	if err != nil {
+		c.Issues = append(c.Issues, fmt.Sprintf("SPF lookup for %s failed: %v", domain, err))
+		return
+	}
+	spf := findRecord(records, "v=spf1")
+	if len(spf) != 1 {
+		c.Issues = append(c.Issues, fmt.Sprintf("%s has no usable SPF record", domain))
+		return
+	}
+	c.walkSPF(ctx, resolver, spf[0], seen)
+}
+
+// --- DKIM ---
+
+// DKIMCheck is the outcome of checking a selector's published key
+type DKIMCheck struct {
+	Selector string   `json:"selector"`
+	Record   string   `json:"record,omitempty"`
+	Valid    bool     `json:"valid"`
+	KeyBits  int      `json:"keyBits,omitempty"`
+	Issues   []string `json:"issues,omitempty"`
+}
+
+// CheckDKIM parses the key published at selector._domainkey.domain and
+// compares it with the key we sign with
+func CheckDKIM(ctx context.Context, resolver DNSResolver, domain, selector string, expected *rsa.PublicKey) *DKIMCheck {
+	check := &DKIMCheck{Selector: selector}
+	if !validDKIMSelector(selector) {
+		check.Issues = append(check.Issues, fmt.Sprintf("DKIM selector %q is not a valid DNS name", selector))
+		return check
+	}
+	host := selector + "._domainkey." + domain
+
+	records, err := lookupTXT(ctx, resolver, host)
+	if err != nil {
+		check.Issues = append(check.Issues, fmt.Sprintf("DKIM lookup failed: %v", err))
+		return check
+	}
+	if len(records) == 0 {
+		check.Issues = append(check.Issues, fmt.Sprintf("no DKIM record found at %s", host))
+		return check
+	}
+	if len(records) > 1 {
+		check.Issues = append(check.Issues, fmt.Sprintf("multiple TXT records found at %s", host))
+		return check
+	}
+	check.Record = records[0]
+
+	tags := parseTagList(check.Record)
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		check.Issues = append(check.Issues, "DKIM record version must be DKIM1")
+		return check
+	}
+	if k, ok := tags["k"]; ok && !strings.EqualFold(k, "rsa") {
+		check.Issues = append(check.Issues, fmt.Sprintf("DKIM key type %q is not the rsa key we sign with", k))
+		return check
+	}
+
+	p := strings.Join(strings.Fields(tags["p"]), "")
+	if p == "" {
+		check.Issues = append(check.Issues, "DKIM key has been revoked (empty p=)")
+		return check
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		check.Issues = append(check.Issues, "DKIM public key is not valid base64")
+		return check
+	}
+	key, err := parseRSAPublicKey(der)
+	if err != nil {
+		check.Issues = append(check.Issues, err.Error())
+		return check
+	}
+	check.KeyBits = key.N.BitLen()
+
+	if check.KeyBits < 1024 {
+		check.Issues = append(check.Issues, fmt.Sprintf("DKIM key is only %d bits; use at least 1024", check.KeyBits))
+	}
+	if expected != nil && !key.Equal(expected) {
+		check.Issues = append(check.Issues, "published DKIM key does not match the signing key")
+	}
+
+	check.Valid = len(check.Issues) == 0
+	return check
+}
+
+// parseRSAPublicKey decodes a DKIM p= value, SubjectPublicKeyInfo or bare PKCS#1
+func parseRSAPublicKey(der []byte) (*rsa.PublicKey, error) {
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		key, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("DKIM public key is not an RSA key")
+		}
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, errors.New("DKIM public key could not be parsed")
+	}
+	return key, nil
+}
+
+// --- DMARC ---
+
+// DMARCCheck is the outcome of checking a domain's DMARC policy
+type DMARCCheck struct {
+	Record          string   `json:"record,omitempty"`
+	Valid           bool     `json:"valid"`
+	Policy          string   `json:"policy,omitempty"`
+	SubdomainPolicy string   `json:"subdomainPolicy,omitempty"`
+	Percent         int      `json:"percent"`
+	ReportURIs      []string `json:"reportUris,omitempty"`
+	Aligned         bool     `json:"aligned"` // our DKIM signature aligns with the From domain
+	Issues          []string `json:"issues,omitempty"`
+}
+
+// CheckDMARC finds the DMARC policy for a From domain, falling back to the
+// organizational domain, and checks that mail signed with dkimDomain aligns
+// under its adkim mode
+func CheckDMARC(ctx context.Context, resolver DNSResolver, fromDomain, dkimDomain string) *DMARCCheck {
+	check := &DMARCCheck{Percent: 100}
+
+	dmarc, err := findDMARC(ctx, resolver, fromDomain)
+	if err != nil {
+		check.Issues = append(check.Issues, fmt.Sprintf("DMARC lookup failed: %v", err))
+		return check
+	}
+	switch {
+	case len(dmarc) == 0:
+		check.Issues = append(check.Issues, "no DMARC record found")
+		return check
+	case len(dmarc) > 1:
+		check.Issues = append(check.Issues, "multiple DMARC records found; receivers ignore them all")
+		return check
+	}
+	check.Record = dmarc[0]
+
+	tags := parseTagList(check.Record)
+	check.Policy = strings.ToLower(tags["p"])
+	check.SubdomainPolicy = strings.ToLower(tags["sp"])
+	switch check.Policy {
+	case "none", "quarantine", "reject":
+	case "":
+		check.Issues = append(check.Issues, "DMARC record has no p= policy")
+	default:
+		check.Issues = append(check.Issues, fmt.Sprintf("DMARC policy %q is not none, quarantine or reject", check.Policy))
+	}
+	if pct, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			check.Issues = append(check.Issues, "DMARC pct= must be between 0 and 100")
+		} else {
+			check.Percent = n
+		}
+	}
+	for _, uri := range strings.Split(tags["rua"], ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			check.ReportURIs = append(check.ReportURIs, uri)
+		}
+	}
+
+	// Strict alignment needs the exact domain, relaxed the same organization
+	fromDomain, dkimDomain = strings.ToLower(fromDomain), strings.ToLower(dkimDomain)
+	if strings.EqualFold(tags["adkim"], "s") {
+		check.Aligned = fromDomain == dkimDomain
+	} else {
+		check.Aligned = organizationalDomain(fromDomain) == organizationalDomain(dkimDomain)
+	}
+	if !check.Aligned {
+		check.Issues = append(check.Issues, fmt.Sprintf("DKIM signatures for %s do not align with %s", dkimDomain, fromDomain))
+	}
+
+	check.Valid = len(check.Issues) == 0
+	return check
+}
+
+// findDMARC looks up _dmarc at the domain, then at its organizational domain
+func findDMARC(ctx context.Context, resolver DNSResolver, domain string) ([]string, error) {
+	records, err := lookupTXT(ctx, resolver, "_dmarc."+domain)
+	if err != nil {
+		return nil, err
+	}
+	if found := findRecord(records, "v=DMARC1"); len(found) > 0 {
+		return found, nil
+	}
+
+	if org := organizationalDomain(domain); org != strings.ToLower(domain) {
+		records, err = lookupTXT(ctx, resolver, "_dmarc."+org)
+		if err != nil {
+			return nil, err
+		}
+		return findRecord(records, "v=DMARC1"), nil
+	}
+	return nil, nil
+}
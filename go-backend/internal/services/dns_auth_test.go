@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeResolver serves TXT records from a map; missing names are NXDOMAIN
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := f[strings.ToLower(name)]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func hasIssue(issues []string, substr string) bool {
+	for _, issue := range issues {
+		if strings.Contains(issue, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckSPF(t *testing.T) {
+	// A chain of eleven includes, one past the lookup limit
+	deep := fakeResolver{"deep.test": {"v=spf1 include:l1.test -all"}}
+	for i := 1; i <= 11; i++ {
+		deep[fmt.Sprintf("l%d.test", i)] = []string{fmt.Sprintf("v=spf1 include:l%d.test -all", i+1)}
+	}
+	deep["l12.test"] = []string{"v=spf1 -all"}
+
+	tests := []struct {
+		name     string
+		resolver fakeResolver
+		domain   string
+		required []string
+		valid    bool
+		lookups  int
+		includes []string
+		issue    string
+	}{
+		{
+			name: "nested includes are followed",
+			resolver: fakeResolver{
+				"example.com":    {"google-site-verification=abc", "v=spf1 include:_spf.esp.test ~all"},
+				"_spf.esp.test":  {"v=spf1 include:_spf2.esp.test ip4:192.0.2.0/24 -all"},
+				"_spf2.esp.test": {"v=spf1 a mx -all"},
+			},
+			domain:   "example.com",
+			required: []string{"_spf2.esp.test"},
+			valid:    true,
+			lookups:  4,
+			includes: []string{"_spf.esp.test", "_spf2.esp.test"},
+		},
+		{
+			name:     "missing required include",
+			resolver: fakeResolver{"example.com": {"v=spf1 mx -all"}},
+			domain:   "example.com",
+			required: []string{"_spf.esp.test"},
+			lookups:  1,
+			issue:    "does not include _spf.esp.test",
+		},
+		{
+			name:     "more than ten lookups",
+			resolver: deep,
+			domain:   "deep.test",
+			lookups:  11,
+			issue:    "the limit is 10",
+		},
+		{
+			name: "redirect loop stops",
+			resolver: fakeResolver{
+				"example.com": {"v=spf1 redirect=a.test"},
+				"a.test":      {"v=spf1 redirect=b.test"},
+				"b.test":      {"v=spf1 redirect=a.test"},
+			},
+			domain:  "example.com",
+			valid:   true,
+			lookups: 3,
+		},
+		{
+			name:     "plus all",
+			resolver: fakeResolver{"example.com": {"v=spf1 ip4:192.0.2.1 +all"}},
+			domain:   "example.com",
+			issue:    "+all",
+		},
+		{
+			name:     "bare all is plus all",
+			resolver: fakeResolver{"example.com": {"v=spf1 all"}},
+			domain:   "example.com",
+			issue:    "+all",
+		},
+		{
+			name:     "no record",
+			resolver: fakeResolver{"example.com": {"some other text"}},
+			domain:   "example.com",
+			issue:    "no SPF record",
+		},
+		{
+			name:     "nxdomain",
+			resolver: fakeResolver{},
+			domain:   "example.com",
+			issue:    "no SPF record",
+		},
+		{
+			name:     "multiple records",
+			resolver: fakeResolver{"example.com": {"v=spf1 -all", "v=spf1 mx -all"}},
+			domain:   "example.com",
+			issue:    "multiple SPF records",
+		},
+		{
+			name:     "include without a record",
+			resolver: fakeResolver{"example.com": {"v=spf1 include:gone.test -all"}},
+			domain:   "example.com",
+			lookups:  1,
+			issue:    "gone.test has no usable SPF record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckSPF(context.Background(), tt.resolver, tt.domain, tt.required)
+			if check.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (issues: %v)", check.Valid, tt.valid, check.Issues)
+			}
+			if tt.lookups != 0 && check.Lookups != tt.lookups {
+				t.Errorf("Lookups = %d, want %d", check.Lookups, tt.lookups)
+			}
+			if tt.includes != nil && strings.Join(check.Includes, ",") != strings.Join(tt.includes, ",") {
+				t.Errorf("Includes = %v, want %v", check.Includes, tt.includes)
+			}
+			if tt.issue != "" && !hasIssue(check.Issues, tt.issue) {
+				t.Errorf("Issues = %v, want one containing %q", check.Issues, tt.issue)
+			}
+		})
+	}
+}
+
+func TestCheckDKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := base64.StdEncoding.EncodeToString(pkix)
+	pkcs1 := base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+
+	tests := []struct {
+		name     string
+		record   []string
+		selector string
+		expected *rsa.PublicKey
+		valid    bool
+		issue    string
+	}{
+		{name: "matching key", record: []string{"v=DKIM1; k=rsa; p=" + published}, expected: &key.PublicKey, valid: true},
+		{name: "bare pkcs1 key", record: []string{"v=DKIM1; p=" + pkcs1}, expected: &key.PublicKey, valid: true},
+		{name: "key split by whitespace", record: []string{"v=DKIM1; p=" + published[:40] + " " + published[40:]}, expected: &key.PublicKey, valid: true},
+		{name: "different key", record: []string{"v=DKIM1; p=" + published}, expected: &other.PublicKey, issue: "does not match"},
+		{name: "revoked key", record: []string{"v=DKIM1; p="}, issue: "revoked"},
+		{name: "wrong version", record: []string{"v=DKIM2; p=" + published}, issue: "must be DKIM1"},
+		{name: "wrong key type", record: []string{"v=DKIM1; k=ed25519; p=" + published}, issue: "not the rsa key"},
+		{name: "bad base64", record: []string{"v=DKIM1; p=***"}, issue: "not valid base64"},
+		{name: "no record", issue: "no DKIM record found"},
+		{name: "invalid selector", selector: "nl1._domainkey.evil.test/", issue: "not a valid DNS name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := tt.selector
+			if selector == "" {
+				selector = "nl1"
+			}
+			resolver := fakeResolver{}
+			if tt.record != nil {
+				resolver["nl1._domainkey.example.com"] = tt.record
+			}
+
+			check := CheckDKIM(context.Background(), resolver, "example.com", selector, tt.expected)
+			if check.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (issues: %v)", check.Valid, tt.valid, check.Issues)
+			}
+			if tt.valid && check.KeyBits != 2048 {
+				t.Errorf("KeyBits = %d, want 2048", check.KeyBits)
+			}
+			if tt.issue != "" && !hasIssue(check.Issues, tt.issue) {
+				t.Errorf("Issues = %v, want one containing %q", check.Issues, tt.issue)
+			}
+		})
+	}
+}
+
+func TestCheckDMARC(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolver   fakeResolver
+		fromDomain string
+		dkimDomain string
+		valid      bool
+		aligned    bool
+		policy     string
+		percent    int
+		issue      string
+	}{
+		{
+			name:       "relaxed alignment accepts a subdomain",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=reject; rua=mailto:a@example.com, mailto:b@example.com"}},
+			fromDomain: "example.com",
+			dkimDomain: "mail.example.com",
+			valid:      true,
+			aligned:    true,
+			policy:     "reject",
+			percent:    100,
+		},
+		{
+			name:       "strict alignment needs the exact domain",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=quarantine; adkim=s"}},
+			fromDomain: "example.com",
+			dkimDomain: "mail.example.com",
+			policy:     "quarantine",
+			percent:    100,
+			issue:      "do not align",
+		},
+		{
+			name:       "strict alignment with the exact domain",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=none; adkim=s; pct=50"}},
+			fromDomain: "example.com",
+			dkimDomain: "EXAMPLE.com",
+			valid:      true,
+			aligned:    true,
+			policy:     "none",
+			percent:    50,
+		},
+		{
+			name:       "falls back to the organizational domain",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=reject"}},
+			fromDomain: "news.example.com",
+			dkimDomain: "example.com",
+			valid:      true,
+			aligned:    true,
+			policy:     "reject",
+			percent:    100,
+		},
+		{
+			name:       "falls back under a country code second level",
+			resolver:   fakeResolver{"_dmarc.shop.co.ke": {"v=DMARC1; p=none"}},
+			fromDomain: "news.shop.co.ke",
+			dkimDomain: "shop.co.ke",
+			valid:      true,
+			aligned:    true,
+			policy:     "none",
+			percent:    100,
+		},
+		{
+			name: "subdomain record wins over the organizational one",
+			resolver: fakeResolver{
+				"_dmarc.news.example.com": {"v=DMARC1; p=none"},
+				"_dmarc.example.com":      {"v=DMARC1; p=reject"},
+			},
+			fromDomain: "news.example.com",
+			dkimDomain: "news.example.com",
+			valid:      true,
+			aligned:    true,
+			policy:     "none",
+			percent:    100,
+		},
+		{
+			name:       "relaxed alignment rejects another organization",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=none"}},
+			fromDomain: "example.com",
+			dkimDomain: "esp.test",
+			policy:     "none",
+			percent:    100,
+			issue:      "do not align",
+		},
+		{
+			name:       "no record",
+			resolver:   fakeResolver{},
+			fromDomain: "example.com",
+			dkimDomain: "example.com",
+			percent:    100,
+			issue:      "no DMARC record",
+		},
+		{
+			name:       "multiple records",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=none", "v=DMARC1; p=reject"}},
+			fromDomain: "example.com",
+			dkimDomain: "example.com",
+			percent:    100,
+			issue:      "multiple DMARC records",
+		},
+		{
+			name:       "bad policy and pct",
+			resolver:   fakeResolver{"_dmarc.example.com": {"v=DMARC1; p=block; pct=150"}},
+			fromDomain: "example.com",
+			dkimDomain: "example.com",
+			aligned:    true,
+			policy:     "block",
+			percent:    100,
+			issue:      "pct= must be between 0 and 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckDMARC(context.Background(), tt.resolver, tt.fromDomain, tt.dkimDomain)
+			if check.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (issues: %v)", check.Valid, tt.valid, check.Issues)
+			}
+			if check.Aligned != tt.aligned {
+				t.Errorf("Aligned = %v, want %v", check.Aligned, tt.aligned)
+			}
+			if check.Policy != tt.policy {
+				t.Errorf("Policy = %q, want %q", check.Policy, tt.policy)
+			}
+			if check.Percent != tt.percent {
+				t.Errorf("Percent = %d, want %d", check.Percent, tt.percent)
+			}
+			if tt.issue != "" && !hasIssue(check.Issues, tt.issue) {
+				t.Errorf("Issues = %v, want one containing %q", check.Issues, tt.issue)
+			}
+		})
+	}
+}
+
+func TestOrganizationalDomain(t *testing.T) {
+	tests := map[string]string{
+		"example.com":        "example.com",
+		"mail.example.com":   "example.com",
+		"a.b.example.com.":   "example.com",
+		"news.shop.co.ke":    "shop.co.ke",
+		"shop.co.ke":         "shop.co.ke",
+		"mail.example.de":    "example.de",
+		"Mail.Example.CO.UK": "example.co.uk",
+		"localhost":          "localhost",
+	}
+	for domain, want := range tests {
+		if got := organizationalDomain(domain); got != want {
+			t.Errorf("organizationalDomain(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
@@ -175,14 +175,11 @@ func (s *EngagementService) GetUnengagedSubscribers(creatorID uuid.UUID, limit,
 	// Find subscribers who either:
 	// 1. Have a last_opened_at older than 90 days
 	// 2. Have never opened (last_opened_at is null) and subscribed more than 90 days ago
-	query := s.db.Where("creator_id = ? AND status = ?", creatorID, models.SubscriberStatusActive).
-		Where("(last_opened_at < ? OR (last_opened_at IS NULL AND subscribed_at < ?))", cutoffDate, cutoffDate)
-	
-	if err := query.Count(&total).Error; err != nil {
+	if err := unengaged(s.db, creatorID, cutoffDate).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	if err := query.Order("engagement_score ASC").Limit(limit).Offset(offset).Find(&subscribers).Error; err != nil {
+	if err := unengaged(s.db, creatorID, cutoffDate).Order("engagement_score ASC").Limit(limit).Offset(offset).Find(&subscribers).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -238,45 +235,6 @@ func (s *EngagementService) GetEngagementStats(creatorID uuid.UUID) (map[string]
 	}, nil
 }
 
-// PrunePreview returns a preview of subscribers that would be pruned
-func (s *EngagementService) PrunePreview(creatorID uuid.UUID) (map[string]interface{}, error) {
-	subscribers, total, err := s.GetUnengagedSubscribers(creatorID, 10, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	return map[string]interface{}{
-		"totalToPrune": total,
-		"preview":      subscribers,
-		"criteria":     "No email opens in the last 90 days",
-	}, nil
-}
-
-// PruneUnengaged archives/removes unengaged subscribers
-func (s *EngagementService) PruneUnengaged(creatorID uuid.UUID, archive bool) (int64, error) {
-	cutoffDate := time.Now().AddDate(0, 0, -UnengagedDays)
-
-	query := s.db.Model(&models.Subscriber{}).
-		Where("creator_id = ? AND status = ?", creatorID, models.SubscriberStatusActive).
-		Where("(last_opened_at < ? OR (last_opened_at IS NULL AND subscribed_at < ?))", cutoffDate, cutoffDate)
-
-	if archive {
-		// Archive by updating status (keeps data but removes from active lists)
-		now := time.Now()
-		result := query.Updates(map[string]interface{}{
-			"status":         models.SubscriberStatusUnsubscribed,
-			"unsubscribed_at": now,
-		})
-		log.Printf("[Engagement] Archived %d unengaged subscribers for creator %s", result.RowsAffected, creatorID)
-		return result.RowsAffected, result.Error
-	}
-
-	// Hard delete (permanent removal)
-	result := query.Delete(&models.Subscriber{})
-	log.Printf("[Engagement] Deleted %d unengaged subscribers for creator %s", result.RowsAffected, creatorID)
-	return result.RowsAffected, result.Error
-}
-
 // RecalculateAllScores recalculates engagement scores for all active subscribers
 func (s *EngagementService) RecalculateAllScores(creatorID uuid.UUID) error {
 	var subscribers []models.Subscriber
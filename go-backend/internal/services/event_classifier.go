@@ -0,0 +1,239 @@
+package services
+
+import (
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// Reasons an open or click is classified as machine-generated
+const (
+	MachineReasonPrivacyProxy = "privacy_proxy"  // Apple Mail Privacy Protection
+	MachineReasonImageProxy   = "image_proxy"    // Gmail/Yahoo image prefetch
+	MachineReasonScanner      = "scanner"        // security gateway or bot user agent
+	MachineReasonNoUserAgent  = "no_user_agent"  // real clients always send one
+	MachineReasonKnownIP      = "known_ip_range" // scanner or proxy network
+	MachineReasonTooFast      = "too_fast"       // within seconds of delivery
+	MachineReasonClickBurst   = "click_burst"    // every link clicked at once
+)
+
+const (
+	// Humans don't open or click within this long of the message being sent
+	machineReactionWindow = 2 * time.Second
+	// Clicks on this many links of one message within the burst window are a scanner
+	machineBurstLinks  = 3
+	machineBurstWindow = 2 * time.Second
+)
+
+// User agent fragments of image proxies and link scanners. Matching is case
+// insensitive.
+var machineUserAgents = []struct {
+	fragment string
+	reason   string
+}{
+	{"googleimageproxy", MachineReasonImageProxy},
+	{"yahoomailproxy", MachineReasonImageProxy},
+	{"barracuda", MachineReasonScanner},
+	{"mimecast", MachineReasonScanner},
+	{"proofpoint", MachineReasonScanner},
+	{"symantec", MachineReasonScanner},
+	{"forcepoint", MachineReasonScanner},
+	{"trendmicro", MachineReasonScanner},
+	{"microsoft office existence discovery", MachineReasonScanner},
+	{"headlesschrome", MachineReasonScanner},
+	{"python-requests", MachineReasonScanner},
+	{"go-http-client", MachineReasonScanner},
+	{"curl/", MachineReasonScanner},
+	{"wget/", MachineReasonScanner},
+	{"bot/", MachineReasonScanner},
+	{"bot;", MachineReasonScanner},
+	{"spider", MachineReasonScanner},
+	{"crawler", MachineReasonScanner},
+	{"+http", MachineReasonScanner}, // crawlers advertise a contact URL
+}
+
+// Networks whose hits are never a person reading mail. Apple's 17.0.0.0/8
+// carries Mail Privacy Protection prefetches; the others are Google's image
+// proxy and Microsoft's Safe Links scanners. Extend with
+// TRACKING_MACHINE_IP_RANGES (comma separated CIDRs).
+var machineNetworks = map[string]string{
+	"17.0.0.0/8":     MachineReasonPrivacyProxy,
+	"66.102.0.0/20":  MachineReasonImageProxy,
+	"66.249.80.0/20": MachineReasonImageProxy,
+	"40.94.0.0/16":   MachineReasonScanner,
+	"52.100.0.0/14":  MachineReasonScanner,
+}
+
+// proxyMachineReasons are the machine reasons where a proxy fetched the
+// message on a reader's behalf. The open is still credited to the reader, but
+// its time says nothing about when they read it.
+var proxyMachineReasons = []string{MachineReasonPrivacyProxy, MachineReasonImageProxy}
+
+// isProxiedEvent reports whether a machine event was a privacy or image proxy
+// rather than a scanner
+func isProxiedEvent(event *models.EmailEvent) bool {
+	return event.IsMachine && event.MachineReason != nil && slices.Contains(proxyMachineReasons, *event.MachineReason)
+}
+
+// countsAsEngagement reports whether an open or click is credited to the
+// subscriber: human and proxied events are, scanner traffic is not
+func countsAsEngagement(event *models.EmailEvent) bool {
+	return !event.IsMachine || isProxiedEvent(event)
+}
+
+type machineNetwork struct {
+	network *net.IPNet
+	reason  string
+}
+
+// EventClassifier flags opens and clicks that come from privacy proxies,
+// image prefetchers and security scanners rather than a person
+type EventClassifier struct {
+	db       *gorm.DB
+	networks []machineNetwork
+}
+
+func NewEventClassifier() *EventClassifier {
+	c := &EventClassifier{db: database.GetDB()}
+
+	for cidr, reason := range machineNetworks {
+		c.addNetwork(cidr, reason)
+	}
+	for _, cidr := range strings.Split(os.Getenv("TRACKING_MACHINE_IP_RANGES"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			c.addNetwork(cidr, MachineReasonKnownIP)
+		}
+	}
+
+	return c
+}
+
+func (c *EventClassifier) addNetwork(cidr, reason string) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		log.Printf("[Tracking] Ignoring invalid machine IP range %q: %v", cidr, err)
+		return
+	}
+	c.networks = append(c.networks, machineNetwork{network: network, reason: reason})
+}
+
+// Classify sets IsMachine and MachineReason on an open or click event before
+// it is stored. Other event types are left alone.
+func (c *EventClassifier) Classify(event *models.EmailEvent) {
+	if event.EventType != models.EmailEventOpen && event.EventType != models.EmailEventClick {
+		return
+	}
+
+	reason := c.reason(event)
+	if reason == "" {
+		return
+	}
+	event.IsMachine = true
+	event.MachineReason = &reason
+}
+
+func (c *EventClassifier) reason(event *models.EmailEvent) string {
+	if event.UserAgent == nil || strings.TrimSpace(*event.UserAgent) == "" {
+		// Events relayed by providers may carry no request details at all
+		if event.IPAddress != nil {
+			return MachineReasonNoUserAgent
+		}
+	} else if reason := classifyUserAgent(*event.UserAgent); reason != "" {
+		return reason
+	}
+	if event.IPAddress != nil {
+		if ip := net.ParseIP(*event.IPAddress); ip != nil {
+			for _, n := range c.networks {
+				if n.network.Contains(ip) {
+					return n.reason
+				}
+			}
+		}
+	}
+	if c.tooFast(event) {
+		return MachineReasonTooFast
+	}
+	if event.EventType == models.EmailEventClick && c.clickBurst(event) {
+		return MachineReasonClickBurst
+	}
+	return ""
+}
+
+func classifyUserAgent(userAgent string) string {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	for _, m := range machineUserAgents {
+		if strings.Contains(ua, m.fragment) {
+			return m.reason
+		}
+	}
+	// Apple's MPP fetcher identifies as a bare "Mozilla/5.0"
+	if ua == "mozilla/5.0" {
+		return MachineReasonPrivacyProxy
+	}
+	return ""
+}
+
+// tooFast reports whether the event came within seconds of the send
+func (c *EventClassifier) tooFast(event *models.EmailEvent) bool {
+	if c.db == nil || event.MessageID == nil {
+		return false
+	}
+
+	var msg models.EmailMessage
+	if err := c.db.Select("id", "sent_at").First(&msg, "id = ?", *event.MessageID).Error; err != nil || msg.SentAt == nil {
+		return false
+	}
+	return eventTime(event).Sub(*msg.SentAt) < machineReactionWindow
+}
+
+// clickBurst reports whether this click completes a burst of clicks on
+// different links of the same message. The earlier clicks of the burst are
+// reclassified too.
+func (c *EventClassifier) clickBurst(event *models.EmailEvent) bool {
+	if c.db == nil {
+		return false
+	}
+
+	var recent []models.EmailEvent
+	c.db.Select("id", "metadata").
+		Where("campaign_id = ? AND subscriber_id = ? AND event_type = ? AND created_at >= ?",
+			event.CampaignID, event.SubscriberID, models.EmailEventClick, eventTime(event).Add(-machineBurstWindow)).
+		Find(&recent)
+
+	links := make(map[string]bool)
+	if event.Metadata != nil {
+		links[*event.Metadata] = true
+	}
+	ids := make([]interface{}, 0, len(recent))
+	for _, e := range recent {
+		if e.Metadata != nil {
+			links[*e.Metadata] = true
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(links) < machineBurstLinks {
+		return false
+	}
+
+	c.db.Model(&models.EmailEvent{}).
+		Where("id IN ? AND is_machine = ?", ids, false).
+		Updates(map[string]interface{}{
+			"is_machine":     true,
+			"machine_reason": MachineReasonClickBurst,
+		})
+	return true
+}
+
+func eventTime(event *models.EmailEvent) time.Time {
+	if event.CreatedAt.IsZero() {
+		return time.Now()
+	}
+	return event.CreatedAt
+}
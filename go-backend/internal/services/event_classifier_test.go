@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+func TestEventClassifierEngagement(t *testing.T) {
+	c := &EventClassifier{}
+	for cidr, reason := range machineNetworks {
+		c.addNetwork(cidr, reason)
+	}
+
+	tests := []struct {
+		name      string
+		eventType models.EmailEventType
+		userAgent string
+		ip        string
+		reason    string // "" for a human event
+		engaged   bool
+	}{
+		{name: "mail client", eventType: models.EmailEventOpen, userAgent: "Mozilla/5.0 (Windows NT 10.0) Thunderbird/128.0", ip: "203.0.113.7", engaged: true},
+		{name: "gmail image proxy", eventType: models.EmailEventOpen, userAgent: "Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)", ip: "66.102.8.1", reason: MachineReasonImageProxy, engaged: true},
+		{name: "yahoo image proxy", eventType: models.EmailEventOpen, userAgent: "YahooMailProxy; https://help.yahoo.com/kb/yahoo-mail-proxy-SLN28749.html", ip: "203.0.113.8", reason: MachineReasonImageProxy, engaged: true},
+		{name: "apple privacy protection", eventType: models.EmailEventOpen, userAgent: "Mozilla/5.0", ip: "17.58.1.1", reason: MachineReasonPrivacyProxy, engaged: true},
+		{name: "apple network", eventType: models.EmailEventOpen, userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X)", ip: "17.58.1.1", reason: MachineReasonPrivacyProxy, engaged: true},
+		{name: "security gateway", eventType: models.EmailEventClick, userAgent: "Mimecast URL Protect", ip: "203.0.113.9", reason: MachineReasonScanner},
+		{name: "safe links", eventType: models.EmailEventClick, userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", ip: "40.94.1.2", reason: MachineReasonScanner},
+		{name: "script", eventType: models.EmailEventOpen, userAgent: "python-requests/2.32", ip: "203.0.113.10", reason: MachineReasonScanner},
+		{name: "no user agent", eventType: models.EmailEventOpen, ip: "203.0.113.11", reason: MachineReasonNoUserAgent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.EmailEvent{EventType: tt.eventType, IPAddress: &tt.ip}
+			if tt.userAgent != "" {
+				event.UserAgent = &tt.userAgent
+			}
+			c.Classify(event)
+
+			reason := ""
+			if event.MachineReason != nil {
+				reason = *event.MachineReason
+			}
+			if event.IsMachine != (tt.reason != "") || reason != tt.reason {
+				t.Errorf("IsMachine = %v, MachineReason = %q; want reason %q", event.IsMachine, reason, tt.reason)
+			}
+			if got := countsAsEngagement(event); got != tt.engaged {
+				t.Errorf("countsAsEngagement() = %v, want %v", got, tt.engaged)
+			}
+		})
+	}
+}
+
+func TestCountsAsEngagementTimingReasons(t *testing.T) {
+	// Hits a human couldn't have made are never credited to the reader
+	for _, reason := range []string{MachineReasonTooFast, MachineReasonClickBurst, MachineReasonKnownIP} {
+		event := &models.EmailEvent{EventType: models.EmailEventClick, IsMachine: true, MachineReason: &reason}
+		if countsAsEngagement(event) {
+			t.Errorf("%s event counts as engagement", reason)
+		}
+	}
+}
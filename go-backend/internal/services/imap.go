@@ -0,0 +1,477 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// imapMaxLiteral caps a single literal, e.g. one fetched message
+const imapMaxLiteral = 25 << 20
+
+// imapClient is the small part of IMAP4rev1 (RFC 3501) needed to find
+// messages in seed and return-path mailboxes: log in, list and open folders,
+// search, fetch and delete. Commands are sent one at a time.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	caps map[string]bool
+}
+
+// imapFolder is one entry of a LIST response
+type imapFolder struct {
+	Name       string
+	Attributes []string
+}
+
+// HasAttribute reports whether the folder carries a flag such as \Junk
+func (f imapFolder) HasAttribute(attr string) bool {
+	for _, a := range f.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrIMAPServerNotAllowed is returned for a creator's IMAP server that is not
+// on a public address or not on a standard IMAP port
+var ErrIMAPServerNotAllowed = errors.New("imap server must be a public host on port 143 or 993")
+
+// publicIMAPPorts are the ports a creator's IMAP server may listen on
+var publicIMAPPorts = []int{143, 993}
+
+// nonPublicRanges are special-purpose ranges not covered by the netip.Addr
+// predicates used in isPublicAddr
+var nonPublicRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT, also some cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach IPv4 private space
+}
+
+// isPublicAddr reports whether addr is routable on the internet. Loopback,
+// private, link-local (including 169.254.169.254 metadata) and multicast
+// addresses are not.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicRanges {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublicIMAPServer resolves a creator's IMAP server and rejects it
+// unless the port is a standard IMAP port and every address is public
+func checkPublicIMAPServer(host string, port int) error {
+	if !slices.Contains(publicIMAPPorts, port) {
+		return ErrIMAPServerNotAllowed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("could not resolve imap server %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return ErrIMAPServerNotAllowed
+		}
+	}
+	return nil
+}
+
+// publicOnlyControl refuses connections to non-public addresses. It runs on
+// the address actually dialled, so a host can't pass checkPublicIMAPServer
+// and then resolve somewhere internal.
+func publicOnlyControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addrPort.Addr()) || !slices.Contains(publicIMAPPorts, int(addrPort.Port())) {
+		return ErrIMAPServerNotAllowed
+	}
+	return nil
+}
+
+// dialIMAP connects to an IMAP server configured by the operator, such as the
+// return-path mailbox
+func dialIMAP(host string, port int, useTLS bool, timeout time.Duration) (*imapClient, error) {
+	return openIMAP(&net.Dialer{Timeout: timeout}, host, port, useTLS, timeout)
+}
+
+// dialPublicIMAP connects to an IMAP server supplied by a creator, which must
+// be a public host on a standard IMAP port
+func dialPublicIMAP(host string, port int, useTLS bool, timeout time.Duration) (*imapClient, error) {
+	if !slices.Contains(publicIMAPPorts, port) {
+		return nil, ErrIMAPServerNotAllowed
+	}
+	return openIMAP(&net.Dialer{Timeout: timeout, Control: publicOnlyControl}, host, port, useTLS, timeout)
+}
+
+// openIMAP connects and reads the greeting. Without implicit TLS the
+// connection is upgraded with STARTTLS when the server offers it. The whole
+// session must finish within timeout.
+func openIMAP(dialer *net.Dialer, host string, port int, useTLS bool, timeout time.Duration) (*imapClient, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, errors.New("imap server refused connection")
+	}
+
+	if err := c.capability(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !useTLS && c.caps["STARTTLS"] {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+		if err := c.capability(); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *imapClient) Close() error {
+	return c.conn.Close()
+}
+
+// Login authenticates with LOGIN and refreshes the capabilities, which
+// servers often extend after authentication
+func (c *imapClient) Login(username, password string) error {
+	if c.caps["LOGINDISABLED"] {
+		return errors.New("imap server does not allow LOGIN on this connection")
+	}
+	user, err := imapQuote(username)
+	if err != nil {
+		return err
+	}
+	pass, err := imapQuote(password)
+	if err != nil {
+		return err
+	}
+	if _, err := c.command("LOGIN " + user + " " + pass); err != nil {
+		return err
+	}
+	return c.capability()
+}
+
+// List returns every folder in the mailbox
+func (c *imapClient) List() ([]imapFolder, error) {
+	lines, err := c.command(`LIST "" "*"`)
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []imapFolder
+	for _, line := range lines {
+		rest, ok := cutPrefixFold(line, "LIST ")
+		if !ok {
+			continue
+		}
+		folder, err := parseIMAPList(rest)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+// Examine opens a folder read-only so searching it leaves flags untouched
+func (c *imapClient) Examine(folder string) error {
+	name, err := imapQuote(folder)
+	if err != nil {
+		return err
+	}
+	_, err = c.command("EXAMINE " + name)
+	return err
+}
+
+// Select opens a folder read-write
+func (c *imapClient) Select(folder string) error {
+	name, err := imapQuote(folder)
+	if err != nil {
+		return err
+	}
+	_, err = c.command("SELECT " + name)
+	return err
+}
+
+// SearchHeader returns the UIDs of messages in the open folder whose header
+// contains value. Extra search keys are appended as given.
+func (c *imapClient) SearchHeader(header, value string, extra ...string) ([]uint32, error) {
+	quoted, err := imapQuote(value)
+	if err != nil {
+		return nil, err
+	}
+	criteria := "HEADER " + header + " " + quoted
+	for _, key := range extra {
+		criteria += " " + key
+	}
+	return c.Search(criteria)
+}
+
+// Search returns the UIDs of messages in the open folder matching the
+// search criteria, e.g. UNSEEN
+func (c *imapClient) Search(criteria string) ([]uint32, error) {
+	lines, err := c.command("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, line := range lines {
+		rest, ok := cutPrefixFold(line, "SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				continue
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	return uids, nil
+}
+
+// Fetch returns the full raw message with the given UID without marking it seen
+func (c *imapClient) Fetch(uid uint32) ([]byte, error) {
+	lines, err := c.command(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		at := strings.Index(strings.ToUpper(line), "BODY[] ")
+		if at < 0 {
+			continue
+		}
+		body, _, err := imapString(line[at+len("BODY[] "):])
+		if err != nil {
+			return nil, err
+		}
+		return []byte(body), nil
+	}
+	return nil, fmt.Errorf("imap message %d not found", uid)
+}
+
+// AddFlags sets flags such as \Seen or \Deleted on a message
+func (c *imapClient) AddFlags(uid uint32, flags ...string) error {
+	_, err := c.command(fmt.Sprintf("UID STORE %d +FLAGS.SILENT (%s)", uid, strings.Join(flags, " ")))
+	return err
+}
+
+// Expunge removes the messages flagged \Deleted from the open folder
+func (c *imapClient) Expunge() error {
+	_, err := c.command("EXPUNGE")
+	return err
+}
+
+// Logout ends the session and closes the connection
+func (c *imapClient) Logout() error {
+	_, err := c.command("LOGOUT")
+	c.conn.Close()
+	return err
+}
+
+func (c *imapClient) capability() error {
+	lines, err := c.command("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	c.caps = make(map[string]bool)
+	for _, line := range lines {
+		if rest, ok := cutPrefixFold(line, "CAPABILITY "); ok {
+			for _, capability := range strings.Fields(rest) {
+				c.caps[strings.ToUpper(capability)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// command sends one command and returns its untagged responses, without
+// the leading "* ". A NO or BAD completion is returned as an error.
+func (c *imapClient) command(cmd string) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%03d", c.tag)
+	if _, err := io.WriteString(c.conn, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(line, "* "):
+			untagged = append(untagged, line[2:])
+		case strings.HasPrefix(line, tag+" "):
+			status := line[len(tag)+1:]
+			if _, ok := cutPrefixFold(status, "OK"); ok {
+				return untagged, nil
+			}
+			verb, _, _ := strings.Cut(cmd, " ")
+			return nil, fmt.Errorf("imap %s failed: %s", verb, status)
+		case strings.HasPrefix(line, "+"):
+			return nil, errors.New("imap server asked for a continuation")
+		}
+	}
+}
+
+// readLine reads one response line. Literals ({n} followed by n bytes) are
+// read in full and inlined as quoted strings, so callers only have to parse
+// atoms and quoted strings.
+func (c *imapClient) readLine() (string, error) {
+	var line strings.Builder
+	for {
+		part, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		part = strings.TrimRight(part, "\r\n")
+
+		open := strings.LastIndex(part, "{")
+		if open < 0 || !strings.HasSuffix(part, "}") {
+			line.WriteString(part)
+			return line.String(), nil
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(part[open+1:], "}"))
+		if err != nil || size < 0 {
+			line.WriteString(part)
+			return line.String(), nil
+		}
+		if size > imapMaxLiteral {
+			return "", fmt.Errorf("imap literal of %d bytes is too large", size)
+		}
+
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return "", err
+		}
+		line.WriteString(part[:open])
+		line.WriteString(`"` + imapEscaper.Replace(string(literal)) + `"`)
+	}
+}
+
+var imapEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// imapQuote renders s as an IMAP quoted string
+func imapQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", errors.New("imap argument contains a line break")
+	}
+	return `"` + imapEscaper.Replace(s) + `"`, nil
+}
+
+// parseIMAPList parses the body of a LIST response:
+// (\HasNoChildren \Junk) "/" "Spam"
+func parseIMAPList(s string) (imapFolder, error) {
+	var folder imapFolder
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return folder, fmt.Errorf("malformed LIST response: %s", s)
+	}
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return folder, fmt.Errorf("malformed LIST response: %s", s)
+	}
+	folder.Attributes = strings.Fields(s[1:end])
+
+	// Hierarchy delimiter, then the name
+	_, rest, err := imapString(strings.TrimSpace(s[end+1:]))
+	if err != nil {
+		return folder, err
+	}
+	folder.Name, _, err = imapString(strings.TrimSpace(rest))
+	return folder, err
+}
+
+// imapString reads a quoted string or an atom (including NIL) from the
+// start of s and returns it with the remainder
+func imapString(s string) (string, string, error) {
+	if s == "" {
+		return "", "", errors.New("malformed IMAP response: missing string")
+	}
+	if s[0] != '"' {
+		atom, rest, _ := strings.Cut(s, " ")
+		if strings.EqualFold(atom, "NIL") {
+			atom = ""
+		}
+		return atom, rest, nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("malformed IMAP response: unterminated string")
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
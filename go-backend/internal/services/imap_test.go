@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// imapHandler answers one command with untagged response text (CRLF
+// terminated, literals included) and a completion status such as "OK done"
+type imapHandler func(cmd string) (untagged, status string)
+
+// serveIMAP runs a scripted IMAP server on conn until the client hangs up
+func serveIMAP(conn net.Conn, greeting string, handle imapHandler) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	io.WriteString(conn, greeting+"\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		untagged, status := handle(cmd)
+		io.WriteString(conn, untagged+tag+" "+status+"\r\n")
+		if cmd == "LOGOUT" {
+			return
+		}
+	}
+}
+
+// pipeIMAP returns a client already past the greeting, talking to handle
+func pipeIMAP(t *testing.T, handle imapHandler) *imapClient {
+	t.Helper()
+	client, server := net.Pipe()
+	go serveIMAP(server, "* OK ready", handle)
+	c := &imapClient{conn: client, r: bufio.NewReader(client)}
+	if _, err := c.readLine(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return c
+}
+
+func TestIMAPReadLineLiterals(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   bool
+	}{
+		{
+			name:  "plain line",
+			input: "* OK [CAPABILITY IMAP4rev1] ready\r\n",
+			want:  "* OK [CAPABILITY IMAP4rev1] ready",
+		},
+		{
+			name:  "literal with line breaks and quotes",
+			input: "* 1 FETCH (BODY[] {23}\r\nSay \"hi\"\r\nC:\\path\r\n end)\r\n",
+			want:  `* 1 FETCH (BODY[] "Say \"hi\"` + "\r\n" + `C:\\path` + "\r\n" + ` end")`,
+		},
+		{
+			name:  "literal that looks like another literal",
+			input: "* LIST () \"/\" {5}\r\nx {3}\r\n",
+			want:  `* LIST () "/" "x {3}"`,
+		},
+		{
+			name:  "two literals in one response",
+			input: "* 1 FETCH (BODY[HEADER] {2}\r\nab BODY[TEXT] {3}\r\ncde)\r\n",
+			want:  `* 1 FETCH (BODY[HEADER] "ab" BODY[TEXT] "cde")`,
+		},
+		{
+			name:  "empty literal",
+			input: "* LIST () \"/\" {0}\r\n\r\n",
+			want:  `* LIST () "/" ""`,
+		},
+		{
+			name:  "braces that are not a literal",
+			input: "* OK {abc}\r\n",
+			want:  "* OK {abc}",
+		},
+		{
+			name:  "truncated literal",
+			input: "* 1 FETCH (BODY[] {100}\r\nshort",
+			err:   true,
+		},
+		{
+			name:  "oversized literal",
+			input: fmt.Sprintf("* 1 FETCH (BODY[] {%d}\r\n", imapMaxLiteral+1),
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &imapClient{r: bufio.NewReader(strings.NewReader(tt.input))}
+			got, err := c.readLine()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("readLine() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLine: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIMAPLiteralRoundTrip(t *testing.T) {
+	// Whatever a literal holds comes back unchanged from the quoted form
+	literal := "From: \"A \\ B\" <a@example.com>\r\nSubject: {7}\r\n\r\nbody \"quoted\"\r\n"
+	input := fmt.Sprintf("BODY[] {%d}\r\n%s)\r\n", len(literal), literal)
+
+	c := &imapClient{r: bufio.NewReader(strings.NewReader(input))}
+	line, err := c.readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, rest, err := imapString(strings.TrimPrefix(line, "BODY[] "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != literal || rest != ")" {
+		t.Errorf("imapString() = %q, %q; want %q, %q", got, rest, literal, ")")
+	}
+}
+
+func TestParseIMAPList(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		attrs []string
+		err   bool
+	}{
+		{input: `(\HasNoChildren \Junk) "/" "Spam"`, name: "Spam", attrs: []string{`\HasNoChildren`, `\Junk`}},
+		{input: `() "." INBOX`, name: "INBOX", attrs: nil},
+		{input: `(\Noselect) NIL "Public"`, name: "Public", attrs: []string{`\Noselect`}},
+		{input: `(\HasNoChildren) "/" "[Gmail]/All \"Mail\""`, name: `[Gmail]/All "Mail"`, attrs: []string{`\HasNoChildren`}},
+		{input: `(\HasNoChildren) "\\" "Folder\\Sub"`, name: `Folder\Sub`, attrs: []string{`\HasNoChildren`}},
+		{input: `  (\Trash)   "/"   Deleted  `, name: "Deleted", attrs: []string{`\Trash`}},
+		{input: `"/" "Spam"`, err: true},
+		{input: `(\Junk "/" "Spam"`, err: true},
+		{input: `(\Junk) "/" "Spam`, err: true},
+		{input: `(\Junk)`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			folder, err := parseIMAPList(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseIMAPList() = %+v, want an error", folder)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseIMAPList: %v", err)
+			}
+			if folder.Name != tt.name {
+				t.Errorf("Name = %q, want %q", folder.Name, tt.name)
+			}
+			if !slices.Equal(folder.Attributes, tt.attrs) {
+				t.Errorf("Attributes = %q, want %q", folder.Attributes, tt.attrs)
+			}
+		})
+	}
+}
+
+func TestIMAPClientListAndFetch(t *testing.T) {
+	message := "From: bounce@example.net\r\nSubject: Delivery failure\r\n\r\nUser unknown\r\n"
+
+	c := pipeIMAP(t, func(cmd string) (string, string) {
+		switch cmd {
+		case `LIST "" "*"`:
+			return "* LIST (\\HasNoChildren) \"/\" INBOX\r\n" +
+				"* LIST (\\HasNoChildren \\Junk) \"/\" {11}\r\nBulk \"Mail\"\r\n", "OK LIST done"
+		case `SELECT "INBOX"`:
+			return "* 3 EXISTS\r\n", "OK [READ-WRITE] SELECT done"
+		case `UID SEARCH HEADER Message-ID "<id@example.com>" UNSEEN`:
+			return "* SEARCH 7 12\r\n", "OK SEARCH done"
+		case "UID FETCH 7 BODY.PEEK[]":
+			return fmt.Sprintf("* 1 FETCH (UID 7 BODY[] {%d}\r\n%s)\r\n", len(message), message), "OK FETCH done"
+		case `EXAMINE "Missing"`:
+			return "", "NO [NONEXISTENT] Unknown mailbox"
+		}
+		return "", "BAD unexpected command " + cmd
+	})
+
+	folders, err := c.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(folders) != 2 || folders[0].Name != "INBOX" || folders[1].Name != `Bulk "Mail"` || !folders[1].HasAttribute(`\junk`) {
+		t.Errorf("List() = %+v", folders)
+	}
+
+	if err := c.Select("INBOX"); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	uids, err := c.SearchHeader("Message-ID", "<id@example.com>", "UNSEEN")
+	if err != nil {
+		t.Fatalf("SearchHeader: %v", err)
+	}
+	if !slices.Equal(uids, []uint32{7, 12}) {
+		t.Errorf("SearchHeader() = %v, want [7 12]", uids)
+	}
+
+	raw, err := c.Fetch(7)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(raw) != message {
+		t.Errorf("Fetch() = %q, want %q", raw, message)
+	}
+
+	if err := c.Examine("Missing"); err == nil || !strings.Contains(err.Error(), "imap EXAMINE failed: NO") {
+		t.Errorf("Examine(missing) error = %v", err)
+	}
+}
+
+func TestIMAPQuoteRejectsLineBreaks(t *testing.T) {
+	if got, err := imapQuote(`pa"ss\word`); err != nil || got != `"pa\"ss\\word"` {
+		t.Errorf("imapQuote() = %q, %v", got, err)
+	}
+	for _, s := range []string{"a\r\nA002 DELETE INBOX", "a\nb", "a\x00b"} {
+		if _, err := imapQuote(s); err == nil {
+			t.Errorf("imapQuote(%q) accepted a line break", s)
+		}
+	}
+}
+
+func TestDialIMAPReadsGreetingAndCapabilities(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		serveIMAP(conn, "* OK IMAP4rev1 ready", func(cmd string) (string, string) {
+			switch {
+			case cmd == "CAPABILITY":
+				return "* CAPABILITY IMAP4rev1 AUTH=PLAIN\r\n", "OK done"
+			case strings.HasPrefix(cmd, "LOGIN "):
+				if cmd != `LOGIN "seed@example.com" "p\"w"` {
+					return "", "NO bad credentials"
+				}
+				return "", "OK logged in"
+			}
+			return "", "OK"
+		})
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	c, err := dialIMAP("127.0.0.1", port, false, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dialIMAP: %v", err)
+	}
+	defer c.Close()
+	if !c.caps["IMAP4REV1"] || c.caps["STARTTLS"] {
+		t.Errorf("caps = %v", c.caps)
+	}
+	if err := c.Login("seed@example.com", `p"w`); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	// The same server is off limits when a creator supplies it
+	if _, err := dialPublicIMAP("127.0.0.1", port, false, time.Second); !errors.Is(err, ErrIMAPServerNotAllowed) {
+		t.Errorf("dialPublicIMAP(loopback) error = %v, want ErrIMAPServerNotAllowed", err)
+	}
+	if _, err := dialPublicIMAP("127.0.0.1", 143, false, time.Second); !errors.Is(err, ErrIMAPServerNotAllowed) {
+		t.Errorf("dialPublicIMAP(loopback:143) error = %v, want ErrIMAPServerNotAllowed", err)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::":    true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.100.100.200":      false,
+		"0.0.0.0":              false,
+		"224.0.0.1":            false,
+		"198.18.0.1":           false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.216.34": true,
+		"64:ff9b::a00:1":       false,
+	}
+	for addr, want := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/queue"
+	"gorm.io/gorm"
+)
+
+const (
+	// returnPathProvider is the provider name events from inbound reports are
+	// recorded under
+	returnPathProvider = "return-path"
+
+	inboundSessionTimeout = 2 * time.Minute
+	inboundBatchSize      = 100
+	inboundMaxPartSize    = 10 << 20
+
+	// returnPathClaim names the return-path mailbox in mailbox_claims
+	returnPathClaim        = "return-path"
+	returnPathClaimTimeout = 15 * time.Minute
+)
+
+// Kinds of inbound message
+const (
+	InboundKindDSN     = "dsn"     // RFC 3464 delivery status notification
+	InboundKindARF     = "arf"     // RFC 5965 feedback-loop complaint
+	InboundKindIgnored = "ignored" // anything else, e.g. an auto-reply
+)
+
+var ErrMalformedInboundMessage = errors.New("malformed inbound message")
+
+// ARF feedback types that are a recipient complaining about the message.
+// not-spam and auth-failure reports are not complaints.
+var complaintFeedbackTypes = []string{"abuse", "fraud", "virus", "other"}
+
+// InboundBounceService handles the mail that comes back to the return path:
+// delivery status notifications and feedback-loop reports. Each is turned
+// into provider events, so bounces and complaints go through the same
+// deduplication, message log and BounceService/ComplaintService handling as
+// provider webhooks.
+type InboundBounceService struct {
+	db       *gorm.DB
+	events   *ProviderEventService
+	messages *EmailMessageService
+}
+
+func NewInboundBounceService() *InboundBounceService {
+	return &InboundBounceService{
+		db:       database.GetDB(),
+		events:   NewProviderEventService(),
+		messages: NewEmailMessageService(),
+	}
+}
+
+// VerifyBounceIngestToken checks the shared secret inbound mail forwarders
+// post bounces with, from BOUNCE_INGEST_SECRET
+func VerifyBounceIngestToken(token string) error {
+	return verifyIngestToken("BOUNCE_INGEST_SECRET", token)
+}
+
+// InboundReport is what an inbound message turned out to be
+type InboundReport struct {
+	Kind      string `json:"kind"`
+	Events    int    `json:"events"`
+	Processed int    `json:"processed"`
+}
+
+// inboundReport is the parsed MIME structure of a multipart/report
+type inboundReport struct {
+	header   mail.Header
+	kind     string
+	fields   []textproto.MIMEHeader // DSN: per-message block then one per recipient; ARF: one block
+	original mail.Header            // headers of the message the report is about, if included
+}
+
+// inboundTarget is the message a report refers to
+type inboundTarget struct {
+	messageID  *uuid.UUID
+	campaignID *uuid.UUID
+	recipient  string
+}
+
+// ProcessMessage parses one raw inbound message and applies the bounces or
+// complaint it reports. envelopeTo is the address it was delivered to, when
+// the transport knows it; otherwise the delivery headers are used.
+func (s *InboundBounceService) ProcessMessage(raw []byte, envelopeTo string) (*InboundReport, error) {
+	report, err := parseInboundReport(raw)
+	if err != nil {
+		return nil, err
+	}
+	if report.kind == InboundKindIgnored {
+		return &InboundReport{Kind: InboundKindIgnored}, nil
+	}
+
+	key := reportKey(report.header, raw)
+	var events []ProviderEventInput
+	switch report.kind {
+	case InboundKindDSN:
+		events = s.dsnEvents(report, envelopeTo, key)
+	case InboundKindARF:
+		events = s.arfEvents(report, envelopeTo, key)
+	}
+
+	result := &InboundReport{Kind: report.kind, Events: len(events)}
+	if len(events) == 0 {
+		return result, nil
+	}
+	result.Processed, err = s.events.Process(events)
+	return result, err
+}
+
+// dsnEvents maps each failed or delayed recipient of a DSN to an event
+func (s *InboundBounceService) dsnEvents(report *inboundReport, envelopeTo, key string) []ProviderEventInput {
+	if len(report.fields) < 2 {
+		return nil
+	}
+	perMessage, recipients := report.fields[0], report.fields[1:]
+	target := s.identify(report, envelopeTo)
+
+	timestamp := time.Now()
+	if arrival, err := mail.ParseDate(perMessage.Get("Arrival-Date")); err == nil {
+		timestamp = arrival
+	}
+
+	var events []ProviderEventInput
+	for _, fields := range recipients {
+		var eventType string
+		switch strings.ToLower(strings.TrimSpace(fields.Get("Action"))) {
+		case "failed":
+			eventType = ProviderEventBounce
+		case "delayed":
+			eventType = ProviderEventDeferred
+		default:
+			// delivered, relayed and expanded are not failures
+			continue
+		}
+
+		recipient := typedValue(fields.Get("Final-Recipient"))
+		if recipient == "" {
+			recipient = typedValue(fields.Get("Original-Recipient"))
+		}
+		if recipient == "" {
+			recipient = target.recipient
+		}
+		status := normalizeEnhancedStatus(fields.Get("Status"))
+		reason := typedValue(fields.Get("Diagnostic-Code"))
+		if reason == "" {
+			reason = status
+		}
+
+		event := ProviderEventInput{
+			Provider:     returnPathProvider,
+			EventID:      "dsn:" + key + ":" + strings.ToLower(recipient),
+			Type:         eventType,
+			Email:        recipient,
+			MessageID:    target.messageID,
+			CampaignID:   target.campaignID,
+			BounceStatus: status,
+			Reason:       reason,
+			Timestamp:    timestamp,
+			Raw:          fieldsJSON(fields),
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// arfEvents maps a feedback report to a complaint event
+func (s *InboundBounceService) arfEvents(report *inboundReport, envelopeTo, key string) []ProviderEventInput {
+	if len(report.fields) == 0 {
+		return nil
+	}
+	fields := report.fields[0]
+
+	feedbackType := strings.ToLower(strings.TrimSpace(fields.Get("Feedback-Type")))
+	if !slices.Contains(complaintFeedbackTypes, feedbackType) {
+		return nil
+	}
+
+	target := s.identify(report, envelopeTo, fields.Get("Original-Mail-From"))
+	recipient := strings.Trim(strings.TrimSpace(fields.Get("Original-Rcpt-To")), "<>")
+	if recipient == "" {
+		recipient = target.recipient
+	}
+
+	timestamp := time.Now()
+	if arrival, err := mail.ParseDate(fields.Get("Arrival-Date")); err == nil {
+		timestamp = arrival
+	}
+
+	return []ProviderEventInput{{
+		Provider:   returnPathProvider,
+		EventID:    "arf:" + key,
+		Type:       ProviderEventComplaint,
+		Email:      recipient,
+		MessageID:  target.messageID,
+		CampaignID: target.campaignID,
+		Reason:     feedbackType,
+		Timestamp:  timestamp,
+		Raw:        fieldsJSON(fields),
+	}}
+}
+
+// identify finds the message a report is about: from the VERP address it
+// was sent to, then from the Message-ID of the included original, which our
+// SMTP mailer sets to the message log ID
+func (s *InboundBounceService) identify(report *inboundReport, envelopeTo string, extra ...string) inboundTarget {
+	var target inboundTarget
+
+	candidates := append([]string{envelopeTo}, extra...)
+	for _, name := range []string{"Delivered-To", "X-Original-To", "To"} {
+		candidates = append(candidates, report.header.Get(name))
+	}
+	if report.original != nil {
+		candidates = append(candidates, report.original.Get("Return-Path"))
+	}
+	for _, candidate := range candidates {
+		if id, ok := parseReturnPathList(candidate); ok {
+			target.messageID = &id
+			break
+		}
+	}
+
+	if report.original != nil {
+		if target.messageID == nil {
+			local, _, _ := strings.Cut(strings.Trim(strings.TrimSpace(report.original.Get("Message-ID")), "<>"), "@")
+			if id, err := uuid.Parse(local); err == nil {
+				target.messageID = &id
+			}
+		}
+		if id, err := uuid.Parse(strings.TrimSpace(report.original.Get("X-Campaign-ID"))); err == nil {
+			target.campaignID = &id
+		}
+	}
+
+	// Feedback reports often redact the recipient; the message log has it
+	if target.messageID != nil {
+		if msg, err := s.messages.FindByID(*target.messageID); err == nil {
+			target.recipient = msg.Recipient
+			if target.campaignID == nil {
+				target.campaignID = msg.CampaignID
+			}
+		}
+	}
+	return target
+}
+
+// EnqueuePoll queues a poll_return_path job when the return-path mailbox is
+// configured and no other worker is reading it
+func (s *InboundBounceService) EnqueuePoll() {
+	if os.Getenv("BOUNCE_IMAP_HOST") == "" {
+		return
+	}
+
+	claimed, err := claimMailbox(s.db, returnPathClaim, returnPathClaimTimeout)
+	if err != nil {
+		log.Printf("[Inbound] Failed to claim return-path mailbox: %v", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	if _, err := queue.Enqueue(queue.TypePollReturnPath, struct{}{}); err != nil {
+		log.Printf("[Inbound] Failed to enqueue return-path poll: %v", err)
+		releaseMailbox(s.db, returnPathClaim)
+	}
+}
+
+// PollMailbox processes unread messages in the return-path mailbox set by
+// BOUNCE_IMAP_HOST and friends. Reports are deleted once applied; anything
+// else is marked read and left in place. Messages that fail to apply stay
+// unread and are retried on the next poll. It releases the mailbox's claim
+// when done.
+func (s *InboundBounceService) PollMailbox(ctx context.Context) {
+	defer releaseMailbox(s.db, returnPathClaim)
+
+	host := os.Getenv("BOUNCE_IMAP_HOST")
+	if host == "" {
+		return
+	}
+	useTLS := getEnvOr("BOUNCE_IMAP_TLS", "true") != "false"
+	defaultPort := 993
+	if !useTLS {
+		defaultPort = 143
+	}
+	port := envInt("BOUNCE_IMAP_PORT", defaultPort)
+
+	client, err := dialIMAP(host, port, useTLS, inboundSessionTimeout)
+	if err != nil {
+		log.Printf("[Inbound] Failed to connect to return-path mailbox: %v", err)
+		return
+	}
+	defer client.Close()
+
+	if err := client.Login(os.Getenv("BOUNCE_IMAP_USERNAME"), os.Getenv("BOUNCE_IMAP_PASSWORD")); err != nil {
+		log.Printf("[Inbound] Failed to log in to return-path mailbox: %v", err)
+		return
+	}
+	if err := client.Select(getEnvOr("BOUNCE_IMAP_FOLDER", "INBOX")); err != nil {
+		log.Printf("[Inbound] Failed to open return-path mailbox: %v", err)
+		return
+	}
+
+	uids, err := client.Search("UNSEEN")
+	if err != nil {
+		log.Printf("[Inbound] Failed to search return-path mailbox: %v", err)
+		return
+	}
+	if len(uids) > inboundBatchSize {
+		uids = uids[:inboundBatchSize]
+	}
+
+	deleted := 0
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			break
+		}
+		raw, err := client.Fetch(uid)
+		if err != nil {
+			log.Printf("[Inbound] Failed to fetch message %d: %v", uid, err)
+			return
+		}
+
+		report, err := s.ProcessMessage(raw, "")
+		switch {
+		case errors.Is(err, ErrMalformedInboundMessage):
+			log.Printf("[Inbound] Skipping message %d: %v", uid, err)
+			err = client.AddFlags(uid, `\Seen`)
+		case err != nil:
+			log.Printf("[Inbound] Failed to apply message %d: %v", uid, err)
+			continue
+		case report.Kind == InboundKindIgnored:
+			err = client.AddFlags(uid, `\Seen`)
+		default:
+			err = client.AddFlags(uid, `\Seen`, `\Deleted`)
+			deleted++
+		}
+		if err != nil {
+			log.Printf("[Inbound] Failed to flag message %d: %v", uid, err)
+			return
+		}
+	}
+
+	if deleted > 0 {
+		if err := client.Expunge(); err != nil {
+			log.Printf("[Inbound] Failed to expunge return-path mailbox: %v", err)
+		}
+	}
+	client.Logout()
+}
+
+// parseInboundReport reads a raw message and, for a multipart/report, its
+// machine-readable part and the included original headers
+func parseInboundReport(raw []byte) (*inboundReport, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedInboundMessage, err)
+	}
+	report := &inboundReport{header: msg.Header, kind: InboundKindIgnored}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return report, nil
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedInboundMessage, err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			report.kind = InboundKindDSN
+		case "message/feedback-report":
+			report.kind = InboundKindARF
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			body, err := readInboundPart(part)
+			if err != nil {
+				return nil, err
+			}
+			// Only the headers are needed; header-only parts may lack the blank line
+			if original, err := mail.ReadMessage(bytes.NewReader(append(body, "\r\n\r\n"...))); err == nil {
+				report.original = original.Header
+			}
+			continue
+		default:
+			continue
+		}
+
+		body, err := readInboundPart(part)
+		if err != nil {
+			return nil, err
+		}
+		report.fields, err = parseFieldBlocks(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// readInboundPart returns the decoded body of a MIME part. Quoted-printable
+// is decoded by the multipart reader itself.
+func readInboundPart(part *multipart.Part) ([]byte, error) {
+	var body io.Reader = part
+	if strings.EqualFold(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding")), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, part)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, inboundMaxPartSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedInboundMessage, err)
+	}
+	return data, nil
+}
+
+// parseFieldBlocks splits a delivery-status or feedback-report body into
+// its header-style blocks, which are separated by blank lines
+func parseFieldBlocks(body []byte) ([]textproto.MIMEHeader, error) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(body)))
+
+	var blocks []textproto.MIMEHeader
+	for {
+		// Tolerate extra blank lines between blocks
+		for {
+			peek, err := reader.R.Peek(1)
+			if err != nil || (peek[0] != '\r' && peek[0] != '\n') {
+				break
+			}
+			reader.R.ReadByte()
+		}
+
+		block, err := reader.ReadMIMEHeader()
+		if len(block) > 0 {
+			blocks = append(blocks, block)
+		}
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedInboundMessage, err)
+		}
+	}
+}
+
+// typedValue strips the address or diagnostic type from a DSN field, e.g.
+// "rfc822; user@example.com" or "smtp; 550 5.1.1 User unknown"
+func typedValue(field string) string {
+	if _, value, ok := strings.Cut(field, ";"); ok {
+		field = value
+	}
+	return strings.Trim(strings.TrimSpace(field), "<>")
+}
+
+// parseReturnPathList finds a VERP address in a header that may hold a
+// display name or a list of addresses
+func parseReturnPathList(value string) (uuid.UUID, bool) {
+	if value == "" {
+		return uuid.Nil, false
+	}
+	if id, ok := ParseReturnPath(value); ok {
+		return id, true
+	}
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	for _, address := range addresses {
+		if id, ok := ParseReturnPath(address.Address); ok {
+			return id, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// reportKey identifies a report for deduplication: its Message-ID when it
+// has one, otherwise its content
+func reportKey(header mail.Header, raw []byte) string {
+	source := []byte(header.Get("Message-ID"))
+	if len(bytes.TrimSpace(source)) == 0 {
+		source = raw
+	}
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:16])
+}
+
+// fieldsJSON keeps the report fields with the stored provider event
+func fieldsJSON(fields textproto.MIMEHeader) json.RawMessage {
+	flat := make(map[string]string, len(fields))
+	for name := range fields {
+		flat[name] = fields.Get(name)
+	}
+	raw, _ := json.Marshal(flat)
+	return raw
+}
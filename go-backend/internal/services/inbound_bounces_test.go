@@ -0,0 +1,314 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// crlf turns a readable fixture into wire format
+func crlf(s string) []byte {
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+const dsnFixture = `From: MAILER-DAEMON@mx.example.org
+To: news@example.com
+Subject: Undelivered Mail Returned to Sender
+Message-ID: <20261012100000.ABC@mx.example.org>
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status;
+	boundary="dsn-boundary"
+
+--dsn-boundary
+Content-Type: text/plain; charset=us-ascii
+
+I'm sorry to have to inform you that your message could not be delivered.
+
+--dsn-boundary
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+Arrival-Date: Mon, 12 Oct 2026 10:00:00 +0000
+
+
+Final-Recipient: rfc822; gone@example.org
+Original-Recipient: rfc822;gone@example.org
+Action: failed
+Status: 5.1.1
+Diagnostic-Code: smtp; 550 5.1.1 <gone@example.org>: Recipient address
+	rejected: User unknown
+
+Final-Recipient: rfc822; <slow@example.org>
+Action: delayed
+Status: 4.4.7 (delivery time expired)
+
+Final-Recipient: rfc822; ok@example.org
+Action: delivered
+Status: 2.0.0
+
+--dsn-boundary
+Content-Type: text/rfc822-headers
+
+Return-Path: <news@example.com>
+From: Example News <news@example.com>
+Message-ID: <6f1c2a4e-8b3d-4c5e-9f70-123456789abc@example.com>
+X-Campaign-ID: 0b6d9a52-3c1e-4f7a-8d2b-5e4f3a2b1c0d
+Subject: This week
+--dsn-boundary--
+`
+
+const arfFixture = `From: feedback@fbl.example.org
+To: fbl@example.com
+Subject: Complaint about message
+Message-ID: <fbl-1@fbl.example.org>
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report; boundary="arf"
+
+--arf
+Content-Type: text/plain
+
+This is an email abuse report.
+
+--arf
+Content-Type: message/feedback-report
+
+Feedback-Type: abuse
+User-Agent: ExampleFBL/1.0
+Version: 1
+Original-Mail-From: <news@example.com>
+Original-Rcpt-To: <reader@example.org>
+Arrival-Date: Tue, 13 Oct 2026 08:30:00 +0000
+
+--arf
+Content-Type: message/rfc822
+
+From: Example News <news@example.com>
+To: reader@example.org
+Message-ID: <6f1c2a4e-8b3d-4c5e-9f70-123456789abc@example.com>
+Subject: This week
+
+Hello!
+--arf--
+`
+
+func TestParseInboundReportDSN(t *testing.T) {
+	report, err := parseInboundReport(crlf(dsnFixture))
+	if err != nil {
+		t.Fatalf("parseInboundReport: %v", err)
+	}
+	if report.kind != InboundKindDSN {
+		t.Fatalf("kind = %q, want %q", report.kind, InboundKindDSN)
+	}
+	if len(report.fields) != 4 {
+		t.Fatalf("got %d field blocks, want the per-message block and 3 recipients", len(report.fields))
+	}
+	if got := report.fields[0].Get("Reporting-MTA"); got != "dns; mx.example.org" {
+		t.Errorf("Reporting-MTA = %q", got)
+	}
+	if got := report.fields[1].Get("Diagnostic-Code"); got != "smtp; 550 5.1.1 <gone@example.org>: Recipient address rejected: User unknown" {
+		t.Errorf("folded Diagnostic-Code = %q", got)
+	}
+	if got := report.fields[2].Get("Action"); got != "delayed" {
+		t.Errorf("second recipient Action = %q", got)
+	}
+	if report.original == nil {
+		t.Fatal("original headers were not kept")
+	}
+	if got := report.original.Get("X-Campaign-ID"); got != "0b6d9a52-3c1e-4f7a-8d2b-5e4f3a2b1c0d" {
+		t.Errorf("original X-Campaign-ID = %q", got)
+	}
+}
+
+func TestParseInboundReportBase64Status(t *testing.T) {
+	status := "Reporting-MTA: dns; mx.example.org\r\n\r\nFinal-Recipient: rfc822; gone@example.org\r\nAction: failed\r\nStatus: 5.1.1\r\n"
+	raw := crlf(`From: MAILER-DAEMON@mx.example.org
+Content-Type: multipart/report; report-type=delivery-status; boundary=b
+
+--b
+Content-Type: message/delivery-status
+Content-Transfer-Encoding: base64
+
+` + base64.StdEncoding.EncodeToString([]byte(status)) + `
+--b--
+`)
+
+	report, err := parseInboundReport(raw)
+	if err != nil {
+		t.Fatalf("parseInboundReport: %v", err)
+	}
+	if report.kind != InboundKindDSN || len(report.fields) != 2 {
+		t.Fatalf("kind = %q with %d blocks, want a DSN with 2", report.kind, len(report.fields))
+	}
+	if got := report.fields[1].Get("Status"); got != "5.1.1" {
+		t.Errorf("Status = %q", got)
+	}
+}
+
+func TestParseInboundReportARF(t *testing.T) {
+	report, err := parseInboundReport(crlf(arfFixture))
+	if err != nil {
+		t.Fatalf("parseInboundReport: %v", err)
+	}
+	if report.kind != InboundKindARF {
+		t.Fatalf("kind = %q, want %q", report.kind, InboundKindARF)
+	}
+	if len(report.fields) != 1 {
+		t.Fatalf("got %d field blocks, want 1", len(report.fields))
+	}
+	fields := report.fields[0]
+	if fields.Get("Feedback-Type") != "abuse" || fields.Get("Original-Rcpt-To") != "<reader@example.org>" {
+		t.Errorf("feedback fields = %v", fields)
+	}
+	if report.original == nil || report.original.Get("Subject") != "This week" {
+		t.Errorf("original headers = %v", report.original)
+	}
+}
+
+func TestParseInboundReportIgnored(t *testing.T) {
+	tests := map[string]string{
+		"auto-reply": `From: reader@example.org
+Subject: Out of office
+Content-Type: text/plain
+
+I'm away until Monday.
+`,
+		"multipart without a report": `From: reader@example.org
+Content-Type: multipart/mixed; boundary=m
+
+--m
+Content-Type: text/plain
+
+Hi
+--m--
+`,
+		"report without a machine-readable part": `From: MAILER-DAEMON@mx.example.org
+Content-Type: multipart/report; report-type=delivery-status; boundary=b
+
+--b
+Content-Type: text/plain
+
+Your message could not be delivered.
+--b--
+`,
+	}
+
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			report, err := parseInboundReport(crlf(raw))
+			if err != nil {
+				t.Fatalf("parseInboundReport: %v", err)
+			}
+			if report.kind != InboundKindIgnored {
+				t.Errorf("kind = %q, want %q", report.kind, InboundKindIgnored)
+			}
+		})
+	}
+}
+
+func TestParseInboundReportMalformed(t *testing.T) {
+	tests := map[string]string{
+		"no headers": "this is not a message",
+		"unterminated multipart": `From: MAILER-DAEMON@mx.example.org
+Content-Type: multipart/report; report-type=delivery-status; boundary=b
+
+--b
+Content-Type: message/delivery-status
+
+Action: failed
+`,
+	}
+
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseInboundReport(crlf(raw)); !errors.Is(err, ErrMalformedInboundMessage) {
+				t.Errorf("err = %v, want ErrMalformedInboundMessage", err)
+			}
+		})
+	}
+}
+
+func TestDSNEvents(t *testing.T) {
+	// Without a signing secret nothing points at a logged message, so the
+	// events come from the report alone
+	t.Setenv("TRACKING_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	report, err := parseInboundReport(crlf(dsnFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.original = nil
+
+	events := (&InboundBounceService{}).dsnEvents(report, "", "key")
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want one per failed or delayed recipient: %+v", len(events), events)
+	}
+
+	bounce, deferred := events[0], events[1]
+	if bounce.Type != ProviderEventBounce || bounce.Email != "gone@example.org" || bounce.BounceStatus != "5.1.1" {
+		t.Errorf("bounce event = %+v", bounce)
+	}
+	if bounce.Reason != "550 5.1.1 <gone@example.org>: Recipient address rejected: User unknown" {
+		t.Errorf("bounce reason = %q", bounce.Reason)
+	}
+	if bounce.EventID != "dsn:key:gone@example.org" || bounce.Provider != returnPathProvider {
+		t.Errorf("bounce event ID = %q from %q", bounce.EventID, bounce.Provider)
+	}
+	if want := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC); !bounce.Timestamp.Equal(want) {
+		t.Errorf("bounce timestamp = %s, want the Arrival-Date %s", bounce.Timestamp, want)
+	}
+
+	if deferred.Type != ProviderEventDeferred || deferred.Email != "slow@example.org" || deferred.BounceStatus != "4.4.7" {
+		t.Errorf("deferred event = %+v", deferred)
+	}
+	if deferred.Reason != "4.4.7" {
+		t.Errorf("deferred reason = %q, want the status when there is no diagnostic", deferred.Reason)
+	}
+}
+
+func TestARFEvents(t *testing.T) {
+	t.Setenv("TRACKING_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+
+	report, err := parseInboundReport(crlf(arfFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.original = nil
+
+	svc := &InboundBounceService{}
+	events := svc.arfEvents(report, "", "key")
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	complaint := events[0]
+	if complaint.Type != ProviderEventComplaint || complaint.Email != "reader@example.org" || complaint.Reason != "abuse" || complaint.EventID != "arf:key" {
+		t.Errorf("complaint event = %+v", complaint)
+	}
+
+	// Reports that aren't a recipient complaining produce nothing
+	for _, feedbackType := range []string{"not-spam", "auth-failure"} {
+		report.fields[0].Set("Feedback-Type", feedbackType)
+		if events := svc.arfEvents(report, "", "key"); len(events) != 0 {
+			t.Errorf("Feedback-Type %s produced %d events", feedbackType, len(events))
+		}
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := map[string]string{
+		"rfc822; user@example.org":          "user@example.org",
+		"rfc822;<user@example.org>":         "user@example.org",
+		"smtp; 550 5.1.1 User unknown":      "550 5.1.1 User unknown",
+		"user@example.org":                  "user@example.org",
+		"  ":                                "",
+		"x-unix; mailbox; with; semicolons": "mailbox; with; semicolons",
+	}
+	for field, want := range tests {
+		if got := typedValue(field); got != want {
+			t.Errorf("typedValue(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
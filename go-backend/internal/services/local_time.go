@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// localSendLayout is the wall-clock time a local-time send goes out at in
+// each subscriber's timezone
+const localSendLayout = "2006-01-02T15:04"
+
+// localZone is one timezone a local-time send will reach
+type localZone struct {
+	name   string
+	sendAt time.Time
+}
+
+// localRecipients are the subscribers a campaign will be sent to
+func (s *CampaignService) localRecipients(campaign *models.Campaign) *gorm.DB {
+	query := s.db.Table("subscribers").
+		Where("subscribers.creator_id = ? AND subscribers.status = ?", campaign.CreatorID, models.SubscriberStatusActive)
+	if len(campaign.TargetTags) > 0 {
+		tagIDs := make([]uuid.UUID, len(campaign.TargetTags))
+		for i, tag := range campaign.TargetTags {
+			tagIDs[i] = tag.ID
+		}
+		query = query.Where("EXISTS (SELECT 1 FROM subscriber_tags WHERE subscriber_tags.subscriber_id = subscribers.id AND subscriber_tags.tag_id IN ?)", tagIDs)
+	}
+	return query
+}
+
+// localZones lists the timezones a local-time send reaches: those set on
+// subscribers, the offsets inferred from their opens, and the default zone
+// for everyone else
+func (s *CampaignService) localZones(campaign *models.Campaign, wall time.Time, defaultTZ string) ([]localZone, error) {
+	var names []string
+	if err := s.localRecipients(campaign).
+		Where("subscribers.timezone IS NOT NULL").
+		Distinct().Pluck("subscribers.timezone", &names).Error; err != nil {
+		return nil, err
+	}
+
+	var offsets []int
+	if err := s.localRecipients(campaign).
+		Joins("JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = subscribers.id").
+		Where("subscribers.timezone IS NULL AND subscriber_send_profiles.utc_offset IS NOT NULL").
+		Distinct().Pluck("subscriber_send_profiles.utc_offset", &offsets).Error; err != nil {
+		return nil, err
+	}
+
+	var unknown int64
+	if err := s.localRecipients(campaign).
+		Joins("LEFT JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = subscribers.id").
+		Where("subscribers.timezone IS NULL AND subscriber_send_profiles.utc_offset IS NULL").
+		Limit(1).Count(&unknown).Error; err != nil {
+		return nil, err
+	}
+
+	var zones []localZone
+	at := func(loc *time.Location) time.Time {
+		return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	}
+	for _, name := range names {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			continue
+		}
+		zones = append(zones, localZone{name: name, sendAt: at(loc)})
+	}
+	for _, offset := range offsets {
+		name := fmt.Sprintf("UTC%+d", offset)
+		zones = append(zones, localZone{name: name, sendAt: at(time.FixedZone(name, offset*3600))})
+	}
+	if unknown > 0 || len(zones) == 0 {
+		loc, err := time.LoadLocation(defaultTZ)
+		if err != nil {
+			return nil, ErrInvalidTimezone
+		}
+		zones = append(zones, localZone{name: defaultTZ, sendAt: at(loc)})
+	}
+	return zones, nil
+}
+
+// scheduleLocal prepares a campaign to go out at a wall-clock time in each
+// subscriber's timezone. It starts with the earliest zone, which must still
+// be ahead.
+func (s *CampaignService) scheduleLocal(campaign *models.Campaign, req *ScheduleCampaignRequest) error {
+	wall, err := time.Parse(localSendLayout, req.LocalTime)
+	if err != nil {
+		return errors.New("localTime must look like 2006-01-02T15:04")
+	}
+
+	defaultTZ := "UTC"
+	if req.Timezone != "" {
+		if defaultTZ, err = NormalizeTimezone(req.Timezone); err != nil {
+			return err
+		}
+	}
+
+	zones, err := s.localZones(campaign, wall, defaultTZ)
+	if err != nil {
+		return errors.New("failed to look up subscriber timezones")
+	}
+
+	first := zones[0]
+	for _, zone := range zones[1:] {
+		if zone.sendAt.Before(first.sendAt) {
+			first = zone
+		}
+	}
+	if first.sendAt.Before(time.Now()) {
+		return fmt.Errorf("%s has already passed in %s", wall.Format("15:04 Jan 2"), first.name)
+	}
+
+	localTime := wall.Format(localSendLayout)
+	campaign.ScheduledAt = &first.sendAt
+	campaign.LocalSendAt = &localTime
+	campaign.DefaultTimezone = &defaultTZ
+	return nil
+}
+
+// planLocalTime holds each pending delivery until the campaign's wall-clock
+// time in the subscriber's timezone: the one they set, else the offset
+// inferred from their opens, else the campaign default. Zones whose time has
+// passed by the time sending starts go out straight away.
+func (s *CampaignService) planLocalTime(campaign *models.Campaign) error {
+	wall, err := time.Parse(localSendLayout, *campaign.LocalSendAt)
+	if err != nil {
+		return err
+	}
+	defaultTZ := "UTC"
+	if campaign.DefaultTimezone != nil {
+		defaultTZ = *campaign.DefaultTimezone
+	}
+	local := wall.Format("2006-01-02 15:04:05")
+
+	return s.db.Exec(`UPDATE campaign_deliveries SET not_before = plan.send_at, timezone = plan.zone, updated_at = NOW()
+		FROM (
+			SELECT campaign_deliveries.id,
+				CASE
+					WHEN subscribers.timezone IS NOT NULL THEN ?::timestamp AT TIME ZONE subscribers.timezone
+					WHEN subscriber_send_profiles.utc_offset IS NOT NULL
+						THEN (?::timestamp - subscriber_send_profiles.utc_offset * INTERVAL '1 hour') AT TIME ZONE 'UTC'
+					ELSE ?::timestamp AT TIME ZONE ?
+				END AS send_at,
+				COALESCE(
+					subscribers.timezone,
+					'UTC' || CASE WHEN subscriber_send_profiles.utc_offset >= 0 THEN '+' ELSE '-' END || ABS(subscriber_send_profiles.utc_offset),
+					?
+				) AS zone
+			FROM campaign_deliveries
+			JOIN subscribers ON subscribers.id = campaign_deliveries.subscriber_id
+			LEFT JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = campaign_deliveries.subscriber_id
+			WHERE campaign_deliveries.campaign_id = ? AND campaign_deliveries.status = ?
+		) plan
+		WHERE campaign_deliveries.id = plan.id`,
+		local, local, local, defaultTZ, defaultTZ, campaign.ID, models.DeliveryStatusPending,
+	).Error
+}
+
+// waitForNextWave parks a rolling send whose next deliveries are not due for
+// a while, so it doesn't hold a worker in the meantime. Counts so far are
+// written to the campaign's stats; processScheduledCampaigns picks the send
+// up again at next.
+func (s *CampaignService) waitForNextWave(campaign *models.Campaign, next time.Time) error {
+	progress, err := s.progress(campaign)
+	if err != nil {
+		return err
+	}
+
+	var stats models.CampaignStats
+	if campaign.Stats != nil {
+		json.Unmarshal([]byte(*campaign.Stats), &stats)
+	}
+	stats.TotalRecipients = int(progress.Total)
+	stats.Sent = int(progress.Sent)
+	statsJSON, _ := json.Marshal(stats)
+
+	return s.db.Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusSending).
+		Updates(map[string]interface{}{
+			"next_send_at": next,
+			"stats":        string(statsJSON),
+		}).Error
+}
+
+// StartDueWaves queues rolling sends whose next deliveries have come due.
+// Clearing next_send_at claims the campaign, so each wave is queued once.
+func (s *CampaignService) StartDueWaves() {
+	var campaignIDs []uuid.UUID
+	s.db.Model(&models.Campaign{}).
+		Where("status = ? AND next_send_at <= ?", models.CampaignStatusSending, time.Now()).
+		Pluck("id", &campaignIDs)
+
+	for _, id := range campaignIDs {
+		result := s.db.Model(&models.Campaign{}).
+			Where("id = ? AND next_send_at IS NOT NULL", id).
+			Update("next_send_at", nil)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		if err := s.enqueueSend(id); err != nil {
+			log.Printf("Failed to enqueue campaign %s: %v", id, err)
+		}
+	}
+}
+
+// timezoneProgress breaks a local-time send down by the timezone each
+// delivery was planned in
+func (s *CampaignService) timezoneProgress(campaignID uuid.UUID) ([]models.TimezoneProgress, error) {
+	var rows []struct {
+		Timezone string
+		Status   models.DeliveryStatus
+		Count    int64
+		SendAt   *time.Time
+	}
+	err := s.db.Model(&models.CampaignDelivery{}).
+		Select("COALESCE(timezone, '') as timezone, status, COUNT(*) as count, MIN(not_before) as send_at").
+		Where("campaign_id = ?", campaignID).
+		Group("timezone, status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []models.TimezoneProgress
+	index := make(map[string]int)
+	for _, row := range rows {
+		i, ok := index[row.Timezone]
+		if !ok {
+			i = len(zones)
+			index[row.Timezone] = i
+			zones = append(zones, models.TimezoneProgress{Timezone: row.Timezone})
+		}
+		zone := &zones[i]
+		zone.Total += row.Count
+		if row.SendAt != nil && (zone.SendAt == nil || row.SendAt.Before(*zone.SendAt)) {
+			zone.SendAt = row.SendAt
+		}
+		switch row.Status {
+		case models.DeliveryStatusPending:
+			zone.Pending = row.Count
+		case models.DeliveryStatusSending:
+			zone.Sending = row.Count
+		case models.DeliveryStatusSent:
+			zone.Sent = row.Count
+		case models.DeliveryStatusFailed:
+			zone.Failed = row.Count
+		case models.DeliveryStatusSkipped:
+			zone.Skipped = row.Count
+		case models.DeliveryStatusHeld:
+			zone.Held = row.Count
+		}
+	}
+
+	now := time.Now()
+	for i := range zones {
+		zone := &zones[i]
+		switch {
+		case zone.Pending == 0 && zone.Sending == 0 && zone.Held == 0:
+			zone.Status = "done"
+		case zone.Pending == 0 && zone.Sending == 0:
+			zone.Status = "waiting" // only held recipients left
+		case zone.Pending+zone.Held == zone.Total && zone.SendAt != nil && zone.SendAt.After(now):
+			zone.Status = "waiting"
+		default:
+			zone.Status = "sending"
+		}
+	}
+
+	sort.Slice(zones, func(i, j int) bool {
+		if zones[i].SendAt == nil || zones[j].SendAt == nil {
+			return zones[i].SendAt != nil
+		}
+		return zones[i].SendAt.Before(*zones[j].SendAt)
+	})
+	return zones, nil
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"time"
+
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// claimMailbox takes the claim on an IMAP mailbox and reports whether it got
+// it. A claim older than ttl was left by a worker that died and is taken over.
+func claimMailbox(db *gorm.DB, mailbox string, ttl time.Duration) (bool, error) {
+	result := db.Exec(`INSERT INTO mailbox_claims (mailbox, claimed_at) VALUES (?, NOW())
+		ON CONFLICT (mailbox) DO UPDATE SET claimed_at = NOW()
+		WHERE mailbox_claims.claimed_at < ?`,
+		mailbox, time.Now().Add(-ttl))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// releaseMailbox gives up a claim once its session is over
+func releaseMailbox(db *gorm.DB, mailbox string) {
+	db.Where("mailbox = ?", mailbox).Delete(&models.MailboxClaim{})
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okemwag/newsletter/internal/database"
+)
+
+// Mailbox providers recipients are grouped by for throttling and reporting
+const (
+	MailboxGmail   = "gmail"
+	MailboxOutlook = "outlook"
+	MailboxYahoo   = "yahoo"
+	MailboxApple   = "apple"
+	MailboxOther   = "other"
+)
+
+// Recipient domains of each provider. Entries ending in "." match the name
+// under any TLD, e.g. yahoo.co.uk.
+var mailboxDomains = []struct {
+	provider string
+	domains  []string
+}{
+	{MailboxGmail, []string{"gmail.", "googlemail."}},
+	{MailboxOutlook, []string{"outlook.", "hotmail.", "live.", "msn."}},
+	{MailboxYahoo, []string{"yahoo.", "ymail."}},
+	{MailboxApple, []string{"icloud.", "me.com", "mac.com"}},
+}
+
+// MailboxProviderFor classifies an address by its domain
+func MailboxProviderFor(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return MailboxOther
+	}
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+
+	for _, p := range mailboxDomains {
+		for _, d := range p.domains {
+			if strings.HasSuffix(d, ".") && strings.HasPrefix(domain, d) || domain == d {
+				return p.provider
+			}
+		}
+	}
+	return MailboxOther
+}
+
+// mailboxProviderSQL is MailboxProviderFor as a SQL expression over an email
+// column, for classifying recipients in bulk
+func mailboxProviderSQL(column string) string {
+	domain := fmt.Sprintf("SPLIT_PART(LOWER(TRIM(%s)), '@', 2)", column)
+
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, p := range mailboxDomains {
+		conds := make([]string, len(p.domains))
+		for i, d := range p.domains {
+			if strings.HasSuffix(d, ".") {
+				conds[i] = fmt.Sprintf("%s LIKE '%s%%'", domain, d)
+			} else {
+				conds[i] = fmt.Sprintf("%s = '%s'", domain, d)
+			}
+		}
+		fmt.Fprintf(&b, " WHEN %s THEN '%s'", strings.Join(conds, " OR "), p.provider)
+	}
+	fmt.Fprintf(&b, " ELSE '%s' END", MailboxOther)
+	return b.String()
+}
+
+// MailboxLimit caps how fast one mailbox provider is sent to
+type MailboxLimit struct {
+	PerMinute   int `json:"perMinute"`
+	Concurrency int `json:"concurrency"`
+}
+
+// Defaults stay well under what each provider accepts from a sender without
+// an established reputation. Override with MAILBOX_LIMIT_<PROVIDER>=perMinute:concurrency.
+var defaultMailboxLimits = map[string]MailboxLimit{
+	MailboxGmail:   {PerMinute: 3000, Concurrency: 10},
+	MailboxOutlook: {PerMinute: 1200, Concurrency: 5},
+	MailboxYahoo:   {PerMinute: 600, Concurrency: 3},
+	MailboxApple:   {PerMinute: 1200, Concurrency: 5},
+	MailboxOther:   {PerMinute: 6000, Concurrency: 10},
+}
+
+func loadMailboxLimits() map[string]MailboxLimit {
+	limits := make(map[string]MailboxLimit, len(defaultMailboxLimits))
+	for provider, limit := range defaultMailboxLimits {
+		value := os.Getenv("MAILBOX_LIMIT_" + strings.ToUpper(provider))
+		if perMinute, concurrency, ok := strings.Cut(value, ":"); ok {
+			if n, err := strconv.Atoi(perMinute); err == nil && n > 0 {
+				limit.PerMinute = n
+			}
+			if n, err := strconv.Atoi(concurrency); err == nil && n > 0 {
+				limit.Concurrency = n
+			}
+		}
+		limits[provider] = limit
+	}
+	return limits
+}
+
+const (
+	// Deferrals back a provider off for 1, 2, 4... minutes up to the maximum
+	mailboxBackoffBase = time.Minute
+	mailboxBackoffMax  = 30 * time.Minute
+	// Backoff escalates while deferrals keep coming within this period
+	mailboxBackoffMemory = time.Hour
+)
+
+// MailboxThrottle enforces per-provider send rates and deferral backoff.
+// Counters live in Redis so every worker shares one budget; without Redis
+// they are kept per process. Concurrency is always per process.
+type MailboxThrottle struct {
+	limits map[string]MailboxLimit
+	slots  map[string]chan struct{}
+
+	mu      sync.Mutex
+	counts  map[string]int       // provider:minute -> sends
+	backoff map[string]time.Time // provider -> deferred until
+	levels  map[string]mailboxBackoffLevel
+}
+
+type mailboxBackoffLevel struct {
+	level   int
+	expires time.Time
+}
+
+var (
+	mailboxThrottleOnce sync.Once
+	mailboxThrottle     *MailboxThrottle
+)
+
+// GetMailboxThrottle returns the process-wide throttle
+func GetMailboxThrottle() *MailboxThrottle {
+	mailboxThrottleOnce.Do(func() {
+		limits := loadMailboxLimits()
+		slots := make(map[string]chan struct{}, len(limits))
+		for provider, limit := range limits {
+			slots[provider] = make(chan struct{}, limit.Concurrency)
+		}
+		mailboxThrottle = &MailboxThrottle{
+			limits:  limits,
+			slots:   slots,
+			counts:  make(map[string]int),
+			backoff: make(map[string]time.Time),
+			levels:  make(map[string]mailboxBackoffLevel),
+		}
+	})
+	return mailboxThrottle
+}
+
+func (t *MailboxThrottle) limit(provider string) MailboxLimit {
+	if limit, ok := t.limits[provider]; ok {
+		return limit
+	}
+	return t.limits[MailboxOther]
+}
+
+func rateKey(provider string, minute int64) string {
+	return fmt.Sprintf("mailbox:rate:%s:%d", provider, minute)
+}
+
+// Allow takes one send from the provider's budget for the current minute
+func (t *MailboxThrottle) Allow(provider string) bool {
+	if !t.DeferredUntil(provider).IsZero() {
+		return false
+	}
+
+	limit := t.limit(provider).PerMinute
+	minute := time.Now().Unix() / 60
+
+	if rdb := database.GetRedis(); rdb != nil {
+		ctx := context.Background()
+		key := rateKey(provider, minute)
+		n, err := rdb.Incr(ctx, key).Result()
+		if err == nil {
+			if n == 1 {
+				rdb.Expire(ctx, key, 2*time.Minute)
+			}
+			return n <= int64(limit)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := rateKey(provider, minute)
+	if t.counts[key] >= limit {
+		return false
+	}
+	t.counts[key]++
+	// Drop counters of minutes that have passed
+	for k := range t.counts {
+		if k != key && strings.HasPrefix(k, "mailbox:rate:"+provider+":") {
+			delete(t.counts, k)
+		}
+	}
+	return true
+}
+
+// Blocked lists the providers that can't take another send right now,
+// either because their budget for this minute is spent or they deferred
+func (t *MailboxThrottle) Blocked() []string {
+	minute := time.Now().Unix() / 60
+	rdb := database.GetRedis()
+
+	var blocked []string
+	for provider, limit := range t.limits {
+		if !t.DeferredUntil(provider).IsZero() {
+			blocked = append(blocked, provider)
+			continue
+		}
+
+		var used int
+		if rdb != nil {
+			n, err := rdb.Get(context.Background(), rateKey(provider, minute)).Int()
+			if err == nil {
+				used = n
+			}
+		} else {
+			t.mu.Lock()
+			used = t.counts[rateKey(provider, minute)]
+			t.mu.Unlock()
+		}
+		if used >= limit.PerMinute {
+			blocked = append(blocked, provider)
+		}
+	}
+	return blocked
+}
+
+// Defer backs a provider off after it answered with a temporary failure.
+// Deferrals after a backoff has ended double the next pause; those during
+// one, typically replies to messages already in flight, don't extend it.
+func (t *MailboxThrottle) Defer(provider string) time.Time {
+	if until := t.DeferredUntil(provider); !until.IsZero() {
+		return until
+	}
+
+	if rdb := database.GetRedis(); rdb != nil {
+		ctx := context.Background()
+		levelKey := "mailbox:backoff-level:" + provider
+		n, err := rdb.Incr(ctx, levelKey).Result()
+		if err == nil {
+			rdb.Expire(ctx, levelKey, mailboxBackoffMemory)
+			pause := mailboxBackoff(int(n))
+			rdb.Set(ctx, "mailbox:backoff:"+provider, n, pause)
+			return time.Now().Add(pause)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.levels[provider]
+	if time.Now().After(state.expires) {
+		state.level = 0
+	}
+	state.level++
+	state.expires = time.Now().Add(mailboxBackoffMemory)
+	t.levels[provider] = state
+
+	until := time.Now().Add(mailboxBackoff(state.level))
+	t.backoff[provider] = until
+	return until
+}
+
+// DeferredUntil returns when a backed-off provider may be sent to again, or
+// the zero time if it isn't backed off
+func (t *MailboxThrottle) DeferredUntil(provider string) time.Time {
+	if rdb := database.GetRedis(); rdb != nil {
+		ttl, err := rdb.PTTL(context.Background(), "mailbox:backoff:"+provider).Result()
+		if err == nil {
+			if ttl > 0 {
+				return time.Now().Add(ttl)
+			}
+			return time.Time{}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until, ok := t.backoff[provider]; ok && time.Now().Before(until) {
+		return until
+	}
+	return time.Time{}
+}
+
+// Acquire waits for a free concurrency slot for the provider
+func (t *MailboxThrottle) Acquire(provider string) {
+	slots, ok := t.slots[provider]
+	if !ok {
+		slots = t.slots[MailboxOther]
+	}
+	slots <- struct{}{}
+}
+
+// Release frees a slot taken with Acquire
+func (t *MailboxThrottle) Release(provider string) {
+	slots, ok := t.slots[provider]
+	if !ok {
+		slots = t.slots[MailboxOther]
+	}
+	<-slots
+}
+
+func mailboxBackoff(level int) time.Duration {
+	pause := mailboxBackoffBase
+	for i := 1; i < level && pause < mailboxBackoffMax; i++ {
+		pause *= 2
+	}
+	if pause > mailboxBackoffMax {
+		pause = mailboxBackoffMax
+	}
+	return pause
+}
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// Mailer is implemented by every outbound email provider
+type Mailer interface {
+	Name() string
+	Send(req *EmailRequest) (*SendResult, error)
+	IsConfigured() bool
+}
+
+type EmailRecipient struct {
+	Email            string
+	FirstName        string
+	LastName         string
+	UnsubscribeToken string
+}
+
+// EmailRequest is the common request structure shared by all providers
+type EmailRequest struct {
+	To          EmailRecipient
+	Subject     string
+	HTMLContent string
+	TextContent string
+	CampaignID  string
+	Tracked     bool // HTML already carries our open pixel and click links
+
+	// Routing and sender overrides (optional). A creator's mail without a
+	// FromEmail goes out from their verified sender domain.
+	Class     models.MessageClass
+	CreatorID *uuid.UUID
+	FromEmail string
+	FromName  string
+	ReplyTo   string
+	Headers   map[string]string
+
+	// Message log correlation. MessageID is assigned on the first send and
+	// passed back in on retries so attempts land on the same log entry.
+	MessageID    uuid.UUID
+	SubscriberID *uuid.UUID
+}
+
+// SendResult describes an accepted message
+type SendResult struct {
+	Provider  string `json:"provider"`
+	MessageID string `json:"messageId,omitempty"`
+}
+
+// ProviderError wraps a failed provider call so callers can decide on failover
+type ProviderError struct {
+	Provider   string
+	StatusCode int // 0 when the request never got a response
+	SMTPCode   int // SMTP reply code for relay errors
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.SMTPCode > 0 {
+		return fmt.Sprintf("%s error: smtp %d: %v", e.Provider, e.SMTPCode, e.Err)
+	}
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s error: status %d: %v", e.Provider, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s error: %v", e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether another provider may succeed where this one failed
+func (e *ProviderError) Retryable() bool {
+	// 4xx SMTP replies are transient, 5xx are permanent rejections
+	if e.SMTPCode > 0 {
+		return e.SMTPCode < 500
+	}
+	return e.StatusCode == 0 || e.StatusCode >= 500
+}
+
+var ErrNoMailerConfigured = errors.New("email service not configured")
+
+// MailerRegistry picks a provider per creator and message class and fails over
+// to the route's secondary provider when the primary is unavailable
+type MailerRegistry struct {
+	db           *gorm.DB
+	providers    map[string]Mailer
+	defaults     map[models.MessageClass]mailRoute
+	baseURL      string
+	suppressions *SuppressionService
+
+	// fromEmailFor returns the From address for a creator's mail (empty for
+	// the provider default)
+	fromEmailFor func(creatorID uuid.UUID) (string, error)
+}
+
+type mailRoute struct {
+	primary  string
+	fallback string
+}
+
+// NewMailerRegistry builds a registry from the configured providers.
+// Defaults come from EMAIL_PROVIDER_TRANSACTIONAL, EMAIL_PROVIDER_BULK and
+// EMAIL_FALLBACK_PROVIDER; rows in mail_routes override them at runtime.
+func NewMailerRegistry() *MailerRegistry {
+	r := &MailerRegistry{
+		db:           database.GetDB(),
+		providers:    make(map[string]Mailer),
+		baseURL:      os.Getenv("APP_BASE_URL"),
+		suppressions: NewSuppressionService(),
+		fromEmailFor: cachedCreatorFromEmail,
+	}
+
+	r.Register(NewSendGridEmailService())
+	r.Register(NewResendEmailService())
+	r.Register(NewSMTPEmailService())
+
+	fallback := os.Getenv("EMAIL_FALLBACK_PROVIDER")
+	r.defaults = map[models.MessageClass]mailRoute{
+		models.MessageClassTransactional: {
+			primary:  getEnvOr("EMAIL_PROVIDER_TRANSACTIONAL", "resend"),
+			fallback: fallback,
+		},
+		models.MessageClassBulk: {
+			primary:  getEnvOr("EMAIL_PROVIDER_BULK", "sendgrid"),
+			fallback: fallback,
+		},
+	}
+
+	return r
+}
+
+// Register adds or replaces a provider
+func (r *MailerRegistry) Register(m Mailer) {
+	r.providers[m.Name()] = m
+}
+
+// Provider returns a registered provider by name
+func (r *MailerRegistry) Provider(name string) (Mailer, bool) {
+	m, ok := r.providers[name]
+	return m, ok
+}
+
+// Providers lists registered providers and whether each is configured
+func (r *MailerRegistry) Providers() map[string]bool {
+	result := make(map[string]bool, len(r.providers))
+	for name, m := range r.providers {
+		result[name] = m.IsConfigured()
+	}
+	return result
+}
+
+// IsConfigured reports whether any provider on the route can send
+func (r *MailerRegistry) IsConfigured(class models.MessageClass, creatorID *uuid.UUID) bool {
+	for _, m := range r.candidates(class, creatorID) {
+		if m.IsConfigured() {
+			return true
+		}
+	}
+	return false
+}
+
+// Send delivers through the primary provider and fails over on 5xx or network errors.
+// Suppressed recipients are refused before anything is logged or sent, and
+// nothing is sent while the suppression list can't be read.
+func (r *MailerRegistry) Send(req *EmailRequest) (*SendResult, error) {
+	if req.Class == "" {
+		req.Class = models.MessageClassTransactional
+	}
+
+	entry, err := r.suppressions.Check(req.To.Email, req.CreatorID)
+	if err != nil {
+		// Never risk mailing a suppressed address; the caller retries later
+		return nil, fmt.Errorf("%w: %v", ErrSuppressionCheckFailed, err)
+	}
+	if entry != nil {
+		log.Printf("[Mailer] Not sending to %s: suppressed (%s)", req.To.Email, entry.Reason)
+		return nil, ErrRecipientSuppressed
+	}
+
+	if req.Class == models.MessageClassBulk {
+		r.setListUnsubscribe(req)
+	}
+	r.setFromEmail(req)
+
+	msg := r.logQueued(req)
+
+	candidates := r.candidates(req.Class, req.CreatorID)
+	if len(candidates) == 0 {
+		r.logFailed(msg, ErrNoMailerConfigured)
+		return nil, ErrNoMailerConfigured
+	}
+
+	var lastErr error
+	for i, m := range candidates {
+		if !m.IsConfigured() {
+			lastErr = ErrNoMailerConfigured
+			continue
+		}
+
+		result, err := m.Send(req)
+		if err == nil {
+			r.logSent(msg, result)
+			return result, nil
+		}
+		lastErr = err
+
+		var perr *ProviderError
+		if !errors.As(err, &perr) || !perr.Retryable() {
+			r.logFailed(msg, err)
+			return nil, err
+		}
+		if i < len(candidates)-1 {
+			log.Printf("[Mailer] %s failed (%v), failing over", m.Name(), err)
+		}
+	}
+
+	r.logFailed(msg, lastErr)
+	return nil, lastErr
+}
+
+// --- Message log ---
+
+// logQueued creates (or, on a retry, reopens) the message log entry and
+// stamps its ID on the request so providers can tag the message with it
+func (r *MailerRegistry) logQueued(req *EmailRequest) *models.EmailMessage {
+	if r.db == nil {
+		return nil
+	}
+
+	var msg models.EmailMessage
+	if req.MessageID != uuid.Nil && r.db.First(&msg, "id = ?", req.MessageID).Error == nil {
+		msg.Attempts++
+		msg.Status = models.MessageStatusQueued
+		r.db.Model(&msg).Updates(map[string]interface{}{"attempts": msg.Attempts, "status": msg.Status})
+		return &msg
+	}
+
+	msg = models.EmailMessage{
+		CreatorID:    req.CreatorID,
+		SubscriberID: req.SubscriberID,
+		Recipient:    req.To.Email,
+		Subject:      req.Subject,
+		Class:        req.Class,
+		Status:       models.MessageStatusQueued,
+		Attempts:     1,
+	}
+	if req.MessageID != uuid.Nil {
+		msg.ID = req.MessageID
+	}
+	if req.CampaignID != "" {
+		if id, err := uuid.Parse(req.CampaignID); err == nil {
+			msg.CampaignID = &id
+		}
+	}
+
+	if err := r.db.Create(&msg).Error; err != nil {
+		log.Printf("[Mailer] Failed to log message to %s: %v", req.To.Email, err)
+		return nil
+	}
+	req.MessageID = msg.ID
+	return &msg
+}
+
+func (r *MailerRegistry) logSent(msg *models.EmailMessage, result *SendResult) {
+	if msg == nil {
+		return
+	}
+	updates := map[string]interface{}{
+		"provider":   result.Provider,
+		"sent_at":    time.Now(),
+		"last_error": nil,
+	}
+	if result.MessageID != "" {
+		updates["provider_message_id"] = result.MessageID
+	}
+	r.db.Model(msg).Updates(updates)
+
+	// A fast provider event may already have moved the message past sent
+	r.db.Model(&models.EmailMessage{}).
+		Where("id = ? AND status = ?", msg.ID, models.MessageStatusQueued).
+		Update("status", models.MessageStatusSent)
+}
+
+func (r *MailerRegistry) logFailed(msg *models.EmailMessage, err error) {
+	if msg == nil || err == nil {
+		return
+	}
+	updates := map[string]interface{}{
+		"status":     models.MessageStatusFailed,
+		"last_error": err.Error(),
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		updates["provider"] = perr.Provider
+	}
+	r.db.Model(msg).Updates(updates)
+}
+
+// candidates returns the primary and fallback mailers for a route
+func (r *MailerRegistry) candidates(class models.MessageClass, creatorID *uuid.UUID) []Mailer {
+	route := r.resolveRoute(class, creatorID)
+
+	var mailers []Mailer
+	for _, name := range []string{route.primary, route.fallback} {
+		if name == "" {
+			continue
+		}
+		m, ok := r.providers[name]
+		if !ok {
+			log.Printf("[Mailer] Unknown provider %q on %s route", name, class)
+			continue
+		}
+		if len(mailers) == 1 && mailers[0] == m {
+			continue
+		}
+		mailers = append(mailers, m)
+	}
+	return mailers
+}
+
+// resolveRoute looks up creator routes, then platform routes, then env defaults
+func (r *MailerRegistry) resolveRoute(class models.MessageClass, creatorID *uuid.UUID) mailRoute {
+	if r.db != nil {
+		var routes []models.MailRoute
+		query := r.db.Where("class = ?", class)
+		if creatorID != nil {
+			query = query.Where("creator_id = ? OR creator_id IS NULL", *creatorID)
+		} else {
+			query = query.Where("creator_id IS NULL")
+		}
+		// Creator-specific rows sort before the platform default
+		if err := query.Order("creator_id IS NULL").Limit(1).Find(&routes).Error; err == nil && len(routes) > 0 {
+			route := mailRoute{primary: routes[0].Provider}
+			if routes[0].FallbackProvider != nil {
+				route.fallback = *routes[0].FallbackProvider
+			}
+			return route
+		}
+	}
+	return r.defaults[class]
+}
+
+// --- Route management ---
+
+type SetMailRouteRequest struct {
+	CreatorID        *uuid.UUID          `json:"creatorId,omitempty"`
+	Class            models.MessageClass `json:"class" binding:"required"`
+	Provider         string              `json:"provider" binding:"required"`
+	FallbackProvider *string             `json:"fallbackProvider,omitempty"`
+}
+
+// ListRoutes returns all configured routes
+func (r *MailerRegistry) ListRoutes() ([]models.MailRoute, error) {
+	var routes []models.MailRoute
+	err := r.db.Order("creator_id IS NOT NULL, class").Find(&routes).Error
+	return routes, err
+}
+
+// SetRoute creates or replaces the route for a creator (or the platform) and class
+func (r *MailerRegistry) SetRoute(req *SetMailRouteRequest) (*models.MailRoute, error) {
+	if req.Class != models.MessageClassTransactional && req.Class != models.MessageClassBulk {
+		return nil, errors.New("class must be transactional or bulk")
+	}
+	if _, ok := r.providers[req.Provider]; !ok {
+		return nil, fmt.Errorf("unknown provider %q", req.Provider)
+	}
+	if req.FallbackProvider != nil && *req.FallbackProvider != "" {
+		if _, ok := r.providers[*req.FallbackProvider]; !ok {
+			return nil, fmt.Errorf("unknown provider %q", *req.FallbackProvider)
+		}
+	}
+
+	var route models.MailRoute
+	query := r.db.Where("class = ?", req.Class)
+	if req.CreatorID != nil {
+		query = query.Where("creator_id = ?", *req.CreatorID)
+	} else {
+		query = query.Where("creator_id IS NULL")
+	}
+	err := query.First(&route).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	route.CreatorID = req.CreatorID
+	route.Class = req.Class
+	route.Provider = req.Provider
+	route.FallbackProvider = req.FallbackProvider
+
+	if err := r.db.Save(&route).Error; err != nil {
+		return nil, errors.New("failed to save mail route")
+	}
+	return &route, nil
+}
+
+// DeleteRoute removes a route so the next level of defaults applies
+func (r *MailerRegistry) DeleteRoute(id uuid.UUID) error {
+	result := r.db.Delete(&models.MailRoute{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("mail route not found")
+	}
+	return nil
+}
+
+// setFromEmail sends a creator's mail from their verified sender domain, so
+// it is signed with that domain's DKIM key and aligns for DMARC
+func (r *MailerRegistry) setFromEmail(req *EmailRequest) {
+	if req.FromEmail != "" || req.CreatorID == nil || r.fromEmailFor == nil {
+		return
+	}
+	fromEmail, err := r.fromEmailFor(*req.CreatorID)
+	if err != nil {
+		log.Printf("[Mailer] Failed to look up sender for creator %s, using the default: %v", *req.CreatorID, err)
+		return
+	}
+	req.FromEmail = fromEmail
+}
+
+// setListUnsubscribe adds the RFC 2369 and RFC 8058 one-click unsubscribe
+// headers that mailbox providers require on bulk mail
+func (r *MailerRegistry) setListUnsubscribe(req *EmailRequest) {
+	if req.To.UnsubscribeToken == "" {
+		return
+	}
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers["List-Unsubscribe"] = "<" + r.UnsubscribeURL(req.To.UnsubscribeToken, req.CampaignID) + ">"
+	req.Headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+}
+
+// UnsubscribeURL is the public unsubscribe link for a subscriber. The campaign,
+// when known, is carried along so the unsubscribe is attributed to it.
+func (r *MailerRegistry) UnsubscribeURL(token, campaignID string) string {
+	link := fmt.Sprintf("%s/api/unsubscribe/%s", r.baseURL, url.PathEscape(token))
+	if campaignID != "" {
+		link += "?c=" + url.QueryEscape(campaignID)
+	}
+	return link
+}
+
+// PreferencesURL is the subscriber's preference center, keyed by the same
+// token as their unsubscribe link
+func (r *MailerRegistry) PreferencesURL(token string) string {
+	return fmt.Sprintf("%s/api/preferences/%s", r.baseURL, url.PathEscape(token))
+}
+
+// --- Rendering ---
+
+// RenderTemplate renders a campaign template with subscriber data
+func (r *MailerRegistry) RenderTemplate(content string, subscriber *models.Subscriber, campaign *models.Campaign) (string, error) {
+	tmpl, err := template.New("email").Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	firstName := ""
+	lastName := ""
+	if subscriber.FirstName != nil {
+		firstName = *subscriber.FirstName
+	}
+	if subscriber.LastName != nil {
+		lastName = *subscriber.LastName
+	}
+
+	data := map[string]interface{}{
+		"FirstName":      firstName,
+		"LastName":       lastName,
+		"Email":          subscriber.Email,
+		"UnsubscribeURL": r.UnsubscribeURL(subscriber.UnsubscribeToken, campaign.ID.String()),
+		"PreferencesURL": r.PreferencesURL(subscriber.UnsubscribeToken),
+		"CampaignTitle":  campaign.Title,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// formatAddress builds a "Name <email>" address
+func formatAddress(name, email string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return email
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+func getEnvOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// EmailMessageService reads and updates the outbound message log
+type EmailMessageService struct {
+	db *gorm.DB
+}
+
+func NewEmailMessageService() *EmailMessageService {
+	return &EmailMessageService{
+		db: database.GetDB(),
+	}
+}
+
+type MessageFilter struct {
+	Status   *models.MessageStatus
+	Page     int
+	PageSize int
+}
+
+// FindByID returns a message by our internal ID
+func (s *EmailMessageService) FindByID(id uuid.UUID) (*models.EmailMessage, error) {
+	var msg models.EmailMessage
+	if err := s.db.First(&msg, "id = ?", id).Error; err != nil {
+		return nil, errors.New("message not found")
+	}
+	return &msg, nil
+}
+
+// FindByProviderID resolves a provider's message ID to our log entry.
+// SendGrid event IDs extend the X-Message-Id returned at send time
+// ("<id>.filter0001..."), so a prefix match is accepted as well.
+func (s *EmailMessageService) FindByProviderID(provider, providerMessageID string) (*models.EmailMessage, error) {
+	providerMessageID = strings.Trim(providerMessageID, "<>")
+	if providerMessageID == "" {
+		return nil, errors.New("message not found")
+	}
+
+	var msg models.EmailMessage
+	err := s.db.Where("provider = ? AND provider_message_id = ?", provider, providerMessageID).First(&msg).Error
+	if err == nil {
+		return &msg, nil
+	}
+
+	if i := strings.Index(providerMessageID, "."); i > 0 {
+		err = s.db.Where("provider = ? AND provider_message_id = ?", provider, providerMessageID[:i]).First(&msg).Error
+		if err == nil {
+			return &msg, nil
+		}
+	}
+
+	return nil, errors.New("message not found")
+}
+
+// FindLatest returns the most recent message of a campaign to a subscriber
+func (s *EmailMessageService) FindLatest(campaignID, subscriberID uuid.UUID) (*models.EmailMessage, error) {
+	var msg models.EmailMessage
+	err := s.db.Where("campaign_id = ? AND subscriber_id = ?", campaignID, subscriberID).
+		Order("created_at DESC").
+		First(&msg).Error
+	if err != nil {
+		return nil, errors.New("message not found")
+	}
+	return &msg, nil
+}
+
+// ApplyStatus moves a message to a new status reported by a provider event.
+// Events can arrive out of order, so a status only replaces one it outranks;
+// it returns false when the event was older news and ignored.
+func (s *EmailMessageService) ApplyStatus(msg *models.EmailMessage, status models.MessageStatus, reason string, at time.Time) (bool, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	updates := map[string]interface{}{}
+	if msg.LastEventAt == nil || at.After(*msg.LastEventAt) {
+		updates["last_event_at"] = at
+	}
+
+	applied := status.Supersedes(msg.Status)
+	if applied {
+		updates["status"] = status
+		if status == models.MessageStatusDelivered {
+			updates["delivered_at"] = at
+		}
+		if reason != "" {
+			updates["last_error"] = reason
+		}
+	}
+
+	if len(updates) == 0 {
+		return false, nil
+	}
+
+	// Guard on the status we read so concurrent events cannot regress it
+	result := s.db.Model(&models.EmailMessage{}).
+		Where("id = ? AND status = ?", msg.ID, msg.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Someone else moved it first; re-read and try once more
+		var fresh models.EmailMessage
+		if err := s.db.First(&fresh, "id = ?", msg.ID).Error; err != nil {
+			return false, err
+		}
+		if fresh.Status == msg.Status {
+			return false, nil
+		}
+		return s.ApplyStatus(&fresh, status, reason, at)
+	}
+
+	if applied {
+		msg.Status = status
+	}
+	return applied, nil
+}
+
+// GetCampaignMessages lists the messages sent for a campaign
+func (s *EmailMessageService) GetCampaignMessages(campaignID uuid.UUID, creatorID uuid.UUID, filter *MessageFilter) ([]models.EmailMessage, int64, error) {
+	var campaign models.Campaign
+	if err := s.db.Where("id = ? AND creator_id = ?", campaignID, creatorID).First(&campaign).Error; err != nil {
+		return nil, 0, errors.New("campaign not found")
+	}
+
+	query := s.db.Model(&models.EmailMessage{}).Where("campaign_id = ?", campaignID)
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+	offset := (filter.Page - 1) * filter.PageSize
+
+	var messages []models.EmailMessage
+	if err := query.Order("created_at DESC").Limit(filter.PageSize).Offset(offset).Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// TimelineEntry is one item on a subscriber's timeline: a message we sent or
+// an event recorded against one
+type TimelineEntry struct {
+	Type    string               `json:"type"` // message or event
+	At      time.Time            `json:"at"`
+	Message *models.EmailMessage `json:"message,omitempty"`
+	Event   *models.EmailEvent   `json:"event,omitempty"`
+}
+
+// GetSubscriberTimeline returns a subscriber's messages and events, newest first
+func (s *EmailMessageService) GetSubscriberTimeline(subscriberID uuid.UUID, creatorID uuid.UUID, limit int) ([]TimelineEntry, error) {
+	var subscriber models.Subscriber
+	if err := s.db.Where("id = ? AND creator_id = ?", subscriberID, creatorID).First(&subscriber).Error; err != nil {
+		return nil, errors.New("subscriber not found")
+	}
+
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	var messages []models.EmailMessage
+	if err := s.db.Where("subscriber_id = ?", subscriberID).Order("created_at DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	var events []models.EmailEvent
+	if err := s.db.Where("subscriber_id = ?", subscriberID).Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	timeline := make([]TimelineEntry, 0, len(messages)+len(events))
+	for i := range messages {
+		timeline = append(timeline, TimelineEntry{Type: "message", At: messages[i].CreatedAt, Message: &messages[i]})
+	}
+	for i := range events {
+		timeline = append(timeline, TimelineEntry{Type: "event", At: events[i].CreatedAt, Event: &events[i]})
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].At.After(timeline[j].At)
+	})
+	if len(timeline) > limit {
+		timeline = timeline[:limit]
+	}
+
+	return timeline, nil
+}
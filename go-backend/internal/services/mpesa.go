@@ -231,6 +231,7 @@ func (s *MpesaService) HandleCallback(callback *MpesaCallbackBody) error {
 		return errors.New("payment not found")
 	}
 
+	previous := payment.Status
 	if callback.Body.StkCallback.ResultCode == 0 {
 		// Payment successful
 		payment.Status = models.PaymentStatusSuccess
@@ -258,7 +259,13 @@ func (s *MpesaService) HandleCallback(callback *MpesaCallbackBody) error {
 		payment.FailureReason = &reason
 	}
 
-	return s.db.Save(&payment).Error
+	if err := s.db.Save(&payment).Error; err != nil {
+		return err
+	}
+	if payment.Status != previous {
+		NewWorkflowService().TriggerPayment(&payment)
+	}
+	return nil
 }
 
 func (s *MpesaService) QuerySTKStatus(checkoutRequestID string) (*models.Payment, error) {
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
 	"math/big"
 	"time"
 
@@ -143,7 +144,11 @@ func (s *OnboardingService) SetupProfile(userID uuid.UUID, req SetupProfileReque
 		updates["sender_email"] = req.SenderEmail
 	}
 
-	return s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		return err
+	}
+	invalidateCreatorFromEmail(userID)
+	return nil
 }
 
 // --- Step 4: Pricing Setup ---
@@ -272,11 +277,19 @@ func (s *OnboardingService) ActivateCreator(userID uuid.UUID) error {
 	}
 
 	now := time.Now()
-	return s.db.Model(&user).Updates(map[string]interface{}{
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
 		"creator_status":   types.CreatorStatusActiveEarning,
 		"onboarding_step":  7,
 		"activated_at":     now,
-	}).Error
+	}).Error; err != nil {
+		return err
+	}
+
+	// New creators start on a warm-up so their first sends build reputation
+	if _, err := NewWarmupService().EnsurePlan(userID); err != nil {
+		log.Printf("[Warmup] Failed to start warm-up for creator %s: %v", userID, err)
+	}
+	return nil
 }
 
 // --- Get Onboarding Status ---
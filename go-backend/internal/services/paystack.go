@@ -202,6 +202,7 @@ func (s *PaystackService) VerifyPayment(reference string) (*models.Payment, erro
 	}
 
 	// Update payment status
+	previous := payment.Status
 	switch result.Data.Status {
 case "success":
 		payment.Status = models.PaymentStatusSuccess
@@ -220,6 +221,10 @@ case "success":
 
 	s.db.Save(&payment)
 
+	if payment.Status != previous {
+		NewWorkflowService().TriggerPayment(&payment)
+	}
+
 	return &payment, nil
 }
 
@@ -249,8 +254,12 @@ func (s *PaystackService) HandleWebhook(eventType string, data map[string]interf
 		if err := s.db.Where("provider_ref = ?", reference).First(&payment).Error; err != nil {
 			return err
 		}
+		if payment.Status == models.PaymentStatusFailed {
+			return nil
+		}
 		payment.Status = models.PaymentStatusFailed
 		s.db.Save(&payment)
+		NewWorkflowService().TriggerPayment(&payment)
 		return nil
 
 	default:
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidWebhookSignature is returned when an inbound provider webhook
+// cannot be authenticated
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// ErrWebhookNotConfigured is returned when no verification key is set
+var ErrWebhookNotConfigured = errors.New("webhook verification key not configured")
+
+// verifyIngestToken checks a shared secret posted by an inbound mail
+// forwarder against the environment variable key
+func verifyIngestToken(key, token string) error {
+	secret := os.Getenv(key)
+	if secret == "" {
+		return ErrWebhookNotConfigured
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// Normalized provider event types
+const (
+	ProviderEventDelivered   = "delivered"
+	ProviderEventDeferred    = "deferred"
+	ProviderEventBounce      = "bounce"
+	ProviderEventDropped     = "dropped"
+	ProviderEventComplaint   = "complaint"
+	ProviderEventOpen        = "open"
+	ProviderEventClick       = "click"
+	ProviderEventUnsubscribe = "unsubscribe"
+)
+
+// ProviderEventInput is a provider webhook event mapped onto a common shape
+type ProviderEventInput struct {
+	Provider          string
+	EventID           string
+	Type              string
+	Email             string
+	ProviderMessageID string
+	MessageID         *uuid.UUID // our email_messages ID, when the provider echoes it back
+	CampaignID        *uuid.UUID
+	BounceType        models.BounceType // provider's own hard/soft call, a hint for ClassifyBounce
+	BounceStatus      string            // RFC 3463 enhanced status code, when reported
+	Reason            string
+	URL               string
+	IPAddress         string
+	UserAgent         string
+	Timestamp         time.Time
+	Raw               json.RawMessage
+}
+
+// ProviderEventService ingests delivery events from email providers and feeds
+// them into the message log, bounce, complaint and deliverability tracking
+type ProviderEventService struct {
+	db                    *gorm.DB
+	messageService        *EmailMessageService
+	bounceService         *BounceService
+	complaintService      *ComplaintService
+	deliverabilityService *DeliverabilityService
+	analyticsService      *AnalyticsService
+}
+
+func NewProviderEventService() *ProviderEventService {
+	return &ProviderEventService{
+		db:                    database.GetDB(),
+		messageService:        NewEmailMessageService(),
+		bounceService:         NewBounceService(),
+		complaintService:      NewComplaintService(),
+		deliverabilityService: NewDeliverabilityService(),
+		analyticsService:      NewAnalyticsService(),
+	}
+}
+
+// ignoredEvent is returned by apply for an event that can never be applied,
+// such as a bounce for a message we have no record of. Redelivery won't
+// change that, so the event is stored as handled with the reason.
+type ignoredEvent struct {
+	reason string
+}
+
+func (e *ignoredEvent) Error() string {
+	return e.reason
+}
+
+// eventContext is what we know about the message an event refers to
+type eventContext struct {
+	message      *models.EmailMessage
+	creatorID    *uuid.UUID
+	campaignID   *uuid.UUID
+	subscriberID *uuid.UUID
+}
+
+// Process handles a batch of events and returns how many were applied.
+// Events already applied are skipped, so providers can safely redeliver a
+// batch. An event that failed to apply is stored unprocessed and applied
+// again on the redelivery, so an error is returned for the provider to retry.
+// Events that can never apply are logged and marked ignored instead.
+func (s *ProviderEventService) Process(events []ProviderEventInput) (int, error) {
+	processed := 0
+	var applyErr error
+	for i := range events {
+		event := &events[i]
+
+		pending, err := s.record(event)
+		if err != nil {
+			return processed, err
+		}
+		if !pending {
+			continue
+		}
+
+		var ignoredReason *string
+		if err := s.apply(event); err != nil {
+			var ignored *ignoredEvent
+			if !errors.As(err, &ignored) {
+				log.Printf("[ProviderEvents] Failed to apply %s %s event %s: %v", event.Provider, event.Type, event.EventID, err)
+				if applyErr == nil {
+					applyErr = fmt.Errorf("apply %s event %s: %w", event.Provider, event.EventID, err)
+				}
+				continue
+			}
+			log.Printf("[ProviderEvents] Ignoring %s %s event %s: %s", event.Provider, event.Type, event.EventID, ignored.reason)
+			ignoredReason = &ignored.reason
+		}
+
+		err = s.db.Model(&models.ProviderEvent{}).
+			Where("provider = ? AND event_id = ?", event.Provider, event.EventID).
+			Updates(map[string]interface{}{"processed_at": time.Now(), "ignored_reason": ignoredReason}).Error
+		if err != nil {
+			return processed, err
+		}
+		if ignoredReason == nil {
+			processed++
+		}
+	}
+	return processed, applyErr
+}
+
+// record stores the event, returning false if it was already ingested and
+// applied. An event stored before but never applied is returned as pending.
+func (s *ProviderEventService) record(event *ProviderEventInput) (bool, error) {
+	if event.EventID == "" {
+		event.EventID = derivedEventID(event)
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	row := &models.ProviderEvent{
+		Provider:   event.Provider,
+		EventID:    event.EventID,
+		EventType:  event.Type,
+		MessageID:  event.MessageID,
+		Email:      strings.ToLower(event.Email),
+		OccurredAt: event.Timestamp,
+	}
+	if event.ProviderMessageID != "" {
+		row.ProviderMessageID = &event.ProviderMessageID
+	}
+	if len(event.Raw) > 0 {
+		raw := string(event.Raw)
+		row.Payload = &raw
+	}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	var unprocessed int64
+	err := s.db.Model(&models.ProviderEvent{}).
+		Where("provider = ? AND event_id = ? AND processed_at IS NULL", event.Provider, event.EventID).
+		Count(&unprocessed).Error
+	return unprocessed > 0, err
+}
+
+// derivedEventID stands in for a missing provider event ID. It is built from
+// the event itself, so a redelivered copy gets the same ID and is skipped.
+func derivedEventID(event *ProviderEventInput) string {
+	messageID := event.ProviderMessageID
+	if event.MessageID != nil {
+		messageID += "/" + event.MessageID.String()
+	}
+	var timestamp int64
+	if !event.Timestamp.IsZero() {
+		timestamp = event.Timestamp.UnixNano()
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%d",
+		event.Provider, event.Type, messageID, strings.ToLower(event.Email), event.URL, timestamp)))
+	return "derived:" + hex.EncodeToString(sum[:])
+}
+
+// resolve correlates an event with our message log, campaign and subscriber
+func (s *ProviderEventService) resolve(event *ProviderEventInput) *eventContext {
+	ctx := &eventContext{campaignID: event.CampaignID}
+
+	if event.MessageID != nil {
+		if msg, err := s.messageService.FindByID(*event.MessageID); err == nil {
+			ctx.message = msg
+		}
+	}
+	if ctx.message == nil && event.ProviderMessageID != "" {
+		if msg, err := s.messageService.FindByProviderID(event.Provider, event.ProviderMessageID); err == nil {
+			ctx.message = msg
+		}
+	}
+
+	if ctx.message != nil {
+		ctx.creatorID = ctx.message.CreatorID
+		ctx.subscriberID = ctx.message.SubscriberID
+		if ctx.message.CampaignID != nil {
+			ctx.campaignID = ctx.message.CampaignID
+		}
+	}
+
+	if ctx.creatorID == nil && ctx.campaignID != nil {
+		var campaign models.Campaign
+		if err := s.db.Select("id", "creator_id").First(&campaign, "id = ?", *ctx.campaignID).Error; err == nil {
+			ctx.creatorID = &campaign.CreatorID
+		}
+	}
+
+	if ctx.subscriberID == nil && ctx.creatorID != nil && event.Email != "" {
+		var subscriber models.Subscriber
+		err := s.db.Select("id").
+			Where("LOWER(email) = ? AND creator_id = ?", strings.ToLower(event.Email), *ctx.creatorID).
+			First(&subscriber).Error
+		if err == nil {
+			ctx.subscriberID = &subscriber.ID
+		}
+	}
+
+	return ctx
+}
+
+// apply maps a new event onto the message log and the downstream services
+func (s *ProviderEventService) apply(event *ProviderEventInput) error {
+	ctx := s.resolve(event)
+
+	if ctx.message != nil {
+		s.db.Model(&models.ProviderEvent{}).
+			Where("provider = ? AND event_id = ?", event.Provider, event.EventID).
+			Update("message_id", ctx.message.ID)
+	}
+
+	switch event.Type {
+	case ProviderEventDelivered:
+		applied := s.setStatus(ctx, models.MessageStatusDelivered, "", event.Timestamp)
+		// Only count the first delivery report for a message
+		if (applied || ctx.message == nil) && ctx.creatorID != nil && ctx.campaignID != nil {
+			s.deliverabilityService.RecordDelivery(*ctx.creatorID, *ctx.campaignID, event.Provider)
+		}
+		s.recordEvent(ctx, event, models.EmailEventDelivered, nil)
+
+	case ProviderEventDeferred:
+		s.setStatus(ctx, models.MessageStatusDeferred, event.Reason, event.Timestamp)
+		// Slow campaign sends to the mailbox provider that is deferring us
+		recipient := event.Email
+		if recipient == "" && ctx.message != nil {
+			recipient = ctx.message.Recipient
+		}
+		if recipient != "" {
+			GetMailboxThrottle().Defer(MailboxProviderFor(recipient))
+		}
+
+	case ProviderEventBounce, ProviderEventDropped:
+		s.setStatus(ctx, models.MessageStatusBounced, event.Reason, event.Timestamp)
+		if ctx.creatorID == nil {
+			return &ignoredEvent{reason: "bounce for unknown message"}
+		}
+		return s.bounceService.ProcessBounce(*ctx.creatorID, &BounceEvent{
+			Email:        event.Email,
+			Status:       event.BounceStatus,
+			Reason:       event.Reason,
+			ProviderType: event.BounceType,
+			Timestamp:    event.Timestamp,
+			CampaignID:   ctx.campaignID,
+			MessageID:    event.ProviderMessageID,
+			Provider:     event.Provider,
+		})
+
+	case ProviderEventComplaint:
+		if ctx.creatorID == nil {
+			return &ignoredEvent{reason: "complaint for unknown message"}
+		}
+		return s.complaintService.ProcessComplaint(*ctx.creatorID, &ComplaintEvent{
+			Email:      event.Email,
+			Reason:     event.Reason,
+			Timestamp:  event.Timestamp,
+			CampaignID: ctx.campaignID,
+			MessageID:  event.ProviderMessageID,
+			Provider:   event.Provider,
+			FeedbackID: event.EventID,
+		})
+
+	case ProviderEventOpen, ProviderEventClick:
+		// Engagement proves delivery even if the delivered event is late or lost
+		s.setStatus(ctx, models.MessageStatusDelivered, "", event.Timestamp)
+
+		eventType := models.EmailEventOpen
+		var metadata map[string]string
+		if event.Type == ProviderEventClick {
+			eventType = models.EmailEventClick
+			metadata = map[string]string{"url": event.URL}
+		}
+		s.recordEvent(ctx, event, eventType, metadata)
+
+	case ProviderEventUnsubscribe:
+		if ctx.subscriberID == nil {
+			return &ignoredEvent{reason: "unsubscribe for unknown subscriber"}
+		}
+		now := time.Now()
+		s.db.Model(&models.Subscriber{}).
+			Where("id = ? AND status = ?", *ctx.subscriberID, models.SubscriberStatusActive).
+			Updates(map[string]interface{}{
+				"status":          models.SubscriberStatusUnsubscribed,
+				"unsubscribed_at": now,
+			})
+		s.recordEvent(ctx, event, models.EmailEventUnsubscribe, nil)
+	}
+
+	return nil
+}
+
+func (s *ProviderEventService) setStatus(ctx *eventContext, status models.MessageStatus, reason string, at time.Time) bool {
+	if ctx.message == nil {
+		return false
+	}
+	applied, err := s.messageService.ApplyStatus(ctx.message, status, reason, at)
+	if err != nil {
+		log.Printf("[ProviderEvents] Failed to update message %s: %v", ctx.message.ID, err)
+	}
+	return applied
+}
+
+// recordEvent stores an EmailEvent when the campaign and subscriber are known.
+// Opens and clicks also go through engagement tracking.
+func (s *ProviderEventService) recordEvent(ctx *eventContext, event *ProviderEventInput, eventType models.EmailEventType, metadata map[string]string) bool {
+	if ctx.campaignID == nil || ctx.subscriberID == nil {
+		return false
+	}
+
+	emailEvent := &models.EmailEvent{
+		CampaignID:   *ctx.campaignID,
+		SubscriberID: *ctx.subscriberID,
+		EventType:    eventType,
+		CreatedAt:    event.Timestamp,
+	}
+	if ctx.message != nil {
+		emailEvent.MessageID = &ctx.message.ID
+	}
+	if len(metadata) > 0 {
+		data, _ := json.Marshal(metadata)
+		str := string(data)
+		emailEvent.Metadata = &str
+	}
+	if event.IPAddress != "" {
+		emailEvent.IPAddress = &event.IPAddress
+	}
+	if event.UserAgent != "" {
+		emailEvent.UserAgent = &event.UserAgent
+	}
+
+	record := s.analyticsService.RecordEvent
+	if eventType == models.EmailEventOpen || eventType == models.EmailEventClick {
+		record = s.analyticsService.RecordEngagement
+	}
+	if err := record(emailEvent); err != nil {
+		log.Printf("[ProviderEvents] Failed to record %s event: %v", eventType, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDerivedEventID(t *testing.T) {
+	messageID := uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-123456789abc")
+	base := ProviderEventInput{
+		Provider:          "sendgrid",
+		Type:              ProviderEventBounce,
+		Email:             "reader@example.org",
+		ProviderMessageID: "sg-1",
+		MessageID:         &messageID,
+		Timestamp:         time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC),
+	}
+
+	id := derivedEventID(&base)
+	if !strings.HasPrefix(id, "derived:") || len(id) > 255 {
+		t.Fatalf("derivedEventID() = %q", id)
+	}
+
+	redelivered := base
+	redelivered.Email = "Reader@Example.org"
+	redelivered.Raw = []byte(`{"retry":1}`)
+	if got := derivedEventID(&redelivered); got != id {
+		t.Errorf("redelivered event got ID %q, want %q", got, id)
+	}
+
+	others := map[string]func(e *ProviderEventInput){
+		"provider":  func(e *ProviderEventInput) { e.Provider = "resend" },
+		"type":      func(e *ProviderEventInput) { e.Type = ProviderEventDeferred },
+		"message":   func(e *ProviderEventInput) { e.ProviderMessageID = "sg-2" },
+		"recipient": func(e *ProviderEventInput) { e.Email = "other@example.org" },
+		"timestamp": func(e *ProviderEventInput) { e.Timestamp = e.Timestamp.Add(time.Second) },
+		"link":      func(e *ProviderEventInput) { e.Type = ProviderEventClick; e.URL = "https://example.com/a" },
+	}
+	for name, change := range others {
+		event := base
+		change(&event)
+		if got := derivedEventID(&event); got == id {
+			t.Errorf("event with a different %s got the same ID", name)
+		}
+	}
+}
+
+func TestIgnoredEventIsDistinguishable(t *testing.T) {
+	err := fmt.Errorf("apply: %w", &ignoredEvent{reason: "bounce for unknown message"})
+	var ignored *ignoredEvent
+	if !errors.As(err, &ignored) || ignored.reason != "bounce for unknown message" {
+		t.Errorf("errors.As(%v) = %v", err, ignored)
+	}
+	if errors.As(errors.New("connection reset"), &ignored) {
+		t.Error("a transient error was treated as ignored")
+	}
+}
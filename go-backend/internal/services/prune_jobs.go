@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPruneJobNotFound    = errors.New("prune job not found")
+	ErrNothingToPrune      = errors.New("no unengaged subscribers to prune")
+	ErrPruneNotConfirmable = errors.New("prune job is not awaiting confirmation")
+	ErrPrunePreviewExpired = errors.New("prune preview has expired, take a new one")
+	ErrPruneNotUndoable    = errors.New("prune job cannot be undone")
+)
+
+const (
+	// minPruneDays keeps a preview from sweeping up subscribers who simply
+	// haven't been mailed in a while
+	minPruneDays = 30
+
+	pruneBatchSize   = 500
+	pruneSampleLimit = 10
+)
+
+// PrunePayload is the queued payload that runs a confirmed prune job
+type PrunePayload struct {
+	JobID uuid.UUID `json:"jobId"`
+}
+
+// PrunePreviewRequest describes the prune a creator is considering
+type PrunePreviewRequest struct {
+	Mode models.PruneMode `json:"mode"` // archive (default) or delete
+	Days int              `json:"days"` // days without opens; defaults to UnengagedDays
+}
+
+// PrunePreview is what a prune job would remove, to show before confirming
+type PrunePreview struct {
+	Job       *models.PruneJob    `json:"job"`
+	Sample    []models.Subscriber `json:"sample"`
+	Criteria  string              `json:"criteria"`
+	ExpiresAt time.Time           `json:"expiresAt"`
+}
+
+// PruneJobFilter narrows the prune job list. A nil creator lists every
+// creator's jobs, for admins.
+type PruneJobFilter struct {
+	CreatorID *uuid.UUID
+	Status    *models.PruneJobStatus
+	Page      int
+	PageSize  int
+}
+
+// pruneConfirmWindow is how long a preview stays valid for confirmation
+func pruneConfirmWindow() time.Duration {
+	return time.Duration(envInt("PRUNE_CONFIRM_HOURS", 24)) * time.Hour
+}
+
+// pruneUndoWindow is how long after completion an archive can be restored
+func pruneUndoWindow() time.Duration {
+	return time.Duration(envInt("PRUNE_UNDO_DAYS", 30)) * 24 * time.Hour
+}
+
+// unengaged selects a creator's active subscribers with no opens since cutoff
+func unengaged(db *gorm.DB, creatorID uuid.UUID, cutoff time.Time) *gorm.DB {
+	return db.Model(&models.Subscriber{}).
+		Where("creator_id = ? AND status = ?", creatorID, models.SubscriberStatusActive).
+		Where("(last_opened_at < ? OR (last_opened_at IS NULL AND subscribed_at < ?))", cutoff, cutoff)
+}
+
+// PreviewPrune counts the subscribers a prune would remove and records the
+// preview as a job awaiting confirmation
+func (s *EngagementService) PreviewPrune(creatorID, requestedBy uuid.UUID, req *PrunePreviewRequest) (*PrunePreview, error) {
+	mode := req.Mode
+	if mode == "" {
+		mode = models.PruneModeArchive
+	}
+	if mode != models.PruneModeArchive && mode != models.PruneModeDelete {
+		return nil, errors.New("mode must be archive or delete")
+	}
+
+	days := req.Days
+	if days == 0 {
+		days = UnengagedDays
+	}
+	if days < minPruneDays {
+		return nil, fmt.Errorf("days must be at least %d", minPruneDays)
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	var total int64
+	if err := unengaged(s.db, creatorID, cutoff).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, ErrNothingToPrune
+	}
+
+	var sample []models.Subscriber
+	if err := unengaged(s.db, creatorID, cutoff).Order("engagement_score ASC").Limit(pruneSampleLimit).Find(&sample).Error; err != nil {
+		return nil, err
+	}
+
+	job := &models.PruneJob{
+		CreatorID:   creatorID,
+		Status:      models.PruneJobPreview,
+		Mode:        mode,
+		Cutoff:      cutoff,
+		RequestedBy: requestedBy,
+		Candidates:  total,
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	return &PrunePreview{
+		Job:       job,
+		Sample:    sample,
+		Criteria:  fmt.Sprintf("No email opens in the last %d days", days),
+		ExpiresAt: job.CreatedAt.Add(pruneConfirmWindow()),
+	}, nil
+}
+
+// ConfirmPrune queues a previewed prune job for the workers
+func (s *EngagementService) ConfirmPrune(id, creatorID uuid.UUID) (*models.PruneJob, error) {
+	job, err := s.GetPruneJob(id, &creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.PruneJobPreview {
+		return nil, ErrPruneNotConfirmable
+	}
+	if time.Since(job.CreatedAt) > pruneConfirmWindow() {
+		s.db.Model(job).Where("status = ?", models.PruneJobPreview).Update("status", models.PruneJobCancelled)
+		return nil, ErrPrunePreviewExpired
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.PruneJob{}).
+		Where("id = ? AND status = ?", id, models.PruneJobPreview).
+		Updates(map[string]interface{}{"status": models.PruneJobQueued, "confirmed_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPruneNotConfirmable
+	}
+
+	if _, err := queue.Enqueue(queue.TypePruneSubscribers, PrunePayload{JobID: id}); err != nil {
+		// Put the preview back so the creator can confirm again
+		s.db.Model(&models.PruneJob{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"status": models.PruneJobPreview, "confirmed_at": nil})
+		return nil, err
+	}
+
+	job.Status = models.PruneJobQueued
+	job.ConfirmedAt = &now
+	log.Printf("[Engagement] Prune job %s confirmed for creator %s (%d candidates, %s)", id, creatorID, job.Candidates, job.Mode)
+	return job, nil
+}
+
+// CancelPrune discards a preview that was never confirmed
+func (s *EngagementService) CancelPrune(id, creatorID uuid.UUID) error {
+	result := s.db.Model(&models.PruneJob{}).
+		Where("id = ? AND creator_id = ? AND status = ?", id, creatorID, models.PruneJobPreview).
+		Update("status", models.PruneJobCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPruneNotConfirmable
+	}
+	return nil
+}
+
+// RunPruneJob archives or deletes a confirmed job's subscribers in batches.
+// Each batch commits on its own, so a retry after a timeout or crash picks up
+// where the last attempt stopped.
+func (s *EngagementService) RunPruneJob(ctx context.Context, id uuid.UUID) error {
+	var job models.PruneJob
+	if err := s.db.First(&job, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPruneJobNotFound
+		}
+		return err
+	}
+
+	switch job.Status {
+	case models.PruneJobQueued, models.PruneJobRunning, models.PruneJobFailed:
+	default:
+		// Cancelled, already finished or undone
+		return nil
+	}
+
+	updates := map[string]interface{}{"status": models.PruneJobRunning, "error": nil}
+	if job.StartedAt == nil {
+		updates["started_at"] = time.Now()
+	}
+	if err := s.db.Model(&job).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := s.pruneBatch(&job)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	if err := s.db.Model(&job).Updates(map[string]interface{}{
+		"status":       models.PruneJobCompleted,
+		"completed_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	s.db.First(&job, "id = ?", id)
+	log.Printf("[Engagement] Prune job %s pruned %d subscribers for creator %s (%s)", id, job.Pruned, job.CreatorID, job.Mode)
+	return nil
+}
+
+// pruneBatch removes the next batch of a job's subscribers and returns how
+// many it removed
+func (s *EngagementService) pruneBatch(job *models.PruneJob) (int, error) {
+	var pruned int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := unengaged(tx, job.CreatorID, job.Cutoff).Limit(pruneBatchSize).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if job.Mode == models.PruneModeArchive {
+			// Postgres keeps microseconds; undo matches on this exact value
+			now := time.Now().Truncate(time.Microsecond)
+			archived := make([]models.PrunedSubscriber, len(ids))
+			for i, id := range ids {
+				archived[i] = models.PrunedSubscriber{JobID: job.ID, SubscriberID: id, ArchivedAt: now}
+			}
+			if err := tx.Create(&archived).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Subscriber{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+				"status":          models.SubscriberStatusUnsubscribed,
+				"unsubscribed_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Where("id IN ?", ids).Delete(&models.Subscriber{}).Error; err != nil {
+			return err
+		}
+
+		pruned = len(ids)
+		return tx.Model(&models.PruneJob{}).Where("id = ?", job.ID).
+			UpdateColumn("pruned", gorm.Expr("pruned + ?", pruned)).Error
+	})
+	return pruned, err
+}
+
+// FailPruneJob records why a prune job gave up. Subscribers already archived
+// stay archived and can still be restored with UndoPrune.
+func (s *EngagementService) FailPruneJob(id uuid.UUID, cause error) {
+	message := cause.Error()
+	s.db.Model(&models.PruneJob{}).
+		Where("id = ? AND status IN ?", id, []models.PruneJobStatus{models.PruneJobQueued, models.PruneJobRunning}).
+		Updates(map[string]interface{}{"status": models.PruneJobFailed, "error": message})
+	log.Printf("[Engagement] Prune job %s failed: %v", id, cause)
+}
+
+// UndoPrune restores the subscribers an archive job unsubscribed. Anyone who
+// has since unsubscribed, bounced or complained on their own is left alone.
+// A nil creator lets admins undo any creator's job.
+func (s *EngagementService) UndoPrune(id uuid.UUID, creatorID *uuid.UUID, actorID uuid.UUID) (*models.PruneJob, error) {
+	job, err := s.GetPruneJob(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Mode != models.PruneModeArchive {
+		return nil, fmt.Errorf("%w: deleted subscribers cannot be restored", ErrPruneNotUndoable)
+	}
+	if job.Status != models.PruneJobCompleted && job.Status != models.PruneJobFailed {
+		return nil, fmt.Errorf("%w: job is %s", ErrPruneNotUndoable, job.Status)
+	}
+	if job.CompletedAt != nil && time.Since(*job.CompletedAt) > pruneUndoWindow() {
+		return nil, fmt.Errorf("%w: the undo window has passed", ErrPruneNotUndoable)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		claim := tx.Model(&models.PruneJob{}).
+			Where("id = ? AND status = ?", id, job.Status).
+			Updates(map[string]interface{}{"status": models.PruneJobUndone, "undone_at": now, "undone_by": actorID})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return fmt.Errorf("%w: job changed while undoing", ErrPruneNotUndoable)
+		}
+
+		restore := tx.Exec(`UPDATE subscribers SET status = ?, unsubscribed_at = NULL, updated_at = NOW()
+			FROM pruned_subscribers p
+			WHERE p.job_id = ? AND p.subscriber_id = subscribers.id
+				AND subscribers.status = ? AND subscribers.unsubscribed_at = p.archived_at`,
+			models.SubscriberStatusActive, id, models.SubscriberStatusUnsubscribed)
+		if restore.Error != nil {
+			return restore.Error
+		}
+		return tx.Model(&models.PruneJob{}).Where("id = ?", id).Update("restored", restore.RowsAffected).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job, err = s.GetPruneJob(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Engagement] Prune job %s undone: restored %d of %d subscribers", id, job.Restored, job.Pruned)
+	return job, nil
+}
+
+// GetPruneJob returns a prune job. A nil creator finds any creator's job.
+func (s *EngagementService) GetPruneJob(id uuid.UUID, creatorID *uuid.UUID) (*models.PruneJob, error) {
+	query := s.db.Where("id = ?", id)
+	if creatorID != nil {
+		query = query.Where("creator_id = ?", *creatorID)
+	}
+
+	var job models.PruneJob
+	if err := query.First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPruneJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListPruneJobs returns prune jobs, newest first
+func (s *EngagementService) ListPruneJobs(filter *PruneJobFilter) ([]models.PruneJob, int64, error) {
+	query := s.db.Model(&models.PruneJob{})
+	if filter.CreatorID != nil {
+		query = query.Where("creator_id = ?", *filter.CreatorID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var jobs []models.PruneJob
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&jobs).Error
+	return jobs, total, err
+}
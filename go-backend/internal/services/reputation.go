@@ -0,0 +1,270 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rolling windows a creator's reputation is tracked over. The 30-day window
+// is the one mirrored into DeliverabilityMetrics.
+var ReputationWindows = []int{7, 30, 90}
+
+const metricsWindowDays = 30
+
+// Reputation model thresholds: bounce and complaint rates above these cost
+// points, open rates above the engagement target earn them
+const (
+	reputationBounceTarget     = 2.0 // percent
+	reputationBouncePenalty    = 5.0 // points per percent over target
+	reputationComplaintTarget  = ComplaintThreshold
+	reputationComplaintPenalty = 200.0 // points per percent over target, i.e. -20 per 0.1%
+	reputationOpenTarget       = 20.0
+	reputationOpenBonus        = 0.5
+)
+
+// DeliverabilityWindow is a creator's sending totals and rates over the last
+// Days days, including today
+type DeliverabilityWindow struct {
+	Days           int   `json:"days"`
+	Sent           int64 `json:"sent"`
+	Delivered      int64 `json:"delivered"`
+	Opened         int64 `json:"opened"`
+	Clicked        int64 `json:"clicked"`
+	MachineOpened  int64 `json:"machineOpened"`
+	MachineClicked int64 `json:"machineClicked"`
+	Bounced        int64 `json:"bounced"`
+	HardBounces    int64 `json:"hardBounces"`
+	SoftBounces    int64 `json:"softBounces"`
+	Complaints     int64 `json:"complaints"`
+
+	DeliveryRate    float64 `json:"deliveryRate"`
+	OpenRate        float64 `json:"openRate"`
+	ClickRate       float64 `json:"clickRate"`
+	BounceRate      float64 `json:"bounceRate"`
+	ComplaintRate   float64 `json:"complaintRate"`
+	ReputationScore float64 `json:"reputationScore"`
+}
+
+// calculate fills in the rates and reputation score from the totals
+func (w *DeliverabilityWindow) calculate() {
+	w.DeliveryRate, w.OpenRate, w.ClickRate, w.BounceRate, w.ComplaintRate = 100, 0, 0, 0, 0
+
+	if w.Sent > 0 {
+		// Not every provider reports deliveries; assume what didn't bounce arrived
+		delivered := w.Delivered
+		if delivered == 0 {
+			delivered = max(w.Sent-w.Bounced, 0)
+		}
+		w.DeliveryRate = float64(delivered) / float64(w.Sent) * 100
+		w.BounceRate = float64(w.Bounced) / float64(w.Sent) * 100
+		w.ComplaintRate = float64(w.Complaints) / float64(w.Sent) * 100
+		if delivered > 0 {
+			w.OpenRate = float64(w.Opened) / float64(delivered) * 100
+			w.ClickRate = float64(w.Clicked) / float64(delivered) * 100
+		}
+	}
+
+	w.ReputationScore = ReputationScore(w.BounceRate, w.ComplaintRate, w.OpenRate)
+}
+
+// ReputationScore is the sender reputation model (0-100) used everywhere a
+// score is shown or acted on. Rates are percentages.
+func ReputationScore(bounceRate, complaintRate, openRate float64) float64 {
+	score := 100.0
+
+	if bounceRate > reputationBounceTarget {
+		score -= (bounceRate - reputationBounceTarget) * reputationBouncePenalty
+	}
+	// Complaints hurt far more than bounces with mailbox providers
+	if complaintRate > reputationComplaintTarget {
+		score -= (complaintRate - reputationComplaintTarget) * reputationComplaintPenalty
+	}
+	if openRate > reputationOpenTarget {
+		score += (openRate - reputationOpenTarget) * reputationOpenBonus
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	if score > 100 {
+		score = 100
+	}
+	return score
+}
+
+// today is the current UTC day, the key of the daily rollup rows
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// incrementDaily adds to the creator's counters for today
+func (s *DeliverabilityService) incrementDaily(creatorID uuid.UUID, counts map[string]int64) error {
+	columns := make([]string, 0, len(counts))
+	for column, n := range counts {
+		if n != 0 {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	sort.Strings(columns)
+
+	values := []interface{}{creatorID, today()}
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		values = append(values, counts[column])
+		updates[i] = fmt.Sprintf("%s = deliverability_daily.%s + EXCLUDED.%s", column, column, column)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO deliverability_daily (creator_id, day, %s, created_at, updated_at)
+		VALUES (?, ?, %s, NOW(), NOW())
+		ON CONFLICT (creator_id, day) DO UPDATE SET %s, updated_at = NOW()`,
+		strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+		strings.Join(updates, ", "))
+	return s.db.Exec(query, values...).Error
+}
+
+// Window sums a creator's daily rollups over the last days days
+func (s *DeliverabilityService) Window(creatorID uuid.UUID, days int) (*DeliverabilityWindow, error) {
+	return s.windowAt(creatorID, days, today())
+}
+
+func (s *DeliverabilityService) windowAt(creatorID uuid.UUID, days int, day time.Time) (*DeliverabilityWindow, error) {
+	window := &DeliverabilityWindow{Days: days}
+	err := s.db.Model(&models.DeliverabilityDaily{}).
+		Select(`COALESCE(SUM(sent), 0) as sent, COALESCE(SUM(delivered), 0) as delivered,
+			COALESCE(SUM(opened), 0) as opened, COALESCE(SUM(clicked), 0) as clicked,
+			COALESCE(SUM(machine_opened), 0) as machine_opened, COALESCE(SUM(machine_clicked), 0) as machine_clicked,
+			COALESCE(SUM(bounced), 0) as bounced, COALESCE(SUM(hard_bounces), 0) as hard_bounces,
+			COALESCE(SUM(soft_bounces), 0) as soft_bounces, COALESCE(SUM(complaints), 0) as complaints`).
+		Where("creator_id = ? AND day > ? AND day <= ?", creatorID, day.AddDate(0, 0, -days), day).
+		Scan(window).Error
+	if err != nil {
+		return nil, err
+	}
+	window.Days = days
+	window.calculate()
+	return window, nil
+}
+
+// RecalculateMetrics refreshes a creator's DeliverabilityMetrics from the
+// last 30 days and records today's reputation snapshot for every window
+func (s *DeliverabilityService) RecalculateMetrics(creatorID uuid.UUID) error {
+	day := today()
+
+	for _, days := range ReputationWindows {
+		window, err := s.windowAt(creatorID, days, day)
+		if err != nil {
+			return err
+		}
+
+		if err := s.saveSnapshot(creatorID, day, window); err != nil {
+			return err
+		}
+		if days == metricsWindowDays {
+			if err := s.saveMetrics(creatorID, window); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *DeliverabilityService) saveMetrics(creatorID uuid.UUID, window *DeliverabilityWindow) error {
+	var metrics models.DeliverabilityMetrics
+	err := s.db.Where("creator_id = ?", creatorID).First(&metrics).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	metrics.CreatorID = creatorID
+	metrics.TotalSent = window.Sent
+	metrics.TotalDelivered = window.Delivered
+	metrics.TotalOpened = window.Opened
+	metrics.TotalClicked = window.Clicked
+	metrics.TotalMachineOpened = window.MachineOpened
+	metrics.TotalMachineClicked = window.MachineClicked
+	metrics.TotalBounced = window.Bounced
+	metrics.HardBounces = window.HardBounces
+	metrics.SoftBounces = window.SoftBounces
+	metrics.TotalComplaints = window.Complaints
+	metrics.DeliveryRate = window.DeliveryRate
+	metrics.OpenRate = window.OpenRate
+	metrics.ClickRate = window.ClickRate
+	metrics.BounceRate = window.BounceRate
+	metrics.ComplaintRate = window.ComplaintRate
+	metrics.ReputationScore = window.ReputationScore
+	metrics.LastCalculatedAt = time.Now()
+
+	return s.db.Save(&metrics).Error
+}
+
+func (s *DeliverabilityService) saveSnapshot(creatorID uuid.UUID, day time.Time, window *DeliverabilityWindow) error {
+	snapshot := models.ReputationSnapshot{
+		CreatorID:       creatorID,
+		Day:             day,
+		WindowDays:      window.Days,
+		Sent:            window.Sent,
+		Delivered:       window.Delivered,
+		Bounced:         window.Bounced,
+		Complaints:      window.Complaints,
+		DeliveryRate:    window.DeliveryRate,
+		OpenRate:        window.OpenRate,
+		ClickRate:       window.ClickRate,
+		BounceRate:      window.BounceRate,
+		ComplaintRate:   window.ComplaintRate,
+		ReputationScore: window.ReputationScore,
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "creator_id"}, {Name: "day"}, {Name: "window_days"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"sent", "delivered", "bounced", "complaints",
+			"delivery_rate", "open_rate", "click_rate", "bounce_rate", "complaint_rate",
+			"reputation_score", "updated_at",
+		}),
+	}).Create(&snapshot).Error
+}
+
+// RecalculateStale refreshes creators whose rollups changed since their
+// metrics were last calculated, and every creator active in the last 90 days
+// once a day so their windows keep rolling forward
+func (s *DeliverabilityService) RecalculateStale() {
+	day := today()
+	maxWindow := ReputationWindows[len(ReputationWindows)-1]
+
+	var creatorIDs []uuid.UUID
+	s.db.Table("deliverability_daily").
+		Select("DISTINCT deliverability_daily.creator_id").
+		Joins("LEFT JOIN deliverability_metrics ON deliverability_metrics.creator_id = deliverability_daily.creator_id").
+		Where("deliverability_daily.day > ?", day.AddDate(0, 0, -maxWindow)).
+		Where("deliverability_metrics.id IS NULL OR deliverability_daily.updated_at > deliverability_metrics.last_calculated_at OR deliverability_metrics.last_calculated_at < ?", day).
+		Pluck("deliverability_daily.creator_id", &creatorIDs)
+
+	for _, creatorID := range creatorIDs {
+		if err := s.RecalculateMetrics(creatorID); err != nil {
+			log.Printf("[Deliverability] Failed to recalculate metrics for creator %s: %v", creatorID, err)
+		}
+	}
+}
+
+// GetReputationHistory returns a creator's daily reputation over one window
+// for the last days days, oldest first
+func (s *DeliverabilityService) GetReputationHistory(creatorID uuid.UUID, windowDays, days int) ([]models.ReputationSnapshot, error) {
+	var snapshots []models.ReputationSnapshot
+	err := s.db.Where("creator_id = ? AND window_days = ? AND day > ?", creatorID, windowDays, today().AddDate(0, 0, -days)).
+		Order("day ASC").
+		Find(&snapshots).Error
+	return snapshots, err
+}
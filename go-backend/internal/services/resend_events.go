@@ -0,0 +1,158 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// resendEvent is a Resend webhook payload
+type resendEvent struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		EmailID string          `json:"email_id"`
+		To      []string        `json:"to"`
+		Tags    json.RawMessage `json:"tags"`
+		Bounce  struct {
+			Type    string `json:"type"` // Permanent or Transient
+			SubType string `json:"subType"`
+			Message string `json:"message"`
+		} `json:"bounce"`
+		Click struct {
+			Link      string `json:"link"`
+			IPAddress string `json:"ipAddress"`
+			UserAgent string `json:"userAgent"`
+		} `json:"click"`
+	} `json:"data"`
+}
+
+// VerifyResendSignature checks the Svix signature Resend puts on webhook
+// requests, using the signing secret from RESEND_WEBHOOK_SECRET
+func VerifyResendSignature(payload []byte, id, timestamp, signatures string) error {
+	secret := os.Getenv("RESEND_WEBHOOK_SECRET")
+	if secret == "" {
+		return ErrWebhookNotConfigured
+	}
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrInvalidWebhookSignature
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return fmt.Errorf("invalid Resend webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	// The header holds space separated "v1,<base64>" entries, one per active secret
+	valid := false
+	for _, entry := range strings.Fields(signatures) {
+		version, sig, ok := strings.Cut(entry, ",")
+		if !ok || version != "v1" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalidWebhookSignature
+	}
+
+	return checkWebhookTimestamp(timestamp)
+}
+
+// ParseResendEvent maps a Resend webhook payload onto a provider event. The
+// Svix message ID is used as the event ID since Resend payloads carry none.
+func ParseResendEvent(payload []byte, eventID string) ([]ProviderEventInput, error) {
+	var e resendEvent
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, fmt.Errorf("invalid Resend event: %w", err)
+	}
+
+	event := ProviderEventInput{
+		Provider:          "resend",
+		EventID:           eventID,
+		ProviderMessageID: e.Data.EmailID,
+		Timestamp:         e.CreatedAt,
+		Raw:               payload,
+	}
+	if len(e.Data.To) > 0 {
+		event.Email = e.Data.To[0]
+	}
+
+	switch e.Type {
+	case "email.delivered":
+		event.Type = ProviderEventDelivered
+	case "email.delivery_delayed":
+		event.Type = ProviderEventDeferred
+	case "email.bounced":
+		event.Type = ProviderEventBounce
+		event.BounceType = models.BounceTypeHard
+		if e.Data.Bounce.Type == "Transient" {
+			event.BounceType = models.BounceTypeSoft
+		}
+		event.Reason = e.Data.Bounce.Message
+	case "email.complained":
+		event.Type = ProviderEventComplaint
+	case "email.opened":
+		event.Type = ProviderEventOpen
+	case "email.clicked":
+		event.Type = ProviderEventClick
+		event.URL = e.Data.Click.Link
+		event.IPAddress = e.Data.Click.IPAddress
+		event.UserAgent = e.Data.Click.UserAgent
+	default:
+		return nil, nil
+	}
+
+	tags := resendTags(e.Data.Tags)
+	if id, err := uuid.Parse(tags["message_id"]); err == nil {
+		event.MessageID = &id
+	}
+	if id, err := uuid.Parse(tags["campaign_id"]); err == nil {
+		event.CampaignID = &id
+	}
+
+	return []ProviderEventInput{event}, nil
+}
+
+// resendTags reads tags, which Resend sends either as an object or as a list
+// of name/value pairs
+func resendTags(raw json.RawMessage) map[string]string {
+	tags := make(map[string]string)
+	if len(raw) == 0 {
+		return tags
+	}
+	if err := json.Unmarshal(raw, &tags); err == nil {
+		return tags
+	}
+
+	var list []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, tag := range list {
+			tags[tag.Name] = tag.Value
+		}
+	}
+	return tags
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const resendTestSecret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+
+// signSvix signs a webhook the way Svix does for Resend
+func signSvix(t *testing.T, secret, id, timestamp string, payload []byte) string {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(payload)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyResendSignatureKnownVector(t *testing.T) {
+	// The example from the Svix documentation. It is long past the replay
+	// window, so a correct signature check gets as far as the timestamp.
+	t.Setenv("RESEND_WEBHOOK_SECRET", resendTestSecret)
+	payload := []byte(`{"test": 2432232314}`)
+	id := "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	timestamp := "1614265330"
+	signature := "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+
+	if got := signSvix(t, resendTestSecret, id, timestamp, payload); got != signature {
+		t.Fatalf("signSvix() = %q, want the documented %q", got, signature)
+	}
+	err := VerifyResendSignature(payload, id, timestamp, signature)
+	if err == nil || errors.Is(err, ErrInvalidWebhookSignature) || !strings.Contains(err.Error(), "timestamp outside tolerance") {
+		t.Errorf("VerifyResendSignature() = %v, want only the timestamp rejected", err)
+	}
+}
+
+func TestVerifyResendSignature(t *testing.T) {
+	t.Setenv("RESEND_WEBHOOK_SECRET", resendTestSecret)
+	payload := []byte(`{"type":"email.bounced","created_at":"2026-10-12T10:00:00Z","data":{"email_id":"re-1","to":["reader@example.org"]}}`)
+	id := "msg_2mZ5QxLq9yJ1"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	signature := signSvix(t, resendTestSecret, id, now, payload)
+	rotated := signSvix(t, "whsec_"+base64.StdEncoding.EncodeToString([]byte("previous secret")), id, now, payload)
+
+	tests := []struct {
+		name       string
+		payload    []byte
+		id         string
+		timestamp  string
+		signatures string
+		wantErr    error  // nil for a valid request
+		wantText   string // for errors without a sentinel
+	}{
+		{name: "signed", payload: payload, id: id, timestamp: now, signatures: signature},
+		{name: "one of several signatures", payload: payload, id: id, timestamp: now, signatures: rotated + " " + signature},
+		{name: "unknown versions are skipped", payload: payload, id: id, timestamp: now, signatures: "v2," + strings.TrimPrefix(signature, "v1,") + " " + signature},
+		{name: "modified body", payload: []byte(strings.Replace(string(payload), "re-1", "re-2", 1)), id: id, timestamp: now, signatures: signature, wantErr: ErrInvalidWebhookSignature},
+		{name: "another message ID", payload: payload, id: "msg_other", timestamp: now, signatures: signature, wantErr: ErrInvalidWebhookSignature},
+		{name: "signed with another secret", payload: payload, id: id, timestamp: now, signatures: rotated, wantErr: ErrInvalidWebhookSignature},
+		{name: "wrong version", payload: payload, id: id, timestamp: now, signatures: "v2," + strings.TrimPrefix(signature, "v1,"), wantErr: ErrInvalidWebhookSignature},
+		{name: "timestamp changed after signing", payload: payload, id: id, timestamp: stale, signatures: signature, wantErr: ErrInvalidWebhookSignature},
+		{name: "stale timestamp", payload: payload, id: id, timestamp: stale, signatures: signSvix(t, resendTestSecret, id, stale, payload), wantText: "timestamp outside tolerance"},
+		{name: "missing headers", payload: payload, wantErr: ErrInvalidWebhookSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyResendSignature(tt.payload, tt.id, tt.timestamp, tt.signatures)
+			switch {
+			case tt.wantErr == nil && tt.wantText == "":
+				if err != nil {
+					t.Errorf("VerifyResendSignature() = %v, want nil", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyResendSignature() = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || !strings.Contains(err.Error(), tt.wantText) {
+					t.Errorf("VerifyResendSignature() = %v, want %q", err, tt.wantText)
+				}
+			}
+		})
+	}
+
+	t.Run("no secret", func(t *testing.T) {
+		t.Setenv("RESEND_WEBHOOK_SECRET", "")
+		if err := VerifyResendSignature(payload, id, now, signature); !errors.Is(err, ErrWebhookNotConfigured) {
+			t.Errorf("error = %v, want ErrWebhookNotConfigured", err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	returnPathPrefix  = "bounces"
+	returnPathMACSize = 8
+)
+
+// returnPathKey derives the VERP signing key the same way tracking links are
+// keyed, so forged bounces can't be pinned on arbitrary messages. It is nil
+// when neither TRACKING_SECRET nor JWT_SECRET is set.
+func returnPathKey() []byte {
+	secret := os.Getenv("TRACKING_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("newsletter-return-path-v1"))
+	return mac.Sum(nil)
+}
+
+// ReturnPathAddress is the VERP envelope sender for a message:
+// bounces+<message id>-<mac>@RETURN_PATH_DOMAIN. Bounces sent to it identify
+// the message without parsing the original. Empty when RETURN_PATH_DOMAIN
+// or the signing secret is not set, or the message has no log entry.
+func ReturnPathAddress(messageID uuid.UUID) string {
+	domain := os.Getenv("RETURN_PATH_DOMAIN")
+	key := returnPathKey()
+	if domain == "" || key == nil || messageID == uuid.Nil {
+		return ""
+	}
+	id := hex.EncodeToString(messageID[:])
+	return returnPathPrefix + "+" + id + "-" + returnPathMAC(key, id) + "@" + domain
+}
+
+// ParseReturnPath returns the message a VERP address was generated for. It
+// accepts a bare address or one in angle brackets, and rejects every address
+// when no signing secret is set.
+func ParseReturnPath(address string) (uuid.UUID, bool) {
+	key := returnPathKey()
+	if key == nil {
+		return uuid.Nil, false
+	}
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return uuid.Nil, false
+	}
+	local := strings.ToLower(address[:at])
+
+	token, ok := strings.CutPrefix(local, returnPathPrefix+"+")
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, mac, ok := strings.Cut(token, "-")
+	if !ok || !hmac.Equal([]byte(mac), []byte(returnPathMAC(key, id))) {
+		return uuid.Nil, false
+	}
+
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 16 {
+		return uuid.Nil, false
+	}
+	return uuid.UUID(raw), true
+}
+
+func returnPathMAC(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:returnPathMACSize])
+}
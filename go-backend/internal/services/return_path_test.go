@@ -0,0 +1,136 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReturnPathAddress(t *testing.T) {
+	id := uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-123456789abc")
+
+	tests := []struct {
+		name   string
+		domain string
+		secret string
+		id     uuid.UUID
+		want   string // prefix of the address, or "" for none
+	}{
+		{name: "configured", domain: "bounces.example.net", secret: "s3cret", id: id, want: "bounces+6f1c2a4e8b3d4c5e9f70123456789abc-"},
+		{name: "no domain", secret: "s3cret", id: id},
+		{name: "no secret", domain: "bounces.example.net", id: id},
+		{name: "no message", domain: "bounces.example.net", secret: "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RETURN_PATH_DOMAIN", tt.domain)
+			t.Setenv("TRACKING_SECRET", tt.secret)
+			t.Setenv("JWT_SECRET", "")
+
+			got := ReturnPathAddress(tt.id)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("ReturnPathAddress() = %q, want none", got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, tt.want) || !strings.HasSuffix(got, "@"+tt.domain) {
+				t.Errorf("ReturnPathAddress() = %q, want %s<mac>@%s", got, tt.want, tt.domain)
+			}
+		})
+	}
+}
+
+func TestParseReturnPath(t *testing.T) {
+	id := uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-123456789abc")
+	t.Setenv("RETURN_PATH_DOMAIN", "bounces.example.net")
+	t.Setenv("TRACKING_SECRET", "s3cret")
+	t.Setenv("JWT_SECRET", "")
+	address := ReturnPathAddress(id)
+
+	local, domain, _ := strings.Cut(address, "@")
+	token := strings.TrimPrefix(local, "bounces+")
+	hexID, mac, _ := strings.Cut(token, "-")
+	flipped := "0"
+	if mac[len(mac)-1] == '0' {
+		flipped = "1"
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		ok      bool
+	}{
+		{name: "bare address", address: address, ok: true},
+		{name: "angle brackets", address: "<" + address + ">", ok: true},
+		{name: "surrounding space", address: "  <" + address + ">\r\n", ok: true},
+		{name: "uppercased by a relay", address: strings.ToUpper(local) + "@" + domain, ok: true},
+		{name: "any domain", address: local + "@mx.example.org", ok: true},
+		{name: "tampered mac", address: "bounces+" + hexID + "-" + mac[:len(mac)-1] + flipped + "@" + domain},
+		{name: "mac for another message", address: "bounces+" + strings.Repeat("0", 32) + "-" + mac + "@" + domain},
+		{name: "missing mac", address: "bounces+" + hexID + "@" + domain},
+		{name: "wrong prefix", address: "returns+" + token + "@" + domain},
+		{name: "no domain", address: local},
+		{name: "plain address", address: "news@example.com"},
+		{name: "empty", address: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseReturnPath(tt.address)
+			if ok != tt.ok {
+				t.Fatalf("ParseReturnPath(%q) ok = %v, want %v", tt.address, ok, tt.ok)
+			}
+			if ok && got != id {
+				t.Errorf("ParseReturnPath(%q) = %s, want %s", tt.address, got, id)
+			}
+		})
+	}
+
+	t.Run("signed with another secret", func(t *testing.T) {
+		t.Setenv("TRACKING_SECRET", "other")
+		if _, ok := ParseReturnPath(address); ok {
+			t.Error("address verified under a different secret")
+		}
+	})
+
+	t.Run("no secret rejects everything", func(t *testing.T) {
+		t.Setenv("TRACKING_SECRET", "")
+		if _, ok := ParseReturnPath(address); ok {
+			t.Error("address accepted with no signing secret")
+		}
+	})
+
+	t.Run("falls back to JWT_SECRET", func(t *testing.T) {
+		t.Setenv("TRACKING_SECRET", "")
+		t.Setenv("JWT_SECRET", "jwt")
+		signed := ReturnPathAddress(id)
+		if got, ok := ParseReturnPath(signed); !ok || got != id {
+			t.Errorf("ParseReturnPath(%q) = %s, %v", signed, got, ok)
+		}
+	})
+}
+
+func TestParseReturnPathList(t *testing.T) {
+	id := uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-123456789abc")
+	t.Setenv("RETURN_PATH_DOMAIN", "bounces.example.net")
+	t.Setenv("TRACKING_SECRET", "s3cret")
+	address := ReturnPathAddress(id)
+
+	for _, value := range []string{
+		address,
+		"Bounces <" + address + ">",
+		"postmaster@example.net, " + address,
+	} {
+		if got, ok := parseReturnPathList(value); !ok || got != id {
+			t.Errorf("parseReturnPathList(%q) = %s, %v", value, got, ok)
+		}
+	}
+	for _, value := range []string{"", "postmaster@example.net", "not an address list"} {
+		if _, ok := parseReturnPathList(value); ok {
+			t.Errorf("parseReturnPathList(%q) found a message", value)
+		}
+	}
+}
@@ -0,0 +1,681 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+	"github.com/okemwag/newsletter/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// seedTokenHeader carries the per seed token the poller searches for
+	seedTokenHeader = "X-Seed-Token"
+
+	seedSessionTimeout = time.Minute
+	seedBatchSize      = 50
+
+	// seedClaimTimeout is how long a seed mailbox stays claimed by a job that
+	// never released it
+	seedClaimTimeout = 15 * time.Minute
+)
+
+// InboxPlacement sources
+const (
+	InboxPlacementEstimate = "estimate"
+	InboxPlacementSeed     = "seed"
+)
+
+var ErrSeedMailboxNotFound = errors.New("seed mailbox not found")
+
+// Folder names that hold spam or promotions when the server doesn't flag
+// them with a special-use attribute; matched against the last path segment
+var (
+	seedSpamFolders       = []string{"spam", "junk", "junk e-mail", "junk email", "bulk mail", "bulk"}
+	seedPromotionsFolders = []string{"promotions", "categories/promotions"}
+)
+
+// SeedService sends every campaign to the creator's seed mailboxes and polls
+// them over IMAP to measure inbox placement per mailbox provider
+type SeedService struct {
+	db     *gorm.DB
+	mailer *MailerRegistry
+}
+
+func NewSeedService() *SeedService {
+	return &SeedService{
+		db:     database.GetDB(),
+		mailer: NewMailerRegistry(),
+	}
+}
+
+// seedPollInterval is how often a sent seed is looked for, from SEED_POLL_MINUTES
+func seedPollInterval() time.Duration {
+	return time.Duration(envInt("SEED_POLL_MINUTES", 5)) * time.Minute
+}
+
+// seedPollWindow is how long after sending a seed that hasn't arrived is
+// still looked for, from SEED_POLL_HOURS
+func seedPollWindow() time.Duration {
+	return time.Duration(envInt("SEED_POLL_HOURS", 4)) * time.Hour
+}
+
+type AddSeedMailboxRequest struct {
+	Email            string `json:"email" binding:"required,email"`
+	Provider         string `json:"provider,omitempty" binding:"omitempty,oneof=gmail outlook yahoo apple other"`
+	IMAPHost         string `json:"imapHost" binding:"required,max=255"`
+	IMAPPort         int    `json:"imapPort,omitempty" binding:"omitempty,oneof=143 993"`
+	IMAPTLS          *bool  `json:"imapTls,omitempty"`
+	Username         string `json:"username,omitempty" binding:"max=255"`
+	Password         string `json:"password" binding:"required"`
+	InboxFolder      string `json:"inboxFolder,omitempty" binding:"max=255"`
+	SpamFolder       string `json:"spamFolder,omitempty" binding:"max=255"`
+	PromotionsFolder string `json:"promotionsFolder,omitempty" binding:"max=255"`
+}
+
+// SeedMailboxCheck is the outcome of connecting to a seed mailbox
+type SeedMailboxCheck struct {
+	Mailbox          *models.SeedMailbox `json:"mailbox"`
+	Folders          []string            `json:"folders"`
+	InboxFolder      string              `json:"inboxFolder"`
+	SpamFolder       string              `json:"spamFolder,omitempty"`
+	PromotionsFolder string              `json:"promotionsFolder,omitempty"`
+	GmailCategories  bool                `json:"gmailCategories"`
+}
+
+// CampaignPlacement is the seed placement report for a campaign
+type CampaignPlacement struct {
+	Providers []models.InboxPlacement `json:"providers"`
+	Seeds     []models.SeedPlacement  `json:"seeds"`
+}
+
+// AddMailbox registers a seed mailbox after checking that it can be read
+func (s *SeedService) AddMailbox(creatorID uuid.UUID, req *AddSeedMailboxRequest) (*SeedMailboxCheck, error) {
+	mailbox := &models.SeedMailbox{
+		CreatorID:        creatorID,
+		Email:            strings.ToLower(strings.TrimSpace(req.Email)),
+		Provider:         req.Provider,
+		IMAPHost:         strings.TrimSpace(req.IMAPHost),
+		IMAPPort:         req.IMAPPort,
+		IMAPTLS:          true,
+		Username:         req.Username,
+		InboxFolder:      req.InboxFolder,
+		SpamFolder:       req.SpamFolder,
+		PromotionsFolder: req.PromotionsFolder,
+		IsActive:         true,
+	}
+	if mailbox.Provider == "" {
+		mailbox.Provider = MailboxProviderFor(mailbox.Email)
+	}
+	if req.IMAPTLS != nil {
+		mailbox.IMAPTLS = *req.IMAPTLS
+	}
+	if mailbox.IMAPPort == 0 {
+		mailbox.IMAPPort = 993
+		if !mailbox.IMAPTLS {
+			mailbox.IMAPPort = 143
+		}
+	}
+	if mailbox.Username == "" {
+		mailbox.Username = mailbox.Email
+	}
+
+	var count int64
+	s.db.Model(&models.SeedMailbox{}).Where("creator_id = ? AND email = ?", creatorID, mailbox.Email).Count(&count)
+	if count > 0 {
+		return nil, errors.New("seed mailbox already added")
+	}
+
+	if err := checkPublicIMAPServer(mailbox.IMAPHost, mailbox.IMAPPort); err != nil {
+		return nil, err
+	}
+	password, err := utils.EncryptSecret(req.Password)
+	if err != nil {
+		log.Printf("[Seeds] Failed to encrypt mailbox password: %v", err)
+		return nil, errors.New("failed to store seed mailbox credentials")
+	}
+	mailbox.Password = password
+
+	check, err := s.inspect(mailbox)
+	if err != nil {
+		return nil, fmt.Errorf("could not read seed mailbox: %w", err)
+	}
+
+	now := time.Now()
+	mailbox.LastCheckedAt = &now
+	if err := s.db.Create(mailbox).Error; err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// ListMailboxes returns a creator's seed mailboxes
+func (s *SeedService) ListMailboxes(creatorID uuid.UUID) ([]models.SeedMailbox, error) {
+	var mailboxes []models.SeedMailbox
+	err := s.db.Where("creator_id = ?", creatorID).Order("created_at ASC").Find(&mailboxes).Error
+	return mailboxes, err
+}
+
+func (s *SeedService) getMailbox(id, creatorID uuid.UUID) (*models.SeedMailbox, error) {
+	var mailbox models.SeedMailbox
+	if err := s.db.Where("id = ? AND creator_id = ?", id, creatorID).First(&mailbox).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSeedMailboxNotFound
+		}
+		return nil, err
+	}
+	return &mailbox, nil
+}
+
+// CheckMailbox connects to a seed mailbox and reports the folders found
+func (s *SeedService) CheckMailbox(id, creatorID uuid.UUID) (*SeedMailboxCheck, error) {
+	mailbox, err := s.getMailbox(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := s.inspect(mailbox)
+	s.markChecked(mailbox, err)
+	if err != nil {
+		return nil, fmt.Errorf("could not read seed mailbox: %w", err)
+	}
+	return check, nil
+}
+
+// DeleteMailbox removes a seed mailbox and its placement history
+func (s *SeedService) DeleteMailbox(id, creatorID uuid.UUID) error {
+	result := s.db.Where("id = ? AND creator_id = ?", id, creatorID).Delete(&models.SeedMailbox{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSeedMailboxNotFound
+	}
+	return nil
+}
+
+// QueueCampaign records one pending placement per active seed mailbox of the
+// campaign's creator. The seeds are sent and polled by ProcessDue.
+func (s *SeedService) QueueCampaign(campaign *models.Campaign) error {
+	var mailboxes []models.SeedMailbox
+	if err := s.db.Where("creator_id = ? AND is_active = ?", campaign.CreatorID, true).Find(&mailboxes).Error; err != nil {
+		return err
+	}
+	if len(mailboxes) == 0 {
+		return nil
+	}
+
+	placements := make([]models.SeedPlacement, 0, len(mailboxes))
+	for _, mailbox := range mailboxes {
+		token, err := seedToken()
+		if err != nil {
+			return err
+		}
+		placements = append(placements, models.SeedPlacement{
+			CampaignID:    campaign.ID,
+			SeedMailboxID: mailbox.ID,
+			CreatorID:     campaign.CreatorID,
+			Email:         mailbox.Email,
+			Provider:      mailbox.Provider,
+			Token:         token,
+			Status:        models.SeedPlacementPending,
+		})
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&placements).Error
+}
+
+// GetCampaignPlacement returns the per provider placement and the result of
+// every seed for a campaign
+func (s *SeedService) GetCampaignPlacement(campaignID, creatorID uuid.UUID) (*CampaignPlacement, error) {
+	var count int64
+	s.db.Model(&models.Campaign{}).Where("id = ? AND creator_id = ?", campaignID, creatorID).Count(&count)
+	if count == 0 {
+		return nil, errors.New("campaign not found")
+	}
+
+	report := &CampaignPlacement{}
+	if err := s.db.Where("campaign_id = ?", campaignID).Order("provider ASC").Find(&report.Providers).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("campaign_id = ?", campaignID).Order("provider ASC, email ASC").Find(&report.Seeds).Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// SeedMailboxPayload is a poll_seed_mailbox job
+type SeedMailboxPayload struct {
+	MailboxID uuid.UUID `json:"mailboxId"`
+}
+
+// seedClaimKey names a seed mailbox in mailbox_claims
+func seedClaimKey(mailboxID uuid.UUID) string {
+	return "seed:" + mailboxID.String()
+}
+
+// EnqueueDue queues a poll_seed_mailbox job for each seed mailbox with seeds
+// to send or look for. A mailbox is claimed until its job is done, so only
+// one worker talks to it at a time.
+func (s *SeedService) EnqueueDue() {
+	var mailboxIDs []uuid.UUID
+	err := s.db.Model(&models.SeedPlacement{}).
+		Joins("JOIN campaigns ON campaigns.id = seed_placements.campaign_id").
+		Where("seed_placements.status = ?", models.SeedPlacementPending).
+		Where(`(seed_placements.sent_at IS NULL AND campaigns.status IN ?)
+			OR (seed_placements.sent_at IS NOT NULL AND (seed_placements.checked_at IS NULL OR seed_placements.checked_at <= ?))`,
+			[]models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusSent}, time.Now().Add(-seedPollInterval())).
+		Distinct().
+		Pluck("seed_placements.seed_mailbox_id", &mailboxIDs).Error
+	if err != nil {
+		log.Printf("[Seeds] Failed to find due seed mailboxes: %v", err)
+		return
+	}
+
+	for _, mailboxID := range mailboxIDs {
+		claimed, err := claimMailbox(s.db, seedClaimKey(mailboxID), seedClaimTimeout)
+		if err != nil {
+			log.Printf("[Seeds] Failed to claim seed mailbox %s: %v", mailboxID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if _, err := queue.Enqueue(queue.TypePollSeedMailbox, SeedMailboxPayload{MailboxID: mailboxID}); err != nil {
+			log.Printf("[Seeds] Failed to enqueue seed mailbox %s: %v", mailboxID, err)
+			releaseMailbox(s.db, seedClaimKey(mailboxID))
+		}
+	}
+}
+
+// ProcessMailbox sends a seed mailbox's queued seeds, then polls it for sent
+// ones that haven't been found yet and updates InboxPlacement for their
+// campaigns. It releases the mailbox's claim when done.
+func (s *SeedService) ProcessMailbox(ctx context.Context, mailboxID uuid.UUID) {
+	defer releaseMailbox(s.db, seedClaimKey(mailboxID))
+
+	var mailbox models.SeedMailbox
+	if err := s.db.First(&mailbox, "id = ?", mailboxID).Error; err != nil {
+		return
+	}
+
+	campaigns := make(map[uuid.UUID]bool)
+	s.sendQueued(ctx, &mailbox, campaigns)
+	if ctx.Err() == nil {
+		s.poll(&mailbox, campaigns)
+	}
+
+	for campaignID := range campaigns {
+		if err := s.recordPlacement(campaignID); err != nil {
+			log.Printf("[Seeds] Failed to record placement for campaign %s: %v", campaignID, err)
+		}
+	}
+}
+
+// sendQueued sends a seed mailbox its seeds of campaigns that have started
+// sending
+func (s *SeedService) sendQueued(ctx context.Context, mailbox *models.SeedMailbox, touched map[uuid.UUID]bool) {
+	var placements []models.SeedPlacement
+	err := s.db.Joins("JOIN campaigns ON campaigns.id = seed_placements.campaign_id").
+		Where("seed_placements.seed_mailbox_id = ?", mailbox.ID).
+		Where("seed_placements.status = ? AND seed_placements.sent_at IS NULL", models.SeedPlacementPending).
+		Where("campaigns.status IN ?", []models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusSent}).
+		Order("seed_placements.created_at ASC").
+		Limit(seedBatchSize).
+		Find(&placements).Error
+	if err != nil {
+		log.Printf("[Seeds] Failed to load queued seeds: %v", err)
+		return
+	}
+
+	campaigns := make(map[uuid.UUID]*models.Campaign)
+	for i := range placements {
+		if ctx.Err() != nil {
+			return
+		}
+		placement := &placements[i]
+		campaign, ok := campaigns[placement.CampaignID]
+		if !ok {
+			campaign = &models.Campaign{}
+			if err := s.db.First(campaign, "id = ?", placement.CampaignID).Error; err != nil {
+				continue
+			}
+			campaigns[placement.CampaignID] = campaign
+		}
+
+		updates := map[string]interface{}{}
+		if err := s.send(campaign, placement); err != nil {
+			log.Printf("[Seeds] Failed to send campaign %s to seed %s: %v", campaign.ID, placement.Email, err)
+			reason := err.Error()
+			updates["status"] = models.SeedPlacementFailed
+			updates["last_error"] = reason
+		} else {
+			updates["sent_at"] = time.Now()
+		}
+		s.db.Model(&models.SeedPlacement{}).Where("id = ?", placement.ID).Updates(updates)
+		touched[placement.CampaignID] = true
+	}
+}
+
+// send delivers the campaign to one seed the way it goes to subscribers,
+// with the seed token in a header
+func (s *SeedService) send(campaign *models.Campaign, placement *models.SeedPlacement) error {
+	seed := &models.Subscriber{Email: placement.Email, UnsubscribeToken: placement.Token}
+
+	htmlContent := campaign.Content
+	if campaign.HTMLContent != nil && *campaign.HTMLContent != "" {
+		rendered, err := s.mailer.RenderTemplate(*campaign.HTMLContent, seed, campaign)
+		if err == nil {
+			htmlContent = rendered
+		}
+	}
+
+	// The unsubscribe token doesn't match a subscriber; it is only there so
+	// seeds carry the same List-Unsubscribe headers as the real send
+	_, err := s.mailer.Send(&EmailRequest{
+		To: EmailRecipient{
+			Email:            placement.Email,
+			UnsubscribeToken: placement.Token,
+		},
+		Subject:     campaign.Subject,
+		HTMLContent: htmlContent,
+		TextContent: campaign.Content,
+		CampaignID:  campaign.ID.String(),
+		Class:       models.MessageClassBulk,
+		CreatorID:   &campaign.CreatorID,
+		Headers:     map[string]string{seedTokenHeader: placement.Token},
+	})
+	return err
+}
+
+// poll looks for a seed mailbox's sent seeds that are due a check, in one
+// IMAP session. Seeds not found within the poll window are marked missing.
+func (s *SeedService) poll(mailbox *models.SeedMailbox, touched map[uuid.UUID]bool) {
+	now := time.Now()
+
+	var placements []models.SeedPlacement
+	err := s.db.Where("seed_mailbox_id = ? AND status = ? AND sent_at IS NOT NULL", mailbox.ID, models.SeedPlacementPending).
+		Where("checked_at IS NULL OR checked_at <= ?", now.Add(-seedPollInterval())).
+		Order("sent_at ASC").
+		Find(&placements).Error
+	if err != nil {
+		log.Printf("[Seeds] Failed to load seeds to poll: %v", err)
+		return
+	}
+	if len(placements) == 0 {
+		return
+	}
+
+	pending := make([]*models.SeedPlacement, len(placements))
+	for i := range placements {
+		pending[i] = &placements[i]
+	}
+
+	results, err := s.locate(mailbox, pending)
+	s.markChecked(mailbox, err)
+	if err != nil {
+		log.Printf("[Seeds] Failed to poll seed %s: %v", mailbox.Email, err)
+	}
+
+	for _, placement := range pending {
+		updates := map[string]interface{}{
+			"checked_at": now,
+			"checks":     gorm.Expr("checks + 1"),
+		}
+		if found, ok := results[placement.ID]; ok {
+			updates["status"] = found.status
+			updates["folder"] = found.folder
+			updates["found_at"] = now
+			updates["last_error"] = nil
+		} else if placement.SentAt.Before(now.Add(-seedPollWindow())) {
+			updates["status"] = models.SeedPlacementMissing
+		}
+		if err != nil {
+			updates["last_error"] = err.Error()
+		}
+		s.db.Model(&models.SeedPlacement{}).Where("id = ?", placement.ID).Updates(updates)
+		touched[placement.CampaignID] = true
+	}
+}
+
+type seedLocation struct {
+	status models.SeedPlacementStatus
+	folder string
+}
+
+// seedFolders are the folders a seed mailbox is searched in
+type seedFolders struct {
+	inbox      string
+	spam       string
+	promotions string
+	all        []string
+	gmail      bool // X-GM-EXT-1: inbox messages can be checked for the promotions category
+}
+
+// locate searches a seed mailbox for the given placements' tokens. Spam is
+// checked first so a message filed in several places counts as spam.
+func (s *SeedService) locate(mailbox *models.SeedMailbox, placements []*models.SeedPlacement) (map[uuid.UUID]seedLocation, error) {
+	client, err := dialPublicIMAP(mailbox.IMAPHost, mailbox.IMAPPort, mailbox.IMAPTLS, seedSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	folders, err := s.folders(client, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[uuid.UUID]seedLocation)
+	search := func(folder string, status models.SeedPlacementStatus) error {
+		if folder == "" {
+			return nil
+		}
+		if err := client.Examine(folder); err != nil {
+			return err
+		}
+		for _, placement := range placements {
+			if _, ok := found[placement.ID]; ok {
+				continue
+			}
+			uids, err := client.SearchHeader(seedTokenHeader, placement.Token)
+			if err != nil {
+				return err
+			}
+			if len(uids) == 0 {
+				continue
+			}
+
+			location := seedLocation{status: status, folder: folder}
+			if status == models.SeedPlacementInbox && folders.gmail {
+				promoted, err := client.SearchHeader(seedTokenHeader, placement.Token, `X-GM-RAW "category:promotions"`)
+				if err == nil && len(promoted) > 0 {
+					location = seedLocation{status: models.SeedPlacementPromotions, folder: folder + " (Promotions)"}
+				}
+			}
+			found[placement.ID] = location
+		}
+		return nil
+	}
+
+	if err := search(folders.spam, models.SeedPlacementSpam); err != nil {
+		return found, err
+	}
+	if err := search(folders.promotions, models.SeedPlacementPromotions); err != nil {
+		return found, err
+	}
+	if err := search(folders.inbox, models.SeedPlacementInbox); err != nil {
+		return found, err
+	}
+
+	client.Logout()
+	return found, nil
+}
+
+// inspect logs in to a mailbox and reports the folders placement would use
+func (s *SeedService) inspect(mailbox *models.SeedMailbox) (*SeedMailboxCheck, error) {
+	client, err := dialPublicIMAP(mailbox.IMAPHost, mailbox.IMAPPort, mailbox.IMAPTLS, seedSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	folders, err := s.folders(client, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	client.Logout()
+
+	return &SeedMailboxCheck{
+		Mailbox:          mailbox,
+		Folders:          folders.all,
+		InboxFolder:      folders.inbox,
+		SpamFolder:       folders.spam,
+		PromotionsFolder: folders.promotions,
+		GmailCategories:  folders.gmail,
+	}, nil
+}
+
+// folders logs in and resolves the inbox, spam and promotions folders from
+// the mailbox's overrides or the server's folder list
+func (s *SeedService) folders(client *imapClient, mailbox *models.SeedMailbox) (*seedFolders, error) {
+	password, err := utils.DecryptSecret(mailbox.Password)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Login(mailbox.Username, password); err != nil {
+		return nil, err
+	}
+	// Mailboxes added before passwords were encrypted are sealed on first use
+	if mailbox.ID != uuid.Nil && !utils.IsEncryptedSecret(mailbox.Password) {
+		if sealed, err := utils.EncryptSecret(password); err == nil {
+			s.db.Model(&models.SeedMailbox{}).Where("id = ?", mailbox.ID).Update("password", sealed)
+		}
+	}
+	list, err := client.List()
+	if err != nil {
+		return nil, err
+	}
+
+	folders := &seedFolders{
+		inbox:      mailbox.InboxFolder,
+		spam:       mailbox.SpamFolder,
+		promotions: mailbox.PromotionsFolder,
+		gmail:      client.caps["X-GM-EXT-1"],
+	}
+	if folders.inbox == "" {
+		folders.inbox = "INBOX"
+	}
+
+	for _, folder := range list {
+		folders.all = append(folders.all, folder.Name)
+		if folder.HasAttribute(`\Noselect`) || folder.HasAttribute(`\NonExistent`) {
+			continue
+		}
+		name := strings.ToLower(folder.Name)
+		base := strings.ToLower(path.Base(strings.ReplaceAll(folder.Name, ".", "/")))
+
+		if mailbox.SpamFolder == "" && (folder.HasAttribute(`\Junk`) || (folders.spam == "" && slices.Contains(seedSpamFolders, base))) {
+			folders.spam = folder.Name
+		}
+		if folders.promotions == "" && (slices.Contains(seedPromotionsFolders, base) || slices.Contains(seedPromotionsFolders, name)) {
+			folders.promotions = folder.Name
+		}
+	}
+	return folders, nil
+}
+
+// markChecked records the outcome of the last IMAP session with a mailbox
+func (s *SeedService) markChecked(mailbox *models.SeedMailbox, err error) {
+	updates := map[string]interface{}{"last_checked_at": time.Now(), "last_error": nil}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	}
+	s.db.Model(&models.SeedMailbox{}).Where("id = ?", mailbox.ID).Updates(updates)
+}
+
+// recordPlacement writes the seed results for a campaign to InboxPlacement,
+// one row per mailbox provider. Measured results replace any estimate from
+// engagement. Seeds that failed to send are left out.
+func (s *SeedService) recordPlacement(campaignID uuid.UUID) error {
+	var rows []struct {
+		CreatorID  uuid.UUID
+		Provider   string
+		Sent       int
+		Inbox      int
+		Promotions int
+		Spam       int
+	}
+	err := s.db.Raw(`SELECT creator_id, provider,
+			COUNT(*) AS sent,
+			COUNT(*) FILTER (WHERE status IN ?) AS inbox,
+			COUNT(*) FILTER (WHERE status = ?) AS promotions,
+			COUNT(*) FILTER (WHERE status = ?) AS spam
+		FROM seed_placements
+		WHERE campaign_id = ? AND status <> ? AND sent_at IS NOT NULL
+		GROUP BY creator_id, provider`,
+		[]models.SeedPlacementStatus{models.SeedPlacementInbox, models.SeedPlacementPromotions},
+		models.SeedPlacementPromotions, models.SeedPlacementSpam,
+		campaignID, models.SeedPlacementFailed,
+	).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campaign_id = ? AND source <> ?", campaignID, InboxPlacementSeed).
+			Delete(&models.InboxPlacement{}).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			placement := models.InboxPlacement{
+				CreatorID:       row.CreatorID,
+				CampaignID:      campaignID,
+				Provider:        row.Provider,
+				Source:          InboxPlacementSeed,
+				TotalSent:       row.Sent,
+				InboxCount:      row.Inbox,
+				SpamCount:       row.Spam,
+				UnknownCount:    int(max(int64(row.Sent-row.Inbox-row.Spam), 0)),
+				PromotionsCount: row.Promotions,
+			}
+			if row.Sent > 0 {
+				placement.InboxRate = float64(row.Inbox) / float64(row.Sent) * 100
+			}
+
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "campaign_id"}, {Name: "provider"}},
+				DoUpdates: clause.AssignmentColumns([]string{"source", "total_sent", "inbox_count", "spam_count", "unknown_count", "promotions_count", "inbox_rate", "updated_at"}),
+			}).Create(&placement).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// seedToken returns a random token identifying one seed send
+func seedToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
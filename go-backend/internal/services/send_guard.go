@@ -0,0 +1,460 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+	"gorm.io/gorm"
+)
+
+var ErrSendingOnHold = errors.New("sending is on hold pending review")
+
+// SendAction is what the circuit breaker tells a campaign send to do next
+type SendAction string
+
+const (
+	SendActionContinue SendAction = "continue"
+	SendActionThrottle SendAction = "throttle"
+	SendActionPause    SendAction = "pause"
+)
+
+const (
+	holdReasonBounceRate    = "bounce_rate"
+	holdReasonComplaintRate = "complaint_rate"
+
+	// How long a platform-wide measurement is reused before querying again
+	platformCheckTTL = 30 * time.Second
+)
+
+// SendGuardLimits are the rates (percent) at which sending slows down or
+// pauses. Rates are only acted on once the window holds MinSample sends.
+type SendGuardLimits struct {
+	Window                 time.Duration
+	MinSample              int64
+	BounceThrottle         float64
+	BouncePause            float64
+	ComplaintThrottle      float64
+	ComplaintPause         float64
+	PlatformMinSample      int64
+	PlatformBouncePause    float64
+	PlatformComplaintPause float64
+}
+
+func loadSendGuardLimits() SendGuardLimits {
+	return SendGuardLimits{
+		Window:                 time.Duration(envInt("SEND_GUARD_WINDOW_MINUTES", 60)) * time.Minute,
+		MinSample:              int64(envInt("SEND_GUARD_MIN_SAMPLE", 200)),
+		BounceThrottle:         envFloat("SEND_GUARD_BOUNCE_THROTTLE", 5),
+		BouncePause:            envFloat("SEND_GUARD_BOUNCE_PAUSE", 10),
+		ComplaintThrottle:      envFloat("SEND_GUARD_COMPLAINT_THROTTLE", 0.1),
+		ComplaintPause:         envFloat("SEND_GUARD_COMPLAINT_PAUSE", 0.3),
+		PlatformMinSample:      int64(envInt("SEND_GUARD_PLATFORM_MIN_SAMPLE", 1000)),
+		PlatformBouncePause:    envFloat("SEND_GUARD_PLATFORM_BOUNCE_PAUSE", 5),
+		PlatformComplaintPause: envFloat("SEND_GUARD_PLATFORM_COMPLAINT_PAUSE", 0.2),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if f, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && f > 0 {
+		return f
+	}
+	return fallback
+}
+
+// sendWindow is the bounce and complaint counts over the sliding window
+type sendWindow struct {
+	Sent       int64
+	Bounces    int64
+	Complaints int64
+}
+
+func (w sendWindow) bounceRate() float64 {
+	if w.Sent == 0 {
+		return 0
+	}
+	return float64(w.Bounces) / float64(w.Sent) * 100
+}
+
+func (w sendWindow) complaintRate() float64 {
+	if w.Sent == 0 {
+		return 0
+	}
+	return float64(w.Complaints) / float64(w.Sent) * 100
+}
+
+// SendGuardService is the sending circuit breaker. It watches bounce and
+// complaint rates of in-flight campaigns, their creator and the platform,
+// throttles sends that are heading for trouble and pauses them once a limit
+// is crossed. Paused sends only resume when an admin releases the hold.
+type SendGuardService struct {
+	db       *gorm.DB
+	mailer   *MailerRegistry
+	webhooks *WebhookService
+	limits   SendGuardLimits
+
+	mu              sync.Mutex
+	platformChecked time.Time
+	platformTripped bool
+}
+
+func NewSendGuardService() *SendGuardService {
+	return &SendGuardService{
+		db:       database.GetDB(),
+		mailer:   NewMailerRegistry(),
+		webhooks: NewWebhookService(),
+		limits:   loadSendGuardLimits(),
+	}
+}
+
+// Check decides whether a campaign may keep sending. When a limit is crossed
+// the hold is recorded, affected campaigns are paused and creators notified.
+func (s *SendGuardService) Check(campaign *models.Campaign) SendAction {
+	if hold := s.ActiveHold(campaign.CreatorID, &campaign.ID); hold != nil {
+		s.pauseFor(hold)
+		return SendActionPause
+	}
+
+	if s.checkPlatform() {
+		return SendActionPause
+	}
+
+	limits := s.limits
+	campaignWindow := s.window(models.HoldScopeCampaign, campaign.CreatorID, &campaign.ID)
+	creatorWindow := s.window(models.HoldScopeCreator, campaign.CreatorID, nil)
+
+	for _, check := range []struct {
+		scope  models.HoldScope
+		window sendWindow
+	}{
+		{models.HoldScopeCampaign, campaignWindow},
+		{models.HoldScopeCreator, creatorWindow},
+	} {
+		if check.window.Sent < limits.MinSample {
+			continue
+		}
+		reason, limit := tripped(check.window, limits.BouncePause, limits.ComplaintPause)
+		if reason == "" {
+			continue
+		}
+
+		hold := &models.SendingHold{Scope: check.scope, CreatorID: &campaign.CreatorID}
+		if check.scope == models.HoldScopeCampaign {
+			hold.CampaignID = &campaign.ID
+		}
+		s.trip(hold, check.window, reason, limit)
+		return SendActionPause
+	}
+
+	for _, w := range []sendWindow{campaignWindow, creatorWindow} {
+		if w.Sent < limits.MinSample {
+			continue
+		}
+		if reason, _ := tripped(w, limits.BounceThrottle, limits.ComplaintThrottle); reason != "" {
+			return SendActionThrottle
+		}
+	}
+	return SendActionContinue
+}
+
+// tripped returns the first rate over its limit
+func tripped(w sendWindow, bounceLimit, complaintLimit float64) (string, float64) {
+	// Complaints are checked first: they do the most damage to reputation
+	if w.complaintRate() >= complaintLimit {
+		return holdReasonComplaintRate, complaintLimit
+	}
+	if w.bounceRate() >= bounceLimit {
+		return holdReasonBounceRate, bounceLimit
+	}
+	return "", 0
+}
+
+// checkPlatform trips the platform-wide hold when bulk sending as a whole
+// crosses the platform limits. The measurement is cached briefly because
+// every worker checks it before each batch.
+func (s *SendGuardService) checkPlatform() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.platformChecked) < platformCheckTTL {
+		return s.platformTripped
+	}
+	s.platformChecked = time.Now()
+	s.platformTripped = false
+
+	w := s.window(models.HoldScopePlatform, uuid.Nil, nil)
+	if w.Sent < s.limits.PlatformMinSample {
+		return false
+	}
+	reason, limit := tripped(w, s.limits.PlatformBouncePause, s.limits.PlatformComplaintPause)
+	if reason == "" {
+		return false
+	}
+
+	s.trip(&models.SendingHold{Scope: models.HoldScopePlatform}, w, reason, limit)
+	s.platformTripped = true
+	return true
+}
+
+// window counts sends, bounces and complaints in the sliding window for a
+// scope. It never reaches back past the last release of a hold on the same
+// scope, so a released send isn't tripped again by the events that paused it.
+func (s *SendGuardService) window(scope models.HoldScope, creatorID uuid.UUID, campaignID *uuid.UUID) sendWindow {
+	since := time.Now().Add(-s.limits.Window)
+
+	released := s.db.Model(&models.SendingHold{}).Where("scope = ? AND released_at IS NOT NULL", scope)
+	switch scope {
+	case models.HoldScopeCampaign:
+		released = released.Where("campaign_id = ?", *campaignID)
+	case models.HoldScopeCreator:
+		released = released.Where("creator_id = ?", creatorID)
+	}
+	var lastRelease struct{ ReleasedAt *time.Time }
+	released.Select("MAX(released_at) as released_at").Scan(&lastRelease)
+	if lastRelease.ReleasedAt != nil && lastRelease.ReleasedAt.After(since) {
+		since = *lastRelease.ReleasedAt
+	}
+
+	deliveries := s.db.Model(&models.CampaignDelivery{}).
+		Where("campaign_deliveries.status = ? AND campaign_deliveries.sent_at >= ?", models.DeliveryStatusSent, since)
+	events := s.db.Model(&models.EmailEvent{}).
+		Where("email_events.created_at >= ?", since)
+	switch scope {
+	case models.HoldScopeCampaign:
+		deliveries = deliveries.Where("campaign_deliveries.campaign_id = ?", *campaignID)
+		events = events.Where("email_events.campaign_id = ?", *campaignID)
+	case models.HoldScopeCreator:
+		deliveries = deliveries.Joins("JOIN campaigns ON campaigns.id = campaign_deliveries.campaign_id").
+			Where("campaigns.creator_id = ?", creatorID)
+		events = events.Joins("JOIN campaigns ON campaigns.id = email_events.campaign_id").
+			Where("campaigns.creator_id = ?", creatorID)
+	}
+
+	var w sendWindow
+	deliveries.Count(&w.Sent)
+
+	var counts []struct {
+		EventType models.EmailEventType
+		Total     int64
+	}
+	events.Select("email_events.event_type, COUNT(DISTINCT email_events.subscriber_id) as total").
+		Where("email_events.event_type IN ?", []models.EmailEventType{models.EmailEventBounce, models.EmailEventComplaint}).
+		Group("email_events.event_type").
+		Scan(&counts)
+	for _, c := range counts {
+		if c.EventType == models.EmailEventBounce {
+			w.Bounces = c.Total
+		} else {
+			w.Complaints = c.Total
+		}
+	}
+	return w
+}
+
+// trip records a new hold and pauses what it covers
+func (s *SendGuardService) trip(hold *models.SendingHold, w sendWindow, reason string, limit float64) {
+	hold.Status = models.HoldStatusActive
+	hold.Reason = reason
+	hold.Sent = w.Sent
+	hold.Bounces = w.Bounces
+	hold.Complaints = w.Complaints
+	hold.BounceRate = w.bounceRate()
+	hold.ComplaintRate = w.complaintRate()
+	hold.Limit = limit
+
+	if err := s.db.Create(hold).Error; err != nil {
+		log.Printf("[SendGuard] Failed to record %s hold: %v", hold.Scope, err)
+	}
+	log.Printf("[SendGuard] %s hold: bounce rate %.2f%%, complaint rate %.2f%% over %d sends crossed the %s limit of %.2f%%",
+		hold.Scope, hold.BounceRate, hold.ComplaintRate, w.Sent, reason, limit)
+
+	s.pauseFor(hold)
+}
+
+// pauseFor pauses every sending campaign covered by a hold and notifies the
+// creators whose campaigns were stopped
+func (s *SendGuardService) pauseFor(hold *models.SendingHold) {
+	query := s.db.Where("status = ?", models.CampaignStatusSending)
+	switch hold.Scope {
+	case models.HoldScopeCampaign:
+		query = query.Where("id = ?", *hold.CampaignID)
+	case models.HoldScopeCreator:
+		query = query.Where("creator_id = ?", *hold.CreatorID)
+	}
+
+	var campaigns []models.Campaign
+	query.Find(&campaigns)
+
+	for i := range campaigns {
+		campaign := &campaigns[i]
+		result := s.db.Model(&models.Campaign{}).
+			Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusSending).
+			Update("status", models.CampaignStatusPaused)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		s.notify(campaign, hold)
+	}
+}
+
+func (s *SendGuardService) notify(campaign *models.Campaign, hold *models.SendingHold) {
+	s.webhooks.TriggerEvent(campaign.CreatorID, models.WebhookEventCampaignPaused, map[string]interface{}{
+		"campaignId":    campaign.ID,
+		"holdId":        hold.ID,
+		"scope":         hold.Scope,
+		"reason":        hold.Reason,
+		"bounceRate":    hold.BounceRate,
+		"complaintRate": hold.ComplaintRate,
+	})
+
+	var creator models.User
+	if err := s.db.Select("id", "email", "first_name").First(&creator, "id = ?", campaign.CreatorID).Error; err != nil {
+		return
+	}
+	if err := s.mailer.SendCampaignPausedEmail(&creator, campaign, hold); err != nil {
+		log.Printf("[SendGuard] Failed to notify creator %s: %v", creator.ID, err)
+	}
+}
+
+// ActiveHold returns an active hold that blocks the creator's campaign, the
+// creator or the whole platform. Pass a nil campaignID to ignore campaign holds.
+func (s *SendGuardService) ActiveHold(creatorID uuid.UUID, campaignID *uuid.UUID) *models.SendingHold {
+	query := s.db.Where("status = ?", models.HoldStatusActive)
+	if campaignID != nil {
+		query = query.Where("scope = ? OR (scope = ? AND creator_id = ?) OR (scope = ? AND campaign_id = ?)",
+			models.HoldScopePlatform, models.HoldScopeCreator, creatorID, models.HoldScopeCampaign, *campaignID)
+	} else {
+		query = query.Where("scope = ? OR (scope = ? AND creator_id = ?)",
+			models.HoldScopePlatform, models.HoldScopeCreator, creatorID)
+	}
+
+	var hold models.SendingHold
+	if err := query.Order("created_at ASC").First(&hold).Error; err != nil {
+		return nil
+	}
+	return &hold
+}
+
+// HoldFilter narrows the hold list for admins
+type HoldFilter struct {
+	Status    *models.HoldStatus
+	CreatorID *uuid.UUID
+	Page      int
+	PageSize  int
+}
+
+// ListHolds returns sending holds, newest first
+func (s *SendGuardService) ListHolds(filter *HoldFilter) ([]models.SendingHold, int64, error) {
+	query := s.db.Model(&models.SendingHold{})
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.CreatorID != nil {
+		query = query.Where("creator_id = ?", *filter.CreatorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var holds []models.SendingHold
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&holds).Error
+	return holds, total, err
+}
+
+// ReleaseHoldRequest is an admin's review of a hold
+type ReleaseHoldRequest struct {
+	Note string `json:"note" binding:"required"`
+}
+
+// Release ends a hold after admin review and resumes the campaigns it paused,
+// unless another active hold still covers them
+func (s *SendGuardService) Release(id uuid.UUID, adminID uuid.UUID, req *ReleaseHoldRequest) (*models.SendingHold, error) {
+	var hold models.SendingHold
+	if err := s.db.First(&hold, "id = ?", id).Error; err != nil {
+		return nil, errors.New("hold not found")
+	}
+	if hold.Status != models.HoldStatusActive {
+		return nil, errors.New("hold already released")
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.SendingHold{}).
+		Where("id = ? AND status = ?", hold.ID, models.HoldStatusActive).
+		Updates(map[string]interface{}{
+			"status":       models.HoldStatusReleased,
+			"released_by":  adminID,
+			"released_at":  now,
+			"release_note": req.Note,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("hold already released")
+	}
+	hold.Status = models.HoldStatusReleased
+	hold.ReleasedBy = &adminID
+	hold.ReleasedAt = &now
+	hold.ReleaseNote = &req.Note
+
+	if hold.Scope == models.HoldScopePlatform {
+		s.mu.Lock()
+		s.platformChecked = time.Time{}
+		s.mu.Unlock()
+	}
+
+	s.resume(&hold)
+	return &hold, nil
+}
+
+// resume restarts paused campaigns covered by a released hold
+func (s *SendGuardService) resume(hold *models.SendingHold) {
+	query := s.db.Where("status = ?", models.CampaignStatusPaused)
+	switch hold.Scope {
+	case models.HoldScopeCampaign:
+		query = query.Where("id = ?", *hold.CampaignID)
+	case models.HoldScopeCreator:
+		query = query.Where("creator_id = ?", *hold.CreatorID)
+	}
+
+	var campaigns []models.Campaign
+	query.Find(&campaigns)
+
+	for _, campaign := range campaigns {
+		if other := s.ActiveHold(campaign.CreatorID, &campaign.ID); other != nil {
+			continue
+		}
+
+		result := s.db.Model(&models.Campaign{}).
+			Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusPaused).
+			Update("status", models.CampaignStatusSending)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		if _, err := queue.Enqueue(queue.TypeSendCampaign, SendCampaignPayload{CampaignID: campaign.ID}); err != nil {
+			// The resume sweep picks the campaign up on the next worker tick
+			log.Printf("[SendGuard] Failed to enqueue campaign %s: %v", campaign.ID, err)
+		}
+	}
+
+	log.Printf("[SendGuard] %s hold %s released", hold.Scope, hold.ID)
+}
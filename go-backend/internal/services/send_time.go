@@ -0,0 +1,311 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	hoursPerDay = 24
+
+	// Opens cluster around early afternoon in the reader's own day; how far
+	// the UTC centre of their opens sits from it gives their timezone
+	assumedLocalOpenHour = 13.0
+
+	// Opens spread evenly around the clock say nothing about the timezone
+	minOffsetConcentration = 0.3
+	minOffsetOpens         = 3
+)
+
+// openHourSQL is the UTC hour an email event happened in
+const openHourSQL = "EXTRACT(HOUR FROM email_events.created_at AT TIME ZONE 'UTC')::int"
+
+// sendTimeMinOpens is how many opens a subscriber needs before their own
+// best hour is trusted over the creator's
+func sendTimeMinOpens() int {
+	return envInt("SEND_TIME_MIN_OPENS", 5)
+}
+
+// sendTimeCreatorMinOpens is how many opens a creator needs for a fallback
+func sendTimeCreatorMinOpens() int {
+	return envInt("SEND_TIME_CREATOR_MIN_OPENS", 50)
+}
+
+// sendTimeSince bounds the open history profiles are built from
+func sendTimeSince() time.Time {
+	return time.Now().AddDate(0, 0, -envInt("SEND_TIME_HISTORY_DAYS", 180))
+}
+
+// SendTimeService learns when subscribers open mail and times optimized
+// campaign sends to match
+type SendTimeService struct {
+	db *gorm.DB
+}
+
+func NewSendTimeService() *SendTimeService {
+	return &SendTimeService{
+		db: database.GetDB(),
+	}
+}
+
+// CreatorSendTime is a creator's open pattern, used for subscribers without
+// enough opens of their own
+type CreatorSendTime struct {
+	OpenHours     []int `json:"openHours"`  // opens per UTC hour
+	LocalHours    []int `json:"localHours"` // opens per hour in each subscriber's inferred timezone
+	Opens         int   `json:"opens"`
+	BestHour      *int  `json:"bestHour,omitempty"`      // UTC
+	BestLocalHour *int  `json:"bestLocalHour,omitempty"` // local to each subscriber
+	Profiled      int64 `json:"profiled"`                // subscribers with a best hour of their own
+}
+
+type hourCount struct {
+	Hour  int
+	Opens int
+}
+
+// bestHour is the peak of an hourly histogram, smoothed over neighbouring
+// hours so one stray open doesn't decide it
+func bestHour(hours []int) int {
+	best, bestScore := 0, -1
+	for h := 0; h < hoursPerDay; h++ {
+		score := 2*hours[h] + hours[(h+hoursPerDay-1)%hoursPerDay] + hours[(h+1)%hoursPerDay]
+		if score > bestScore {
+			best, bestScore = h, score
+		}
+	}
+	return best
+}
+
+// inferUTCOffset estimates a timezone, in whole hours east of UTC, from the
+// circular mean of the UTC hours someone opens mail at
+func inferUTCOffset(hours []int) (int, bool) {
+	var x, y, total float64
+	for h, count := range hours {
+		angle := 2 * math.Pi * float64(h) / hoursPerDay
+		x += float64(count) * math.Cos(angle)
+		y += float64(count) * math.Sin(angle)
+		total += float64(count)
+	}
+	if total == 0 || math.Hypot(x, y)/total < minOffsetConcentration {
+		return 0, false
+	}
+
+	mean := math.Atan2(y, x) * hoursPerDay / (2 * math.Pi)
+	offset := int(math.Round(assumedLocalOpenHour - mean))
+	for offset > 12 {
+		offset -= hoursPerDay
+	}
+	for offset <= -12 {
+		offset += hoursPerDay
+	}
+	return offset, true
+}
+
+// summarize recomputes a profile's best hour and timezone from its histogram
+func summarize(profile *models.SubscriberSendProfile) {
+	profile.BestHour, profile.UTCOffset = nil, nil
+	if profile.Opens >= sendTimeMinOpens() {
+		hour := bestHour(profile.OpenHours)
+		profile.BestHour = &hour
+	}
+	if profile.Opens >= minOffsetOpens {
+		if offset, ok := inferUTCOffset(profile.OpenHours); ok {
+			profile.UTCOffset = &offset
+		}
+	}
+}
+
+// RecordOpen adds a human open to the subscriber's profile. A subscriber's
+// first profile is built from their open history, which already includes
+// this open.
+func (s *SendTimeService) RecordOpen(subscriberID, creatorID uuid.UUID, at time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var profile models.SubscriberSendProfile
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&profile, "subscriber_id = ?", subscriberID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var rows []hourCount
+			if err := tx.Raw(`SELECT `+openHourSQL+` AS hour, COUNT(*) AS opens FROM email_events
+				WHERE subscriber_id = ? AND event_type = ? AND is_machine = false AND created_at > ?
+				GROUP BY hour`,
+				subscriberID, models.EmailEventOpen, sendTimeSince(),
+			).Scan(&rows).Error; err != nil {
+				return err
+			}
+
+			profile = models.SubscriberSendProfile{SubscriberID: subscriberID, CreatorID: creatorID, OpenHours: make([]int, hoursPerDay)}
+			for _, row := range rows {
+				profile.OpenHours[row.Hour] += row.Opens
+				profile.Opens += row.Opens
+			}
+			profile.LastOpenAt = &at
+			summarize(&profile)
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&profile).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(profile.OpenHours) != hoursPerDay {
+			profile.OpenHours = make([]int, hoursPerDay)
+		}
+		profile.OpenHours[at.UTC().Hour()]++
+		profile.Opens++
+		profile.LastOpenAt = &at
+		summarize(&profile)
+		return tx.Save(&profile).Error
+	})
+}
+
+// backfill builds profiles for a campaign's recipients who have opened mail
+// before but have no profile yet
+func (s *SendTimeService) backfill(campaign *models.Campaign) error {
+	var rows []struct {
+		SubscriberID uuid.UUID
+		Hour         int
+		Opens        int
+		LastOpenAt   time.Time
+	}
+	err := s.db.Raw(`SELECT email_events.subscriber_id, `+openHourSQL+` AS hour, COUNT(*) AS opens, MAX(email_events.created_at) AS last_open_at
+		FROM email_events
+		JOIN campaign_deliveries ON campaign_deliveries.subscriber_id = email_events.subscriber_id AND campaign_deliveries.campaign_id = ?
+		LEFT JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = email_events.subscriber_id
+		WHERE subscriber_send_profiles.subscriber_id IS NULL
+			AND email_events.event_type = ? AND email_events.is_machine = false AND email_events.created_at > ?
+		GROUP BY email_events.subscriber_id, hour`,
+		campaign.ID, models.EmailEventOpen, sendTimeSince(),
+	).Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	profiles := make(map[uuid.UUID]*models.SubscriberSendProfile)
+	for _, row := range rows {
+		profile, ok := profiles[row.SubscriberID]
+		if !ok {
+			profile = &models.SubscriberSendProfile{SubscriberID: row.SubscriberID, CreatorID: campaign.CreatorID, OpenHours: make([]int, hoursPerDay)}
+			profiles[row.SubscriberID] = profile
+		}
+		profile.OpenHours[row.Hour] += row.Opens
+		profile.Opens += row.Opens
+		if profile.LastOpenAt == nil || row.LastOpenAt.After(*profile.LastOpenAt) {
+			last := row.LastOpenAt
+			profile.LastOpenAt = &last
+		}
+	}
+
+	batch := make([]*models.SubscriberSendProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		summarize(profile)
+		batch = append(batch, profile)
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(batch, 500).Error
+}
+
+// CreatorProfile returns a creator's open pattern over the history window
+func (s *SendTimeService) CreatorProfile(creatorID uuid.UUID) (*CreatorSendTime, error) {
+	result := &CreatorSendTime{OpenHours: make([]int, hoursPerDay), LocalHours: make([]int, hoursPerDay)}
+	since := sendTimeSince()
+
+	var utc []hourCount
+	if err := s.db.Raw(`SELECT `+openHourSQL+` AS hour, COUNT(*) AS opens
+		FROM email_events JOIN campaigns ON campaigns.id = email_events.campaign_id
+		WHERE campaigns.creator_id = ? AND email_events.event_type = ? AND email_events.is_machine = false AND email_events.created_at > ?
+		GROUP BY hour`,
+		creatorID, models.EmailEventOpen, since,
+	).Scan(&utc).Error; err != nil {
+		return nil, err
+	}
+
+	var local []hourCount
+	if err := s.db.Raw(`SELECT (`+openHourSQL+` + subscriber_send_profiles.utc_offset + 24) % 24 AS hour, COUNT(*) AS opens
+		FROM email_events
+		JOIN campaigns ON campaigns.id = email_events.campaign_id
+		JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = email_events.subscriber_id
+		WHERE campaigns.creator_id = ? AND email_events.event_type = ? AND email_events.is_machine = false AND email_events.created_at > ?
+			AND subscriber_send_profiles.utc_offset IS NOT NULL
+		GROUP BY hour`,
+		creatorID, models.EmailEventOpen, since,
+	).Scan(&local).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range utc {
+		result.OpenHours[row.Hour] += row.Opens
+		result.Opens += row.Opens
+	}
+	localOpens := 0
+	for _, row := range local {
+		result.LocalHours[row.Hour] += row.Opens
+		localOpens += row.Opens
+	}
+
+	if result.Opens >= sendTimeCreatorMinOpens() {
+		hour := bestHour(result.OpenHours)
+		result.BestHour = &hour
+	}
+	if localOpens >= sendTimeCreatorMinOpens() {
+		hour := bestHour(result.LocalHours)
+		result.BestLocalHour = &hour
+	}
+
+	s.db.Model(&models.SubscriberSendProfile{}).
+		Where("creator_id = ? AND best_hour IS NOT NULL", creatorID).
+		Count(&result.Profiled)
+	return result, nil
+}
+
+// Plan holds each pending delivery of a campaign until its subscriber's best
+// hour within the 24 hours from start. Subscribers without enough opens get
+// the creator's best local hour in their inferred timezone, then the
+// creator's best UTC hour; anyone left is sent right away. Deliveries due in
+// the same hour are spread across it.
+func (s *SendTimeService) Plan(campaign *models.Campaign, start time.Time) error {
+	if err := s.backfill(campaign); err != nil {
+		log.Printf("[SendTime] Failed to build profiles for campaign %s: %v", campaign.ID, err)
+	}
+
+	creator, err := s.CreatorProfile(campaign.CreatorID)
+	if err != nil {
+		return err
+	}
+
+	start = start.UTC()
+	base := start.Truncate(time.Hour)
+	result := s.db.Exec(`UPDATE campaign_deliveries
+		SET not_before = GREATEST(?::timestamptz, ?::timestamptz + (plan.offset_hours + plan.slot) * INTERVAL '1 hour'), updated_at = NOW()
+		FROM (
+			SELECT timed.id, timed.offset_hours,
+				(ROW_NUMBER() OVER (PARTITION BY timed.offset_hours ORDER BY timed.id) - 1)::float
+					/ COUNT(*) OVER (PARTITION BY timed.offset_hours) AS slot
+			FROM (
+				SELECT campaign_deliveries.id,
+					(COALESCE(
+						subscriber_send_profiles.best_hour,
+						(?::int - subscriber_send_profiles.utc_offset + 48) % 24,
+						?::int
+					) - ?::int + 24) % 24 AS offset_hours
+				FROM campaign_deliveries
+				LEFT JOIN subscriber_send_profiles ON subscriber_send_profiles.subscriber_id = campaign_deliveries.subscriber_id
+				WHERE campaign_deliveries.campaign_id = ? AND campaign_deliveries.status = ?
+			) timed
+			WHERE timed.offset_hours IS NOT NULL
+		) plan
+		WHERE campaign_deliveries.id = plan.id`,
+		start, base, creator.BestLocalHour, creator.BestHour, start.Hour(), campaign.ID, models.DeliveryStatusPending,
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	log.Printf("[SendTime] Timed %d deliveries of campaign %s to subscribers' best hours", result.RowsAffected, campaign.ID)
+	return nil
+}
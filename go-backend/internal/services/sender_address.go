@@ -0,0 +1,113 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// defaultSenderLocalPart is used on a verified domain when the creator's own
+// sender address is on another domain
+const defaultSenderLocalPart = "newsletter"
+
+// senderAddress picks the From address for a creator's mail: their sender
+// address when its domain is verified, otherwise the same local part at their
+// first verified domain. Empty means the provider's default From.
+func senderAddress(senderEmail string, verified []string) string {
+	if len(verified) == 0 {
+		return ""
+	}
+	domain := emailDomain(senderEmail)
+	for _, d := range verified {
+		if strings.EqualFold(d, domain) {
+			return senderEmail
+		}
+	}
+
+	local, _, ok := strings.Cut(senderEmail, "@")
+	if !ok || local == "" {
+		local = defaultSenderLocalPart
+	}
+	return local + "@" + verified[0]
+}
+
+// CreatorFromEmail looks up the From address for a creator's mail
+func CreatorFromEmail(creatorID uuid.UUID) (string, error) {
+	db := database.GetDB()
+
+	var user models.User
+	if err := db.Select("id, sender_email").First(&user, "id = ?", creatorID).Error; err != nil {
+		return "", err
+	}
+
+	var verified []string
+	err := db.Model(&models.SenderDomain{}).
+		Where("creator_id = ? AND status = ?", creatorID, models.SenderDomainVerified).
+		Order("verified_at ASC").
+		Pluck("domain", &verified).Error
+	if err != nil {
+		return "", err
+	}
+
+	senderEmail := ""
+	if user.SenderEmail != nil {
+		senderEmail = strings.TrimSpace(*user.SenderEmail)
+	}
+	return senderAddress(senderEmail, verified), nil
+}
+
+// creatorSendingDomain is the domain a creator's mail goes out from, empty for
+// the platform's shared domain. It follows the From address the mailer uses,
+// so warm-up caps the domain receivers actually see.
+func creatorSendingDomain(creatorID uuid.UUID) (string, error) {
+	fromEmail, err := cachedCreatorFromEmail(creatorID)
+	if err != nil || fromEmail == "" {
+		return "", err
+	}
+	return emailDomain(fromEmail), nil
+}
+
+type cachedSender struct {
+	fromEmail string
+	expiresAt time.Time
+}
+
+var (
+	senderCache   = make(map[uuid.UUID]cachedSender)
+	senderCacheMu sync.Mutex
+)
+
+const senderCacheTTL = 5 * time.Minute
+
+// cachedCreatorFromEmail looks up a creator's From address, caching results
+// briefly so a campaign batch doesn't query it per recipient
+func cachedCreatorFromEmail(creatorID uuid.UUID) (string, error) {
+	senderCacheMu.Lock()
+	entry, ok := senderCache[creatorID]
+	senderCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.fromEmail, nil
+	}
+
+	fromEmail, err := CreatorFromEmail(creatorID)
+	if err != nil {
+		return "", err
+	}
+
+	senderCacheMu.Lock()
+	senderCache[creatorID] = cachedSender{fromEmail: fromEmail, expiresAt: time.Now().Add(senderCacheTTL)}
+	senderCacheMu.Unlock()
+	return fromEmail, nil
+}
+
+// invalidateCreatorFromEmail drops a cached From address after the creator's
+// sender domains change
+func invalidateCreatorFromEmail(creatorID uuid.UUID) {
+	senderCacheMu.Lock()
+	delete(senderCache, creatorID)
+	senderCacheMu.Unlock()
+}
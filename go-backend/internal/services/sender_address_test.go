@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+func TestSenderAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		senderEmail string
+		verified    []string
+		want        string
+	}{
+		{name: "no verified domain", senderEmail: "editor@creator.example", want: ""},
+		{name: "sender on a verified domain", senderEmail: "editor@creator.example", verified: []string{"creator.example"}, want: "editor@creator.example"},
+		{name: "domain case differs", senderEmail: "editor@Creator.Example", verified: []string{"creator.example"}, want: "editor@Creator.Example"},
+		{name: "sender on a second verified domain", senderEmail: "editor@news.creator.example", verified: []string{"creator.example", "news.creator.example"}, want: "editor@news.creator.example"},
+		{name: "sender on an unverified domain", senderEmail: "editor@gmail.com", verified: []string{"creator.example"}, want: "editor@creator.example"},
+		{name: "no sender address", verified: []string{"creator.example"}, want: "newsletter@creator.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := senderAddress(tt.senderEmail, tt.verified); got != tt.want {
+				t.Errorf("senderAddress(%q, %q) = %q, want %q", tt.senderEmail, tt.verified, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMailerRegistrySendsFromVerifiedDomain(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "")
+
+	keyPEM, err := GenerateDKIMKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creatorKey, err := NewDKIMSigner("creator.example", "pulse202610", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	platformKey, err := NewDKIMSigner("example.com", "nl1", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := newSMTPSink(t, "")
+	smtp := sink.service()
+	defer smtp.Close()
+	smtp.SetSignerLookup(func(domain string) (*DKIMSigner, error) {
+		switch domain {
+		case "creator.example":
+			return creatorKey, nil
+		case "example.com":
+			return platformKey, nil
+		}
+		return nil, nil
+	})
+
+	creatorID := uuid.New()
+	registry := &MailerRegistry{
+		providers:    map[string]Mailer{},
+		suppressions: &SuppressionService{},
+		defaults: map[models.MessageClass]mailRoute{
+			models.MessageClassBulk:          {primary: smtp.Name()},
+			models.MessageClassTransactional: {primary: smtp.Name()},
+		},
+		fromEmailFor: func(id uuid.UUID) (string, error) {
+			if id == creatorID {
+				return "editor@creator.example", nil
+			}
+			return "", nil
+		},
+	}
+	registry.Register(smtp)
+
+	campaignID := uuid.New().String()
+	if _, err := registry.Send(&EmailRequest{
+		To:          EmailRecipient{Email: "reader@example.org"},
+		Subject:     "This week",
+		TextContent: "Hello",
+		CampaignID:  campaignID,
+		Class:       models.MessageClassBulk,
+		CreatorID:   &creatorID,
+	}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	// Platform mail keeps the default From and key
+	if _, err := registry.Send(&EmailRequest{
+		To:          EmailRecipient{Email: "creator@example.org"},
+		Subject:     "Your payout",
+		TextContent: "Hello",
+	}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := sink.received()
+	if len(messages) != 2 {
+		t.Fatalf("sink received %d messages, want 2", len(messages))
+	}
+
+	campaign := messages[0]
+	if campaign.from != "editor@creator.example" {
+		t.Errorf("campaign envelope sender = %q, want the creator's address", campaign.from)
+	}
+	if !bytes.Contains(campaign.data, []byte("<editor@creator.example>")) {
+		t.Error("campaign From header is not the creator's address")
+	}
+	if err := verifyDKIM(campaign.data, "creator.example", "pulse202610", &creatorKey.key.PublicKey); err != nil {
+		t.Errorf("campaign is not signed with d=creator.example: %v", err)
+	}
+
+	platform := messages[1]
+	if platform.from != "news@example.com" {
+		t.Errorf("platform envelope sender = %q, want the default From", platform.from)
+	}
+	if err := verifyDKIM(platform.data, "example.com", "nl1", &platformKey.key.PublicKey); err != nil {
+		t.Errorf("platform mail is not signed with d=example.com: %v", err)
+	}
+}
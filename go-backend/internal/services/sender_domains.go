@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	dkimKeyBits     = 2048
+	dnsCheckTimeout = 15 * time.Second
+
+	// Newly added domains are checked hourly while the creator sets up DNS
+	pendingRecheckInterval = time.Hour
+	pendingRecheckFor      = 72 * time.Hour
+	recheckBatchSize       = 20
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+var (
+	ErrSenderDomainExists  = errors.New("domain is already registered")
+	ErrSenderDomainClaimed = errors.New("domain is already verified by another account")
+)
+
+// SenderDomainService manages the domains creators send from: their DKIM
+// keys, the DNS records to publish and periodic SPF/DKIM/DMARC checks
+type SenderDomainService struct {
+	db             *gorm.DB
+	resolver       DNSResolver
+	deliverability *DeliverabilityService
+	mailer         *MailerRegistry
+	webhooks       *WebhookService
+}
+
+func NewSenderDomainService() *SenderDomainService {
+	return NewSenderDomainServiceWithResolver(net.DefaultResolver)
+}
+
+// NewSenderDomainServiceWithResolver checks DNS through the given resolver
+func NewSenderDomainServiceWithResolver(resolver DNSResolver) *SenderDomainService {
+	return &SenderDomainService{
+		db:             database.GetDB(),
+		resolver:       resolver,
+		deliverability: NewDeliverabilityService(),
+		mailer:         NewMailerRegistry(),
+		webhooks:       NewWebhookService(),
+	}
+}
+
+// spfIncludes are the includes a sender domain's SPF record must reach,
+// from the comma separated SPF_INCLUDES
+func spfIncludes() []string {
+	var includes []string
+	for _, include := range strings.Split(getEnvOr("SPF_INCLUDES", "sendgrid.net"), ",") {
+		if include = strings.ToLower(strings.TrimSpace(include)); include != "" {
+			includes = append(includes, include)
+		}
+	}
+	return includes
+}
+
+// dmarcReportAddress is where aggregate DMARC reports for a domain are sent
+func dmarcReportAddress(domain string) string {
+	if address := os.Getenv("DMARC_REPORT_EMAIL"); address != "" {
+		return address
+	}
+	return "dmarc-reports@" + domain
+}
+
+// DNSConfigGuide returns the DNS records needed for a domain
+type DNSConfigGuide struct {
+	Domain string                `json:"domain"`
+	SPF    DNSRecordGuide        `json:"spf"`
+	DKIM   DNSRecordGuide        `json:"dkim"`
+	DMARC  DNSRecordGuide        `json:"dmarc"`
+	Status DNSVerificationStatus `json:"status"`
+}
+
+// DNSRecordGuide contains the recommended DNS record
+type DNSRecordGuide struct {
+	RecordType   string `json:"recordType"`
+	Host         string `json:"host"`
+	Value        string `json:"value"`
+	TTL          int    `json:"ttl"`
+	IsVerified   bool   `json:"isVerified"`
+	Instructions string `json:"instructions"`
+}
+
+// DNSVerificationStatus overall verification status
+type DNSVerificationStatus struct {
+	AllVerified   bool       `json:"allVerified"`
+	SPFVerified   bool       `json:"spfVerified"`
+	DKIMVerified  bool       `json:"dkimVerified"`
+	DMARCVerified bool       `json:"dmarcVerified"`
+	LastChecked   *time.Time `json:"lastChecked,omitempty"`
+}
+
+// DomainVerification is the outcome of checking a sender domain
+type DomainVerification struct {
+	Domain *models.SenderDomain `json:"domain"`
+	SPF    *SPFCheck            `json:"spf"`
+	DKIM   *DKIMCheck           `json:"dkim"`
+	DMARC  *DMARCCheck          `json:"dmarc"`
+}
+
+type AddSenderDomainRequest struct {
+	Domain string `json:"domain" binding:"required,max=253"`
+}
+
+// Add registers a sender domain for a creator, generates its DKIM key and
+// records the SPF, DKIM and DMARC values the creator has to publish
+func (s *SenderDomainService) Add(creatorID uuid.UUID, req *AddSenderDomainRequest) (*models.SenderDomain, error) {
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Domain)), ".")
+	if !domainPattern.MatchString(domain) {
+		return nil, errors.New("invalid domain")
+	}
+
+	privateKey, err := GenerateDKIMKey(dkimKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	selector := "pulse" + time.Now().UTC().Format("200601")
+
+	spf := "v=spf1"
+	for _, include := range spfIncludes() {
+		spf += " include:" + include
+	}
+	spf += " ~all"
+
+	senderDomain := &models.SenderDomain{
+		CreatorID:    creatorID,
+		Domain:       domain,
+		Status:       models.SenderDomainPending,
+		DKIMSelector: selector,
+	}
+
+	// The claim is inserted first so the unique index settles concurrent
+	// adds; its key and records only exist once the claim does
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(senderDomain)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSenderDomainExists
+		}
+
+		if _, err := s.deliverability.configureDKIMKey(tx, &creatorID, &ConfigureDKIMKeyRequest{
+			Domain:     domain,
+			Selector:   selector,
+			PrivateKey: privateKey,
+		}); err != nil {
+			return err
+		}
+
+		if err := saveRecord(tx, creatorID, domain, "SPF", "@", spf); err != nil {
+			return err
+		}
+		return saveRecord(tx, creatorID, domain, "DMARC", "_dmarc",
+			fmt.Sprintf("v=DMARC1; p=none; rua=mailto:%s; adkim=r; aspf=r", dmarcReportAddress(domain)))
+	})
+	if errors.Is(err, ErrSenderDomainExists) || errors.Is(err, ErrSenderDomainClaimed) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("[SenderDomain] Failed to add %s for creator %s: %v", domain, creatorID, err)
+		return nil, errors.New("failed to add domain")
+	}
+
+	return senderDomain, nil
+}
+
+// saveRecord stores the value a creator should publish for one record type
+func saveRecord(db *gorm.DB, creatorID uuid.UUID, domain, recordType, name, value string) error {
+	var record models.DNSRecord
+	err := db.Where("creator_id = ? AND domain = ? AND record_type = ?", creatorID, domain, recordType).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil {
+		record = models.DNSRecord{CreatorID: creatorID, Domain: domain, RecordType: recordType}
+	}
+	record.RecordName = name
+	record.RecordValue = value
+	return db.Save(&record).Error
+}
+
+// List returns a creator's sender domains
+func (s *SenderDomainService) List(creatorID uuid.UUID) ([]models.SenderDomain, error) {
+	var domains []models.SenderDomain
+	err := s.db.Where("creator_id = ?", creatorID).Order("created_at ASC").Find(&domains).Error
+	return domains, err
+}
+
+// Get returns one of a creator's sender domains
+func (s *SenderDomainService) Get(id, creatorID uuid.UUID) (*models.SenderDomain, error) {
+	var domain models.SenderDomain
+	if err := s.db.Where("id = ? AND creator_id = ?", id, creatorID).First(&domain).Error; err != nil {
+		return nil, errors.New("domain not found")
+	}
+	return &domain, nil
+}
+
+// Delete removes a sender domain with its DKIM key and DNS records
+func (s *SenderDomainService) Delete(id, creatorID uuid.UUID) error {
+	domain, err := s.Get(id, creatorID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(domain).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("creator_id = ? AND domain = ?", creatorID, domain.Domain).Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("creator_id = ? AND domain = ?", creatorID, domain.Domain).Delete(&models.DKIMKey{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	invalidateDKIMSigner(domain.Domain)
+	invalidateCreatorFromEmail(creatorID)
+	return nil
+}
+
+// DNSConfig lists the records to publish for a sender domain
+func (s *SenderDomainService) DNSConfig(domain *models.SenderDomain) (*DNSConfigGuide, error) {
+	var records []models.DNSRecord
+	if err := s.db.Where("creator_id = ? AND domain = ?", domain.CreatorID, domain.Domain).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	byType := make(map[string]models.DNSRecord, len(records))
+	for _, record := range records {
+		byType[record.RecordType] = record
+	}
+
+	spf, dkim, dmarc := byType["SPF"], byType["DKIM"], byType["DMARC"]
+	return &DNSConfigGuide{
+		Domain: domain.Domain,
+		SPF: DNSRecordGuide{
+			RecordType:   "TXT",
+			Host:         "@",
+			Value:        spf.RecordValue,
+			TTL:          3600,
+			IsVerified:   domain.SPFValid,
+			Instructions: "Add this TXT record, or add the include: entries to your existing SPF record. A domain may only have one SPF record, and it must stay within 10 DNS lookups.",
+		},
+		DKIM: DNSRecordGuide{
+			RecordType:   "TXT",
+			Host:         dkim.RecordName,
+			Value:        dkim.RecordValue,
+			TTL:          3600,
+			IsVerified:   domain.DKIMValid,
+			Instructions: "Add this TXT record so receivers can verify the signature we add to your emails.",
+		},
+		DMARC: DNSRecordGuide{
+			RecordType:   "TXT",
+			Host:         "_dmarc",
+			Value:        dmarc.RecordValue,
+			TTL:          3600,
+			IsVerified:   domain.DMARCValid,
+			Instructions: "Add this TXT record for DMARC. Start with p=none and move to quarantine or reject once reports show your mail passes.",
+		},
+		Status: DNSVerificationStatus{
+			AllVerified:   domain.Status == models.SenderDomainVerified,
+			SPFVerified:   domain.SPFValid,
+			DKIMVerified:  domain.DKIMValid,
+			DMARCVerified: domain.DMARCValid,
+			LastChecked:   domain.LastCheckedAt,
+		},
+	}, nil
+}
+
+// Verify checks one of a creator's sender domains now
+func (s *SenderDomainService) Verify(id, creatorID uuid.UUID) (*DomainVerification, error) {
+	domain, err := s.Get(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(domain), nil
+}
+
+// VerifyAll checks all of a creator's sender domains now
+func (s *SenderDomainService) VerifyAll(creatorID uuid.UUID) ([]*DomainVerification, error) {
+	domains, err := s.List(creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*DomainVerification, len(domains))
+	for i := range domains {
+		results[i] = s.check(&domains[i])
+	}
+	return results, nil
+}
+
+// check runs the SPF, DKIM and DMARC checks for a domain and records them
+func (s *SenderDomainService) check(domain *models.SenderDomain) *DomainVerification {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsCheckTimeout)
+	defer cancel()
+
+	var expected *rsa.PublicKey
+	if signer, err := s.deliverability.GetCreatorDKIMSigner(&domain.CreatorID, domain.Domain); err == nil && signer != nil {
+		expected = &signer.key.PublicKey
+	}
+
+	// We sign with d= set to the sender domain itself
+	result := &DomainVerification{
+		Domain: domain,
+		SPF:    CheckSPF(ctx, s.resolver, domain.Domain, spfIncludes()),
+		DKIM:   CheckDKIM(ctx, s.resolver, domain.Domain, domain.DKIMSelector, expected),
+		DMARC:  CheckDMARC(ctx, s.resolver, domain.Domain, domain.Domain),
+	}
+	s.record(domain, result)
+	return result
+}
+
+// record saves a check's results and alerts the creator when a domain that
+// was verified starts failing a check
+func (s *SenderDomainService) record(domain *models.SenderDomain, result *DomainVerification) {
+	now := time.Now()
+	previous := *domain
+
+	domain.SPFValid = result.SPF.Valid
+	domain.SPFLookups = result.SPF.Lookups
+	domain.DKIMValid = result.DKIM.Valid
+	domain.DMARCValid = result.DMARC.Valid
+	domain.DMARCPolicy = result.DMARC.Policy
+	domain.DMARCAligned = result.DMARC.Aligned
+	domain.Issues = nil
+	domain.Issues = append(domain.Issues, result.SPF.Issues...)
+	domain.Issues = append(domain.Issues, result.DKIM.Issues...)
+	domain.Issues = append(domain.Issues, result.DMARC.Issues...)
+	domain.LastCheckedAt = &now
+
+	switch {
+	case domain.SPFValid && domain.DKIMValid && domain.DMARCValid:
+		if domain.Status != models.SenderDomainVerified {
+			domain.VerifiedAt = &now
+		}
+		domain.Status = models.SenderDomainVerified
+		domain.FailingSince = nil
+	case domain.Status == models.SenderDomainVerified:
+		domain.Status = models.SenderDomainFailing
+		domain.FailingSince = &now
+	}
+
+	if err := s.db.Save(domain).Error; err != nil {
+		// Includes losing a race with another account verifying the domain
+		log.Printf("[SenderDomain] Failed to save check of %s: %v", domain.Domain, err)
+		return
+	}
+	if domain.Status != previous.Status {
+		invalidateDKIMSigner(domain.Domain)
+		invalidateCreatorFromEmail(domain.CreatorID)
+	}
+
+	s.updateRecord(domain, "SPF", result.SPF.Valid, result.SPF.Issues, now)
+	s.updateRecord(domain, "DKIM", result.DKIM.Valid, result.DKIM.Issues, now)
+	s.updateRecord(domain, "DMARC", result.DMARC.Valid, result.DMARC.Issues, now)
+
+	// Setup in progress isn't a regression; only alert once a domain was verified
+	if previous.Status == models.SenderDomainPending {
+		return
+	}
+	var regressed []string
+	if previous.SPFValid && !domain.SPFValid {
+		regressed = append(regressed, "SPF")
+	}
+	if previous.DKIMValid && !domain.DKIMValid {
+		regressed = append(regressed, "DKIM")
+	}
+	if previous.DMARCValid && !domain.DMARCValid {
+		regressed = append(regressed, "DMARC")
+	}
+	if len(regressed) > 0 {
+		s.alert(domain, regressed)
+	}
+}
+
+// updateRecord mirrors a check result onto the matching DNSRecord row
+func (s *SenderDomainService) updateRecord(domain *models.SenderDomain, recordType string, valid bool, issues []string, checkedAt time.Time) {
+	updates := map[string]interface{}{
+		"is_verified":   valid,
+		"last_checked":  checkedAt,
+		"error_message": nil,
+	}
+	if valid {
+		updates["verified_at"] = gorm.Expr("COALESCE(verified_at, ?)", checkedAt)
+	} else {
+		message := strings.Join(issues, "; ")
+		if len(message) > 500 {
+			message = message[:500]
+		}
+		updates["error_message"] = message
+	}
+	s.db.Model(&models.DNSRecord{}).
+		Where("creator_id = ? AND domain = ? AND record_type = ?", domain.CreatorID, domain.Domain, recordType).
+		Updates(updates)
+}
+
+// alert tells the creator, by email and webhook, which checks started failing
+func (s *SenderDomainService) alert(domain *models.SenderDomain, regressed []string) {
+	log.Printf("[SenderDomain] %s is failing %s: %s", domain.Domain, strings.Join(regressed, ", "), strings.Join(domain.Issues, "; "))
+
+	s.webhooks.TriggerEvent(domain.CreatorID, models.WebhookEventDomainFailing, map[string]interface{}{
+		"domainId": domain.ID,
+		"domain":   domain.Domain,
+		"failing":  regressed,
+		"issues":   domain.Issues,
+	})
+
+	var creator models.User
+	if err := s.db.Select("id", "email", "first_name").First(&creator, "id = ?", domain.CreatorID).Error; err != nil {
+		return
+	}
+	if err := s.mailer.SendDomainFailingEmail(&creator, domain, regressed); err != nil {
+		log.Printf("[SenderDomain] Failed to notify creator %s: %v", creator.ID, err)
+	}
+}
+
+// RecheckDue re-checks domains whose last check is older than
+// DOMAIN_RECHECK_HOURS, and recently added domains every hour
+func (s *SenderDomainService) RecheckDue() {
+	now := time.Now()
+	interval := time.Duration(envInt("DOMAIN_RECHECK_HOURS", 24)) * time.Hour
+
+	var domains []models.SenderDomain
+	s.db.Where("last_checked_at IS NULL OR last_checked_at < ? OR (status = ? AND created_at > ? AND last_checked_at < ?)",
+		now.Add(-interval), models.SenderDomainPending, now.Add(-pendingRecheckFor), now.Add(-pendingRecheckInterval)).
+		Order("last_checked_at ASC NULLS FIRST").
+		Limit(recheckBatchSize).
+		Find(&domains)
+
+	for i := range domains {
+		s.check(&domains[i])
+	}
+}
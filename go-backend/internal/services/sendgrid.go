@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SendGridEmailService implements email sending via the SendGrid v3 API
+type SendGridEmailService struct {
+	apiKey    string
+	fromEmail string
+	fromName  string
+	client    *http.Client
+}
+
+func NewSendGridEmailService() *SendGridEmailService {
+	return &SendGridEmailService{
+		apiKey:    os.Getenv("SENDGRID_API_KEY"),
+		fromEmail: os.Getenv("SENDGRID_FROM_EMAIL"),
+		fromName:  os.Getenv("SENDGRID_FROM_NAME"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type SendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type SendGridPersonalization struct {
+	To      []SendGridAddress `json:"to"`
+	Subject string            `json:"subject,omitempty"`
+}
+
+type SendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type SendGridToggle struct {
+	Enable bool `json:"enable"`
+}
+
+type SendGridTrackingSettings struct {
+	ClickTracking *SendGridToggle `json:"click_tracking,omitempty"`
+	OpenTracking  *SendGridToggle `json:"open_tracking,omitempty"`
+}
+
+type SendGridMail struct {
+	Personalizations []SendGridPersonalization `json:"personalizations"`
+	From             SendGridAddress           `json:"from"`
+	ReplyTo          *SendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []SendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	CustomArgs       map[string]string         `json:"custom_args,omitempty"`
+	TrackingSettings *SendGridTrackingSettings `json:"tracking_settings,omitempty"`
+}
+
+func (s *SendGridEmailService) Name() string {
+	return "sendgrid"
+}
+
+func (s *SendGridEmailService) Send(req *EmailRequest) (*SendResult, error) {
+	if s.apiKey == "" {
+		return nil, errors.New("SendGrid API key not configured")
+	}
+
+	mail := SendGridMail{
+		Subject: req.Subject,
+		Content: []SendGridContent{},
+	}
+
+	mail.From = SendGridAddress{Email: s.fromEmail, Name: s.fromName}
+	if req.FromEmail != "" {
+		mail.From.Email = req.FromEmail
+	}
+	if req.FromName != "" {
+		mail.From.Name = req.FromName
+	}
+	if req.ReplyTo != "" {
+		mail.ReplyTo = &SendGridAddress{Email: req.ReplyTo}
+	}
+
+	// Add recipient
+	mail.Personalizations = append(mail.Personalizations, SendGridPersonalization{
+		To: []SendGridAddress{
+			{
+				Email: req.To.Email,
+				Name:  strings.TrimSpace(fmt.Sprintf("%s %s", req.To.FirstName, req.To.LastName)),
+			},
+		},
+	})
+
+	// Add content
+	if req.TextContent != "" {
+		mail.Content = append(mail.Content, SendGridContent{
+			Type:  "text/plain",
+			Value: req.TextContent,
+		})
+	}
+	if req.HTMLContent != "" {
+		mail.Content = append(mail.Content, SendGridContent{
+			Type:  "text/html",
+			Value: req.HTMLContent,
+		})
+	}
+
+	// Add custom headers for tracking
+	mail.Headers = map[string]string{}
+	for k, v := range req.Headers {
+		mail.Headers[k] = v
+	}
+	if req.CampaignID != "" {
+		mail.Headers["X-Campaign-ID"] = req.CampaignID
+	}
+
+	// Custom args are echoed back on every Event Webhook entry
+	if req.MessageID != uuid.Nil {
+		mail.CustomArgs = map[string]string{"message_id": req.MessageID.String()}
+		if req.CampaignID != "" {
+			mail.CustomArgs["campaign_id"] = req.CampaignID
+		}
+	}
+
+	// Enable tracking, unless the HTML is already instrumented with ours
+	mail.TrackingSettings = &SendGridTrackingSettings{
+		ClickTracking: &SendGridToggle{Enable: !req.Tracked},
+		OpenTracking:  &SendGridToggle{Enable: !req.Tracked},
+	}
+
+	// Send request
+	jsonData, err := json.Marshal(mail)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", "https://api.sendgrid.com/v3/mail/send", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+s.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, &ProviderError{Provider: s.Name(), Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &ProviderError{
+			Provider:   s.Name(),
+			StatusCode: resp.StatusCode,
+			Err:        errors.New(strings.TrimSpace(string(body))),
+		}
+	}
+
+	return &SendResult{
+		Provider:  s.Name(),
+		MessageID: resp.Header.Get("X-Message-Id"),
+	}, nil
+}
+
+func (s *SendGridEmailService) IsConfigured() bool {
+	return s.apiKey != "" && s.fromEmail != ""
+}
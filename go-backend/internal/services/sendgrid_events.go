@@ -0,0 +1,175 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// sendGridEvent is a single entry of a SendGrid Event Webhook batch.
+// Custom args (message_id, campaign_id) are flattened into the event.
+type sendGridEvent struct {
+	Email       string `json:"email"`
+	Timestamp   int64  `json:"timestamp"`
+	Event       string `json:"event"`
+	SGEventID   string `json:"sg_event_id"`
+	SGMessageID string `json:"sg_message_id"`
+	Reason      string `json:"reason"`
+	Response    string `json:"response"`
+	Type        string `json:"type"`   // bounce or blocked
+	Status      string `json:"status"` // enhanced status code of a bounce
+	URL         string `json:"url"`
+	IP          string `json:"ip"`
+	UserAgent   string `json:"useragent"`
+	MessageID   string `json:"message_id"`
+	CampaignID  string `json:"campaign_id"`
+}
+
+// VerifySendGridSignature checks the ECDSA signature SendGrid puts on Event
+// Webhook requests, using the verification key from SENDGRID_WEBHOOK_PUBLIC_KEY
+func VerifySendGridSignature(payload []byte, signature, timestamp string) error {
+	publicKey := os.Getenv("SENDGRID_WEBHOOK_PUBLIC_KEY")
+	if publicKey == "" {
+		return ErrWebhookNotConfigured
+	}
+	if signature == "" || timestamp == "" {
+		return ErrInvalidWebhookSignature
+	}
+
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid SendGrid verification key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("invalid SendGrid verification key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("SendGrid verification key must be ECDSA")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	hash := sha256.Sum256(append([]byte(timestamp), payload...))
+	if !ecdsa.VerifyASN1(key, hash[:], sig) {
+		return ErrInvalidWebhookSignature
+	}
+
+	if err := checkWebhookTimestamp(timestamp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseSendGridEvents maps an Event Webhook batch onto provider events
+func ParseSendGridEvents(payload []byte) ([]ProviderEventInput, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid SendGrid event batch: %w", err)
+	}
+
+	events := make([]ProviderEventInput, 0, len(raw))
+	for _, item := range raw {
+		var e sendGridEvent
+		if err := json.Unmarshal(item, &e); err != nil {
+			continue
+		}
+
+		eventType, bounceType := sendGridEventType(&e)
+		if eventType == "" {
+			continue
+		}
+
+		reason := e.Reason
+		if reason == "" {
+			reason = e.Response
+		}
+
+		event := ProviderEventInput{
+			Provider:          "sendgrid",
+			EventID:           e.SGEventID,
+			Type:              eventType,
+			Email:             e.Email,
+			ProviderMessageID: e.SGMessageID,
+			BounceType:        bounceType,
+			BounceStatus:      e.Status,
+			Reason:            reason,
+			URL:               e.URL,
+			IPAddress:         e.IP,
+			UserAgent:         e.UserAgent,
+			Timestamp:         time.Unix(e.Timestamp, 0),
+			Raw:               item,
+		}
+		if id, err := uuid.Parse(e.MessageID); err == nil {
+			event.MessageID = &id
+		}
+		if id, err := uuid.Parse(e.CampaignID); err == nil {
+			event.CampaignID = &id
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// sendGridEventType maps SendGrid event names onto our event types
+func sendGridEventType(e *sendGridEvent) (string, models.BounceType) {
+	switch e.Event {
+	case "delivered":
+		return ProviderEventDelivered, ""
+	case "deferred":
+		return ProviderEventDeferred, ""
+	case "bounce":
+		// "blocked" bounces are usually reputation or content blocks, not dead mailboxes
+		if e.Type == "blocked" {
+			return ProviderEventBounce, models.BounceTypeSoft
+		}
+		return ProviderEventBounce, models.BounceTypeHard
+	case "dropped":
+		// Only drops for bad addresses count against the subscriber
+		reason := strings.ToLower(e.Reason)
+		if strings.Contains(reason, "bounced address") || strings.Contains(reason, "invalid") {
+			return ProviderEventDropped, models.BounceTypeHard
+		}
+		return "", ""
+	case "spamreport":
+		return ProviderEventComplaint, ""
+	case "open":
+		return ProviderEventOpen, ""
+	case "click":
+		return ProviderEventClick, ""
+	case "unsubscribe", "group_unsubscribe":
+		return ProviderEventUnsubscribe, ""
+	}
+	return "", ""
+}
+
+// checkWebhookTimestamp rejects signed requests older than five minutes to
+// limit replays
+func checkWebhookTimestamp(timestamp string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age > 5*time.Minute || age < -5*time.Minute {
+		return errors.New("webhook timestamp outside tolerance")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendGridKey sets SENDGRID_WEBHOOK_PUBLIC_KEY to a fresh P-256 key the way
+// the SendGrid console shows it, and returns the private half
+func sendGridKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", base64.StdEncoding.EncodeToString(der))
+	return key
+}
+
+// signSendGrid signs timestamp + payload as SendGrid does
+func signSendGrid(t *testing.T, key *ecdsa.PrivateKey, payload []byte, timestamp string) string {
+	t.Helper()
+	hash := sha256.Sum256(append([]byte(timestamp), payload...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestVerifySendGridSignature(t *testing.T) {
+	key := sendGridKey(t)
+	payload := []byte(`[{"email":"reader@example.org","timestamp":1760000000,"event":"bounce","sg_event_id":"ev-1","status":"5.1.1"}]`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	signature := signSendGrid(t, key, payload, now)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		timestamp string
+		wantErr   error  // nil for a valid request
+		wantText  string // for errors without a sentinel
+	}{
+		{name: "signed", payload: payload, signature: signature, timestamp: now},
+		{name: "modified body", payload: []byte(strings.Replace(string(payload), "5.1.1", "2.0.0", 1)), signature: signature, timestamp: now, wantErr: ErrInvalidWebhookSignature},
+		{name: "signed by another key", payload: payload, signature: signSendGrid(t, other, payload, now), timestamp: now, wantErr: ErrInvalidWebhookSignature},
+		{name: "timestamp changed after signing", payload: payload, signature: signature, timestamp: stale, wantErr: ErrInvalidWebhookSignature},
+		{name: "stale timestamp", payload: payload, signature: signSendGrid(t, key, payload, stale), timestamp: stale, wantText: "timestamp outside tolerance"},
+		{name: "signature not base64", payload: payload, signature: "not base64!", timestamp: now, wantErr: ErrInvalidWebhookSignature},
+		{name: "missing signature", payload: payload, timestamp: now, wantErr: ErrInvalidWebhookSignature},
+		{name: "missing timestamp", payload: payload, signature: signature, wantErr: ErrInvalidWebhookSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySendGridSignature(tt.payload, tt.signature, tt.timestamp)
+			switch {
+			case tt.wantErr == nil && tt.wantText == "":
+				if err != nil {
+					t.Errorf("VerifySendGridSignature() = %v, want nil", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifySendGridSignature() = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || !strings.Contains(err.Error(), tt.wantText) {
+					t.Errorf("VerifySendGridSignature() = %v, want %q", err, tt.wantText)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifySendGridSignatureKeyConfig(t *testing.T) {
+	payload := []byte(`[]`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", "")
+	if err := VerifySendGridSignature(payload, "c2ln", now); !errors.Is(err, ErrWebhookNotConfigured) {
+		t.Errorf("no key: error = %v, want ErrWebhookNotConfigured", err)
+	}
+
+	// An RSA key is a misconfiguration, not something to verify against
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", base64.StdEncoding.EncodeToString(der))
+	if err := VerifySendGridSignature(payload, "c2ln", now); err == nil || errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("RSA key: error = %v, want a configuration error", err)
+	}
+}
@@ -0,0 +1,502 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTP TLS modes
+const (
+	SMTPTLSStartTLS = "starttls" // Upgrade with STARTTLS, fail if the server does not offer it
+	SMTPTLSImplicit = "tls"      // Connect over TLS (usually port 465)
+	SMTPTLSNone     = "none"     // Plain connection, for local SMTP sinks only
+)
+
+// SMTPConfig configures the SMTP relay mailer
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	FromEmail   string
+	FromName    string
+	TLSMode     string
+	HeloName    string
+	PoolSize    int
+	IdleTimeout time.Duration
+	DialTimeout time.Duration
+}
+
+// SMTPEmailService relays mail through an SMTP server over pooled persistent
+// connections and DKIM-signs messages for domains with a configured key
+type SMTPEmailService struct {
+	config SMTPConfig
+	pool   chan *smtpConn
+	slots  chan struct{}
+
+	// signerFor returns the DKIM signer for a From domain (nil when unsigned)
+	signerFor func(domain string) (*DKIMSigner, error)
+}
+
+type smtpConn struct {
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+var (
+	sharedSMTP     *SMTPEmailService
+	sharedSMTPOnce sync.Once
+)
+
+// NewSMTPEmailService returns the process-wide SMTP mailer configured from the
+// environment. The instance is shared so every registry uses the same pool.
+func NewSMTPEmailService() *SMTPEmailService {
+	sharedSMTPOnce.Do(func() {
+		port, _ := strconv.Atoi(getEnvOr("SMTP_PORT", "587"))
+		poolSize, _ := strconv.Atoi(getEnvOr("SMTP_POOL_SIZE", "4"))
+
+		sharedSMTP = NewSMTPEmailServiceWithConfig(SMTPConfig{
+			Host:      os.Getenv("SMTP_HOST"),
+			Port:      port,
+			Username:  os.Getenv("SMTP_USERNAME"),
+			Password:  os.Getenv("SMTP_PASSWORD"),
+			FromEmail: os.Getenv("SMTP_FROM_EMAIL"),
+			FromName:  os.Getenv("SMTP_FROM_NAME"),
+			TLSMode:   getEnvOr("SMTP_TLS", SMTPTLSStartTLS),
+			HeloName:  os.Getenv("SMTP_HELO_NAME"),
+			PoolSize:  poolSize,
+		})
+	})
+	return sharedSMTP
+}
+
+// NewSMTPEmailServiceWithConfig builds an SMTP mailer with explicit settings,
+// e.g. pointed at a local SMTP sink
+func NewSMTPEmailServiceWithConfig(config SMTPConfig) *SMTPEmailService {
+	if config.PoolSize <= 0 {
+		config.PoolSize = 4
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 30 * time.Second
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	if config.TLSMode == "" {
+		config.TLSMode = SMTPTLSStartTLS
+	}
+
+	return &SMTPEmailService{
+		config:    config,
+		pool:      make(chan *smtpConn, config.PoolSize),
+		slots:     make(chan struct{}, config.PoolSize),
+		signerFor: cachedDKIMSigner,
+	}
+}
+
+// SetSignerLookup replaces the DKIM key lookup (nil disables signing)
+func (s *SMTPEmailService) SetSignerLookup(lookup func(domain string) (*DKIMSigner, error)) {
+	s.signerFor = lookup
+}
+
+func (s *SMTPEmailService) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPEmailService) IsConfigured() bool {
+	return s.config.Host != "" && s.config.FromEmail != ""
+}
+
+func (s *SMTPEmailService) Send(req *EmailRequest) (*SendResult, error) {
+	if !s.IsConfigured() {
+		return nil, errors.New("SMTP relay not configured")
+	}
+
+	fromEmail := s.config.FromEmail
+	if req.FromEmail != "" {
+		fromEmail = req.FromEmail
+	}
+	fromName := s.config.FromName
+	if req.FromName != "" {
+		fromName = req.FromName
+	}
+
+	messageID, raw, err := s.buildMessage(req, fromName, fromEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bounces go to a per-message VERP address when one is configured
+	envelopeFrom := ReturnPathAddress(req.MessageID)
+	if envelopeFrom == "" {
+		envelopeFrom = fromEmail
+	}
+
+	conn, err := s.acquire()
+	if err != nil {
+		return nil, &ProviderError{Provider: s.Name(), Err: err}
+	}
+
+	if err := s.transmit(conn.client, envelopeFrom, req.To.Email, raw); err != nil {
+		s.discard(conn)
+		return nil, s.wrapError(err)
+	}
+
+	s.release(conn)
+	return &SendResult{Provider: s.Name(), MessageID: messageID}, nil
+}
+
+// transmit runs a single MAIL/RCPT/DATA transaction
+func (s *SMTPEmailService) transmit(c *smtp.Client, from, to string, raw []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// wrapError maps SMTP replies onto ProviderError so 4xx replies are retried
+func (s *SMTPEmailService) wrapError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return &ProviderError{Provider: s.Name(), SMTPCode: tpErr.Code, Err: errors.New(tpErr.Msg)}
+	}
+	return &ProviderError{Provider: s.Name(), Err: err}
+}
+
+// --- Connection pool ---
+
+// acquire returns an idle pooled connection or dials a new one when a slot is free
+func (s *SMTPEmailService) acquire() (*smtpConn, error) {
+	for {
+		// Prefer an idle connection over dialing a new one
+		select {
+		case conn := <-s.pool:
+			if s.usable(conn) {
+				return conn, nil
+			}
+			continue
+		default:
+		}
+
+		select {
+		case conn := <-s.pool:
+			if s.usable(conn) {
+				return conn, nil
+			}
+		case s.slots <- struct{}{}:
+			client, err := s.dial()
+			if err != nil {
+				<-s.slots
+				return nil, err
+			}
+			return &smtpConn{client: client, lastUsed: time.Now()}, nil
+		}
+	}
+}
+
+// usable checks an idle connection is still alive, discarding it otherwise
+func (s *SMTPEmailService) usable(conn *smtpConn) bool {
+	if time.Since(conn.lastUsed) > s.config.IdleTimeout || conn.client.Noop() != nil {
+		s.discard(conn)
+		return false
+	}
+	return true
+}
+
+// release resets the session and returns the connection to the pool
+func (s *SMTPEmailService) release(conn *smtpConn) {
+	if err := conn.client.Reset(); err != nil {
+		s.discard(conn)
+		return
+	}
+	conn.lastUsed = time.Now()
+	s.pool <- conn
+}
+
+// discard closes a broken or stale connection and frees its slot
+func (s *SMTPEmailService) discard(conn *smtpConn) {
+	conn.client.Close()
+	<-s.slots
+}
+
+// Close shuts down all idle pooled connections
+func (s *SMTPEmailService) Close() {
+	for {
+		select {
+		case conn := <-s.pool:
+			conn.client.Quit()
+			<-s.slots
+		default:
+			return
+		}
+	}
+}
+
+func (s *SMTPEmailService) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLSMode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: s.config.DialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, s.config.DialTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.config.HeloName != "" {
+		if err := client.Hello(s.config.HeloName); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	if s.config.TLSMode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if s.config.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			client.Close()
+			return nil, errors.New("SMTP server does not support AUTH")
+		}
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// --- Message building ---
+
+// buildMessage renders the RFC 5322 message and signs it when a DKIM key exists
+func (s *SMTPEmailService) buildMessage(req *EmailRequest, fromName, fromEmail string) (string, []byte, error) {
+	domain := emailDomain(fromEmail)
+
+	// Reuse the message log ID so bounces quoting Message-ID can be matched
+	localPart := req.MessageID
+	if localPart == uuid.Nil {
+		localPart = uuid.New()
+	}
+	messageID := fmt.Sprintf("%s@%s", localPart.String(), domain)
+
+	toName := strings.TrimSpace(req.To.FirstName + " " + req.To.LastName)
+
+	headers := []mailHeader{
+		{"From", encodeAddress(fromName, fromEmail)},
+		{"To", encodeAddress(toName, req.To.Email)},
+		{"Subject", mime.QEncoding.Encode("utf-8", req.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + messageID + ">"},
+		{"MIME-Version", "1.0"},
+	}
+	if req.ReplyTo != "" {
+		headers = append(headers, mailHeader{"Reply-To", req.ReplyTo})
+	}
+	if req.CampaignID != "" {
+		headers = append(headers, mailHeader{"X-Campaign-ID", req.CampaignID})
+	}
+
+	// Custom headers in a stable order so signatures are reproducible
+	keys := make([]string, 0, len(req.Headers))
+	for k := range req.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		headers = append(headers, mailHeader{k, req.Headers[k]})
+	}
+
+	contentType, body, err := buildMIMEBody(req.TextContent, req.HTMLContent)
+	if err != nil {
+		return "", nil, err
+	}
+	headers = append(headers, contentType...)
+
+	if s.signerFor != nil {
+		signer, err := s.signerFor(domain)
+		if err != nil {
+			log.Printf("[SMTP] DKIM key lookup failed for %s: %v", domain, err)
+		} else if signer != nil {
+			sig, err := signer.Sign(headers, body)
+			if err != nil {
+				return "", nil, err
+			}
+			headers = append([]mailHeader{{"DKIM-Signature", sig}}, headers...)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, h := range headers {
+		buf.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return messageID, buf.Bytes(), nil
+}
+
+// buildMIMEBody returns content headers and a CRLF body with text and/or HTML parts
+func buildMIMEBody(text, html string) ([]mailHeader, []byte, error) {
+	if html == "" || text == "" {
+		contentType := "text/plain; charset=utf-8"
+		content := text
+		if html != "" {
+			contentType = "text/html; charset=utf-8"
+			content = html
+		}
+		body, err := quotedPrintable(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []mailHeader{
+			{"Content-Type", contentType},
+			{"Content-Transfer-Encoding", "quoted-printable"},
+		}, body, nil
+	}
+
+	boundary := randomBoundary()
+	var buf bytes.Buffer
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		encoded, err := quotedPrintable(part.content)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.WriteString("--" + boundary + "\r\n")
+		buf.WriteString("Content-Type: " + part.contentType + "\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		buf.Write(encoded)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return []mailHeader{
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary)},
+	}, buf.Bytes(), nil
+}
+
+func quotedPrintable(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if _, err := w.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeAddress(name, email string) string {
+	if name == "" {
+		return "<" + email + ">"
+	}
+	return mime.QEncoding.Encode("utf-8", name) + " <" + email + ">"
+}
+
+func randomBoundary() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// emailDomain returns the lowercased domain part of an address
+func emailDomain(email string) string {
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		return strings.ToLower(email[i+1:])
+	}
+	return ""
+}
+
+// --- DKIM key cache ---
+
+type cachedSigner struct {
+	signer    *DKIMSigner
+	expiresAt time.Time
+}
+
+var (
+	dkimSignerCache   = make(map[string]cachedSigner)
+	dkimSignerCacheMu sync.Mutex
+)
+
+const dkimSignerCacheTTL = 5 * time.Minute
+
+// cachedDKIMSigner looks up a domain's signing key, caching results briefly
+func cachedDKIMSigner(domain string) (*DKIMSigner, error) {
+	dkimSignerCacheMu.Lock()
+	entry, ok := dkimSignerCache[domain]
+	dkimSignerCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.signer, nil
+	}
+
+	signer, err := NewDeliverabilityService().GetDKIMSigner(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	dkimSignerCacheMu.Lock()
+	dkimSignerCache[domain] = cachedSigner{signer: signer, expiresAt: time.Now().Add(dkimSignerCacheTTL)}
+	dkimSignerCacheMu.Unlock()
+	return signer, nil
+}
+
+// invalidateDKIMSigner drops a cached key after it changes
+func invalidateDKIMSigner(domain string) {
+	dkimSignerCacheMu.Lock()
+	delete(dkimSignerCache, domain)
+	dkimSignerCacheMu.Unlock()
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// smtpSink is a minimal SMTP server that keeps every message it accepts
+type smtpSink struct {
+	ln        net.Listener
+	rcptReply string // replaces the RCPT TO reply when set
+
+	mu       sync.Mutex
+	conns    int
+	quits    int
+	messages []sinkMessage
+}
+
+type sinkMessage struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func newSMTPSink(t *testing.T, rcptReply string) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{ln: ln, rcptReply: rcptReply}
+	t.Cleanup(func() { ln.Close() })
+	go sink.serve()
+	return sink
+}
+
+// service returns a mailer pointed at the sink over a plain connection
+func (s *smtpSink) service() *SMTPEmailService {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return NewSMTPEmailServiceWithConfig(SMTPConfig{
+		Host:      addr.IP.String(),
+		Port:      addr.Port,
+		FromEmail: "news@example.com",
+		FromName:  "Example News",
+		TLSMode:   SMTPTLSNone,
+		PoolSize:  1,
+	})
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.session(conn)
+	}
+}
+
+func (s *smtpSink) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 sink ESMTP")
+	var msg sinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(verb, "EHLO"), strings.HasPrefix(verb, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(verb, "MAIL FROM:"):
+			msg = sinkMessage{from: angleAddr(line)}
+			reply("250 OK")
+		case strings.HasPrefix(verb, "RCPT TO:"):
+			if s.rcptReply != "" {
+				reply(s.rcptReply)
+				continue
+			}
+			msg.to = append(msg.to, angleAddr(line))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readDotData(r)
+			if err != nil {
+				return
+			}
+			msg.data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case verb == "RSET", verb == "NOOP":
+			reply("250 OK")
+		case verb == "QUIT":
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// readDotData reads a DATA payload byte for byte, undoing dot-stuffing
+func readDotData(r *bufio.Reader) ([]byte, error) {
+	var data bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" {
+			return data.Bytes(), nil
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func angleAddr(line string) string {
+	start, end := strings.Index(line, "<"), strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+func (s *smtpSink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+// --- DKIM verification ---
+
+var (
+	wspRun   = regexp.MustCompile(`[ \t]+`)
+	dkimBTag = regexp.MustCompile(`(^|;)(\s*b\s*=)[^;]*`)
+)
+
+// headerField is a raw header field as received, folding intact
+type headerField struct {
+	name, value string
+}
+
+// splitMessage separates the unfolded-but-raw header fields from the body
+func splitMessage(raw []byte) ([]headerField, []byte, error) {
+	head, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, nil, errors.New("message has no header/body separator")
+	}
+	var fields []headerField
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += "\r\n" + line
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed header line %q", line)
+		}
+		fields = append(fields, headerField{name, value})
+	}
+	return fields, body, nil
+}
+
+// relaxedHeader canonicalizes a field as RFC 6376 §3.4.2 describes
+func relaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.TrimSpace(wspRun.ReplaceAllString(value, " "))
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value
+}
+
+// relaxedBody canonicalizes a body as RFC 6376 §3.4.4 describes
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(wspRun.ReplaceAllString(line, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// verifyDKIM checks a received message's relaxed/relaxed rsa-sha256 signature
+func verifyDKIM(raw []byte, domain, selector string, key *rsa.PublicKey) error {
+	fields, body, err := splitMessage(raw)
+	if err != nil {
+		return err
+	}
+
+	var sigField *headerField
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, "DKIM-Signature") {
+			sigField = &fields[i]
+			break
+		}
+	}
+	if sigField == nil {
+		return errors.New("no DKIM-Signature header")
+	}
+
+	tags := map[string]string{}
+	for _, part := range strings.Split(sigField.value, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if ok {
+			tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+		}
+	}
+	for tag, want := range map[string]string{"v": "1", "a": "rsa-sha256", "c": "relaxed/relaxed", "d": domain, "s": selector} {
+		if tags[tag] != want {
+			return fmt.Errorf("tag %s=%q, want %q", tag, tags[tag], want)
+		}
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != tags["bh"] {
+		return fmt.Errorf("body hash %s does not match bh=%s", got, tags["bh"])
+	}
+
+	// Hash the signed fields bottom-up, each occurrence used once
+	h := sha256.New()
+	used := map[int]bool{}
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				h.Write([]byte(relaxedHeader(fields[i].name, fields[i].value) + "\r\n"))
+				break
+			}
+		}
+	}
+	unsigned := dkimBTag.ReplaceAllString(sigField.value, "$1$2")
+	h.Write([]byte(relaxedHeader(sigField.name, unsigned)))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("b= is not base64: %w", err)
+	}
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, h.Sum(nil), sig)
+}
+
+// --- Tests ---
+
+func TestSMTPEmailServiceSendsSignedMessage(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "")
+
+	keyPEM, err := GenerateDKIMKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewDKIMSigner("Example.com", "nl1", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := newSMTPSink(t, "")
+	svc := sink.service()
+	defer svc.Close()
+	svc.SetSignerLookup(func(domain string) (*DKIMSigner, error) {
+		if domain == "example.com" {
+			return signer, nil
+		}
+		return nil, nil
+	})
+
+	id := uuid.New()
+	result, err := svc.Send(&EmailRequest{
+		To:      EmailRecipient{Email: "reader@example.org", FirstName: "Wanjirũ", LastName: "Kamau"},
+		Subject: "Habari za wiki — issue 12",
+		// A leading dot exercises dot-stuffing, trailing blanks the body canonicalization
+		TextContent: "Hello  there,\n.hidden line\nindented\tline   \n\n\n",
+		HTMLContent: "<p>Hello there</p>",
+		ReplyTo:     "editor@example.com",
+		CampaignID:  "42",
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<https://example.com/u/abc>",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+		MessageID: id,
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if want := id.String() + "@example.com"; result.MessageID != want {
+		t.Errorf("MessageID = %q, want %q", result.MessageID, want)
+	}
+
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.from != "news@example.com" {
+		t.Errorf("envelope sender = %q, want the From address", msg.from)
+	}
+	if len(msg.to) != 1 || msg.to[0] != "reader@example.org" {
+		t.Errorf("envelope recipients = %v", msg.to)
+	}
+	if !bytes.Contains(msg.data, []byte("\r\n.hidden line")) {
+		t.Error("dot-stuffed line was not restored")
+	}
+
+	if err := verifyDKIM(msg.data, "example.com", "nl1", &signer.key.PublicKey); err != nil {
+		t.Fatalf("DKIM signature does not verify: %v", err)
+	}
+
+	fields, _, err := splitMessage(msg.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signedHeaders string
+	for _, f := range fields {
+		if strings.EqualFold(f.name, "DKIM-Signature") {
+			signedHeaders = strings.Join(strings.Fields(f.value), "")
+		}
+	}
+	for _, name := range []string{"from", "to", "subject", "date", "message-id", "reply-to", "list-unsubscribe", "list-unsubscribe-post"} {
+		if !regexp.MustCompile(`h=([a-z-]+:)*` + name + `(:|;)`).MatchString(signedHeaders) {
+			t.Errorf("%s is not signed: %s", name, signedHeaders)
+		}
+	}
+
+	// The verifier must notice a message changed in transit
+	tampered := bytes.Replace(msg.data, []byte("Hello there"), []byte("Hello thera"), 1)
+	if verifyDKIM(tampered, "example.com", "nl1", &signer.key.PublicKey) == nil {
+		t.Error("tampered body still verifies")
+	}
+	tampered = bytes.Replace(msg.data, []byte("Reply-To: editor@"), []byte("Reply-To: attacker@"), 1)
+	if verifyDKIM(tampered, "example.com", "nl1", &signer.key.PublicKey) == nil {
+		t.Error("tampered header still verifies")
+	}
+}
+
+func TestSMTPEmailServiceUnsignedDomain(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "")
+
+	sink := newSMTPSink(t, "")
+	svc := sink.service()
+	defer svc.Close()
+	svc.SetSignerLookup(func(string) (*DKIMSigner, error) { return nil, nil })
+
+	if _, err := svc.Send(&EmailRequest{To: EmailRecipient{Email: "reader@example.org"}, Subject: "Hi", TextContent: "Hi"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	if bytes.Contains(messages[0].data, []byte("DKIM-Signature:")) {
+		t.Error("message for a domain without a key was signed")
+	}
+}
+
+func TestSMTPEmailServiceReturnPath(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "bounces.example.net")
+	t.Setenv("TRACKING_SECRET", "test-secret")
+
+	sink := newSMTPSink(t, "")
+	svc := sink.service()
+	defer svc.Close()
+	svc.SetSignerLookup(nil)
+
+	id := uuid.New()
+	if _, err := svc.Send(&EmailRequest{To: EmailRecipient{Email: "reader@example.org"}, Subject: "Hi", TextContent: "Hi", MessageID: id}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	got, ok := ParseReturnPath(messages[0].from)
+	if !ok || got != id {
+		t.Errorf("envelope sender %q does not identify message %s", messages[0].from, id)
+	}
+}
+
+func TestSMTPEmailServiceReusesConnections(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "")
+
+	sink := newSMTPSink(t, "")
+	svc := sink.service()
+	svc.SetSignerLookup(nil)
+
+	for i := 0; i < 3; i++ {
+		req := &EmailRequest{To: EmailRecipient{Email: "reader" + strconv.Itoa(i) + "@example.org"}, Subject: "Hi", TextContent: "Hi"}
+		if _, err := svc.Send(req); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+	svc.Close()
+
+	if got := len(sink.received()); got != 3 {
+		t.Errorf("sink received %d messages, want 3", got)
+	}
+	// QUIT is answered before the session ends; give it a moment to be counted
+	deadline := time.Now().Add(time.Second)
+	for {
+		sink.mu.Lock()
+		conns, quits := sink.conns, sink.quits
+		sink.mu.Unlock()
+		if quits == 1 || time.Now().After(deadline) {
+			if conns != 1 || quits != 1 {
+				t.Errorf("connections = %d, quits = %d; want one pooled connection closed once", conns, quits)
+			}
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSMTPEmailServiceTemporaryRejection(t *testing.T) {
+	t.Setenv("RETURN_PATH_DOMAIN", "")
+
+	sink := newSMTPSink(t, "451 4.7.1 Try again later")
+	svc := sink.service()
+	defer svc.Close()
+	svc.SetSignerLookup(nil)
+
+	_, err := svc.Send(&EmailRequest{To: EmailRecipient{Email: "reader@example.org"}, Subject: "Hi", TextContent: "Hi"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("err = %v, want a ProviderError", err)
+	}
+	if providerErr.SMTPCode != 451 || !providerErr.Retryable() {
+		t.Errorf("SMTPCode = %d, Retryable = %v; want a retryable 451", providerErr.SMTPCode, providerErr.Retryable())
+	}
+}
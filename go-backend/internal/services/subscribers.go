@@ -29,12 +29,15 @@ type CreateSubscriberRequest struct {
 	LastName  *string   `json:"lastName,omitempty"`
 	Source    *string   `json:"source,omitempty"`
 	TagIDs    []string  `json:"tagIds,omitempty"`
+	Timezone  *string   `json:"timezone,omitempty"` // IANA name; inferred from SignupIP when absent
+	SignupIP  *string   `json:"signupIp,omitempty" binding:"omitempty,ip"`
 }
 
 type UpdateSubscriberRequest struct {
 	FirstName *string   `json:"firstName,omitempty"`
 	LastName  *string   `json:"lastName,omitempty"`
 	TagIDs    []string  `json:"tagIds,omitempty"`
+	Timezone  *string   `json:"timezone,omitempty"` // "" clears it
 }
 
 type SubscriberFilter struct {
@@ -46,6 +49,12 @@ type SubscriberFilter struct {
 }
 
 func (s *SubscriberService) Create(req *CreateSubscriberRequest, creatorID uuid.UUID) (*models.Subscriber, error) {
+	return s.create(req, creatorID, true)
+}
+
+// create adds a subscriber and, unless startWorkflows is false as it is for
+// imports, starts the creator's subscriber_created and tag_added workflows
+func (s *SubscriberService) create(req *CreateSubscriberRequest, creatorID uuid.UUID, startWorkflows bool) (*models.Subscriber, error) {
 	// Check if subscriber already exists for this creator
 	var existing models.Subscriber
 	result := s.db.Where("email = ? AND creator_id = ?", strings.ToLower(req.Email), creatorID).First(&existing)
@@ -67,6 +76,19 @@ func (s *SubscriberService) Create(req *CreateSubscriberRequest, creatorID uuid.
 		CreatorID:        creatorID,
 		UnsubscribeToken: token,
 		Source:           req.Source,
+		SignupIP:         req.SignupIP,
+	}
+
+	if req.Timezone != nil && *req.Timezone != "" {
+		tz, err := NormalizeTimezone(*req.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		setTimezone(subscriber, tz, models.TimezoneSourceAPI)
+	} else if req.SignupIP != nil {
+		if tz := TimezoneForIP(*req.SignupIP); tz != "" {
+			setTimezone(subscriber, tz, models.TimezoneSourceGeoIP)
+		}
 	}
 
 	if err := s.db.Create(subscriber).Error; err != nil {
@@ -74,14 +96,23 @@ func (s *SubscriberService) Create(req *CreateSubscriberRequest, creatorID uuid.
 	}
 
 	// Add tags if provided
+	var addedTags []uuid.UUID
 	if len(req.TagIDs) > 0 {
-		if err := s.updateTags(subscriber.ID, req.TagIDs); err != nil {
+		added, _, err := s.updateTags(subscriber.ID, req.TagIDs)
+		if err != nil {
 			// Log but don't fail
 		}
+		addedTags = added
 		// Reload with tags
 		s.db.Preload("Tags").First(subscriber, "id = ?", subscriber.ID)
 	}
 
+	if startWorkflows {
+		workflows := NewWorkflowService()
+		workflows.TriggerWorkflows(creatorID, subscriber.ID, &WorkflowEvent{Type: models.TriggerSubscriberCreated})
+		workflows.TriggerTagChanges(creatorID, subscriber.ID, addedTags, nil)
+	}
+
 	return subscriber, nil
 }
 
@@ -156,16 +187,30 @@ func (s *SubscriberService) Update(id uuid.UUID, req *UpdateSubscriberRequest, c
 	if req.LastName != nil {
 		subscriber.LastName = req.LastName
 	}
+	if req.Timezone != nil {
+		if *req.Timezone == "" {
+			subscriber.Timezone = nil
+			subscriber.TimezoneSource = nil
+		} else {
+			tz, err := NormalizeTimezone(*req.Timezone)
+			if err != nil {
+				return nil, err
+			}
+			setTimezone(subscriber, tz, models.TimezoneSourceAPI)
+		}
+	}
 
 	if err := s.db.Save(subscriber).Error; err != nil {
 		return nil, errors.New("failed to update subscriber")
 	}
 
 	if req.TagIDs != nil {
-		if err := s.updateTags(subscriber.ID, req.TagIDs); err != nil {
+		added, removed, err := s.updateTags(subscriber.ID, req.TagIDs)
+		if err != nil {
 			return nil, err
 		}
 		s.db.Preload("Tags").First(subscriber, "id = ?", subscriber.ID)
+		NewWorkflowService().TriggerTagChanges(creatorID, subscriber.ID, added, removed)
 	}
 
 	return subscriber, nil
@@ -182,18 +227,75 @@ func (s *SubscriberService) Delete(id uuid.UUID, creatorID uuid.UUID) error {
 	return nil
 }
 
-func (s *SubscriberService) Unsubscribe(token string) error {
+// FindByUnsubscribeToken looks up the subscriber behind an unsubscribe link
+func (s *SubscriberService) FindByUnsubscribeToken(token string) (*models.Subscriber, error) {
 	var subscriber models.Subscriber
-	result := s.db.Where("unsubscribe_token = ?", token).First(&subscriber)
-	if result.Error != nil {
-		return errors.New("invalid unsubscribe token")
+	if err := s.db.Where("unsubscribe_token = ?", token).First(&subscriber).Error; err != nil {
+		return nil, errors.New("invalid unsubscribe token")
+	}
+	return &subscriber, nil
+}
+
+// SetTimezoneByToken records the timezone a subscriber picked in the
+// preference center
+func (s *SubscriberService) SetTimezoneByToken(token, timezone string) (*models.Subscriber, error) {
+	subscriber, err := s.FindByUnsubscribeToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	tz, err := NormalizeTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+	setTimezone(subscriber, tz, models.TimezoneSourcePreferences)
+
+	if err := s.db.Model(subscriber).Updates(map[string]interface{}{
+		"timezone":        subscriber.Timezone,
+		"timezone_source": subscriber.TimezoneSource,
+	}).Error; err != nil {
+		return nil, errors.New("failed to update preferences")
+	}
+	return subscriber, nil
+}
+
+func setTimezone(subscriber *models.Subscriber, tz, source string) {
+	subscriber.Timezone = &tz
+	subscriber.TimezoneSource = &source
+}
+
+// Unsubscribe opts a subscriber out. Repeated requests are no-ops. When the
+// link came from a campaign the unsubscribe is recorded against it.
+func (s *SubscriberService) Unsubscribe(token string, campaignID *uuid.UUID) error {
+	subscriber, err := s.FindByUnsubscribeToken(token)
+	if err != nil {
+		return err
+	}
+	if subscriber.Status != models.SubscriberStatusActive {
+		return nil
 	}
 
 	now := time.Now()
 	subscriber.Status = models.SubscriberStatusUnsubscribed
 	subscriber.UnsubscribedAt = &now
 
-	return s.db.Save(&subscriber).Error
+	if err := s.db.Save(subscriber).Error; err != nil {
+		return err
+	}
+
+	if campaignID != nil {
+		var count int64
+		s.db.Model(&models.Campaign{}).Where("id = ? AND creator_id = ?", *campaignID, subscriber.CreatorID).Count(&count)
+		if count > 0 {
+			NewAnalyticsService().RecordEvent(&models.EmailEvent{
+				CampaignID:   *campaignID,
+				SubscriberID: subscriber.ID,
+				EventType:    models.EmailEventUnsubscribe,
+			})
+		}
+	}
+
+	return nil
 }
 
 func (s *SubscriberService) BulkCreate(subscribers []CreateSubscriberRequest, creatorID uuid.UUID, source string) (int, int, error) {
@@ -204,7 +306,7 @@ func (s *SubscriberService) BulkCreate(subscribers []CreateSubscriberRequest, cr
 		if source != "" && req.Source == nil {
 			req.Source = &source
 		}
-		_, err := s.Create(&req, creatorID)
+		_, err := s.create(&req, creatorID, false)
 		if err != nil {
 			skipped++
 		} else {
@@ -233,24 +335,49 @@ func (s *SubscriberService) GetStats(creatorID uuid.UUID) (map[string]int64, err
 	return stats, nil
 }
 
-func (s *SubscriberService) updateTags(subscriberID uuid.UUID, tagIDs []string) error {
-	// Clear existing tags
-	s.db.Exec("DELETE FROM subscriber_tags WHERE subscriber_id = ?", subscriberID)
-
-	if len(tagIDs) == 0 {
-		return nil
+// updateTags replaces a subscriber's tags and returns the tags it added and
+// removed
+func (s *SubscriberService) updateTags(subscriberID uuid.UUID, tagIDs []string) ([]uuid.UUID, []uuid.UUID, error) {
+	var current []uuid.UUID
+	if err := s.db.Table("subscriber_tags").Where("subscriber_id = ?", subscriberID).Pluck("tag_id", &current).Error; err != nil {
+		return nil, nil, err
 	}
 
-	// Add new tags
+	wanted := make(map[uuid.UUID]bool, len(tagIDs))
 	for _, tagIDStr := range tagIDs {
 		tagID, err := uuid.Parse(tagIDStr)
 		if err != nil {
 			continue
 		}
-		s.db.Exec("INSERT INTO subscriber_tags (subscriber_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", subscriberID, tagID)
+		wanted[tagID] = true
 	}
 
-	return nil
+	// Clear tags no longer wanted
+	var removed []uuid.UUID
+	had := make(map[uuid.UUID]bool, len(current))
+	for _, tagID := range current {
+		had[tagID] = true
+		if !wanted[tagID] {
+			removed = append(removed, tagID)
+		}
+	}
+	if len(removed) > 0 {
+		s.db.Exec("DELETE FROM subscriber_tags WHERE subscriber_id = ? AND tag_id IN ?", subscriberID, removed)
+	}
+
+	// Add new tags
+	var added []uuid.UUID
+	for tagID := range wanted {
+		if had[tagID] {
+			continue
+		}
+		result := s.db.Exec("INSERT INTO subscriber_tags (subscriber_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", subscriberID, tagID)
+		if result.Error == nil && result.RowsAffected > 0 {
+			added = append(added, tagID)
+		}
+	}
+
+	return added, removed, nil
 }
 
 func generateToken(length int) (string, error) {
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrRecipientSuppressed is returned when a send targets a suppressed address
+var ErrRecipientSuppressed = errors.New("recipient is on the suppression list")
+
+// ErrSuppressionCheckFailed is returned when the suppression list couldn't be
+// read, so the send should be tried again later
+var ErrSuppressionCheckFailed = errors.New("suppression list unavailable")
+
+// NormalizeEmail is the form addresses are stored and matched in on the
+// suppression list
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// SuppressionService manages the global and per-creator suppression lists.
+// A nil creator ID means the platform-wide list.
+type SuppressionService struct {
+	db *gorm.DB
+}
+
+func NewSuppressionService() *SuppressionService {
+	return &SuppressionService{
+		db: database.GetDB(),
+	}
+}
+
+type AddSuppressionRequest struct {
+	Email  string                   `json:"email" binding:"required,email"`
+	Reason models.SuppressionReason `json:"reason"`
+	Note   *string                  `json:"note"`
+}
+
+type SuppressionFilter struct {
+	Email    string
+	Reason   string
+	Page     int
+	PageSize int
+}
+
+// scoped restricts a query to one suppression list
+func scoped(query *gorm.DB, creatorID *uuid.UUID) *gorm.DB {
+	if creatorID == nil {
+		return query.Where("creator_id IS NULL")
+	}
+	return query.Where("creator_id = ?", *creatorID)
+}
+
+// Add puts an address on a list. Adding an address that is already listed is
+// not an error; the existing entry is returned with created=false.
+func (s *SuppressionService) Add(creatorID *uuid.UUID, req *AddSuppressionRequest, source string, actorID *uuid.UUID) (*models.Suppression, bool, error) {
+	email := NormalizeEmail(req.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, false, errors.New("invalid email address")
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = models.SuppressionReasonManual
+	}
+	if !reason.IsValid() {
+		return nil, false, errors.New("invalid suppression reason")
+	}
+
+	entry := &models.Suppression{
+		Email:     email,
+		CreatorID: creatorID,
+		Reason:    reason,
+		Source:    source,
+		Note:      req.Note,
+		CreatedBy: actorID,
+	}
+	created := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Suppression
+		err := scoped(tx.Where("email = ?", email), creatorID).First(&existing).Error
+		if err == nil {
+			*entry = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		created = true
+
+		return tx.Create(&models.SuppressionAudit{
+			Email:     email,
+			CreatorID: creatorID,
+			Action:    models.SuppressionActionAdded,
+			Reason:    reason,
+			Source:    source,
+			Note:      req.Note,
+			ActorID:   actorID,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return entry, created, nil
+}
+
+// Suppress adds an entry on behalf of the system, e.g. after a hard bounce
+func (s *SuppressionService) Suppress(creatorID *uuid.UUID, email string, reason models.SuppressionReason, source string) {
+	_, created, err := s.Add(creatorID, &AddSuppressionRequest{Email: email, Reason: reason}, source, nil)
+	if err != nil {
+		log.Printf("[Suppression] Failed to suppress %s: %v", email, err)
+		return
+	}
+	if created {
+		log.Printf("[Suppression] Suppressed %s (%s)", email, reason)
+	}
+}
+
+// Remove deletes an entry from the given list and records who removed it
+func (s *SuppressionService) Remove(id uuid.UUID, creatorID *uuid.UUID, actorID *uuid.UUID, note *string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var entry models.Suppression
+		if err := scoped(tx.Where("id = ?", id), creatorID).First(&entry).Error; err != nil {
+			return errors.New("suppression not found")
+		}
+
+		if err := tx.Delete(&entry).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.SuppressionAudit{
+			Email:     entry.Email,
+			CreatorID: creatorID,
+			Action:    models.SuppressionActionRemoved,
+			Reason:    entry.Reason,
+			Source:    "api",
+			Note:      note,
+			ActorID:   actorID,
+		}).Error
+	})
+}
+
+// Check returns the entry blocking mail to email from creatorID, or nil. The
+// global list always applies; a nil creator checks only the global list. An
+// error means the list couldn't be read, not that the address is clear.
+func (s *SuppressionService) Check(email string, creatorID *uuid.UUID) (*models.Suppression, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+
+	query := s.db.Where("email = ?", NormalizeEmail(email))
+	if creatorID != nil {
+		query = query.Where("creator_id IS NULL OR creator_id = ?", *creatorID)
+	} else {
+		query = query.Where("creator_id IS NULL")
+	}
+
+	var entry models.Suppression
+	err := query.First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Suppressed returns which of emails are blocked for creatorID, keyed by
+// normalized address
+func (s *SuppressionService) Suppressed(emails []string, creatorID uuid.UUID) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(emails) == 0 {
+		return result, nil
+	}
+
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		normalized[i] = NormalizeEmail(email)
+	}
+
+	var matched []string
+	err := s.db.Model(&models.Suppression{}).
+		Where("email IN ? AND (creator_id IS NULL OR creator_id = ?)", normalized, creatorID).
+		Pluck("email", &matched).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, email := range matched {
+		result[email] = true
+	}
+	return result, nil
+}
+
+// List returns one page of a suppression list
+func (s *SuppressionService) List(creatorID *uuid.UUID, filter *SuppressionFilter) ([]models.Suppression, int64, error) {
+	var entries []models.Suppression
+	var total int64
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 100 {
+		filter.PageSize = 50
+	}
+	offset := (filter.Page - 1) * filter.PageSize
+
+	query := scoped(s.db.Model(&models.Suppression{}), creatorID)
+	if filter.Email != "" {
+		query = query.Where("email LIKE ?", "%"+NormalizeEmail(filter.Email)+"%")
+	}
+	if filter.Reason != "" {
+		query = query.Where("reason = ?", filter.Reason)
+	}
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Limit(filter.PageSize).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// All returns a whole suppression list, for export
+func (s *SuppressionService) All(creatorID *uuid.UUID) ([]models.Suppression, error) {
+	var entries []models.Suppression
+	if err := scoped(s.db, creatorID).Order("email").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Import adds many entries at once, returning how many were new and how many
+// were already listed or invalid
+func (s *SuppressionService) Import(creatorID *uuid.UUID, entries []AddSuppressionRequest, actorID *uuid.UUID) (int, int) {
+	added := 0
+	skipped := 0
+
+	for i := range entries {
+		_, created, err := s.Add(creatorID, &entries[i], "import", actorID)
+		if err != nil || !created {
+			skipped++
+			continue
+		}
+		added++
+	}
+
+	return added, skipped
+}
+
+// GetAudit lists the change history of a suppression list, newest first
+func (s *SuppressionService) GetAudit(creatorID *uuid.UUID, email string, page, pageSize int) ([]models.SuppressionAudit, int64, error) {
+	var entries []models.SuppressionAudit
+	var total int64
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 50
+	}
+	offset := (page - 1) * pageSize
+
+	query := scoped(s.db.Model(&models.SuppressionAudit{}), creatorID)
+	if email != "" {
+		query = query.Where("email = ?", NormalizeEmail(email))
+	}
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
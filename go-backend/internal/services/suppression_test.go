@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// unreachableDB is a handle whose queries all fail to connect
+func unreachableDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	dsn := "host=127.0.0.1 user=test dbname=test sslmode=disable connect_timeout=2 port=" + strconv.Itoa(addr.Port)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSuppressionCheckFailsClosed(t *testing.T) {
+	creatorID := uuid.New()
+	s := &SuppressionService{db: unreachableDB(t)}
+
+	entry, err := s.Check("reader@example.org", &creatorID)
+	if err == nil {
+		t.Fatalf("Check() = %+v, nil; want the lookup error", entry)
+	}
+	if entry != nil {
+		t.Errorf("Check() returned an entry with its error: %+v", entry)
+	}
+
+	// The registry refuses to send rather than treat the address as clear
+	sink := newSMTPSink(t, "")
+	smtp := sink.service()
+	defer smtp.Close()
+	smtp.SetSignerLookup(nil)
+
+	registry := &MailerRegistry{
+		providers:    map[string]Mailer{},
+		suppressions: s,
+		defaults: map[models.MessageClass]mailRoute{
+			models.MessageClassBulk: {primary: smtp.Name()},
+		},
+	}
+	registry.Register(smtp)
+
+	_, err = registry.Send(&EmailRequest{
+		To:          EmailRecipient{Email: "reader@example.org"},
+		Subject:     "This week",
+		TextContent: "Hello",
+		Class:       models.MessageClassBulk,
+		CreatorID:   &creatorID,
+	})
+	if !errors.Is(err, ErrSuppressionCheckFailed) {
+		t.Errorf("Send() error = %v, want ErrSuppressionCheckFailed", err)
+	}
+	if errors.Is(err, ErrRecipientSuppressed) {
+		t.Error("an unreadable list was reported as a suppressed recipient")
+	}
+	if n := len(sink.received()); n != 0 {
+		t.Errorf("sink received %d messages, want none", n)
+	}
+}
+
+func TestSuppressionCheckWithoutDatabase(t *testing.T) {
+	entry, err := (&SuppressionService{}).Check("reader@example.org", nil)
+	if entry != nil || err != nil {
+		t.Errorf("Check() = %+v, %v; want nil, nil", entry, err)
+	}
+}
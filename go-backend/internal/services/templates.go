@@ -439,6 +439,7 @@ func (s *TemplateService) PreviewTemplate(id uuid.UUID, creatorID uuid.UUID) (st
 		"Content":           "<p>This is sample newsletter content for preview purposes.</p>",
 		"DashboardURL":      "https://example.com/dashboard",
 		"UnsubscribeURL":    "https://example.com/unsubscribe/sample-token",
+		"PreferencesURL":    "https://example.com/preferences/sample-token",
 		"ReferrerName":      "Jane Smith",
 		"ReferrerInitial":   "J",
 		"ReferrerEmail":     "jane@example.com",
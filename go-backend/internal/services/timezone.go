@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// NormalizeTimezone checks that name is an IANA timezone and returns it in
+// canonical form
+func NormalizeTimezone(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "Local" {
+		return "", ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return "", ErrInvalidTimezone
+	}
+	return loc.String(), nil
+}
+
+// GeoIP lookups read an offline MaxMind City database (GeoLite2-City or
+// GeoIP2-City) from GEOIP_DB_PATH. Without one, no timezones are inferred.
+var (
+	geoIPOnce   sync.Once
+	geoIPReader *maxminddb.Reader
+)
+
+type geoIPRecord struct {
+	Location struct {
+		TimeZone string `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+func geoIP() *maxminddb.Reader {
+	geoIPOnce.Do(func() {
+		path := os.Getenv("GEOIP_DB_PATH")
+		if path == "" {
+			return
+		}
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			log.Printf("[GeoIP] Failed to open %s: %v", path, err)
+			return
+		}
+		geoIPReader = reader
+	})
+	return geoIPReader
+}
+
+// TimezoneForIP returns the timezone an IP address is located in, or "" when
+// it can't be told
+func TimezoneForIP(ip string) string {
+	reader := geoIP()
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if reader == nil || addr == nil || addr.IsPrivate() || addr.IsLoopback() {
+		return ""
+	}
+
+	var record geoIPRecord
+	if err := reader.Lookup(addr, &record); err != nil {
+		return ""
+	}
+	tz, err := NormalizeTimezone(record.Location.TimeZone)
+	if err != nil {
+		return ""
+	}
+	return tz
+}
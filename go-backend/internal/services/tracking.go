@@ -0,0 +1,228 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Attributes that exclude a single link from click tracking. clicktracking
+// is the attribute SendGrid uses, so existing templates keep working.
+var trackingOptOutAttrs = map[string]string{
+	"data-notrack":  "",
+	"data-track":    "false",
+	"clicktracking": "off",
+}
+
+// TrackingService instruments campaign HTML with our own open pixel and
+// click-tracking links
+type TrackingService struct {
+	db      *gorm.DB
+	baseURL string
+	key     []byte
+
+	mu    sync.Mutex
+	links map[string]uuid.UUID // campaign ID + URL hash -> link ID
+}
+
+func NewTrackingService() *TrackingService {
+	return &TrackingService{
+		db:      database.GetDB(),
+		baseURL: os.Getenv("APP_BASE_URL"),
+		key:     trackingKey(),
+		links:   make(map[string]uuid.UUID),
+	}
+}
+
+// Instrument rewrites every trackable <a href> to the click endpoint and
+// appends the open pixel to the body
+func (s *TrackingService) Instrument(content string, campaignID, subscriberID uuid.UUID) (string, error) {
+	if len(s.key) == 0 {
+		return "", ErrTrackingNotConfigured
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	var body *html.Node
+	var walkErr error
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Body:
+				body = n
+			case atom.A:
+				if err := s.rewriteLink(n, campaignID, subscriberID); err != nil && walkErr == nil {
+					walkErr = err
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	if walkErr != nil {
+		return "", walkErr
+	}
+
+	if body != nil {
+		pixel, err := s.openURL(campaignID, subscriberID)
+		if err != nil {
+			return "", err
+		}
+		body.AppendChild(&html.Node{
+			Type:     html.ElementNode,
+			Data:     "img",
+			DataAtom: atom.Img,
+			Attr: []html.Attribute{
+				{Key: "src", Val: pixel},
+				{Key: "width", Val: "1"},
+				{Key: "height", Val: "1"},
+				{Key: "alt", Val: ""},
+				{Key: "style", Val: "display:block;width:1px;height:1px;border:0;"},
+			},
+		})
+	}
+
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// rewriteLink points one anchor at the click endpoint unless it is opted out
+// or must not be tracked
+func (s *TrackingService) rewriteLink(n *html.Node, campaignID, subscriberID uuid.UUID) error {
+	hrefIdx := -1
+	optedOut := false
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if want, ok := trackingOptOutAttrs[key]; ok && (want == "" || strings.EqualFold(attr.Val, want)) {
+			optedOut = true
+			// Our own markers are dropped; clicktracking is left for SendGrid
+			if key != "clicktracking" {
+				continue
+			}
+		}
+		if key == "href" {
+			hrefIdx = len(attrs)
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+
+	if hrefIdx < 0 || optedOut {
+		return nil
+	}
+
+	href := strings.TrimSpace(n.Attr[hrefIdx].Val)
+	if !s.trackable(href) {
+		return nil
+	}
+
+	linkID, err := s.linkID(campaignID, href)
+	if err != nil {
+		return err
+	}
+	click, err := s.clickURL(campaignID, subscriberID, linkID)
+	if err != nil {
+		return err
+	}
+	n.Attr[hrefIdx].Val = click
+	return nil
+}
+
+// trackable reports whether a link should go through the click endpoint.
+// mailto:, anchors and other non-web links are left alone, and so are
+// unsubscribe and preference links, which must keep working without a
+// redirect.
+func (s *TrackingService) trackable(href string) bool {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return false
+	}
+	if strings.Contains(parsed.Path, "/api/unsubscribe/") || strings.Contains(parsed.Path, "/api/preferences/") ||
+		strings.Contains(parsed.Path, "/api/t/") {
+		return false
+	}
+	return true
+}
+
+// linkID returns the ID of a campaign link, creating the row on first use
+func (s *TrackingService) linkID(campaignID uuid.UUID, target string) (uuid.UUID, error) {
+	sum := sha256.Sum256([]byte(target))
+	hash := hex.EncodeToString(sum[:])
+	key := campaignID.String() + ":" + hash
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.links[key]; ok {
+		return id, nil
+	}
+
+	link := models.CampaignLink{
+		CampaignID: campaignID,
+		URLHash:    hash,
+		URL:        target,
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error; err != nil {
+		return uuid.Nil, err
+	}
+	// Another worker registered the link first
+	if link.ID == uuid.Nil {
+		if err := s.db.Where("campaign_id = ? AND url_hash = ?", campaignID, hash).First(&link).Error; err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	s.links[key] = link.ID
+	return link.ID, nil
+}
+
+// ResolveLink returns a tracked link of a campaign
+func (s *TrackingService) ResolveLink(campaignID, linkID uuid.UUID) (*models.CampaignLink, error) {
+	var link models.CampaignLink
+	if err := s.db.Where("id = ? AND campaign_id = ?", linkID, campaignID).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (s *TrackingService) openURL(campaignID, subscriberID uuid.UUID) (string, error) {
+	token, err := s.OpenToken(campaignID, subscriberID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/api/t/o/%s", s.baseURL, token), nil
+}
+
+func (s *TrackingService) clickURL(campaignID, subscriberID, linkID uuid.UUID) (string, error) {
+	token, err := s.ClickToken(campaignID, subscriberID, linkID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/api/t/c/%s", s.baseURL, token), nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTrackingToken is returned for tracking tokens that are malformed,
+// of the wrong kind or fail signature verification
+var ErrInvalidTrackingToken = errors.New("invalid tracking token")
+
+// ErrTrackingNotConfigured is returned when there is no secret to sign
+// tracking tokens with
+var ErrTrackingNotConfigured = errors.New("tracking secret not configured")
+
+const (
+	trackingKindOpen  byte = 'o'
+	trackingKindClick byte = 'c'
+
+	trackingMACSize = 16
+)
+
+// TrackingTarget is what a verified tracking token refers to
+type TrackingTarget struct {
+	CampaignID   uuid.UUID
+	SubscriberID uuid.UUID
+	LinkID       uuid.UUID // click tokens only
+}
+
+var trackingKeyWarning sync.Once
+
+// trackingKey derives the signing key from TRACKING_SECRET, falling back to
+// JWT_SECRET so existing deployments get signed links without new config.
+// Nil without either: nothing is signed or accepted rather than using a key
+// anyone could compute.
+func trackingKey() []byte {
+	secret := os.Getenv("TRACKING_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		trackingKeyWarning.Do(func() {
+			log.Println("[Tracking] TRACKING_SECRET is not set, campaigns are sent without open and click tracking")
+		})
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("newsletter-tracking-v1"))
+	return mac.Sum(nil)
+}
+
+// OpenToken signs the campaign and subscriber of an open pixel
+func (s *TrackingService) OpenToken(campaignID, subscriberID uuid.UUID) (string, error) {
+	return s.signToken(trackingKindOpen, campaignID, subscriberID)
+}
+
+// ClickToken signs the campaign, subscriber and link of a tracked link
+func (s *TrackingService) ClickToken(campaignID, subscriberID, linkID uuid.UUID) (string, error) {
+	return s.signToken(trackingKindClick, campaignID, subscriberID, linkID)
+}
+
+// ParseOpenToken verifies an open pixel token
+func (s *TrackingService) ParseOpenToken(token string) (*TrackingTarget, error) {
+	ids, err := s.verifyToken(trackingKindOpen, token, 2)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackingTarget{CampaignID: ids[0], SubscriberID: ids[1]}, nil
+}
+
+// ParseClickToken verifies a click token
+func (s *TrackingService) ParseClickToken(token string) (*TrackingTarget, error) {
+	ids, err := s.verifyToken(trackingKindClick, token, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackingTarget{CampaignID: ids[0], SubscriberID: ids[1], LinkID: ids[2]}, nil
+}
+
+// signToken encodes kind | ids | truncated HMAC-SHA256 as unpadded base64url
+func (s *TrackingService) signToken(kind byte, ids ...uuid.UUID) (string, error) {
+	if len(s.key) == 0 {
+		return "", ErrTrackingNotConfigured
+	}
+
+	raw := make([]byte, 0, 1+16*len(ids)+trackingMACSize)
+	raw = append(raw, kind)
+	for _, id := range ids {
+		raw = append(raw, id[:]...)
+	}
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(raw)
+	raw = append(raw, mac.Sum(nil)[:trackingMACSize]...)
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (s *TrackingService) verifyToken(kind byte, token string, count int) ([]uuid.UUID, error) {
+	if len(s.key) == 0 {
+		return nil, ErrInvalidTrackingToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 1+16*count+trackingMACSize || raw[0] != kind {
+		return nil, ErrInvalidTrackingToken
+	}
+
+	payload := raw[:len(raw)-trackingMACSize]
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil)[:trackingMACSize], raw[len(payload):]) {
+		return nil, ErrInvalidTrackingToken
+	}
+
+	ids := make([]uuid.UUID, count)
+	for i := range ids {
+		copy(ids[i][:], payload[1+16*i:1+16*(i+1)])
+	}
+	return ids, nil
+}
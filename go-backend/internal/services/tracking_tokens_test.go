@@ -0,0 +1,132 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTrackingTokens(t *testing.T) {
+	t.Setenv("TRACKING_SECRET", "s3cret")
+	t.Setenv("JWT_SECRET", "")
+	s := &TrackingService{key: trackingKey()}
+
+	campaignID := uuid.MustParse("0b6d9a52-3c1e-4f7a-8d2b-5e4f3a2b1c0d")
+	subscriberID := uuid.MustParse("6f1c2a4e-8b3d-4c5e-9f70-123456789abc")
+	linkID := uuid.MustParse("9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b")
+
+	open, err := s.OpenToken(campaignID, subscriberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	click, err := s.ClickToken(campaignID, subscriberID, linkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tamper flips one bit of the decoded token at offset
+	tamper := func(token string, offset int) string {
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[offset] ^= 0x01
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	tests := []struct {
+		name  string
+		parse func(string) (*TrackingTarget, error)
+		token string
+		want  *TrackingTarget // nil when the token must be rejected
+	}{
+		{name: "open", parse: s.ParseOpenToken, token: open, want: &TrackingTarget{CampaignID: campaignID, SubscriberID: subscriberID}},
+		{name: "click", parse: s.ParseClickToken, token: click, want: &TrackingTarget{CampaignID: campaignID, SubscriberID: subscriberID, LinkID: linkID}},
+		{name: "open with tampered campaign", parse: s.ParseOpenToken, token: tamper(open, 1)},
+		{name: "open with tampered subscriber", parse: s.ParseOpenToken, token: tamper(open, 17)},
+		{name: "click with tampered link", parse: s.ParseClickToken, token: tamper(click, 33)},
+		{name: "open with tampered mac", parse: s.ParseOpenToken, token: tamper(open, 1+32)},
+		{name: "click token as an open", parse: s.ParseOpenToken, token: click},
+		{name: "open token as a click", parse: s.ParseClickToken, token: open},
+		{name: "open with a click's kind byte", parse: s.ParseClickToken, token: tamper(open, 0)},
+		{name: "truncated open", parse: s.ParseOpenToken, token: open[:len(open)-4]},
+		{name: "truncated click", parse: s.ParseClickToken, token: click[:len(click)-1]},
+		{name: "empty", parse: s.ParseOpenToken, token: ""},
+		{name: "not base64url", parse: s.ParseOpenToken, token: "not+a/token=="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(tt.token)
+			if tt.want == nil {
+				if !errors.Is(err, ErrInvalidTrackingToken) {
+					t.Errorf("parse(%q) = %+v, %v; want ErrInvalidTrackingToken", tt.token, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse(%q): %v", tt.token, err)
+			}
+			if *got != *tt.want {
+				t.Errorf("parse(%q) = %+v, want %+v", tt.token, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("signed with another secret", func(t *testing.T) {
+		t.Setenv("TRACKING_SECRET", "other")
+		other := &TrackingService{key: trackingKey()}
+		if _, err := other.ParseOpenToken(open); !errors.Is(err, ErrInvalidTrackingToken) {
+			t.Errorf("token verified under a different secret: %v", err)
+		}
+	})
+}
+
+func TestTrackingTokensWithoutSecret(t *testing.T) {
+	t.Setenv("TRACKING_SECRET", "s3cret")
+	t.Setenv("JWT_SECRET", "")
+	signed := &TrackingService{key: trackingKey()}
+	open, err := signed.OpenToken(uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TRACKING_SECRET", "")
+	s := &TrackingService{key: trackingKey()}
+	if _, err := s.OpenToken(uuid.New(), uuid.New()); !errors.Is(err, ErrTrackingNotConfigured) {
+		t.Errorf("OpenToken() error = %v, want ErrTrackingNotConfigured", err)
+	}
+	if _, err := s.ClickToken(uuid.New(), uuid.New(), uuid.New()); !errors.Is(err, ErrTrackingNotConfigured) {
+		t.Errorf("ClickToken() error = %v, want ErrTrackingNotConfigured", err)
+	}
+	if _, err := s.Instrument("<html><body><a href=\"https://example.com\">x</a></body></html>", uuid.New(), uuid.New()); !errors.Is(err, ErrTrackingNotConfigured) {
+		t.Errorf("Instrument() error = %v, want ErrTrackingNotConfigured", err)
+	}
+
+	// Nothing verifies either, including a token that was valid under a secret
+	if _, err := s.ParseOpenToken(open); !errors.Is(err, ErrInvalidTrackingToken) {
+		t.Errorf("ParseOpenToken() error = %v, want ErrInvalidTrackingToken", err)
+	}
+	empty := hmacTokenWithEmptySecret(t)
+	if _, err := s.ParseOpenToken(empty); !errors.Is(err, ErrInvalidTrackingToken) {
+		t.Errorf("token signed with an empty secret verified: %v", err)
+	}
+}
+
+// hmacTokenWithEmptySecret forges an open token the way the key was derived
+// before an empty secret was refused
+func hmacTokenWithEmptySecret(t *testing.T) string {
+	t.Helper()
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte("newsletter-tracking-v1"))
+	forger := &TrackingService{key: mac.Sum(nil)}
+	token, err := forger.OpenToken(uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/okemwag/newsletter/internal/models"
+)
+
+// SendVerificationEmail sends email verification OTP
+func (r *MailerRegistry) SendVerificationEmail(email, code string) error {
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<style>
+		body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #0a0a0a; color: #fff; padding: 40px; }
+		.container { max-width: 500px; margin: 0 auto; background: #111; border: 1px solid #222; border-radius: 12px; padding: 40px; }
+		.logo { text-align: center; margin-bottom: 30px; }
+		.logo span { font-size: 32px; font-weight: bold; background: linear-gradient(135deg, #06b6d4, #a855f7); -webkit-background-clip: text; -webkit-text-fill-color: transparent; }
+		h1 { text-align: center; font-size: 24px; margin-bottom: 16px; }
+		.code { text-align: center; font-size: 36px; font-weight: bold; letter-spacing: 8px; color: #06b6d4; background: rgba(6, 182, 212, 0.1); padding: 20px; border-radius: 8px; margin: 30px 0; font-family: monospace; }
+		p { color: #888; line-height: 1.6; text-align: center; }
+		.footer { margin-top: 40px; text-align: center; font-size: 12px; color: #555; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="logo"><span>Pulse</span></div>
+		<h1>Verify your email</h1>
+		<p>Enter this code to verify your email address and continue with onboarding.</p>
+		<div class="code">%s</div>
+		<p>This code expires in 15 minutes. If you didn't request this, please ignore this email.</p>
+		<div class="footer">© 2024 Pulse. All rights reserved.</div>
+	</div>
+</body>
+</html>`, code)
+
+	_, err := r.Send(&EmailRequest{
+		To:          EmailRecipient{Email: email},
+		Subject:     "Your Pulse verification code: " + code,
+		HTMLContent: html,
+		TextContent: fmt.Sprintf("Your Pulse verification code is: %s\n\nThis code expires in 15 minutes.", code),
+		Class:       models.MessageClassTransactional,
+	})
+	return err
+}
+
+// SendCampaignPausedEmail tells a creator that the sending circuit breaker
+// stopped one of their campaigns
+func (r *MailerRegistry) SendCampaignPausedEmail(creator *models.User, campaign *models.Campaign, hold *models.SendingHold) error {
+	cause := fmt.Sprintf("the bounce rate reached %.2f%%", hold.BounceRate)
+	if hold.Reason == "complaint_rate" {
+		cause = fmt.Sprintf("the spam complaint rate reached %.2f%%", hold.ComplaintRate)
+	}
+	if hold.Scope == models.HoldScopePlatform {
+		cause = "platform-wide sending was paused to protect delivery for all senders"
+	}
+
+	content := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<style>
+		body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #0a0a0a; color: #fff; padding: 40px; }
+		.container { max-width: 500px; margin: 0 auto; background: #111; border: 1px solid #222; border-radius: 12px; padding: 40px; }
+		.logo { text-align: center; margin-bottom: 30px; }
+		.logo span { font-size: 32px; font-weight: bold; background: linear-gradient(135deg, #06b6d4, #a855f7); -webkit-background-clip: text; -webkit-text-fill-color: transparent; }
+		h1 { text-align: center; font-size: 24px; margin-bottom: 16px; }
+		p { color: #888; line-height: 1.6; text-align: center; }
+		.footer { margin-top: 40px; text-align: center; font-size: 12px; color: #555; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="logo"><span>Pulse</span></div>
+		<h1>Your campaign was paused</h1>
+		<p>Hi %s, we paused sending <strong>%s</strong> because %s.</p>
+		<p>Our team will review the send before it resumes. Recipients who haven't received it yet will get it once the hold is released.</p>
+		<div class="footer">© 2024 Pulse. All rights reserved.</div>
+	</div>
+</body>
+</html>`, html.EscapeString(creator.FirstName), html.EscapeString(campaign.Title), cause)
+
+	_, err := r.Send(&EmailRequest{
+		To:          EmailRecipient{Email: creator.Email, FirstName: creator.FirstName},
+		Subject:     "Campaign paused: " + campaign.Title,
+		HTMLContent: content,
+		TextContent: fmt.Sprintf("Hi %s,\n\nWe paused sending \"%s\" because %s.\n\nOur team will review the send before it resumes.", creator.FirstName, campaign.Title, cause),
+		Class:       models.MessageClassTransactional,
+	})
+	return err
+}
+
+// SendDomainFailingEmail tells a creator that a verified sender domain
+// started failing authentication checks
+func (r *MailerRegistry) SendDomainFailingEmail(creator *models.User, domain *models.SenderDomain, failing []string) error {
+	checks := strings.Join(failing, ", ")
+
+	var items strings.Builder
+	for _, issue := range domain.Issues {
+		items.WriteString("<li>" + html.EscapeString(issue) + "</li>")
+	}
+
+	content := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<style>
+		body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #0a0a0a; color: #fff; padding: 40px; }
+		.container { max-width: 500px; margin: 0 auto; background: #111; border: 1px solid #222; border-radius: 12px; padding: 40px; }
+		.logo { text-align: center; margin-bottom: 30px; }
+		.logo span { font-size: 32px; font-weight: bold; background: linear-gradient(135deg, #06b6d4, #a855f7); -webkit-background-clip: text; -webkit-text-fill-color: transparent; }
+		h1 { text-align: center; font-size: 24px; margin-bottom: 16px; }
+		p, li { color: #888; line-height: 1.6; }
+		p { text-align: center; }
+		.footer { margin-top: 40px; text-align: center; font-size: 12px; color: #555; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="logo"><span>Pulse</span></div>
+		<h1>Check your DNS records</h1>
+		<p>Hi %s, <strong>%s</strong> no longer passes its %s check. Mail from it may be rejected or land in spam until the records are fixed.</p>
+		<ul>%s</ul>
+		<p>Open your domain settings to see the records we expect.</p>
+		<div class="footer">© 2024 Pulse. All rights reserved.</div>
+	</div>
+</body>
+</html>`, html.EscapeString(creator.FirstName), html.EscapeString(domain.Domain), checks, items.String())
+
+	_, err := r.Send(&EmailRequest{
+		To:          EmailRecipient{Email: creator.Email, FirstName: creator.FirstName},
+		Subject:     fmt.Sprintf("%s is failing %s", domain.Domain, checks),
+		HTMLContent: content,
+		TextContent: fmt.Sprintf("Hi %s,\n\n%s no longer passes its %s check:\n\n- %s\n\nOpen your domain settings to see the records we expect.",
+			creator.FirstName, domain.Domain, checks, strings.Join(domain.Issues, "\n- ")),
+		Class: models.MessageClassTransactional,
+	})
+	return err
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WarmupService ramps up the daily volume of new sending domains. Recipients
+// over a day's cap are held back to following days, most engaged first.
+type WarmupService struct {
+	db *gorm.DB
+}
+
+func NewWarmupService() *WarmupService {
+	return &WarmupService{db: database.GetDB()}
+}
+
+// warmupDefaults is the ramp new plans start with
+func warmupDefaults() (days, initial, target int) {
+	return envInt("WARMUP_DAYS", 30),
+		envInt("WARMUP_INITIAL_DAILY_LIMIT", 50),
+		envInt("WARMUP_TARGET_DAILY_LIMIT", 100000)
+}
+
+// WarmupLimit is a plan's cap on day n of the ramp (0 is the start date), or
+// -1 once the ramp is over. Without explicit DailyLimits the cap grows by the
+// same factor every day from InitialDailyLimit to TargetDailyLimit.
+func WarmupLimit(plan *models.WarmupPlan, n int) int64 {
+	if n < 0 {
+		n = 0
+	}
+	if len(plan.DailyLimits) > 0 {
+		if n >= len(plan.DailyLimits) {
+			return -1
+		}
+		return int64(plan.DailyLimits[n])
+	}
+	if n >= plan.Days {
+		return -1
+	}
+
+	initial, target := float64(plan.InitialDailyLimit), float64(plan.TargetDailyLimit)
+	if plan.Days <= 1 || initial <= 0 || initial >= target {
+		return int64(plan.TargetDailyLimit)
+	}
+	growth := math.Pow(target/initial, float64(n)/float64(plan.Days-1))
+	return int64(math.Round(initial * growth))
+}
+
+// warmupLength is how many days a plan's ramp lasts
+func warmupLength(plan *models.WarmupPlan) int {
+	if len(plan.DailyLimits) > 0 {
+		return len(plan.DailyLimits)
+	}
+	return plan.Days
+}
+
+// warmupDay is how many days into the ramp the given day is
+func warmupDay(plan *models.WarmupPlan, day time.Time) int {
+	start := plan.StartDate.UTC().Truncate(24 * time.Hour)
+	return int(day.Sub(start).Hours() / 24)
+}
+
+// EnsurePlan starts a warm-up for the creator's current sending domain unless
+// it already has one. Called when a creator is activated.
+func (s *WarmupService) EnsurePlan(creatorID uuid.UUID) (*models.WarmupPlan, error) {
+	domain, err := creatorSendingDomain(creatorID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ensurePlan(creatorID, domain)
+}
+
+func (s *WarmupService) ensurePlan(creatorID uuid.UUID, domain string) (*models.WarmupPlan, error) {
+	days, initial, target := warmupDefaults()
+	plan := models.WarmupPlan{
+		CreatorID:         creatorID,
+		Domain:            domain,
+		Status:            models.WarmupStatusActive,
+		StartDate:         today(),
+		Days:              days,
+		InitialDailyLimit: initial,
+		TargetDailyLimit:  target,
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&plan).Error; err != nil {
+		return nil, err
+	}
+
+	var existing models.WarmupPlan
+	if err := s.db.Where("creator_id = ? AND domain = ?", creatorID, domain).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// ActivePlan returns the plan capping the creator's sends today, or nil.
+// Creators who already warmed up one domain warm up any domain they switch
+// to; creators from before warm-ups existed have no plan and are not capped.
+func (s *WarmupService) ActivePlan(creatorID uuid.UUID) (*models.WarmupPlan, error) {
+	domain, err := creatorSendingDomain(creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan models.WarmupPlan
+	err = s.db.Where("creator_id = ? AND domain = ?", creatorID, domain).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var count int64
+		s.db.Model(&models.WarmupPlan{}).Where("creator_id = ?", creatorID).Count(&count)
+		if count == 0 {
+			return nil, nil
+		}
+		created, err := s.ensurePlan(creatorID, domain)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[Warmup] Started warm-up of %q for creator %s", domain, creatorID)
+		plan = *created
+	} else if err != nil {
+		return nil, err
+	}
+
+	if plan.Status != models.WarmupStatusActive {
+		return nil, nil
+	}
+	if WarmupLimit(&plan, warmupDay(&plan, today())) < 0 {
+		s.db.Model(&plan).Update("status", models.WarmupStatusCompleted)
+		return nil, nil
+	}
+	return &plan, nil
+}
+
+// Schedule fits a campaign's pending deliveries into the creator's warm-up.
+// Today's remaining capacity goes to the most engaged subscribers; the rest
+// are held until the same time on following days. It reports whether a plan
+// applied, in which case the deliveries must not be re-spread.
+func (s *WarmupService) Schedule(campaign *models.Campaign) (bool, error) {
+	plan, err := s.ActivePlan(campaign.CreatorID)
+	if err != nil || plan == nil {
+		return false, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the plan so concurrent sends don't reserve the same capacity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.WarmupPlan{}, "id = ?", plan.ID).Error; err != nil {
+			return err
+		}
+		return s.reserve(tx, plan, campaign.ID)
+	})
+	return err == nil, err
+}
+
+// reserve assigns a campaign's pending deliveries to days of the plan
+func (s *WarmupService) reserve(tx *gorm.DB, plan *models.WarmupPlan, campaignID uuid.UUID) error {
+	var pending int64
+	tx.Model(&models.CampaignDelivery{}).
+		Where("campaign_id = ? AND status = ?", campaignID, models.DeliveryStatusPending).
+		Count(&pending)
+	if pending == 0 {
+		return nil
+	}
+
+	day := today()
+	var usage []models.WarmupUsage
+	if err := tx.Where("plan_id = ? AND day >= ?", plan.ID, day).Find(&usage).Error; err != nil {
+		return err
+	}
+	reserved := make(map[string]int64, len(usage))
+	for _, u := range usage {
+		reserved[u.Day.Format("2006-01-02")] = u.Reserved
+	}
+
+	now := time.Now()
+	start := warmupDay(plan, day)
+	var offset int64
+	for n := 0; offset < pending; n++ {
+		date := day.AddDate(0, 0, n)
+		take := pending - offset
+		if limit := WarmupLimit(plan, start+n); limit >= 0 {
+			available := limit - reserved[date.Format("2006-01-02")]
+			if available <= 0 {
+				continue
+			}
+			if take > available {
+				take = available
+			}
+		}
+
+		var notBefore *time.Time
+		if n > 0 {
+			at := now.AddDate(0, 0, n)
+			notBefore = &at
+		}
+		if err := s.assign(tx, campaignID, notBefore, offset, offset+take); err != nil {
+			return err
+		}
+		if err := s.addUsage(tx, plan.ID, date, take, 0); err != nil {
+			return err
+		}
+		offset += take
+	}
+	return nil
+}
+
+// assign sets the not-before time of pending deliveries ranked (from, to] by
+// their subscriber's engagement score
+func (s *WarmupService) assign(tx *gorm.DB, campaignID uuid.UUID, notBefore *time.Time, from, to int64) error {
+	return tx.Exec(`UPDATE campaign_deliveries SET not_before = ?, updated_at = NOW()
+		FROM (
+			SELECT d.id, ROW_NUMBER() OVER (ORDER BY s.engagement_score DESC, d.id) AS rank
+			FROM campaign_deliveries d
+			JOIN subscribers s ON s.id = d.subscriber_id
+			WHERE d.campaign_id = ? AND d.status = ?
+		) ranked
+		WHERE campaign_deliveries.id = ranked.id AND ranked.rank > ? AND ranked.rank <= ?`,
+		notBefore, campaignID, models.DeliveryStatusPending, from, to,
+	).Error
+}
+
+func (s *WarmupService) addUsage(tx *gorm.DB, planID uuid.UUID, day time.Time, reserved, sent int64) error {
+	return tx.Exec(`INSERT INTO warmup_usage (plan_id, day, reserved, sent, created_at, updated_at)
+		VALUES (?, ?, ?, ?, NOW(), NOW())
+		ON CONFLICT (plan_id, day) DO UPDATE SET
+			reserved = warmup_usage.reserved + EXCLUDED.reserved,
+			sent = warmup_usage.sent + EXCLUDED.sent,
+			updated_at = NOW()`,
+		planID, day, reserved, sent,
+	).Error
+}
+
+// RecordSent counts messages sent today against the creator's warm-up
+func (s *WarmupService) RecordSent(creatorID uuid.UUID, count int64) error {
+	plan, err := s.ActivePlan(creatorID)
+	if err != nil || plan == nil {
+		return err
+	}
+	return s.addUsage(s.db, plan.ID, today(), 0, count)
+}
+
+// WarmupDay is one day of a plan's schedule
+type WarmupDay struct {
+	Day        time.Time `json:"day"`
+	DailyLimit int64     `json:"dailyLimit"`
+	Reserved   int64     `json:"reserved"`
+	Sent       int64     `json:"sent"`
+}
+
+// WarmupProgress is how far a plan has got
+type WarmupProgress struct {
+	Plan       models.WarmupPlan `json:"plan"`
+	CurrentDay int               `json:"currentDay"` // 1 on the start date
+	TodayLimit int64             `json:"todayLimit"` // -1 once the ramp is over
+	Queued     int64             `json:"queued"`     // recipients held for later days
+	Schedule   []WarmupDay       `json:"schedule"`
+}
+
+// GetProgress returns the creator's warm-up plans with their daily schedule
+func (s *WarmupService) GetProgress(creatorID uuid.UUID) ([]WarmupProgress, error) {
+	var plans []models.WarmupPlan
+	if err := s.db.Where("creator_id = ?", creatorID).Order("created_at DESC").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+
+	day := today()
+	progress := make([]WarmupProgress, len(plans))
+	for i := range plans {
+		plan := &plans[i]
+
+		var usage []models.WarmupUsage
+		s.db.Where("plan_id = ?", plan.ID).Find(&usage)
+		byDay := make(map[string]models.WarmupUsage, len(usage))
+		for _, u := range usage {
+			byDay[u.Day.Format("2006-01-02")] = u
+		}
+
+		start := plan.StartDate.UTC().Truncate(24 * time.Hour)
+		schedule := make([]WarmupDay, warmupLength(plan))
+		for n := range schedule {
+			date := start.AddDate(0, 0, n)
+			u := byDay[date.Format("2006-01-02")]
+			schedule[n] = WarmupDay{
+				Day:        date,
+				DailyLimit: WarmupLimit(plan, n),
+				Reserved:   u.Reserved,
+				Sent:       u.Sent,
+			}
+		}
+
+		current := warmupDay(plan, day)
+		progress[i] = WarmupProgress{
+			Plan:       *plan,
+			CurrentDay: current + 1,
+			TodayLimit: WarmupLimit(plan, current),
+			Schedule:   schedule,
+		}
+		if plan.Status == models.WarmupStatusActive {
+			progress[i].Queued = s.queued(creatorID, day.AddDate(0, 0, 1))
+		}
+	}
+	return progress, nil
+}
+
+// queued counts the creator's pending deliveries held until after the given time
+func (s *WarmupService) queued(creatorID uuid.UUID, after time.Time) int64 {
+	var count int64
+	s.db.Model(&models.CampaignDelivery{}).
+		Joins("JOIN campaigns ON campaigns.id = campaign_deliveries.campaign_id").
+		Where("campaigns.creator_id = ? AND campaign_deliveries.status = ? AND campaign_deliveries.not_before >= ?",
+			creatorID, models.DeliveryStatusPending, after).
+		Count(&count)
+	return count
+}
+
+// WarmupFilter narrows the plan list for admins
+type WarmupFilter struct {
+	Status    *models.WarmupStatus
+	CreatorID *uuid.UUID
+	Page      int
+	PageSize  int
+}
+
+// ListPlans returns warm-up plans, newest first
+func (s *WarmupService) ListPlans(filter *WarmupFilter) ([]models.WarmupPlan, int64, error) {
+	query := s.db.Model(&models.WarmupPlan{})
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.CreatorID != nil {
+		query = query.Where("creator_id = ?", *filter.CreatorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var plans []models.WarmupPlan
+	err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&plans).Error
+	return plans, total, err
+}
+
+// UpdateWarmupPlanRequest is an admin's override of a plan. An empty
+// dailyLimits list drops explicit caps in favour of the ramp.
+type UpdateWarmupPlanRequest struct {
+	Status            *models.WarmupStatus `json:"status,omitempty" binding:"omitempty,oneof=active completed disabled"`
+	Days              *int                 `json:"days,omitempty" binding:"omitempty,min=1,max=365"`
+	InitialDailyLimit *int                 `json:"initialDailyLimit,omitempty" binding:"omitempty,min=1"`
+	TargetDailyLimit  *int                 `json:"targetDailyLimit,omitempty" binding:"omitempty,min=1"`
+	DailyLimits       []int                `json:"dailyLimits,omitempty" binding:"omitempty,max=365,dive,min=0"`
+	Restart           bool                 `json:"restart"` // start the ramp over from today
+	Note              string               `json:"note" binding:"required"`
+}
+
+// Override changes a plan on an admin's behalf and reschedules the recipients
+// it is holding back
+func (s *WarmupService) Override(id uuid.UUID, adminID uuid.UUID, req *UpdateWarmupPlanRequest) (*models.WarmupPlan, error) {
+	var plan models.WarmupPlan
+	if err := s.db.First(&plan, "id = ?", id).Error; err != nil {
+		return nil, errors.New("warm-up plan not found")
+	}
+
+	if req.Status != nil {
+		plan.Status = *req.Status
+	}
+	if req.Days != nil {
+		plan.Days = *req.Days
+	}
+	if req.InitialDailyLimit != nil {
+		plan.InitialDailyLimit = *req.InitialDailyLimit
+	}
+	if req.TargetDailyLimit != nil {
+		plan.TargetDailyLimit = *req.TargetDailyLimit
+	}
+	if req.DailyLimits != nil {
+		plan.DailyLimits = req.DailyLimits
+		if len(req.DailyLimits) == 0 {
+			plan.DailyLimits = nil
+		}
+	}
+	if req.Restart {
+		plan.StartDate = today()
+		if req.Status == nil {
+			plan.Status = models.WarmupStatusActive
+		}
+	}
+	if plan.InitialDailyLimit > plan.TargetDailyLimit {
+		return nil, errors.New("initial daily limit cannot exceed the target")
+	}
+
+	plan.OverriddenBy = &adminID
+	plan.OverrideNote = &req.Note
+	if err := s.db.Save(&plan).Error; err != nil {
+		return nil, errors.New("failed to update warm-up plan")
+	}
+
+	if err := s.reschedule(&plan); err != nil {
+		log.Printf("[Warmup] Failed to reschedule plan %s: %v", plan.ID, err)
+	}
+	return &plan, nil
+}
+
+// reschedule drops the plan's outstanding reservations and fits the pending
+// deliveries of the creator's running campaigns into the plan again
+func (s *WarmupService) reschedule(plan *models.WarmupPlan) error {
+	domain, err := creatorSendingDomain(plan.CreatorID)
+	if err != nil || domain != plan.Domain {
+		// Not the domain the creator sends from, so nothing is held by it
+		return err
+	}
+
+	var campaignIDs []uuid.UUID
+	s.db.Model(&models.Campaign{}).
+		Where("creator_id = ? AND status IN ?", plan.CreatorID,
+			[]models.CampaignStatus{models.CampaignStatusSending, models.CampaignStatusPaused}).
+		Order("created_at ASC").
+		Pluck("id", &campaignIDs)
+
+	day := today()
+	capped := plan.Status == models.WarmupStatusActive && WarmupLimit(plan, warmupDay(plan, day)) >= 0
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.WarmupPlan{}, "id = ?", plan.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("plan_id = ? AND day > ?", plan.ID, day).Delete(&models.WarmupUsage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.WarmupUsage{}).Where("plan_id = ? AND day = ?", plan.ID, day).
+			Update("reserved", gorm.Expr("sent")).Error; err != nil {
+			return err
+		}
+		if len(campaignIDs) == 0 {
+			return nil
+		}
+
+		if !capped {
+			// The plan no longer holds anyone back
+			return tx.Model(&models.CampaignDelivery{}).
+				Where("campaign_id IN ? AND status = ? AND not_before > ?", campaignIDs, models.DeliveryStatusPending, time.Now()).
+				Updates(map[string]interface{}{"not_before": nil, "updated_at": time.Now()}).Error
+		}
+		for _, campaignID := range campaignIDs {
+			if err := s.reserve(tx, plan, campaignID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/okemwag/newsletter/internal/database"
 	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
 	"gorm.io/gorm"
 )
 
@@ -144,22 +145,60 @@ func (s *WebhookService) TriggerEvent(creatorID uuid.UUID, eventType models.Webh
 			continue
 		}
 
-		// Send webhook asynchronously
-		go s.sendWebhook(&webhook, eventType, payload)
+		// Deliver through the job queue so failed deliveries are retried
+		delivery := &WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventType: eventType,
+			Payload:   payload,
+			Timestamp: time.Now().UTC(),
+		}
+		if _, err := queue.Enqueue(queue.TypeSendWebhook, delivery); err != nil {
+			go s.sendWebhook(&webhook, eventType, delivery.Timestamp, payload)
+		}
+	}
+}
+
+// WebhookDelivery is the queued payload for a single webhook call
+type WebhookDelivery struct {
+	WebhookID uuid.UUID               `json:"webhookId"`
+	EventType models.WebhookEventType `json:"eventType"`
+	Payload   interface{}             `json:"payload"`
+	Timestamp time.Time               `json:"timestamp"`
+}
+
+// Deliver sends a queued webhook and returns an error if the endpoint did not
+// accept it, so the caller can retry
+func (s *WebhookService) Deliver(delivery *WebhookDelivery) error {
+	var webhook models.Webhook
+	if err := s.db.Where("id = ?", delivery.WebhookID).First(&webhook).Error; err != nil {
+		return errWebhookGone
+	}
+	if !webhook.IsActive {
+		return errWebhookGone
 	}
+
+	return s.sendWebhook(&webhook, delivery.EventType, delivery.Timestamp, delivery.Payload)
 }
 
-func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.WebhookEventType, payload interface{}) {
+// errWebhookGone is returned when a queued webhook was deleted or disabled
+var errWebhookGone = errors.New("webhook no longer active")
+
+// IsWebhookGone reports whether a delivery failed because the webhook was removed
+func IsWebhookGone(err error) bool {
+	return errors.Is(err, errWebhookGone)
+}
+
+func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.WebhookEventType, timestamp time.Time, payload interface{}) error {
 	// Prepare payload
 	body := map[string]interface{}{
 		"event":     eventType,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"timestamp": timestamp.Format(time.RFC3339),
 		"data":      payload,
 	}
 
 	jsonData, err := json.Marshal(body)
 	if err != nil {
-		return
+		return err
 	}
 
 	// Create HMAC signature
@@ -171,7 +210,7 @@ func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.W
 	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		s.logWebhookError(webhook, eventType, jsonData, 0, err.Error())
-		return
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -182,7 +221,7 @@ func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.W
 	resp, err := client.Do(req)
 	if err != nil {
 		s.logWebhookError(webhook, eventType, jsonData, 0, err.Error())
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -198,10 +237,12 @@ func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.W
 		Response:   &respStr,
 	}
 
+	var sendErr error
 	if resp.StatusCode >= 400 {
 		errStr := "HTTP " + resp.Status
 		log.Error = &errStr
 		webhook.LastError = &errStr
+		sendErr = errors.New(errStr)
 	} else {
 		webhook.LastError = nil
 	}
@@ -210,6 +251,8 @@ func (s *WebhookService) sendWebhook(webhook *models.Webhook, eventType models.W
 	webhook.LastSentAt = &now
 	s.db.Save(webhook)
 	s.db.Create(log)
+
+	return sendErr
 }
 
 func (s *WebhookService) logWebhookError(webhook *models.Webhook, eventType models.WebhookEventType, payload []byte, statusCode int, errMsg string) {
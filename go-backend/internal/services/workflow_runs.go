@@ -0,0 +1,549 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+)
+
+// errRunReleased is returned when a run was cancelled or deleted while a job
+// was advancing it
+var errRunReleased = errors.New("workflow run no longer held")
+
+// EnqueueDueRuns queues runs of active workflows whose wait is over, and runs
+// that were queued or claimed so long ago that their job must have been lost.
+// Moving them to queued in the same statement claims them, so each is queued
+// once.
+func (s *WorkflowService) EnqueueDueRuns() {
+	var due []struct{ ID uuid.UUID }
+	err := s.db.Raw(`UPDATE workflow_runs SET status = ?, claimed_at = NOW(), updated_at = NOW()
+		WHERE id IN (
+			SELECT workflow_runs.id FROM workflow_runs
+			JOIN workflows ON workflows.id = workflow_runs.workflow_id
+			WHERE workflows.status = ? AND (
+				(workflow_runs.status = ? AND workflow_runs.wake_at <= NOW())
+				OR (workflow_runs.status IN ? AND workflow_runs.claimed_at < ?)
+			)
+			ORDER BY workflow_runs.wake_at ASC NULLS FIRST
+			LIMIT ?
+			FOR UPDATE OF workflow_runs SKIP LOCKED
+		)
+		RETURNING id`,
+		models.WorkflowRunQueued, models.WorkflowActive, models.WorkflowRunWaiting,
+		[]models.WorkflowRunStatus{models.WorkflowRunQueued, models.WorkflowRunRunning},
+		time.Now().Add(-workflowClaimTimeout), workflowDueBatch,
+	).Scan(&due).Error
+	if err != nil {
+		log.Printf("[Workflows] Failed to queue due runs: %v", err)
+		return
+	}
+
+	for _, run := range due {
+		s.enqueueRun(run.ID)
+	}
+}
+
+// AdvanceRun moves a queued run through its workflow until it has to wait or
+// reaches the end, saving it after every step. A step that errors leaves the
+// run queued at that step for the job's retry.
+func (s *WorkflowService) AdvanceRun(ctx context.Context, runID uuid.UUID) error {
+	err := s.advance(ctx, runID)
+	if errors.Is(err, errRunReleased) {
+		return nil
+	}
+	return err
+}
+
+func (s *WorkflowService) advance(ctx context.Context, runID uuid.UUID) error {
+	claim := s.db.Model(&models.WorkflowRun{}).
+		Where("id = ? AND status = ?", runID, models.WorkflowRunQueued).
+		Updates(map[string]interface{}{"status": models.WorkflowRunRunning, "claimed_at": time.Now()})
+	if claim.Error != nil {
+		return claim.Error
+	}
+
+	var run models.WorkflowRun
+	if err := s.db.First(&run, "id = ?", runID).Error; err != nil {
+		return ErrWorkflowRunNotFound
+	}
+	if claim.RowsAffected == 0 {
+		// Already advanced by another job, or cancelled
+		return nil
+	}
+
+	var workflow models.Workflow
+	if err := s.db.First(&workflow, "id = ?", run.WorkflowID).Error; err != nil {
+		return ErrWorkflowRunNotFound
+	}
+	if workflow.Status != models.WorkflowActive {
+		// Paused: hold the run where it is until the workflow is activated
+		now := time.Now()
+		run.Status = models.WorkflowRunWaiting
+		run.WakeAt = &now
+		return s.saveRun(&run)
+	}
+
+	var subscriber models.Subscriber
+	if err := s.db.First(&subscriber, "id = ?", run.SubscriberID).Error; err != nil {
+		return ErrWorkflowRunNotFound
+	}
+
+	// The graph has no cycles, so a run can't take more steps than it has
+	for i := 0; i <= len(workflow.Steps); i++ {
+		if run.CurrentStep == "" {
+			return s.finishRun(&run, models.WorkflowRunCompleted, "")
+		}
+		step := findStep(workflow.Steps, run.CurrentStep)
+		if step == nil {
+			return s.finishRun(&run, models.WorkflowRunCancelled, fmt.Sprintf("step %q was removed from the workflow", run.CurrentStep))
+		}
+		if subscriber.Status != models.SubscriberStatusActive {
+			return s.finishRun(&run, models.WorkflowRunExited, "")
+		}
+		if err := ctx.Err(); err != nil {
+			return s.releaseRun(&run, err)
+		}
+
+		next, result, err := s.runStep(&workflow, &run, step, &subscriber)
+		if err != nil {
+			return s.releaseRun(&run, fmt.Errorf("step %q: %w", step.ID, err))
+		}
+
+		run.History = append(run.History, models.WorkflowRunEvent{
+			StepID: step.ID,
+			Type:   string(step.Type),
+			Result: result,
+			At:     time.Now(),
+		})
+		if len(run.History) > workflowHistoryLimit {
+			run.History = run.History[len(run.History)-workflowHistoryLimit:]
+		}
+		run.CurrentStep = next
+		run.LastError = nil
+
+		if step.Type == models.StepWait {
+			run.Status = models.WorkflowRunWaiting
+			return s.saveRun(&run)
+		}
+		if err := s.saveRun(&run); err != nil {
+			return err
+		}
+	}
+	return s.finishRun(&run, models.WorkflowRunFailed, "run took more steps than its workflow has")
+}
+
+// FailRun marks a run failed once its job has run out of retries
+func (s *WorkflowService) FailRun(runID uuid.UUID, cause error) {
+	message := cause.Error()
+	s.db.Model(&models.WorkflowRun{}).
+		Where("id = ? AND status IN ?", runID, []models.WorkflowRunStatus{models.WorkflowRunQueued, models.WorkflowRunRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.WorkflowRunFailed,
+			"last_error":  message,
+			"finished_at": time.Now(),
+		})
+}
+
+func findStep(steps []models.WorkflowStep, id string) *models.WorkflowStep {
+	for i := range steps {
+		if steps[i].ID == id {
+			return &steps[i]
+		}
+	}
+	return nil
+}
+
+// saveRun writes the progress of a run this job holds. A run cancelled or
+// deleted meanwhile is left alone and errRunReleased returned.
+func (s *WorkflowService) saveRun(run *models.WorkflowRun) error {
+	result := s.db.Model(&models.WorkflowRun{}).
+		Where("id = ? AND status = ?", run.ID, models.WorkflowRunRunning).
+		Select("status", "current_step", "wake_at", "history", "last_error", "finished_at", "updated_at").
+		Updates(run)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errRunReleased
+	}
+	return nil
+}
+
+func (s *WorkflowService) finishRun(run *models.WorkflowRun, status models.WorkflowRunStatus, reason string) error {
+	now := time.Now()
+	run.Status = status
+	run.FinishedAt = &now
+	run.WakeAt = nil
+	if reason != "" {
+		run.LastError = &reason
+	}
+	return s.saveRun(run)
+}
+
+// releaseRun puts a run whose step failed back in the queued state, so the
+// job's retry can claim it again, and returns the error
+func (s *WorkflowService) releaseRun(run *models.WorkflowRun, cause error) error {
+	message := cause.Error()
+	run.Status = models.WorkflowRunQueued
+	run.LastError = &message
+	if err := s.saveRun(run); err != nil && !errors.Is(err, errRunReleased) {
+		log.Printf("[Workflows] Failed to release run %s: %v", run.ID, err)
+	}
+	return cause
+}
+
+// runStep carries out one step and returns the step to go to next, with a
+// short note for the run's history
+func (s *WorkflowService) runStep(workflow *models.Workflow, run *models.WorkflowRun, step *models.WorkflowStep, sub *models.Subscriber) (string, string, error) {
+	switch step.Type {
+	case models.StepWait:
+		delay, err := parseDelay(step.Delay)
+		if err != nil {
+			return "", "", err
+		}
+		wake := time.Now().Add(delay)
+		run.WakeAt = &wake
+		return step.Next, "until " + wake.UTC().Format(time.RFC3339), nil
+
+	case models.StepCondition:
+		ok, err := s.evaluate(step.Condition, sub, run)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			return step.Then, "true", nil
+		}
+		return step.Else, "false", nil
+
+	case models.StepSendTemplate:
+		result, err := s.sendTemplate(workflow, step, sub)
+		return step.Next, result, err
+
+	case models.StepAddTag, models.StepRemoveTag:
+		result, err := s.setTag(workflow.CreatorID, sub.ID, *step.TagID, step.Type == models.StepAddTag)
+		return step.Next, result, err
+
+	case models.StepUpdateField:
+		if err := s.updateField(sub, step.Field, step.Value); err != nil {
+			return "", "", err
+		}
+		return step.Next, "updated " + step.Field, nil
+
+	case models.StepWebhook:
+		result, err := s.callWebhook(workflow, run, step, sub)
+		return step.Next, result, err
+	}
+	return "", "", fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// --- Conditions ---
+
+func (s *WorkflowService) evaluate(cond *models.WorkflowCondition, sub *models.Subscriber, run *models.WorkflowRun) (bool, error) {
+	switch {
+	case len(cond.All) > 0:
+		for i := range cond.All {
+			ok, err := s.evaluate(&cond.All[i], sub, run)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case len(cond.Any) > 0:
+		for i := range cond.Any {
+			ok, err := s.evaluate(&cond.Any[i], sub, run)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case cond.Field == "tag":
+		var count int64
+		if err := s.db.Table("subscriber_tags").
+			Where("subscriber_id = ? AND tag_id = ?", sub.ID, cond.Value).
+			Count(&count).Error; err != nil {
+			return false, err
+		}
+		return (count > 0) == (cond.Op == "eq"), nil
+	}
+
+	value, present := conditionValue(sub, run, cond.Field)
+	return compare(cond.Op, value, present, cond.Value), nil
+}
+
+// conditionValue reads the field a condition tests. Days since the last open
+// or click count from subscribing for subscribers who never have.
+func conditionValue(sub *models.Subscriber, run *models.WorkflowRun, field string) (string, bool) {
+	str := func(v *string) (string, bool) {
+		if v == nil {
+			return "", false
+		}
+		return *v, true
+	}
+	daysSince := func(t *time.Time) (string, bool) {
+		since := sub.SubscribedAt
+		if t != nil {
+			since = *t
+		}
+		return strconv.Itoa(int(time.Since(since).Hours() / 24)), true
+	}
+
+	switch {
+	case strings.HasPrefix(field, "metadata."):
+		if sub.Metadata == nil {
+			return "", false
+		}
+		var metadata map[string]interface{}
+		if err := json.Unmarshal([]byte(*sub.Metadata), &metadata); err != nil {
+			return "", false
+		}
+		v, ok := metadata[strings.TrimPrefix(field, "metadata.")]
+		if !ok || v == nil {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	case strings.HasPrefix(field, "trigger."):
+		v, ok := run.TriggerData[strings.TrimPrefix(field, "trigger.")]
+		return v, ok
+	}
+
+	switch field {
+	case "email":
+		return sub.Email, true
+	case "firstName":
+		return str(sub.FirstName)
+	case "lastName":
+		return str(sub.LastName)
+	case "source":
+		return str(sub.Source)
+	case "timezone":
+		return str(sub.Timezone)
+	case "status":
+		return string(sub.Status), true
+	case "engagementScore":
+		return strconv.FormatFloat(sub.EngagementScore, 'f', -1, 64), true
+	case "emailsSent":
+		return strconv.Itoa(sub.EmailsSent), true
+	case "emailsOpened":
+		return strconv.Itoa(sub.EmailsOpened), true
+	case "emailsClicked":
+		return strconv.Itoa(sub.EmailsClicked), true
+	case "daysSinceOpen":
+		return daysSince(sub.LastOpenedAt)
+	case "daysSinceClick":
+		return daysSince(sub.LastClickedAt)
+	case "daysSubscribed":
+		return daysSince(nil)
+	}
+	return "", false
+}
+
+func compare(op, actual string, present bool, want string) bool {
+	switch op {
+	case "exists":
+		return present && actual != ""
+	case "not_exists":
+		return !present || actual == ""
+	case "eq":
+		return present && strings.EqualFold(actual, want)
+	case "neq":
+		return !present || !strings.EqualFold(actual, want)
+	case "contains":
+		return present && strings.Contains(strings.ToLower(actual), strings.ToLower(want))
+	}
+
+	a, err := strconv.ParseFloat(actual, 64)
+	if !present || err != nil {
+		return false
+	}
+	b, err := strconv.ParseFloat(want, 64)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	case "lte":
+		return a <= b
+	}
+	return false
+}
+
+// --- Actions ---
+
+// sendTemplate renders one of the creator's templates for the subscriber and
+// sends it as bulk mail. Suppressed subscribers and deleted templates are
+// skipped rather than failing the run.
+func (s *WorkflowService) sendTemplate(workflow *models.Workflow, step *models.WorkflowStep, sub *models.Subscriber) (string, error) {
+	tmpl, err := s.templates.GetByID(*step.TemplateID, workflow.CreatorID)
+	if err != nil {
+		return "skipped: template no longer exists", nil
+	}
+
+	firstName := ""
+	lastName := ""
+	if sub.FirstName != nil {
+		firstName = *sub.FirstName
+	}
+	if sub.LastName != nil {
+		lastName = *sub.LastName
+	}
+
+	htmlContent, subject, err := s.templates.RenderTemplate(tmpl, map[string]interface{}{
+		"FirstName":      firstName,
+		"LastName":       lastName,
+		"Email":          sub.Email,
+		"UnsubscribeURL": s.mailer.UnsubscribeURL(sub.UnsubscribeToken, ""),
+		"PreferencesURL": s.mailer.PreferencesURL(sub.UnsubscribeToken),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+
+	textContent := ""
+	if tmpl.TextContent != nil {
+		textContent = *tmpl.TextContent
+	}
+
+	_, err = s.mailer.Send(&EmailRequest{
+		To: EmailRecipient{
+			Email:            sub.Email,
+			FirstName:        firstName,
+			LastName:         lastName,
+			UnsubscribeToken: sub.UnsubscribeToken,
+		},
+		Subject:      subject,
+		HTMLContent:  htmlContent,
+		TextContent:  textContent,
+		Class:        models.MessageClassBulk,
+		CreatorID:    &workflow.CreatorID,
+		SubscriberID: &sub.ID,
+	})
+	if errors.Is(err, ErrRecipientSuppressed) {
+		return "skipped: suppressed", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := NewEngagementService().RecordSend(sub.ID); err != nil {
+		log.Printf("[Workflows] Failed to count send to subscriber %s: %v", sub.ID, err)
+	}
+	return "sent " + tmpl.Name, nil
+}
+
+// setTag adds or removes one of the subscriber's tags and, when that changed
+// anything, starts the workflows triggered by it
+func (s *WorkflowService) setTag(creatorID, subscriberID, tagID uuid.UUID, add bool) (string, error) {
+	if add {
+		result := s.db.Exec("INSERT INTO subscriber_tags (subscriber_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", subscriberID, tagID)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 0 {
+			return "already tagged", nil
+		}
+		s.TriggerTagChanges(creatorID, subscriberID, []uuid.UUID{tagID}, nil)
+		return "tag added", nil
+	}
+
+	result := s.db.Exec("DELETE FROM subscriber_tags WHERE subscriber_id = ? AND tag_id = ?", subscriberID, tagID)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "not tagged", nil
+	}
+	s.TriggerTagChanges(creatorID, subscriberID, nil, []uuid.UUID{tagID})
+	return "tag removed", nil
+}
+
+// updateField sets a subscriber field, or a key in their metadata. An empty
+// value clears it.
+func (s *WorkflowService) updateField(sub *models.Subscriber, field, value string) error {
+	var ptr *string
+	if value != "" {
+		ptr = &value
+	}
+
+	switch {
+	case strings.HasPrefix(field, "metadata."):
+		key := strings.TrimPrefix(field, "metadata.")
+		if err := s.db.Exec(`UPDATE subscribers SET metadata = CASE
+				WHEN ?::text = '' THEN COALESCE(metadata, '{}'::jsonb) - ?::text
+				ELSE jsonb_set(COALESCE(metadata, '{}'::jsonb), ARRAY[?::text], to_jsonb(?::text))
+			END, updated_at = NOW()
+			WHERE id = ?`, value, key, key, value, sub.ID).Error; err != nil {
+			return err
+		}
+		return s.db.Select("id", "metadata").First(sub, "id = ?", sub.ID).Error
+	case field == "timezone":
+		if ptr == nil {
+			sub.Timezone = nil
+			sub.TimezoneSource = nil
+			return s.db.Model(sub).Updates(map[string]interface{}{"timezone": nil, "timezone_source": nil}).Error
+		}
+		tz, err := NormalizeTimezone(value)
+		if err != nil {
+			return err
+		}
+		setTimezone(sub, tz, models.TimezoneSourceAPI)
+		return s.db.Model(sub).Updates(map[string]interface{}{"timezone": sub.Timezone, "timezone_source": sub.TimezoneSource}).Error
+	case field == "firstName":
+		sub.FirstName = ptr
+		return s.db.Model(sub).Update("first_name", ptr).Error
+	case field == "lastName":
+		sub.LastName = ptr
+		return s.db.Model(sub).Update("last_name", ptr).Error
+	case field == "source":
+		sub.Source = ptr
+		return s.db.Model(sub).Update("source", ptr).Error
+	}
+	return fmt.Errorf("cannot update field %q", field)
+}
+
+// callWebhook queues a call to one of the creator's webhooks with the
+// subscriber and what started the run. The webhook gets it whatever events
+// it is subscribed to.
+func (s *WorkflowService) callWebhook(workflow *models.Workflow, run *models.WorkflowRun, step *models.WorkflowStep, sub *models.Subscriber) (string, error) {
+	var webhook models.Webhook
+	if err := s.db.Where("id = ? AND creator_id = ? AND is_active = ?", *step.WebhookID, workflow.CreatorID, true).
+		First(&webhook).Error; err != nil {
+		return "skipped: webhook not found or inactive", nil
+	}
+
+	delivery := &WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventType: models.WebhookEventWorkflowStep,
+		Payload: map[string]interface{}{
+			"workflowId":   workflow.ID,
+			"workflowName": workflow.Name,
+			"runId":        run.ID,
+			"stepId":       step.ID,
+			"subscriber": map[string]interface{}{
+				"id":        sub.ID,
+				"email":     sub.Email,
+				"firstName": sub.FirstName,
+				"lastName":  sub.LastName,
+			},
+			"triggerData": run.TriggerData,
+		},
+		Timestamp: time.Now().UTC(),
+	}
+	if _, err := queue.Enqueue(queue.TypeSendWebhook, delivery); err != nil {
+		return "", err
+	}
+	return "webhook queued", nil
+}
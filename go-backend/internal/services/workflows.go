@@ -0,0 +1,691 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/database"
+	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkflowNotFound    = errors.New("workflow not found")
+	ErrWorkflowRunNotFound = errors.New("workflow run not found")
+	ErrInvalidWorkflow     = errors.New("invalid workflow")
+)
+
+const (
+	workflowMaxSteps     = 100
+	workflowHistoryLimit = 50
+	workflowMaxDelay     = 365 * 24 * time.Hour
+
+	// workflowClaimTimeout is how long a run may sit queued or running before
+	// it is assumed lost and queued again
+	workflowClaimTimeout = 15 * time.Minute
+
+	workflowDueBatch        = 500
+	inactivityBatchSize     = 1000
+	inactivityCheckInterval = time.Hour
+)
+
+// openRunStatuses are the statuses of runs still in progress. A subscriber
+// has at most one open run per workflow; a unique index on open runs keeps
+// concurrent triggers from starting a second one.
+var openRunStatuses = []models.WorkflowRunStatus{
+	models.WorkflowRunWaiting, models.WorkflowRunQueued, models.WorkflowRunRunning,
+}
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type WorkflowService struct {
+	db        *gorm.DB
+	mailer    *MailerRegistry
+	templates *TemplateService
+}
+
+func NewWorkflowService() *WorkflowService {
+	return &WorkflowService{
+		db:        database.GetDB(),
+		mailer:    NewMailerRegistry(),
+		templates: NewTemplateService(),
+	}
+}
+
+type WorkflowRequest struct {
+	Name         string                 `json:"name" binding:"required,max=200"`
+	Trigger      models.WorkflowTrigger `json:"trigger"`
+	Steps        []models.WorkflowStep  `json:"steps" binding:"required"`
+	AllowReentry bool                   `json:"allowReentry"`
+}
+
+// WorkflowEvent is something that happened to a subscriber which may start
+// workflows. Data is stored on the runs it starts.
+type WorkflowEvent struct {
+	Type       models.WorkflowTriggerType
+	TagID      *uuid.UUID
+	CampaignID *uuid.UUID
+	URL        string
+	Data       map[string]string
+}
+
+// WorkflowRunPayload is the queued payload that advances a workflow run
+type WorkflowRunPayload struct {
+	RunID uuid.UUID `json:"runId"`
+}
+
+// WorkflowRunFilter narrows a workflow's run list
+type WorkflowRunFilter struct {
+	Status       *models.WorkflowRunStatus
+	SubscriberID *uuid.UUID
+	Page         int
+	PageSize     int
+}
+
+// --- Workflows ---
+
+func (s *WorkflowService) Create(req *WorkflowRequest, creatorID uuid.UUID) (*models.Workflow, error) {
+	if err := s.validate(req, creatorID); err != nil {
+		return nil, err
+	}
+
+	workflow := &models.Workflow{
+		CreatorID:    creatorID,
+		Name:         req.Name,
+		Status:       models.WorkflowDraft,
+		Trigger:      req.Trigger,
+		TriggerType:  string(req.Trigger.Type),
+		Steps:        req.Steps,
+		AllowReentry: req.AllowReentry,
+	}
+	if err := s.db.Create(workflow).Error; err != nil {
+		return nil, errors.New("failed to create workflow")
+	}
+	return workflow, nil
+}
+
+func (s *WorkflowService) GetAll(creatorID uuid.UUID) ([]models.Workflow, error) {
+	var workflows []models.Workflow
+	if err := s.db.Where("creator_id = ?", creatorID).Order("created_at DESC").Find(&workflows).Error; err != nil {
+		return nil, err
+	}
+	return workflows, nil
+}
+
+func (s *WorkflowService) GetByID(id, creatorID uuid.UUID) (*models.Workflow, error) {
+	var workflow models.Workflow
+	if err := s.db.Where("id = ? AND creator_id = ?", id, creatorID).First(&workflow).Error; err != nil {
+		return nil, ErrWorkflowNotFound
+	}
+	return &workflow, nil
+}
+
+// Update replaces a workflow's definition. Runs in progress carry on from
+// their current step in the new graph; runs whose step was removed are
+// cancelled when they next move.
+func (s *WorkflowService) Update(id uuid.UUID, req *WorkflowRequest, creatorID uuid.UUID) (*models.Workflow, error) {
+	workflow, err := s.GetByID(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(req, creatorID); err != nil {
+		return nil, err
+	}
+
+	workflow.Name = req.Name
+	workflow.Trigger = req.Trigger
+	workflow.TriggerType = string(req.Trigger.Type)
+	workflow.Steps = req.Steps
+	workflow.AllowReentry = req.AllowReentry
+	workflow.CheckedAt = nil
+	if err := s.db.Save(workflow).Error; err != nil {
+		return nil, errors.New("failed to update workflow")
+	}
+	return workflow, nil
+}
+
+// Delete removes a workflow along with its runs
+func (s *WorkflowService) Delete(id, creatorID uuid.UUID) error {
+	result := s.db.Where("id = ? AND creator_id = ?", id, creatorID).Delete(&models.Workflow{})
+	if result.Error != nil {
+		return errors.New("failed to delete workflow")
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// SetStatus activates or pauses a workflow. Pausing stops new runs and holds
+// runs in progress at their current step until it is activated again.
+func (s *WorkflowService) SetStatus(id, creatorID uuid.UUID, status models.WorkflowStatus) (*models.Workflow, error) {
+	if status != models.WorkflowActive && status != models.WorkflowPaused {
+		return nil, fmt.Errorf("%w: status must be active or paused", ErrInvalidWorkflow)
+	}
+	workflow, err := s.GetByID(id, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(workflow).Update("status", status).Error; err != nil {
+		return nil, errors.New("failed to update workflow")
+	}
+	return workflow, nil
+}
+
+// ListRuns returns a workflow's runs, newest first
+func (s *WorkflowService) ListRuns(id, creatorID uuid.UUID, filter *WorkflowRunFilter) ([]models.WorkflowRun, int64, error) {
+	if _, err := s.GetByID(id, creatorID); err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&models.WorkflowRun{}).Where("workflow_id = ?", id)
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.SubscriberID != nil {
+		query = query.Where("subscriber_id = ?", *filter.SubscriberID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []models.WorkflowRun
+	err := query.Order("started_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&runs).Error
+	return runs, total, err
+}
+
+// GetRunCounts returns how many of a workflow's runs are in each status
+func (s *WorkflowService) GetRunCounts(id, creatorID uuid.UUID) (map[models.WorkflowRunStatus]int64, error) {
+	if _, err := s.GetByID(id, creatorID); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Status models.WorkflowRunStatus
+		Count  int64
+	}
+	if err := s.db.Model(&models.WorkflowRun{}).
+		Select("status, COUNT(*) as count").
+		Where("workflow_id = ?", id).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[models.WorkflowRunStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// CancelRun stops a subscriber's run where it is
+func (s *WorkflowService) CancelRun(id, runID, creatorID uuid.UUID) error {
+	if _, err := s.GetByID(id, creatorID); err != nil {
+		return err
+	}
+	now := time.Now()
+	result := s.db.Model(&models.WorkflowRun{}).
+		Where("id = ? AND workflow_id = ? AND status IN ?", runID, id, openRunStatuses).
+		Updates(map[string]interface{}{
+			"status":      models.WorkflowRunCancelled,
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowRunNotFound
+	}
+	return nil
+}
+
+// --- Validation ---
+
+// validate checks a workflow definition: a known trigger, step IDs that are
+// unique and referenced correctly, the fields each step type needs, and no
+// cycles, so every run reaches an end
+func (s *WorkflowService) validate(req *WorkflowRequest, creatorID uuid.UUID) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidWorkflow, fmt.Sprintf(format, args...))
+	}
+
+	trigger := req.Trigger
+	switch trigger.Type {
+	case models.TriggerSubscriberCreated, models.TriggerPaymentSuccess, models.TriggerPaymentFailed:
+	case models.TriggerTagAdded, models.TriggerTagRemoved:
+		if trigger.TagID != nil && !s.owns("tags", *trigger.TagID, creatorID) {
+			return invalid("trigger tag not found")
+		}
+	case models.TriggerLinkClicked:
+		if trigger.CampaignID != nil && !s.owns("campaigns", *trigger.CampaignID, creatorID) {
+			return invalid("trigger campaign not found")
+		}
+	case models.TriggerInactivity:
+		if trigger.InactiveDays < 1 {
+			return invalid("inactivity triggers need inactiveDays of at least 1")
+		}
+	default:
+		return invalid("unknown trigger type %q", trigger.Type)
+	}
+
+	if len(req.Steps) == 0 {
+		return invalid("a workflow needs at least one step")
+	}
+	if len(req.Steps) > workflowMaxSteps {
+		return invalid("a workflow can have at most %d steps", workflowMaxSteps)
+	}
+
+	steps := make(map[string]*models.WorkflowStep, len(req.Steps))
+	for i := range req.Steps {
+		step := &req.Steps[i]
+		if step.ID == "" || len(step.ID) > 100 {
+			return invalid("step %d needs an id of up to 100 characters", i+1)
+		}
+		if steps[step.ID] != nil {
+			return invalid("step id %q is used twice", step.ID)
+		}
+		steps[step.ID] = step
+	}
+
+	for i := range req.Steps {
+		step := &req.Steps[i]
+		links := []string{step.Next}
+
+		switch step.Type {
+		case models.StepWait:
+			if _, err := parseDelay(step.Delay); err != nil {
+				return invalid("step %q: %v", step.ID, err)
+			}
+			if step.Next == "" {
+				return invalid("step %q: a wait needs a next step", step.ID)
+			}
+		case models.StepCondition:
+			if step.Condition == nil {
+				return invalid("step %q: condition is required", step.ID)
+			}
+			if err := validateCondition(step.Condition); err != nil {
+				return invalid("step %q: %v", step.ID, err)
+			}
+			if step.Next != "" {
+				return invalid("step %q: conditions branch with then and else, not next", step.ID)
+			}
+			links = []string{step.Then, step.Else}
+		case models.StepSendTemplate:
+			if step.TemplateID == nil || !s.owns("email_templates", *step.TemplateID, creatorID) {
+				return invalid("step %q: template not found", step.ID)
+			}
+		case models.StepAddTag, models.StepRemoveTag:
+			if step.TagID == nil || !s.owns("tags", *step.TagID, creatorID) {
+				return invalid("step %q: tag not found", step.ID)
+			}
+		case models.StepUpdateField:
+			if err := validateField(step.Field, step.Value); err != nil {
+				return invalid("step %q: %v", step.ID, err)
+			}
+		case models.StepWebhook:
+			if step.WebhookID == nil || !s.owns("webhooks", *step.WebhookID, creatorID) {
+				return invalid("step %q: webhook not found", step.ID)
+			}
+		default:
+			return invalid("step %q: unknown step type %q", step.ID, step.Type)
+		}
+
+		for _, link := range links {
+			if link != "" && steps[link] == nil {
+				return invalid("step %q links to unknown step %q", step.ID, link)
+			}
+		}
+	}
+
+	// Depth-first search for a step that leads back to itself
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(steps))
+	var visit func(id string) error
+	visit = func(id string) error {
+		if id == "" || state[id] == done {
+			return nil
+		}
+		if state[id] == visiting {
+			return invalid("step %q is part of a loop", id)
+		}
+		state[id] = visiting
+		step := steps[id]
+		for _, next := range []string{step.Next, step.Then, step.Else} {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+		return nil
+	}
+	for i := range req.Steps {
+		if err := visit(req.Steps[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// owns reports whether a row of the given table belongs to the creator
+func (s *WorkflowService) owns(table string, id, creatorID uuid.UUID) bool {
+	var count int64
+	s.db.Table(table).Where("id = ? AND creator_id = ?", id, creatorID).Count(&count)
+	return count > 0
+}
+
+// parseDelay reads a wait step's delay: whole days ("3d") or a Go duration
+// ("12h", "30m", "1h30m")
+func parseDelay(delay string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(delay, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid delay %q", delay)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(delay); err != nil {
+			return 0, fmt.Errorf("invalid delay %q, use e.g. 3d, 12h or 30m", delay)
+		}
+	}
+	if d <= 0 || d > workflowMaxDelay {
+		return 0, fmt.Errorf("delay must be between 1m and 365d")
+	}
+	return d, nil
+}
+
+// conditionFields are the subscriber fields conditions can test, besides
+// tag, metadata.<key> and trigger.<key>
+var conditionFields = map[string]bool{
+	"email": true, "firstName": true, "lastName": true, "source": true, "timezone": true, "status": true,
+	"engagementScore": true, "emailsSent": true, "emailsOpened": true, "emailsClicked": true,
+	"daysSinceOpen": true, "daysSinceClick": true, "daysSubscribed": true,
+}
+
+func validateCondition(cond *models.WorkflowCondition) error {
+	parts := 0
+	if cond.Field != "" {
+		parts++
+	}
+	if len(cond.All) > 0 {
+		parts++
+	}
+	if len(cond.Any) > 0 {
+		parts++
+	}
+	if parts != 1 {
+		return errors.New("each condition needs exactly one of field, all or any")
+	}
+
+	for _, group := range [][]models.WorkflowCondition{cond.All, cond.Any} {
+		for i := range group {
+			if err := validateCondition(&group[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if cond.Field == "" {
+		return nil
+	}
+
+	switch {
+	case cond.Field == "tag":
+		if cond.Op != "eq" && cond.Op != "neq" {
+			return errors.New("tag conditions use eq (has the tag) or neq (doesn't)")
+		}
+		if _, err := uuid.Parse(cond.Value); err != nil {
+			return errors.New("tag conditions need a tag id as value")
+		}
+		return nil
+	case strings.HasPrefix(cond.Field, "metadata."):
+		if !metadataKeyPattern.MatchString(strings.TrimPrefix(cond.Field, "metadata.")) {
+			return fmt.Errorf("invalid metadata key in %q", cond.Field)
+		}
+	case strings.HasPrefix(cond.Field, "trigger."):
+	case !conditionFields[cond.Field]:
+		return fmt.Errorf("unknown condition field %q", cond.Field)
+	}
+
+	switch cond.Op {
+	case "eq", "neq", "contains", "exists", "not_exists":
+	case "gt", "gte", "lt", "lte":
+		if _, err := strconv.ParseFloat(cond.Value, 64); err != nil {
+			return fmt.Errorf("%s needs a number to compare with", cond.Op)
+		}
+	default:
+		return fmt.Errorf("unknown condition op %q", cond.Op)
+	}
+	return nil
+}
+
+// validateField checks an update_field step's target and value
+func validateField(field, value string) error {
+	switch {
+	case field == "firstName" || field == "lastName":
+		if len(value) > 100 {
+			return fmt.Errorf("%s can be at most 100 characters", field)
+		}
+	case field == "source":
+		if len(value) > 100 {
+			return errors.New("source can be at most 100 characters")
+		}
+	case field == "timezone":
+		if value != "" {
+			if _, err := NormalizeTimezone(value); err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(field, "metadata."):
+		if !metadataKeyPattern.MatchString(strings.TrimPrefix(field, "metadata.")) {
+			return fmt.Errorf("invalid metadata key in %q", field)
+		}
+	default:
+		return fmt.Errorf("field must be firstName, lastName, source, timezone or metadata.<key>, not %q", field)
+	}
+	return nil
+}
+
+// --- Triggers ---
+
+// TriggerWorkflows starts the creator's active workflows whose trigger
+// matches the event for a subscriber. A subscriber already on a workflow is
+// not started again, nor is one who finished it unless it allows reentry.
+func (s *WorkflowService) TriggerWorkflows(creatorID, subscriberID uuid.UUID, event *WorkflowEvent) {
+	var workflows []models.Workflow
+	if err := s.db.Where("creator_id = ? AND status = ? AND trigger_type = ?", creatorID, models.WorkflowActive, event.Type).
+		Find(&workflows).Error; err != nil {
+		log.Printf("[Workflows] Failed to look up %s workflows for creator %s: %v", event.Type, creatorID, err)
+		return
+	}
+
+	for i := range workflows {
+		if !triggerMatches(&workflows[i].Trigger, event) {
+			continue
+		}
+		if err := s.startRun(&workflows[i], subscriberID, event.Data); err != nil {
+			log.Printf("[Workflows] Failed to start workflow %s for subscriber %s: %v", workflows[i].ID, subscriberID, err)
+		}
+	}
+}
+
+// TriggerTagChanges starts the workflows triggered by tags being added to or
+// removed from a subscriber
+func (s *WorkflowService) TriggerTagChanges(creatorID, subscriberID uuid.UUID, added, removed []uuid.UUID) {
+	for _, tagID := range added {
+		s.TriggerWorkflows(creatorID, subscriberID, &WorkflowEvent{
+			Type:  models.TriggerTagAdded,
+			TagID: &tagID,
+			Data:  map[string]string{"tagId": tagID.String()},
+		})
+	}
+	for _, tagID := range removed {
+		s.TriggerWorkflows(creatorID, subscriberID, &WorkflowEvent{
+			Type:  models.TriggerTagRemoved,
+			TagID: &tagID,
+			Data:  map[string]string{"tagId": tagID.String()},
+		})
+	}
+}
+
+func triggerMatches(trigger *models.WorkflowTrigger, event *WorkflowEvent) bool {
+	switch trigger.Type {
+	case models.TriggerTagAdded, models.TriggerTagRemoved:
+		return trigger.TagID == nil || (event.TagID != nil && *trigger.TagID == *event.TagID)
+	case models.TriggerLinkClicked:
+		if trigger.CampaignID != nil && (event.CampaignID == nil || *trigger.CampaignID != *event.CampaignID) {
+			return false
+		}
+		return trigger.URLContains == "" || strings.Contains(event.URL, trigger.URLContains)
+	}
+	return true
+}
+
+// startRun puts a subscriber on a workflow's first step and queues the run
+func (s *WorkflowService) startRun(workflow *models.Workflow, subscriberID uuid.UUID, data map[string]string) error {
+	dataJSON, _ := json.Marshal(data)
+
+	var started []struct{ ID uuid.UUID }
+	err := s.db.Raw(`INSERT INTO workflow_runs (workflow_id, subscriber_id, status, current_step, claimed_at, trigger_data, history, started_at, updated_at)
+		SELECT ?, ?, ?, ?, NOW(), ?::jsonb, '[]'::jsonb, NOW(), NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM workflow_runs
+			WHERE workflow_id = ? AND subscriber_id = ? AND (? OR status IN ?)
+		)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		workflow.ID, subscriberID, models.WorkflowRunQueued, workflow.Steps[0].ID, string(dataJSON),
+		workflow.ID, subscriberID, !workflow.AllowReentry, openRunStatuses,
+	).Scan(&started).Error
+	if err != nil {
+		return err
+	}
+
+	for _, run := range started {
+		s.enqueueRun(run.ID)
+	}
+	return nil
+}
+
+// enqueueRun queues a job to advance a run. If that fails the run stays
+// queued and EnqueueDueRuns retries once its claim times out.
+func (s *WorkflowService) enqueueRun(runID uuid.UUID) {
+	if _, err := queue.Enqueue(queue.TypeRunWorkflow, WorkflowRunPayload{RunID: runID}); err != nil {
+		log.Printf("[Workflows] Failed to enqueue run %s: %v", runID, err)
+	}
+}
+
+// TriggerPayment starts payment workflows for the subscriber who paid, found
+// by the payment's email on the plan creator's list
+func (s *WorkflowService) TriggerPayment(payment *models.Payment) {
+	if payment.PlanID == nil {
+		return
+	}
+	var event *WorkflowEvent
+	switch payment.Status {
+	case models.PaymentStatusSuccess:
+		event = &WorkflowEvent{Type: models.TriggerPaymentSuccess}
+	case models.PaymentStatusFailed:
+		event = &WorkflowEvent{Type: models.TriggerPaymentFailed}
+	default:
+		return
+	}
+
+	var plan models.SubscriptionPlan
+	if err := s.db.Select("id", "creator_id").First(&plan, "id = ?", *payment.PlanID).Error; err != nil {
+		return
+	}
+
+	email := ""
+	if payment.Email != nil {
+		email = *payment.Email
+	} else {
+		var user models.User
+		if err := s.db.Select("id", "email").First(&user, "id = ?", payment.UserID).Error; err != nil {
+			return
+		}
+		email = user.Email
+	}
+
+	var subscriber models.Subscriber
+	if err := s.db.Select("id").
+		Where("creator_id = ? AND email = ?", plan.CreatorID, strings.ToLower(email)).
+		First(&subscriber).Error; err != nil {
+		return
+	}
+
+	event.Data = map[string]string{
+		"paymentId": payment.ID.String(),
+		"planId":    plan.ID.String(),
+		"amount":    strconv.FormatInt(payment.Amount, 10),
+		"currency":  payment.Currency,
+	}
+	s.TriggerWorkflows(plan.CreatorID, subscriber.ID, event)
+}
+
+// TriggerInactivity starts inactivity workflows for subscribers who haven't
+// opened or clicked for the workflow's InactiveDays. Each workflow is scanned
+// about once an hour. A subscriber re-enters a workflow that allows it only
+// after engaging again and going quiet once more.
+func (s *WorkflowService) TriggerInactivity() {
+	var workflows []models.Workflow
+	s.db.Where("status = ? AND trigger_type = ?", models.WorkflowActive, models.TriggerInactivity).
+		Where("checked_at IS NULL OR checked_at < ?", time.Now().Add(-inactivityCheckInterval)).
+		Find(&workflows)
+
+	for i := range workflows {
+		workflow := &workflows[i]
+		cutoff := time.Now().AddDate(0, 0, -workflow.Trigger.InactiveDays)
+
+		var started []struct{ ID uuid.UUID }
+		err := s.db.Raw(`INSERT INTO workflow_runs (workflow_id, subscriber_id, status, current_step, claimed_at, trigger_data, history, started_at, updated_at)
+			SELECT ?, subscribers.id, ?, ?, NOW(), '{}'::jsonb, '[]'::jsonb, NOW(), NOW()
+			FROM subscribers
+			WHERE subscribers.creator_id = ? AND subscribers.status = ?
+			AND GREATEST(subscribers.subscribed_at, subscribers.last_opened_at, subscribers.last_clicked_at) < ?
+			AND NOT EXISTS (
+				SELECT 1 FROM workflow_runs
+				WHERE workflow_runs.workflow_id = ? AND workflow_runs.subscriber_id = subscribers.id
+				AND (? OR workflow_runs.status IN ?
+					OR workflow_runs.started_at >= GREATEST(subscribers.subscribed_at, subscribers.last_opened_at, subscribers.last_clicked_at))
+			)
+			LIMIT ?
+			ON CONFLICT DO NOTHING
+			RETURNING id`,
+			workflow.ID, models.WorkflowRunQueued, workflow.Steps[0].ID,
+			workflow.CreatorID, models.SubscriberStatusActive, cutoff,
+			workflow.ID, !workflow.AllowReentry, openRunStatuses,
+			inactivityBatchSize,
+		).Scan(&started).Error
+		if err != nil {
+			log.Printf("[Workflows] Failed to scan workflow %s for inactive subscribers: %v", workflow.ID, err)
+			continue
+		}
+
+		for _, run := range started {
+			s.enqueueRun(run.ID)
+		}
+		// A full batch means more are waiting; scan again on the next tick
+		if len(started) < inactivityBatchSize {
+			s.db.Model(workflow).UpdateColumn("checked_at", time.Now())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/okemwag/newsletter/internal/queue"
+	"github.com/okemwag/newsletter/internal/services"
+)
+
+// BulkImportPayload imports subscribers for a creator in the background
+type BulkImportPayload struct {
+	CreatorID   uuid.UUID                          `json:"creatorId"`
+	Source      string                             `json:"source"`
+	Subscribers []services.CreateSubscriberRequest `json:"subscribers"`
+}
+
+// AggregateStatsPayload recomputes a campaign's stats
+type AggregateStatsPayload struct {
+	CampaignID uuid.UUID `json:"campaignId"`
+}
+
+// registerJobHandlers wires each job type to its consumer
+func registerJobHandlers() {
+	queue.Register(queue.TypeSendEmail, handleSendEmail, queue.Options{Concurrency: 4, Timeout: time.Minute})
+	queue.Register(queue.TypeBulkImport, handleBulkImport, queue.Options{Concurrency: 1, MaxAttempts: 3, Timeout: 30 * time.Minute})
+	queue.Register(queue.TypeAggregateStats, handleAggregateStats, queue.Options{Concurrency: 2, MaxAttempts: 3})
+	queue.Register(queue.TypeSendWebhook, handleSendWebhook, queue.Options{Concurrency: 4, MaxAttempts: 8, Timeout: time.Minute})
+	queue.Register(queue.TypeSendCampaign, handleSendCampaign, queue.Options{Concurrency: 2, MaxAttempts: 10, Timeout: 10 * time.Minute})
+	queue.Register(queue.TypePruneSubscribers, handlePruneSubscribers, queue.Options{Concurrency: 1, MaxAttempts: 5, Timeout: 30 * time.Minute})
+	queue.Register(queue.TypeRunWorkflow, handleRunWorkflow, queue.Options{Concurrency: 4, MaxAttempts: 5, Timeout: 5 * time.Minute})
+	queue.Register(queue.TypePollSeedMailbox, handlePollSeedMailbox, queue.Options{Concurrency: 2, MaxAttempts: 1, Timeout: 10 * time.Minute})
+	queue.Register(queue.TypePollReturnPath, handlePollReturnPath, queue.Options{Concurrency: 1, MaxAttempts: 1, Timeout: 10 * time.Minute})
+}
+
+// handleSendEmail sends a single message (payload is a services.EmailRequest)
+func handleSendEmail(ctx context.Context, job *queue.Job) error {
+	var req services.EmailRequest
+	if err := job.Decode(&req); err != nil {
+		return queue.Permanent(err)
+	}
+
+	_, err := services.NewMailerRegistry().Send(&req)
+	if err == nil || errors.Is(err, services.ErrRecipientSuppressed) {
+		return nil
+	}
+
+	// Rejections (bad address, invalid request) will not succeed on retry
+	var perr *services.ProviderError
+	if errors.As(err, &perr) && !perr.Retryable() {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+func handleBulkImport(ctx context.Context, job *queue.Job) error {
+	var payload BulkImportPayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	created, skipped, err := services.NewSubscriberService().BulkCreate(payload.Subscribers, payload.CreatorID, payload.Source)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Bulk import for creator %s: %d created, %d skipped", payload.CreatorID, created, skipped)
+	return nil
+}
+
+func handleAggregateStats(ctx context.Context, job *queue.Job) error {
+	var payload AggregateStatsPayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	_, err := services.NewCampaignService().AggregateStats(payload.CampaignID)
+	return err
+}
+
+func handleSendWebhook(ctx context.Context, job *queue.Job) error {
+	var delivery services.WebhookDelivery
+	if err := job.Decode(&delivery); err != nil {
+		return queue.Permanent(err)
+	}
+
+	err := services.NewWebhookService().Deliver(&delivery)
+	if services.IsWebhookGone(err) {
+		return queue.Permanent(fmt.Errorf("webhook %s: %w", delivery.WebhookID, err))
+	}
+	return err
+}
+
+// handleSendCampaign works through a campaign's pending deliveries and hands
+// the remainder to a fresh job when its time slice runs out
+func handleSendCampaign(ctx context.Context, job *queue.Job) error {
+	var payload services.SendCampaignPayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	done, err := services.NewCampaignService().ProcessDeliveries(ctx, payload.CampaignID)
+	if err != nil {
+		return err
+	}
+	if !done {
+		_, err = queue.Enqueue(queue.TypeSendCampaign, payload)
+	}
+	return err
+}
+
+// handlePruneSubscribers runs a confirmed prune job. Batches already committed
+// stay done, so retries resume; the job is marked failed when retries run out.
+func handlePruneSubscribers(ctx context.Context, job *queue.Job) error {
+	var payload services.PrunePayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	engagement := services.NewEngagementService()
+	err := engagement.RunPruneJob(ctx, payload.JobID)
+	if errors.Is(err, services.ErrPruneJobNotFound) {
+		return queue.Permanent(err)
+	}
+	if err != nil && job.Attempts >= job.MaxAttempts {
+		engagement.FailPruneJob(payload.JobID, err)
+	}
+	return err
+}
+
+// handleRunWorkflow advances a workflow run to its next wait or its end. The
+// run stays at the failing step between retries and is marked failed when
+// retries run out.
+func handleRunWorkflow(ctx context.Context, job *queue.Job) error {
+	var payload services.WorkflowRunPayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	workflows := services.NewWorkflowService()
+	err := workflows.AdvanceRun(ctx, payload.RunID)
+	if errors.Is(err, services.ErrWorkflowRunNotFound) {
+		return queue.Permanent(err)
+	}
+	if err != nil && job.Attempts >= job.MaxAttempts {
+		workflows.FailRun(payload.RunID, err)
+	}
+	return err
+}
+
+// handlePollSeedMailbox sends a seed mailbox its queued seeds and looks for
+// the sent ones over IMAP. Failures are recorded on the mailbox and the
+// worker queues it again on a later tick.
+func handlePollSeedMailbox(ctx context.Context, job *queue.Job) error {
+	var payload services.SeedMailboxPayload
+	if err := job.Decode(&payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	services.NewSeedService().ProcessMailbox(ctx, payload.MailboxID)
+	return nil
+}
+
+// handlePollReturnPath reads bounces and complaints from the return-path
+// mailbox over IMAP
+func handlePollReturnPath(ctx context.Context, job *queue.Job) error {
+	services.NewInboundBounceService().PollMailbox(ctx)
+	return nil
+}
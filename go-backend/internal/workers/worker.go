@@ -2,27 +2,39 @@ package workers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/okemwag/newsletter/internal/database"
 	"github.com/okemwag/newsletter/internal/models"
+	"github.com/okemwag/newsletter/internal/queue"
 	"github.com/okemwag/newsletter/internal/services"
 )
 
 type Worker struct {
-	campaignService *services.CampaignService
-	emailService    *services.EmailService
-	ticker          *time.Ticker
-	quit            chan bool
+	campaignService       *services.CampaignService
+	deliverabilityService *services.DeliverabilityService
+	senderDomainService   *services.SenderDomainService
+	seedService           *services.SeedService
+	inboundBounceService  *services.InboundBounceService
+	workflowService       *services.WorkflowService
+	ticker                *time.Ticker
+	quit                  chan bool
 }
 
 func NewWorker() *Worker {
+	registerJobHandlers()
+
 	return &Worker{
-		campaignService: services.NewCampaignService(),
-		emailService:    services.NewEmailService(),
-		quit:            make(chan bool),
+		campaignService:       services.NewCampaignService(),
+		deliverabilityService: services.NewDeliverabilityService(),
+		senderDomainService:   services.NewSenderDomainService(),
+		seedService:           services.NewSeedService(),
+		inboundBounceService:  services.NewInboundBounceService(),
+		workflowService:       services.NewWorkflowService(),
+		quit:                  make(chan bool),
 	}
 }
 
@@ -30,6 +42,8 @@ func NewWorker() *Worker {
 func (w *Worker) Start() {
 	log.Println("Starting background worker...")
 
+	queue.Default().Start()
+
 	// Run every minute
 	w.ticker = time.NewTicker(1 * time.Minute)
 
@@ -53,15 +67,28 @@ func (w *Worker) Start() {
 func (w *Worker) Stop() {
 	log.Println("Stopping background worker...")
 	w.quit <- true
+	queue.Default().Stop()
 }
 
 func (w *Worker) runTasks() {
 	w.processScheduledCampaigns()
+	w.campaignService.ResumeStalledSends()
 	w.checkExpiredSubscriptions()
+	w.enqueueStatsAggregation()
+	w.deliverabilityService.RecalculateStale()
+	w.senderDomainService.RecheckDue()
+	w.seedService.EnqueueDue()
+	w.inboundBounceService.EnqueuePoll()
+	w.processWorkflows()
 }
 
-// processScheduledCampaigns sends campaigns that are due
+// processScheduledCampaigns sends campaigns that are due, sends A/B test
+// winners, and picks up rolling local-time sends whose next timezone has come
+// due
 func (w *Worker) processScheduledCampaigns() {
+	w.campaignService.DecideDueTests()
+	w.campaignService.StartDueWaves()
+
 	db := database.GetDB()
 
 	var campaigns []models.Campaign
@@ -79,15 +106,47 @@ func (w *Worker) processScheduledCampaigns() {
 
 		// Send the campaign
 		_, err := w.campaignService.SendNow(campaign.ID, creatorID)
+		if errors.Is(err, services.ErrSendingOnHold) {
+			// Stays scheduled and goes out on a later tick once the hold is
+			// released
+			continue
+		}
 		if err != nil {
 			log.Printf("Failed to send campaign %s: %v", campaign.ID, err)
-			// Mark as failed
-			campaign.Status = models.CampaignStatusFailed
+			// Mark as failed, unless another worker has started it meanwhile;
+			// a rolling send already under way keeps its status
 			reason := err.Error()
 			statsJSON, _ := json.Marshal(map[string]string{"error": reason})
-			statsStr := string(statsJSON)
-			campaign.Stats = &statsStr
-			db.Save(&campaign)
+			db.Model(&models.Campaign{}).
+				Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusScheduled).
+				Updates(map[string]interface{}{
+					"status": models.CampaignStatusFailed,
+					"stats":  string(statsJSON),
+				})
+		}
+	}
+}
+
+// processWorkflows starts inactivity workflows for subscribers who have gone
+// quiet and queues workflow runs whose wait is over
+func (w *Worker) processWorkflows() {
+	w.workflowService.TriggerInactivity()
+	w.workflowService.EnqueueDueRuns()
+}
+
+// enqueueStatsAggregation refreshes stats for recently sent campaigns while
+// their engagement is still coming in
+func (w *Worker) enqueueStatsAggregation() {
+	db := database.GetDB()
+
+	var campaignIDs []uuid.UUID
+	db.Model(&models.Campaign{}).
+		Where("status = ? AND sent_at >= ?", models.CampaignStatusSent, time.Now().Add(-72*time.Hour)).
+		Pluck("id", &campaignIDs)
+
+	for _, id := range campaignIDs {
+		if err := EnqueueJob(JobTypeAggregateStats, AggregateStatsPayload{CampaignID: id}); err != nil {
+			log.Printf("Failed to enqueue stats aggregation for campaign %s: %v", id, err)
 		}
 	}
 }
@@ -106,41 +165,16 @@ func (w *Worker) checkExpiredSubscriptions() {
 type JobType string
 
 const (
-	JobTypeSendEmail     JobType = "send_email"
-	JobTypeBulkImport    JobType = "bulk_import"
-	JobTypeAggregateStats JobType = "aggregate_stats"
-	JobTypeSendWebhook   JobType = "send_webhook"
+	JobTypeSendEmail      JobType = queue.TypeSendEmail
+	JobTypeBulkImport     JobType = queue.TypeBulkImport
+	JobTypeAggregateStats JobType = queue.TypeAggregateStats
+	JobTypeSendWebhook    JobType = queue.TypeSendWebhook
+	JobTypeSendCampaign   JobType = queue.TypeSendCampaign
 )
 
-type Job struct {
-	ID        uuid.UUID   `json:"id"`
-	Type      JobType     `json:"type"`
-	Payload   interface{} `json:"payload"`
-	Status    string      `json:"status"` // pending, processing, completed, failed
-	Attempts  int         `json:"attempts"`
-	CreatedAt time.Time   `json:"createdAt"`
-}
-
-// EnqueueJob adds a job to the Redis queue
+// EnqueueJob adds a job to the durable job queue. Jobs run in-process when
+// Redis is not available.
 func EnqueueJob(jobType JobType, payload interface{}) error {
-	if !database.IsRedisConnected() {
-		// Process synchronously if Redis not available
-		return nil
-	}
-
-	job := Job{
-		ID:        uuid.New(),
-		Type:      jobType,
-		Payload:   payload,
-		Status:    "pending",
-		Attempts:  0,
-		CreatedAt: time.Now(),
-	}
-
-	jobJSON, err := json.Marshal(job)
-	if err != nil {
-		return err
-	}
-
-	return database.CacheSet("job:"+job.ID.String(), string(jobJSON), 24*time.Hour)
+	_, err := queue.Enqueue(string(jobType), payload)
+	return err
 }
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// secretPrefix marks a value sealed by EncryptSecret
+const secretPrefix = "enc:v1:"
+
+var (
+	ErrEncryptionKeyMissing = errors.New("ENCRYPTION_KEY is not set")
+	ErrSecretCorrupt        = errors.New("encrypted secret is corrupt or was sealed with another key")
+)
+
+// secretCipher is AES-256-GCM keyed from ENCRYPTION_KEY
+func secretCipher() (cipher.AEAD, error) {
+	key := os.Getenv("ENCRYPTION_KEY")
+	if key == "" {
+		return nil, ErrEncryptionKeyMissing
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret seals a credential for storage
+func EncryptSecret(plaintext string) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// IsEncryptedSecret reports whether a stored value was sealed by EncryptSecret
+func IsEncryptedSecret(stored string) bool {
+	return strings.HasPrefix(stored, secretPrefix)
+}
+
+// DecryptSecret opens a value sealed by EncryptSecret. Values stored before
+// encryption was introduced have no prefix and are returned as they are.
+func DecryptSecret(stored string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrSecretCorrupt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrSecretCorrupt
+	}
+	return string(plaintext), nil
+}